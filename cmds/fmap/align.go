@@ -0,0 +1,53 @@
+package main
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"io/ioutil"
+	"log"
+
+	"github.com/insomniacslk/fmap/pkg/fmap"
+)
+
+// align rounds the sections of a flashmap to the erase block size, logs the
+// changes and the sections left misaligned, and prints the result unless in
+// dry-run mode.
+func align(fs *flag.FlagSet, args []string) error {
+	block := fs.String("block", "4K", "erase block size of the flash, e.g. 4K or 64K")
+	dryRun := fs.Bool("dry-run", false, "only print the changes, without writing the resulting flashmap")
+	output := fs.String("o", "", "file to write the resulting flashmap to. If empty, write to standard output")
+	_ = fs.Parse(args)
+	if fs.NArg() != 1 {
+		fs.Usage()
+		return errors.New("expected exactly one flashmap file")
+	}
+	blockSize, err := parseSize(*block)
+	if err != nil {
+		return err
+	}
+
+	flash, err := parseLayout(fs.Arg(0))
+	if err != nil {
+		return err
+	}
+	changes, err := flash.Align(blockSize, *dryRun)
+	if err != nil {
+		return err
+	}
+	for _, c := range changes {
+		log.Print(c)
+	}
+	log.Printf("%d sections changed", len(changes))
+	if *dryRun {
+		return nil
+	}
+	for _, v := range flash.ValidateWith(fmap.ValidateOptions{Align: blockSize}) {
+		log.Printf("%s: %v", v.Severity, v)
+	}
+	if *output == "" {
+		fmt.Print(formatLayout(flash))
+		return nil
+	}
+	return ioutil.WriteFile(*output, []byte(formatLayout(flash)), 0644)
+}
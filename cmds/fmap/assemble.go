@@ -0,0 +1,47 @@
+package main
+
+import (
+	"errors"
+	"flag"
+	"io/ioutil"
+	"log"
+	"os"
+	"path/filepath"
+)
+
+// assemble builds a flash image from the payload files of its sections, named
+// after the sections as written by extract.
+func assemble(fs *flag.FlagSet, args []string) error {
+	dir := fs.String("dir", ".", "directory to read the section files from")
+	output := fs.String("o", "", "file to write the image to (required)")
+	_ = fs.Parse(args)
+	if fs.NArg() != 1 || *output == "" {
+		fs.Usage()
+		return errors.New("expected an output file and exactly one flashmap file")
+	}
+
+	flash, err := parseLayout(fs.Arg(0))
+	if err != nil {
+		return err
+	}
+	payloads := make(map[string][]byte)
+	for _, sec := range allSections(flash) {
+		if _, ok := payloads[sec.Name]; ok {
+			continue
+		}
+		infile := filepath.Join(*dir, sec.Name+".bin")
+		data, err := ioutil.ReadFile(infile)
+		if os.IsNotExist(err) {
+			continue
+		} else if err != nil {
+			return err
+		}
+		payloads[sec.Name] = data
+		log.Printf("Read %s (0x%x bytes) for section %s", infile, len(data), sec.Path())
+	}
+	image, err := flash.Assemble(payloads)
+	if err != nil {
+		return err
+	}
+	return ioutil.WriteFile(*output, image, 0644)
+}
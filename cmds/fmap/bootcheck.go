@@ -0,0 +1,52 @@
+package main
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"log"
+	"strings"
+
+	"github.com/insomniacslk/fmap/pkg/fmap"
+)
+
+// bootcheck looks up regions in the binary FMAP of a flash image the way
+// firmware does at boot time, and compares them with a text layout.
+func bootcheck(fs *flag.FlagSet, args []string) error {
+	var names sectionsFlag
+	fs.Var(&names, "name", "name of a region to look up. Can be repeated. If omitted, look up "+strings.Join(fmap.BootLookupNames, ", "))
+	layout := fs.String("layout", "", "flashmap file describing the image (required)")
+	_ = fs.Parse(args)
+	if fs.NArg() != 1 || *layout == "" {
+		fs.Usage()
+		return errors.New("expected a layout and exactly one image file")
+	}
+	if len(names) == 0 {
+		names = fmap.BootLookupNames
+	}
+
+	flash, err := parseLayout(*layout)
+	if err != nil {
+		return err
+	}
+	image, err := fmap.OpenImage(fs.Arg(0), false)
+	if err != nil {
+		return err
+	}
+	defer image.Close()
+	lookups, err := flash.SimulateBootLookup(image, names)
+	if err != nil {
+		return err
+	}
+	failed := 0
+	for _, l := range lookups {
+		log.Print(l)
+		if !l.OK() {
+			failed++
+		}
+	}
+	if failed > 0 {
+		return fmt.Errorf("%d of %d lookups disagree with the layout", failed, len(lookups))
+	}
+	return nil
+}
@@ -0,0 +1,112 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io/ioutil"
+	"log"
+	"os"
+
+	"github.com/insomniacslk/fmap/pkg/fmap"
+)
+
+// converters produce the output formats of the convert command, by name.
+var converters = map[string]func(flash *fmap.Section) ([]byte, error){
+	"fmd": func(flash *fmap.Section) ([]byte, error) {
+		return []byte(formatLayout(flash)), nil
+	},
+	"json": func(flash *fmap.Section) ([]byte, error) {
+		data, err := json.MarshalIndent(flash, "", "  ")
+		if err != nil {
+			return nil, err
+		}
+		return append(data, '\n'), nil
+	},
+	"yaml": func(flash *fmap.Section) ([]byte, error) {
+		return flash.ToYAML()
+	},
+	"binary": func(flash *fmap.Section) ([]byte, error) {
+		return flash.ToBinary()
+	},
+	"cheader": func(flash *fmap.Section) ([]byte, error) {
+		header, err := flash.ToCHeader()
+		return []byte(header), err
+	},
+	"fmap_config": func(flash *fmap.Section) ([]byte, error) {
+		return []byte(flash.ToFmapConfig()), nil
+	},
+	"dump_fmap": func(flash *fmap.Section) ([]byte, error) {
+		out, err := flash.ToDumpFmap(fmap.DumpFmapDefault)
+		return []byte(out), err
+	},
+	"dump_fmap_p": func(flash *fmap.Section) ([]byte, error) {
+		out, err := flash.ToDumpFmap(fmap.DumpFmapParseable)
+		return []byte(out), err
+	},
+	"dump_fmap_h": func(flash *fmap.Section) ([]byte, error) {
+		out, err := flash.ToDumpFmap(fmap.DumpFmapHuman)
+		return []byte(out), err
+	},
+	"dot": func(flash *fmap.Section) ([]byte, error) {
+		return []byte(flash.ToDOT()), nil
+	},
+	"svg": func(flash *fmap.Section) ([]byte, error) {
+		return []byte(flash.ToSVG()), nil
+	},
+	"html": func(flash *fmap.Section) ([]byte, error) {
+		return []byte(flash.ToHTML()), nil
+	},
+}
+
+// convert writes a flashmap in another format, and reports the information
+// that the format cannot represent.
+func convert(fs *flag.FlagSet, args []string) error {
+	to := fs.String("to", "", "output format: fmd, json, yaml, binary, cheader, fmap_config, dump_fmap, dump_fmap_p, dump_fmap_h, dot, svg or html (required)")
+	output := fs.String("o", "", "file to write the result to. If empty, write to standard output")
+	report := fs.String("report", "", "file to write the fidelity report to, as JSON. If empty, log it")
+	_ = fs.Parse(args)
+	if fs.NArg() != 1 || *to == "" {
+		fs.Usage()
+		return errors.New("expected an output format and exactly one flashmap file")
+	}
+	conv, ok := converters[*to]
+	if !ok {
+		return fmt.Errorf("unknown output format %q", *to)
+	}
+
+	flash, err := parseLayout(fs.Arg(0))
+	if err != nil {
+		return err
+	}
+	data, err := conv(flash)
+	if err != nil {
+		return err
+	}
+	losses, err := flash.Fidelity(*to)
+	if err != nil {
+		return err
+	}
+	if *report != "" {
+		if losses == nil {
+			losses = []fmap.Loss{}
+		}
+		rep, err := json.MarshalIndent(losses, "", "  ")
+		if err != nil {
+			return err
+		}
+		if err := ioutil.WriteFile(*report, append(rep, '\n'), 0644); err != nil {
+			return err
+		}
+	} else {
+		for _, l := range losses {
+			log.Printf("%s: %s", l.Kind, l)
+		}
+	}
+	if *output == "" {
+		_, err := os.Stdout.Write(data)
+		return err
+	}
+	return ioutil.WriteFile(*output, data, 0644)
+}
@@ -0,0 +1,63 @@
+package main
+
+import (
+	"errors"
+	"flag"
+	"log"
+
+	"github.com/insomniacslk/fmap/pkg/fmap"
+)
+
+// copyRegions copies sections from a flash image to another, each addressed
+// with its own layout.
+func copyRegions(fs *flag.FlagSet, args []string) error {
+	var regions sectionsFlag
+	fs.Var(&regions, "region", "name of a section to copy. Can be repeated (required)")
+	srcLayout := fs.String("src-layout", "", "flashmap file describing the source image. If empty, use the FMAP embedded in the image")
+	dstLayout := fs.String("dst-layout", "", "flashmap file describing the destination image. If empty, use the FMAP embedded in the image")
+	output := fs.String("o", "", "write the modified destination image to this file instead of modifying it in place")
+	_ = fs.Parse(args)
+	if fs.NArg() != 2 || len(regions) == 0 {
+		fs.Usage()
+		return errors.New("expected at least one section name, a source and a destination image file")
+	}
+	srcfile, dstfile := fs.Arg(0), fs.Arg(1)
+
+	src, err := fmap.OpenImage(srcfile, false)
+	if err != nil {
+		return err
+	}
+	defer src.Close()
+	srcFlash, err := imageLayout(*srcLayout, src)
+	if err != nil {
+		return err
+	}
+	if *output != "" {
+		if err := copyImage(dstfile, *output); err != nil {
+			return err
+		}
+		dstfile = *output
+	}
+	dst, err := fmap.OpenImage(dstfile, true)
+	if err != nil {
+		return err
+	}
+	defer dst.Close()
+	dstFlash, err := imageLayout(*dstLayout, dst)
+	if err != nil {
+		return err
+	}
+	if err := checkImageSize(dstFlash, dst); err != nil {
+		return err
+	}
+	if err := fmap.CopyRegions(dst, dstFlash, src, srcFlash, regions); err != nil {
+		return err
+	}
+	for _, name := range regions {
+		log.Printf("Copied section %s from %s to %s", name, srcfile, dstfile)
+	}
+	if err := dst.Commit(); err != nil {
+		return err
+	}
+	return dst.Close()
+}
@@ -0,0 +1,117 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+
+	"github.com/insomniacslk/fmap/pkg/fmap"
+)
+
+// dbCommands are the subcommands of db.
+var dbCommands = []command{
+	{"db add", "[-db FILE] [-layout file.fmd] [-device NAME] image.bin", "hash the sections of an image and append them to a hash database", dbAdd},
+	{"db query", "[-db FILE] [-device NAME] [-section PATTERN] [-changes] [-json]", "print the history of the section hashes in a hash database", dbQuery},
+}
+
+// db runs a subcommand operating on a hash database.
+func db(fs *flag.FlagSet, args []string) error {
+	if len(args) > 0 {
+		for _, cmd := range dbCommands {
+			if cmd.name == "db "+args[0] {
+				return cmd.run(newFlagSet(cmd), args[1:])
+			}
+		}
+	}
+	fs.Usage()
+	return errors.New("expected one of add, query")
+}
+
+// dbAdd hashes the sections of an image and appends them to a hash database.
+func dbAdd(fs *flag.FlagSet, args []string) error {
+	dbPath := fs.String("db", "fmap.db", "hash database file")
+	layout := fs.String("layout", "", "flashmap file describing the image. If empty, use the FMAP embedded in the image")
+	device := fs.String("device", "", "name of the device the image was read from")
+	_ = fs.Parse(args)
+	if fs.NArg() != 1 {
+		fs.Usage()
+		return errors.New("expected exactly one image file")
+	}
+
+	image, err := fmap.OpenImage(fs.Arg(0), false)
+	if err != nil {
+		return err
+	}
+	defer image.Close()
+	flash, err := imageLayout(*layout, image)
+	if err != nil {
+		return err
+	}
+	report, err := flash.Hash(image)
+	if err != nil {
+		return err
+	}
+	report.Device = *device
+
+	fd, err := os.OpenFile(*dbPath, os.O_WRONLY|os.O_APPEND|os.O_CREATE, 0644)
+	if err != nil {
+		return err
+	}
+	entry := fmap.HashDBEntry{Time: now().UTC(), Image: fs.Arg(0), HashReport: *report}
+	if err := fmap.AppendHashDB(fd, &entry); err != nil {
+		fd.Close()
+		return err
+	}
+	return fd.Close()
+}
+
+// dbQuery prints the history of the section hashes in a hash database.
+func dbQuery(fs *flag.FlagSet, args []string) error {
+	dbPath := fs.String("db", "fmap.db", "hash database file")
+	device := fs.String("device", "", "only print the hashes of this device")
+	section := fs.String("section", "", "only print the sections whose path or name matches this pattern")
+	changes := fs.Bool("changes", false, "only print the hashes that changed")
+	asJSON := fs.Bool("json", false, "print the records as JSON")
+	_ = fs.Parse(args)
+	if fs.NArg() != 0 {
+		fs.Usage()
+		return errors.New("unexpected arguments")
+	}
+
+	fd, err := os.Open(*dbPath)
+	if err != nil {
+		return err
+	}
+	defer fd.Close()
+	entries, err := fmap.ReadHashDB(fd)
+	if err != nil {
+		return fmt.Errorf("%s: %v", *dbPath, err)
+	}
+	records, err := fmap.QueryHashDB(entries, *device, *section)
+	if err != nil {
+		return err
+	}
+	if *changes {
+		var changed []fmap.HashRecord
+		for _, r := range records {
+			if r.Changed {
+				changed = append(changed, r)
+			}
+		}
+		records = changed
+	}
+	if *asJSON {
+		if records == nil {
+			records = []fmap.HashRecord{}
+		}
+		enc := json.NewEncoder(os.Stdout)
+		enc.SetIndent("", "  ")
+		return enc.Encode(records)
+	}
+	for _, r := range records {
+		fmt.Println(r)
+	}
+	return nil
+}
@@ -0,0 +1,52 @@
+package main
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"io/ioutil"
+	"log"
+
+	"github.com/insomniacslk/fmap/pkg/fmap"
+)
+
+// defragment compacts the sections of a flashmap, logs the moves, and prints
+// the result unless in dry-run mode.
+func defragment(fs *flag.FlagSet, args []string) error {
+	dryRun := fs.Bool("dry-run", false, "only print the moves, without writing the resulting flashmap")
+	strategy := fs.String("strategy", "compact", "compact: move all the sections towards the start of their parent; minimize-moves: move as few bytes as possible")
+	output := fs.String("o", "", "file to write the resulting flashmap to. If empty, write to standard output")
+	_ = fs.Parse(args)
+	if fs.NArg() != 1 {
+		fs.Usage()
+		return errors.New("expected exactly one flashmap file")
+	}
+
+	var st fmap.DefragStrategy
+	switch *strategy {
+	case "compact":
+		st = fmap.DefragCompact
+	case "minimize-moves":
+		st = fmap.DefragMinimizeMoves
+	default:
+		return fmt.Errorf("unknown strategy %q", *strategy)
+	}
+
+	flash, err := parseLayout(fs.Arg(0))
+	if err != nil {
+		return err
+	}
+	moves := flash.DefragWith(st, *dryRun)
+	for _, m := range moves {
+		log.Print(m)
+	}
+	log.Printf("%d sections moved, 0x%x bytes", len(moves), fmap.MovedBytes(moves))
+	if *dryRun {
+		return nil
+	}
+	if *output == "" {
+		fmt.Print(formatLayout(flash))
+		return nil
+	}
+	return ioutil.WriteFile(*output, []byte(formatLayout(flash)), 0644)
+}
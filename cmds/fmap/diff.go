@@ -0,0 +1,42 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+
+	"github.com/insomniacslk/fmap/pkg/fmap"
+)
+
+// diff prints the semantic differences between two flashmaps.
+func diff(fs *flag.FlagSet, args []string) error {
+	asJSON := fs.Bool("json", false, "print the differences as JSON")
+	_ = fs.Parse(args)
+	if fs.NArg() != 2 {
+		fs.Usage()
+		return errors.New("expected two flashmap files")
+	}
+	a, err := parseLayout(fs.Arg(0))
+	if err != nil {
+		return err
+	}
+	b, err := parseLayout(fs.Arg(1))
+	if err != nil {
+		return err
+	}
+	changes := fmap.Diff(a, b)
+	if *asJSON {
+		if changes == nil {
+			changes = []fmap.Change{}
+		}
+		enc := json.NewEncoder(os.Stdout)
+		enc.SetIndent("", "  ")
+		return enc.Encode(changes)
+	}
+	for _, c := range changes {
+		fmt.Println(c)
+	}
+	return nil
+}
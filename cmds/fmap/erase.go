@@ -0,0 +1,123 @@
+package main
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"log"
+
+	"github.com/insomniacslk/fmap/pkg/fmap"
+)
+
+// lookupSections returns the sections of `flash` called `names`, or all of its
+// sub-sections if `names` is empty.
+func lookupSections(flash *fmap.Section, names []string) ([]*fmap.Section, error) {
+	if len(names) == 0 {
+		return allSections(flash), nil
+	}
+	var ret []*fmap.Section
+	for _, name := range names {
+		sec, err := flash.Lookup(name, true)
+		if err != nil {
+			return nil, err
+		}
+		ret = append(ret, sec)
+	}
+	return ret, nil
+}
+
+// blankCheck checks that sections of a flash image are erased, i.e. full of
+// 0xff.
+func blankCheck(fs *flag.FlagSet, args []string) error {
+	var regions sectionsFlag
+	fs.Var(&regions, "region", "name of a section to check. Can be repeated. If omitted, check all the sections")
+	layout := fs.String("layout", "", "flashmap file describing the image. If empty, use the FMAP embedded in the image")
+	_ = fs.Parse(args)
+	if fs.NArg() != 1 {
+		fs.Usage()
+		return errors.New("expected exactly one image file")
+	}
+
+	image, err := fmap.OpenImage(fs.Arg(0), false)
+	if err != nil {
+		return err
+	}
+	defer image.Close()
+	flash, err := imageLayout(*layout, image)
+	if err != nil {
+		return err
+	}
+	sections, err := lookupSections(flash, regions)
+	if err != nil {
+		return err
+	}
+	programmed := 0
+	for _, sec := range sections {
+		blank, first, err := flash.BlankCheckSection(image, sec)
+		if err != nil {
+			return err
+		}
+		if blank {
+			fmt.Printf("%s: blank\n", sec.Path())
+		} else {
+			fmt.Printf("%s: not blank, first programmed byte at 0x%x\n", sec.Path(), first)
+			programmed++
+		}
+	}
+	if programmed > 0 {
+		return fmt.Errorf("%d of %d sections are not blank", programmed, len(sections))
+	}
+	return nil
+}
+
+// erase erases, or zero-fills, sections of a flash image.
+func erase(fs *flag.FlagSet, args []string) error {
+	var regions sectionsFlag
+	fs.Var(&regions, "region", "name of a section to erase. Can be repeated (required)")
+	layout := fs.String("layout", "", "flashmap file describing the image. If empty, use the FMAP embedded in the image")
+	zero := fs.Bool("zero", false, "fill the sections with 0x00 instead of 0xff")
+	output := fs.String("o", "", "write the modified image to this file instead of modifying it in place")
+	_ = fs.Parse(args)
+	if fs.NArg() != 1 || len(regions) == 0 {
+		fs.Usage()
+		return errors.New("expected at least one section name and exactly one image file")
+	}
+	imagefile := fs.Arg(0)
+
+	if *output != "" {
+		if err := copyImage(imagefile, *output); err != nil {
+			return err
+		}
+		imagefile = *output
+	}
+	image, err := fmap.OpenImage(imagefile, true)
+	if err != nil {
+		return err
+	}
+	defer image.Close()
+	flash, err := imageLayout(*layout, image)
+	if err != nil {
+		return err
+	}
+	if err := checkImageSize(flash, image); err != nil {
+		return err
+	}
+	sections, err := lookupSections(flash, regions)
+	if err != nil {
+		return err
+	}
+	value, verb := byte(0xff), "Erased"
+	if *zero {
+		value, verb = 0, "Zero-filled"
+	}
+	if err := flash.WipeSections(image, sections, value); err != nil {
+		return err
+	}
+	for _, sec := range sections {
+		log.Printf("%s section %s (0x%x bytes) of %s", verb, sec.Path(), sec.ByteSize(), imagefile)
+	}
+	if err := image.Commit(); err != nil {
+		return err
+	}
+	return image.Close()
+}
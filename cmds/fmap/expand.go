@@ -0,0 +1,69 @@
+package main
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"io/ioutil"
+	"log"
+	"os"
+	"path/filepath"
+
+	"github.com/insomniacslk/fmap/pkg/fmap"
+)
+
+// expand compiles a board family file into one flashmap per variant.
+func expand(fs *flag.FlagSet, args []string) error {
+	variant := fs.String("variant", "", "only expand this variant, and print it to standard output")
+	dir := fs.String("dir", ".", "directory to write the expanded <variant>.fmd files to")
+	_ = fs.Parse(args)
+	if fs.NArg() != 1 {
+		fs.Usage()
+		return errors.New("expected exactly one family file")
+	}
+	fd, err := os.Open(fs.Arg(0))
+	if err != nil {
+		return err
+	}
+	defer fd.Close()
+	r := newHashingReader(fd)
+	family, err := fmap.ParseFamily(r)
+	if err != nil {
+		return fmt.Errorf("%s: %v", fs.Arg(0), err)
+	}
+	addSource(r)
+
+	if *variant != "" {
+		flash, err := expandVariant(family, *variant)
+		if err != nil {
+			return err
+		}
+		fmt.Print(formatLayout(flash))
+		return nil
+	}
+	for _, v := range family.Variants {
+		flash, err := expandVariant(family, v.Name)
+		if err != nil {
+			return err
+		}
+		outfile := filepath.Join(*dir, v.Name+".fmd")
+		if err := ioutil.WriteFile(outfile, []byte(formatLayout(flash)), 0644); err != nil {
+			return err
+		}
+		log.Printf("Wrote variant %s to %s", v.Name, outfile)
+	}
+	return nil
+}
+
+// expandVariant returns the flashmap of a variant of `family`, parsed with the
+// global parse options, and logs its parse warnings.
+func expandVariant(family *fmap.Family, name string) (*fmap.Section, error) {
+	flash, err := family.Expand(name, parseOptions)
+	if err != nil {
+		return nil, err
+	}
+	for _, w := range flash.ParseWarnings() {
+		log.Printf("%s: %v", w.Severity, w)
+	}
+	return flash, nil
+}
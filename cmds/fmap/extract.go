@@ -0,0 +1,65 @@
+package main
+
+import (
+	"errors"
+	"flag"
+	"io/ioutil"
+	"log"
+	"path/filepath"
+
+	"github.com/insomniacslk/fmap/pkg/fmap"
+)
+
+// allSections returns all the sub-sections of `s`, at any depth, in pre-order.
+func allSections(s *fmap.Section) []*fmap.Section {
+	var ret []*fmap.Section
+	for _, sec := range s.Sections {
+		ret = append(ret, sec)
+		ret = append(ret, allSections(sec)...)
+	}
+	return ret
+}
+
+// extract writes the content of the sections of a flash image to files named
+// after the sections.
+func extract(fs *flag.FlagSet, args []string) error {
+	layout := fs.String("layout", "", "flashmap file describing the image. If empty, use the FMAP embedded in the image")
+	section := fs.String("section", "", "name of the section to extract. If empty, extract all the sections")
+	dir := fs.String("dir", ".", "directory to write the section files to")
+	_ = fs.Parse(args)
+	if fs.NArg() != 1 {
+		fs.Usage()
+		return errors.New("expected exactly one image file")
+	}
+
+	image, err := fmap.OpenImage(fs.Arg(0), false)
+	if err != nil {
+		return err
+	}
+	defer image.Close()
+	flash, err := imageLayout(*layout, image)
+	if err != nil {
+		return err
+	}
+
+	sections := allSections(flash)
+	if *section != "" {
+		sec, err := flash.Lookup(*section, true)
+		if err != nil {
+			return err
+		}
+		sections = []*fmap.Section{sec}
+	}
+	for _, sec := range sections {
+		data, err := flash.ExtractSection(image, sec)
+		if err != nil {
+			return err
+		}
+		outfile := filepath.Join(*dir, sec.Name+".bin")
+		if err := ioutil.WriteFile(outfile, data, 0644); err != nil {
+			return err
+		}
+		log.Printf("Extracted %s (0x%x bytes) to %s", sec.Name, len(data), outfile)
+	}
+	return nil
+}
@@ -0,0 +1,167 @@
+package main
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"io/ioutil"
+	"log"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/insomniacslk/fmap/pkg/fmap"
+)
+
+// payloadFlag is a flag.Value collecting NAME=FILE payloads.
+type payloadFlag map[string]string
+
+func (p payloadFlag) String() string {
+	var payloads []string
+	for name, path := range p {
+		payloads = append(payloads, name+"="+path)
+	}
+	return strings.Join(payloads, " ")
+}
+
+func (p payloadFlag) Set(s string) error {
+	parts := strings.SplitN(s, "=", 2)
+	if len(parts) != 2 || parts[0] == "" || parts[1] == "" {
+		return fmt.Errorf("invalid payload %q: must be NAME=FILE", s)
+	}
+	p[parts[0]] = parts[1]
+	return nil
+}
+
+// parseFitOptions parses the values of the -headroom and -align flags.
+func parseFitOptions(headroom, align string) (fmap.FitOptions, error) {
+	var opts fmap.FitOptions
+	for _, v := range []struct {
+		name  string
+		value string
+		dest  *int64
+	}{{"headroom", headroom, &opts.Headroom}, {"align", align, &opts.Align}} {
+		n, err := strconv.ParseInt(v.value, 0, 64)
+		if err != nil || n < 0 {
+			return opts, fmt.Errorf("invalid %s %q", v.name, v.value)
+		}
+		*v.dest = n
+	}
+	return opts, nil
+}
+
+// fit resizes sections of a flashmap to fit payload files, and prints the
+// result, or checks that payload files fit their sections.
+func fit(fs *flag.FlagSet, args []string) error {
+	payloads := make(payloadFlag)
+	fs.Var(payloads, "payload", "resize the section NAME to fit FILE, as NAME=FILE. Can be repeated")
+	checks := make(payloadFlag)
+	fs.Var(checks, "map", "check that FILE fits the section NAME, as NAME=FILE, without resizing it. Can be repeated")
+	donor := fs.String("donor", "", "grow the sections of the payloads just enough, taking the space from this section instead of defragmenting")
+	headroom := fs.String("headroom", "0", "bytes added to the size of every payload")
+	align := fs.String("align", "0", "round the sizes up to a multiple of this many bytes")
+	output := fs.String("o", "", "file to write the resulting flashmap to. If empty, write to standard output")
+	_ = fs.Parse(args)
+	if fs.NArg() != 1 || len(payloads) == 0 && len(checks) == 0 {
+		fs.Usage()
+		return errors.New("expected a flashmap file and at least one payload")
+	}
+	if len(payloads) > 0 && len(checks) > 0 {
+		return errors.New("-payload and -map are mutually exclusive")
+	}
+	opts, err := parseFitOptions(*headroom, *align)
+	if err != nil {
+		return err
+	}
+
+	flash, err := parseLayout(fs.Arg(0))
+	if err != nil {
+		return err
+	}
+	if len(checks) > 0 {
+		return checkFit(flash, checks, opts)
+	}
+	sizes, err := payloadSizes(payloads)
+	if err != nil {
+		return err
+	}
+	violations, err := fitPayloads(flash, sizes, *donor, opts)
+	if err != nil {
+		return err
+	}
+	failed := false
+	for _, v := range violations {
+		log.Printf("%s: %v", v.Severity, v)
+		if v.Severity == fmap.SeverityError {
+			failed = true
+		}
+	}
+	if failed {
+		return errors.New("the payloads don't fit in the layout")
+	}
+	if *output == "" {
+		fmt.Print(formatLayout(flash))
+		return nil
+	}
+	return ioutil.WriteFile(*output, []byte(formatLayout(flash)), 0644)
+}
+
+// fitPayloads resizes the sections of `flash` to fit the payloads, see
+// fmap.Section.Fit, or grows them taking the space from `donor`, if not empty,
+// see fmap.Section.GrowToFit.
+func fitPayloads(flash *fmap.Section, sizes map[string]int64, donor string, opts fmap.FitOptions) ([]fmap.Violation, error) {
+	if donor == "" {
+		return flash.Fit(sizes, opts)
+	}
+	var names []string
+	for name := range sizes {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	var violations []fmap.Violation
+	for _, name := range names {
+		var err error
+		if violations, err = flash.GrowToFit(name, sizes[name], donor, opts); err != nil {
+			return nil, err
+		}
+	}
+	return violations, nil
+}
+
+// payloadSizes returns the sizes of the payload files, by section name.
+func payloadSizes(payloads payloadFlag) (map[string]int64, error) {
+	sizes := make(map[string]int64)
+	for name, path := range payloads {
+		fi, err := os.Stat(path)
+		if err != nil {
+			return nil, err
+		}
+		sizes[name] = fi.Size()
+	}
+	return sizes, nil
+}
+
+// checkFit checks that the payload files fit their sections of `flash`, and
+// prints the slack of every section.
+func checkFit(flash *fmap.Section, payloads payloadFlag, opts fmap.FitOptions) error {
+	sizes, err := payloadSizes(payloads)
+	if err != nil {
+		return err
+	}
+	checks, err := flash.CheckFit(sizes, opts)
+	if err != nil {
+		return err
+	}
+	failed := 0
+	for _, c := range checks {
+		fmt.Println(c)
+		if !c.OK() {
+			failed++
+		}
+	}
+	if failed > 0 {
+		return fmt.Errorf("%d of %d payloads don't fit their sections", failed, len(checks))
+	}
+	return nil
+}
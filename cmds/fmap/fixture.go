@@ -0,0 +1,59 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"flag"
+	"io/ioutil"
+	"log"
+
+	"github.com/insomniacslk/fmap/pkg/fmap"
+)
+
+// fixture writes a synthetic flashmap, a matching image and the hashes of its
+// sections, for the integration tests of flash tooling.
+func fixture(fs *flag.FlagSet, args []string) error {
+	size := fs.String("size", "1M", "size of the flash, e.g. 16M")
+	align := fs.String("align", "4K", "alignment of the sections")
+	depth := fs.Int("depth", 2, "levels of sub-sections below the root")
+	fanOut := fs.Int("fanout", 4, "maximum number of sub-sections of a section")
+	seed := fs.Int64("seed", 0, "seed of the layout and of the content: the same options always generate the same fixture")
+	_ = fs.Parse(args)
+	if fs.NArg() != 1 {
+		fs.Usage()
+		return errors.New("expected exactly one output prefix")
+	}
+	prefix := fs.Arg(0)
+
+	opts := fmap.FixtureOptions{Depth: *depth, FanOut: *fanOut, Seed: *seed}
+	var err error
+	if opts.Size, err = parseSize(*size); err != nil {
+		return err
+	}
+	if opts.Align, err = parseSize(*align); err != nil {
+		return err
+	}
+	fx, err := fmap.GenerateFixture(opts)
+	if err != nil {
+		return err
+	}
+	hashes, err := json.MarshalIndent(fx.Hashes, "", "  ")
+	if err != nil {
+		return err
+	}
+	for _, out := range []struct {
+		suffix string
+		data   []byte
+	}{
+		{".fmd", []byte(formatLayout(fx.Layout))},
+		{".bin", fx.Image},
+		{".hashes.json", append(hashes, '\n')},
+	} {
+		if err := ioutil.WriteFile(prefix+out.suffix, out.data, 0644); err != nil {
+			return err
+		}
+		log.Printf("Wrote %s", prefix+out.suffix)
+	}
+	log.Printf("%d sections, seed %d", len(fx.Hashes.Sections)-1, *seed)
+	return nil
+}
@@ -0,0 +1,78 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+
+	"github.com/insomniacslk/fmap/pkg/fmap"
+)
+
+// readHashReport reads a JSON hash report from a file. Reports without a
+// device name are named after the file.
+func readHashReport(path string) (*fmap.HashReport, error) {
+	fd, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer fd.Close()
+	report, err := fmap.ReadHashReport(fd)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %v", path, err)
+	}
+	if report.Device == "" {
+		report.Device = path
+	}
+	return report, nil
+}
+
+// fleet compares the hash reports of many devices against a golden report, and
+// fails if any device deviates.
+func fleet(fs *flag.FlagSet, args []string) error {
+	asJSON := fs.Bool("json", false, "print the deviations as JSON")
+	_ = fs.Parse(args)
+	if fs.NArg() < 2 {
+		fs.Usage()
+		return errors.New("expected a golden report and at least one device report")
+	}
+	golden, err := readHashReport(fs.Arg(0))
+	if err != nil {
+		return err
+	}
+	var reports []*fmap.HashReport
+	for _, path := range fs.Args()[1:] {
+		report, err := readHashReport(path)
+		if err != nil {
+			return err
+		}
+		reports = append(reports, report)
+	}
+	deviations, err := fmap.CompareFleet(golden, reports)
+	if err != nil {
+		return err
+	}
+	if *asJSON {
+		if deviations == nil {
+			deviations = []fmap.Deviation{}
+		}
+		enc := json.NewEncoder(os.Stdout)
+		enc.SetIndent("", "  ")
+		if err := enc.Encode(deviations); err != nil {
+			return err
+		}
+	} else {
+		for _, d := range deviations {
+			fmt.Println(d)
+		}
+	}
+	devices := make(map[string]bool)
+	for _, d := range deviations {
+		devices[d.Device] = true
+	}
+	if len(devices) > 0 {
+		return fmt.Errorf("%d of %d devices deviate from %s", len(devices), len(reports), fs.Arg(0))
+	}
+	return nil
+}
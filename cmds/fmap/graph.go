@@ -0,0 +1,28 @@
+package main
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"io/ioutil"
+)
+
+// graph prints the hierarchy of a flashmap in the Graphviz DOT language.
+func graph(fs *flag.FlagSet, args []string) error {
+	output := fs.String("o", "", "file to write the graph to. If empty, write to standard output")
+	_ = fs.Parse(args)
+	if fs.NArg() != 1 {
+		fs.Usage()
+		return errors.New("expected exactly one flashmap file")
+	}
+
+	flash, err := parseLayout(fs.Arg(0))
+	if err != nil {
+		return err
+	}
+	if *output == "" {
+		fmt.Print(flash.ToDOT())
+		return nil
+	}
+	return ioutil.WriteFile(*output, []byte(flash.ToDOT()), 0644)
+}
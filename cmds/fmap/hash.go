@@ -0,0 +1,72 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"strings"
+
+	"github.com/insomniacslk/fmap/pkg/fmap"
+)
+
+// hashImage writes the manifest of the hashes of the sections of a flash
+// image, or checks an image against a manifest.
+func hashImage(fs *flag.FlagSet, args []string) error {
+	layout := fs.String("layout", "", "flashmap file describing the image. If empty, use the FMAP embedded in the image")
+	algorithm := fs.String("algorithm", fmap.HashAlgorithmSHA256, "hash algorithm: "+strings.Join(fmap.HashAlgorithms(), ", "))
+	device := fs.String("device", "", "name of the device the image was read from")
+	output := fs.String("o", "", "file to write the manifest to. If empty, write to standard output")
+	verifyPath := fs.String("verify", "", "manifest to check the image against, with its algorithm, instead of writing one")
+	_ = fs.Parse(args)
+	if fs.NArg() != 1 {
+		fs.Usage()
+		return errors.New("expected exactly one image file")
+	}
+
+	image, err := fmap.OpenImage(fs.Arg(0), false)
+	if err != nil {
+		return err
+	}
+	defer image.Close()
+	flash, err := imageLayout(*layout, image)
+	if err != nil {
+		return err
+	}
+
+	if *verifyPath != "" {
+		manifest, err := readHashReport(*verifyPath)
+		if err != nil {
+			return err
+		}
+		deviations, err := flash.VerifyHashes(image, manifest)
+		if err != nil {
+			return err
+		}
+		for _, d := range deviations {
+			fmt.Println(d)
+		}
+		if len(deviations) > 0 {
+			return fmt.Errorf("%d sections of %s differ from %s", len(deviations), image.Name(), *verifyPath)
+		}
+		return nil
+	}
+
+	report, err := flash.HashWith(image, *algorithm)
+	if err != nil {
+		return err
+	}
+	report.Device = *device
+	data, err := json.MarshalIndent(report, "", "  ")
+	if err != nil {
+		return err
+	}
+	data = append(data, '\n')
+	if *output == "" {
+		_, err = os.Stdout.Write(data)
+		return err
+	}
+	return ioutil.WriteFile(*output, data, 0644)
+}
@@ -0,0 +1,95 @@
+package main
+
+import (
+	"bytes"
+	"errors"
+	"flag"
+	"fmt"
+	"io/ioutil"
+	"log"
+	"os"
+
+	"github.com/insomniacslk/fmap/pkg/fmap"
+)
+
+// importLayout converts a layout written by a legacy tool, or in YAML, to a
+// flashmap. The regions of an Intel Flash Descriptor can be merged with the
+// layout of the BIOS region.
+func importLayout(fs *flag.FlagSet, args []string) error {
+	format := fs.String("format", "fmap_decode", "format of the input file: fmap_decode, dump_fmap, yaml, ifd for the descriptor of a flash image, or ifdtool for the output of ifdtool -d")
+	biosLayout := fs.String("bios", "", "flashmap of the BIOS region, to merge into SI_BIOS with the ifd and ifdtool formats")
+	output := fs.String("o", "", "file to write the flashmap to. If empty, write to standard output")
+	_ = fs.Parse(args)
+	if fs.NArg() != 1 {
+		fs.Usage()
+		return errors.New("expected exactly one input file")
+	}
+
+	fd := os.Stdin
+	if fs.Arg(0) != "-" {
+		var err error
+		if fd, err = os.Open(fs.Arg(0)); err != nil {
+			return err
+		}
+		defer fd.Close()
+	}
+	r := newHashingReader(fd)
+	var (
+		flash *fmap.Section
+		err   error
+	)
+	switch *format {
+	case "fmap_decode":
+		flash, err = fmap.ParseFmapDecode(r)
+	case "dump_fmap":
+		flash, err = fmap.ParseDumpFmap(r)
+	case "yaml":
+		flash, err = fmap.FromYAML(r)
+	case "ifd", "ifdtool":
+		flash, err = importIFD(r, *format == "ifd", *biosLayout)
+	default:
+		return fmt.Errorf("unknown format %q", *format)
+	}
+	if err != nil {
+		return fmt.Errorf("%s: %v", fs.Arg(0), err)
+	}
+	addSource(r)
+	if *output == "" {
+		fmt.Print(formatLayout(flash))
+		return nil
+	}
+	return ioutil.WriteFile(*output, []byte(formatLayout(flash)), 0644)
+}
+
+// importIFD returns the layout of the regions of the Intel Flash Descriptor of
+// the image read from `r`, or listed by ifdtool -d if `image` is false, merged
+// with the flashmap of the BIOS region at `biosLayout`, if not empty.
+func importIFD(r hashingReader, image bool, biosLayout string) (*fmap.Section, error) {
+	var (
+		regions []fmap.IFDRegion
+		size    int64
+		err     error
+	)
+	if image {
+		data, err := ioutil.ReadAll(r)
+		if err != nil {
+			return nil, err
+		}
+		if regions, err = fmap.ReadIFD(bytes.NewReader(data)); err != nil {
+			return nil, err
+		}
+		size = int64(len(data))
+	} else if regions, size, err = fmap.ParseIfdtoolDump(r); err != nil {
+		return nil, err
+	}
+	for _, region := range regions {
+		log.Printf("Region %d: %v", region.Index, region)
+	}
+	var bios *fmap.Section
+	if biosLayout != "" {
+		if bios, err = parseLayout(biosLayout); err != nil {
+			return nil, fmt.Errorf("%s: %v", biosLayout, err)
+		}
+	}
+	return fmap.FromIFD(regions, size, bios)
+}
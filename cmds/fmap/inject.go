@@ -0,0 +1,126 @@
+package main
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"log"
+	"os"
+
+	"github.com/insomniacslk/fmap/pkg/fmap"
+)
+
+// copyImage copies the image at `src`, in any storage backend, to the local
+// file `dst`, overwriting it.
+func copyImage(src, dst string) error {
+	in, err := fmap.OpenImage(src, false)
+	if err != nil {
+		return err
+	}
+	defer in.Close()
+	size, err := in.Size()
+	if err != nil {
+		return err
+	}
+	out, err := os.Create(dst)
+	if err != nil {
+		return err
+	}
+	if _, err := io.Copy(out, io.NewSectionReader(in, 0, size)); err != nil {
+		out.Close()
+		return err
+	}
+	return out.Close()
+}
+
+// inject writes a payload file into a section of a flash image.
+func inject(fs *flag.FlagSet, args []string) error {
+	layout := fs.String("layout", "", "flashmap file describing the image. If empty, use the FMAP embedded in the image")
+	section := fs.String("section", "", "name of the section to write the payload to (required)")
+	pad := fs.Bool("pad", false, "fill the rest of the section with 0xff")
+	output := fs.String("o", "", "write the modified image to this file instead of modifying it in place")
+	verify := fs.Bool("verify", false, "re-open the modified image and verify the content of the section")
+	_ = fs.Parse(args)
+	if fs.NArg() != 2 || *section == "" {
+		fs.Usage()
+		return errors.New("expected a section name, an image file and a payload file")
+	}
+	imagefile, payloadfile := fs.Arg(0), fs.Arg(1)
+
+	payload, err := ioutil.ReadFile(payloadfile)
+	if err != nil {
+		return err
+	}
+	if *output != "" {
+		if err := copyImage(imagefile, *output); err != nil {
+			return err
+		}
+		imagefile = *output
+	}
+	image, err := fmap.OpenImage(imagefile, true)
+	if err != nil {
+		return err
+	}
+	defer image.Close()
+	flash, err := imageLayout(*layout, image)
+	if err != nil {
+		return err
+	}
+	if err := checkImageSize(flash, image); err != nil {
+		return err
+	}
+	sec, err := flash.Lookup(*section, true)
+	if err != nil {
+		return err
+	}
+	if err := flash.InjectSection(image, sec, payload, *pad); err != nil {
+		return err
+	}
+	log.Printf("Wrote %s (0x%x bytes) to section %s of %s", payloadfile, len(payload), *section, imagefile)
+	if err := image.Commit(); err != nil {
+		return err
+	}
+	if err := image.Close(); err != nil {
+		return err
+	}
+	if !*verify {
+		return nil
+	}
+	return verifyImage(imagefile, flash, []written{{sec, payload, *pad}})
+}
+
+// written is data written into a section of an image.
+type written struct {
+	section *fmap.Section
+	data    []byte
+	pad     bool
+}
+
+// verifyImage re-opens the image at `path`, described by `flash`, and
+// checks that the sections hold the data written to them. It reports the
+// result of every check, and returns an error if any fails.
+func verifyImage(path string, flash *fmap.Section, writes []written) error {
+	image, err := fmap.OpenImage(path, false)
+	if err != nil {
+		return err
+	}
+	defer image.Close()
+	log.Print("Verification:")
+	failed := 0
+	for _, w := range writes {
+		v, err := flash.VerifySection(image, w.section, w.data, w.pad)
+		if err != nil {
+			return err
+		}
+		log.Printf("  %s", v)
+		if !v.OK() {
+			failed++
+		}
+	}
+	if failed > 0 {
+		return fmt.Errorf("%s: %d of %d sections failed verification", path, failed, len(writes))
+	}
+	return nil
+}
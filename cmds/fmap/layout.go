@@ -0,0 +1,196 @@
+package main
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"hash"
+	"log"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/insomniacslk/fmap/pkg/fmap"
+)
+
+// parseOptions are the options used to parse all the flashmap files, set by
+// the global flags.
+var parseOptions = fmap.ParseOptions{Defines: make(map[string]string)}
+
+// allowRO is set by the global -allow-ro flag to allow the commands to modify
+// read-only sections, see fmap.Section.IsReadOnly.
+var allowRO bool
+
+// stamp and stampTime are set by the global -stamp and -stamp-time flags to
+// write a stamp at the start of the flashmaps written by the commands.
+var stamp, stampTime bool
+
+// reproducible is set by the global -reproducible flag to make the output of
+// the commands depend only on their inputs: stamps have no time and only the
+// base names of the sources, and the current time is replaced by sourceDate.
+var reproducible bool
+
+// sourceDate is the time used instead of the current time in reproducible
+// mode, taken from SOURCE_DATE_EPOCH, see
+// https://reproducible-builds.org/specs/source-date-epoch/. It is zero if the
+// variable is not set, and the time is then omitted where possible.
+var sourceDate time.Time
+
+// parseSourceDate sets sourceDate from the SOURCE_DATE_EPOCH environment
+// variable, if set.
+func parseSourceDate() error {
+	epoch := os.Getenv("SOURCE_DATE_EPOCH")
+	if epoch == "" {
+		return nil
+	}
+	secs, err := strconv.ParseInt(epoch, 10, 64)
+	if err != nil {
+		return fmt.Errorf("invalid SOURCE_DATE_EPOCH %q: %v", epoch, err)
+	}
+	sourceDate = time.Unix(secs, 0).UTC()
+	return nil
+}
+
+// now returns the current time, or sourceDate in reproducible mode.
+func now() time.Time {
+	if reproducible {
+		return sourceDate
+	}
+	return time.Now()
+}
+
+// sources are the input files read by the command, for the stamp.
+var sources []fmap.StampSource
+
+// hashingReader is a file that hashes what is read from it.
+type hashingReader struct {
+	*os.File
+	h hash.Hash
+}
+
+func newHashingReader(fd *os.File) hashingReader {
+	return hashingReader{File: fd, h: sha256.New()}
+}
+
+func (r hashingReader) Read(p []byte) (int, error) {
+	n, err := r.File.Read(p)
+	r.h.Write(p[:n])
+	return n, err
+}
+
+// addSource adds what was read from `r` to the sources.
+func addSource(r hashingReader) {
+	sources = append(sources, fmap.StampSource{Path: r.Name(), Hash: hex.EncodeToString(r.h.Sum(nil))})
+}
+
+// formatLayout returns the flashmap of `flash`, stamped with the version of
+// the tool and the sources if -stamp is passed.
+func formatLayout(flash *fmap.Section) string {
+	if !stamp {
+		return flash.ToFlashmap()
+	}
+	st := fmap.Stamp{Tool: "fmap " + getVersionInfo().Version, Sources: sources}
+	if reproducible {
+		st = st.Reproducible()
+	}
+	if stampTime {
+		st.Time = now()
+	}
+	return flash.ToFlashmap(fmap.WithStamp(st))
+}
+
+// defineFlag is a flag.Value that adds NAME=VALUE constants to the defines.
+type defineFlag map[string]string
+
+func (d defineFlag) String() string {
+	var defs []string
+	for name, value := range d {
+		defs = append(defs, name+"="+value)
+	}
+	return strings.Join(defs, " ")
+}
+
+func (d defineFlag) Set(s string) error {
+	parts := strings.SplitN(s, "=", 2)
+	if len(parts) != 2 || parts[0] == "" {
+		return fmt.Errorf("invalid constant %q: must be NAME=VALUE", s)
+	}
+	d[parts[0]] = parts[1]
+	return nil
+}
+
+// modeFlag is a flag.Value that sets a parse mode, see fmap.ParseMode.
+type modeFlag struct {
+	mode *fmap.ParseMode
+}
+
+func (m modeFlag) String() string {
+	if m.mode == nil {
+		return fmap.ParseDefault.String()
+	}
+	return m.mode.String()
+}
+
+func (m modeFlag) Set(s string) error {
+	for _, mode := range []fmap.ParseMode{fmap.ParseDefault, fmap.ParseStrict, fmap.ParseLenient} {
+		if s == mode.String() {
+			*m.mode = mode
+			return nil
+		}
+	}
+	return fmt.Errorf("invalid parse mode %q: must be default, strict or lenient", s)
+}
+
+// parseLayout parses the flashmap file at `path`, or standard input if `path`
+// is "-". Its read-only sections are protected unless -allow-ro is passed.
+func parseLayout(path string) (*fmap.Section, error) {
+	fd := os.Stdin
+	if path != "-" {
+		var err error
+		if fd, err = os.Open(path); err != nil {
+			return nil, err
+		}
+		defer fd.Close()
+	}
+	r := newHashingReader(fd)
+	flash, err := fmap.ParseWithOptions(r, parseOptions)
+	if err != nil {
+		return nil, err
+	}
+	addSource(r)
+	for _, w := range flash.ParseWarnings() {
+		log.Printf("%s: %v", w.Severity, w)
+	}
+	flash.ProtectReadOnly(!allowRO)
+	return flash, nil
+}
+
+// imageLayout returns the layout of a flash image: the one in the flashmap
+// file at `path` if not empty, otherwise the FMAP embedded in the image.
+func imageLayout(path string, image fmap.Image) (*fmap.Section, error) {
+	if path != "" {
+		return parseLayout(path)
+	}
+	flash, offset, err := fmap.ScanImage(image)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %v", image.Name(), err)
+	}
+	log.Printf("Found FMAP at offset 0x%x", offset)
+	flash.ProtectReadOnly(!allowRO)
+	return flash, nil
+}
+
+// checkImageSize returns an error if the image is smaller than the flash
+// described by the layout, so that writes don't silently extend it.
+func checkImageSize(flash *fmap.Section, image fmap.Image) error {
+	size, err := image.Size()
+	if err != nil {
+		return err
+	}
+	want := flash.ByteSize()
+	if size < want {
+		return fmt.Errorf("%s: image is 0x%x bytes, but the layout describes 0x%x bytes", image.Name(), size, want)
+	}
+	return nil
+}
@@ -0,0 +1,110 @@
+package main
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"io/ioutil"
+	"regexp"
+
+	"github.com/insomniacslk/fmap/pkg/fmap"
+	"gopkg.in/yaml.v2"
+)
+
+// lintPolicy are the lint rules of a team, read from the YAML file passed to
+// lint with -policy, e.g.
+//
+//	rules:
+//	  - name: aligned
+//	    severity: warning
+//	    align: 4K
+//	  - name: names
+//	    name_pattern: "^[A-Z0-9_]+$"
+//	  - name: rw-outside-wp-ro
+//	    sections: "RW_*"
+//	    not_under: WP_RO
+type lintPolicy struct {
+	Rules []lintRule `yaml:"rules"`
+}
+
+// lintRule is a rule of a lint policy, see fmap.LintRule. The severity is
+// "error", the default, or "warning", and the alignment is in bytes, with an
+// optional unit, see parseSize.
+type lintRule struct {
+	Name        string `yaml:"name"`
+	Severity    string `yaml:"severity"`
+	Sections    string `yaml:"sections"`
+	Align       string `yaml:"align"`
+	NamePattern string `yaml:"name_pattern"`
+	NotUnder    string `yaml:"not_under"`
+}
+
+// readPolicy reads the lint policy in the YAML file at `path`.
+func readPolicy(path string) ([]fmap.LintRule, error) {
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var policy lintPolicy
+	if err := yaml.UnmarshalStrict(data, &policy); err != nil {
+		return nil, fmt.Errorf("%s: %v", path, err)
+	}
+	var rules []fmap.LintRule
+	for idx, r := range policy.Rules {
+		if r.Name == "" {
+			return nil, fmt.Errorf("%s: rule %d has no name", path, idx+1)
+		}
+		rule := fmap.LintRule{Name: r.Name, Sections: r.Sections, NotUnder: r.NotUnder}
+		switch r.Severity {
+		case "", "error":
+			rule.Severity = fmap.SeverityError
+		case "warning":
+			rule.Severity = fmap.SeverityWarning
+		default:
+			return nil, fmt.Errorf("%s: rule %s: invalid severity %q: must be error or warning", path, r.Name, r.Severity)
+		}
+		if r.Align != "" {
+			if rule.Align, err = parseSize(r.Align); err != nil {
+				return nil, fmt.Errorf("%s: rule %s: align: %v", path, r.Name, err)
+			}
+		}
+		if r.NamePattern != "" {
+			if rule.NamePattern, err = regexp.Compile(r.NamePattern); err != nil {
+				return nil, fmt.Errorf("%s: rule %s: name_pattern: %v", path, r.Name, err)
+			}
+		}
+		rules = append(rules, rule)
+	}
+	return rules, nil
+}
+
+// lint checks a flashmap against the rules of a lint policy, and fails if any
+// of the findings is an error.
+func lint(fs *flag.FlagSet, args []string) error {
+	policyFile := fs.String("policy", "", "YAML file with the lint rules (required)")
+	asJSON := fs.Bool("json", false, "print the findings as JSON")
+	_ = fs.Parse(args)
+	if fs.NArg() != 1 || *policyFile == "" {
+		fs.Usage()
+		return errors.New("expected a policy and exactly one flashmap file")
+	}
+	rules, err := readPolicy(*policyFile)
+	if err != nil {
+		return err
+	}
+	flash, err := parseLayout(fs.Arg(0))
+	if err != nil {
+		return err
+	}
+	findings, err := flash.Lint(rules)
+	if err != nil {
+		return err
+	}
+	var violations []violationJSON
+	for _, f := range findings {
+		vj := toViolationJSON(f.Violation)
+		vj.Rule = f.Rule
+		violations = append(violations, vj)
+	}
+	return printViolations(violations, *asJSON)
+}
@@ -7,18 +7,125 @@ import (
 	"os"
 
 	"github.com/insomniacslk/fmap/pkg/fmap"
+	// the storage backends of the images that are not local files
+	_ "github.com/insomniacslk/fmap/pkg/fmap/storage"
 )
 
+// command is a subcommand of the fmap tool. `run` receives a flag set, with a
+// usage message built from the command description, on which it defines its
+// own flags, and the command line arguments to parse.
+type command struct {
+	name string
+	args string
+	help string
+	run  func(fs *flag.FlagSet, args []string) error
+}
+
+// commands is the list of subcommands. It is initialized in init() because
+// some commands, like version, refer to it.
+var commands []command
+
+func init() {
+	commands = []command{
+		{"extract", "[-layout file.fmd] [-section NAME] [-dir DIR] image.bin", "extract sections from a flash image", extract},
+		{"assemble", "[-dir DIR] -o image.bin layout.fmd", "build a flash image from the files of its sections, the inverse of extract", assemble},
+		{"inject", "[-layout file.fmd] [-pad] [-verify] [-o output.bin] -section NAME image.bin payload.bin", "write a payload into a section of a flash image", inject},
+		{"blank-check", "[-layout file.fmd] [-region NAME]... image.bin", "check that sections of a flash image are erased, i.e. full of 0xff", blankCheck},
+		{"erase", "[-layout file.fmd] [-zero] [-o output.bin] -region NAME... image.bin", "erase sections of a flash image, filling them with 0xff, or with 0x00 with -zero", erase},
+		{"copy", "[-src-layout src.fmd] [-dst-layout dst.fmd] [-o output.bin] -region NAME... src.bin dst.bin", "copy sections from a flash image to another, e.g. to preserve the VPD across a reflash", copyRegions},
+		{"overlay", "base.fmd override.fmd", "apply an overlay flashmap onto a base flashmap", overlay},
+		{"expand", "[-variant NAME] [-dir DIR] family.fmdf", "compile a board family file into per-variant flashmaps", expand},
+		{"fit", "[-headroom N] [-align N] [-donor NAME] [-o output.fmd] -payload NAME=FILE...|-map NAME=FILE... layout.fmd", "resize sections to fit payload files, then defragment, or take the space from a donor section, and validate, or with -map check that they fit and report the slack", fit},
+		{"shrink", "[-layout file.fmd] [-headroom N] [-align N] [-apply] [-o output.fmd] [-section NAME]... image.bin", "propose or apply shrinking sections to their content in a flash image", shrink},
+		{"defrag", "[-dry-run] [-strategy compact|minimize-moves] [-o output.fmd] layout.fmd", "compact the sections of a flashmap, leaving no free space between them", defragment},
+		{"align", "[-block SIZE] [-dry-run] [-o output.fmd] layout.fmd", "round the starts and the sizes of the sections of a flashmap to the erase block size", align},
+		{"scale", "-size SIZE [-flexible NAME]... [-align SIZE] [-o output.fmd] layout.fmd", "rewrite a flashmap for a bigger or smaller flash, resizing the flexible sections and moving the ones that follow them", scale},
+		{"normalize", "[-strip] [-o output.fmd] layout.fmd", "cover the gaps of a flashmap with UNUSED_N sections, or remove them", normalize},
+		{"stats", "[-min SIZE] [-json] layout.fmd", "show the utilization and the free space of the sections of a flashmap", stats},
+		{"validate", "[-align SIZE] [-zero-size allow|warn|error] [-json] layout.fmd", "check the structure of a flashmap: overlaps, containment, duplicate names and alignment", validate},
+		{"lint", "-policy policy.yaml [-json] layout.fmd", "check a flashmap against the local conventions of a lint policy", lint},
+		{"summary", "layout.fmd", "print a one-line summary of a flashmap, for build logs", summary},
+		{"release-check", "-layout board.fmd [-image rom.bin] [-rules rules.yaml] [-baseline prev.fmd] [-key key.pem] [-o report.json]", "run all the release checks and write a single pass/fail report with the manifest of the image", releaseCheckCmd},
+		{"verify", "[-json] layout.fmd image.bin", "compare a flashmap with the FMAP embedded in an image, reporting mismatched offsets, sizes and missing areas", verify},
+		{"bootcheck", "-layout file.fmd [-name NAME]... image.bin", "check that boot-time FMAP lookups in an image match the layout", bootcheck},
+		{"import", "[-format fmap_decode|dump_fmap|yaml|ifd|ifdtool] [-bios bios.fmd] [-o output.fmd] input", "convert a layout dumped by a legacy tool, written in YAML, or given by the Intel Flash Descriptor of an image, to a flashmap", importLayout},
+		{"convert", "-to fmd|json|yaml|binary|cheader|fmap_config|dump_fmap|dump_fmap_p|dump_fmap_h|dot|svg|html [-o output] [-report fidelity.json] layout.fmd", "write a flashmap in another format, e.g. a C header like fmaptool -h or the listing of dump_fmap, reporting what the format cannot represent", convert},
+		{"graph", "[-o output.dot] layout.fmd", "render the hierarchy of a flashmap as a Graphviz DOT graph", graph},
+		{"render", "[-format svg|html] [-o output.svg] layout.fmd", "draw a flashmap as a proportional flash bar in SVG or HTML", render},
+		{"diff", "[-json] old.fmd new.fmd", "show the semantic differences between two flashmaps", diff},
+		{"owners", "[-paths changed.txt] [-strict] [-json] old.fmd [new.fmd]", "report the owners that must approve the changes to a flashmap", owners},
+		{"hash", "[-layout file.fmd] [-algorithm sha256] [-device NAME] [-o manifest.json] [-verify manifest.json] image.bin", "write the manifest of the hashes of the sections of an image, or check an image against one", hashImage},
+		{"fleet", "[-json] golden.json report.json...", "compare per-device hash reports against a golden one", fleet},
+		{"db", "add|query [arguments]", "record and query the history of section hashes", db},
+		{"fixture", "[-size SIZE] [-align SIZE] [-depth N] [-fanout N] [-seed N] prefix", "generate a synthetic flashmap, image and section hashes for integration tests", fixture},
+		{"version", "[-format text|json]", "print version and capabilities", printVersion},
+	}
+}
+
+// findCommand returns the subcommand with the given name, if any.
+func findCommand(name string) (command, bool) {
+	for _, cmd := range commands {
+		if cmd.name == name {
+			return cmd, true
+		}
+	}
+	return command{}, false
+}
+
+// newFlagSet returns a flag set for a subcommand, with a usage message built
+// from the command description.
+func newFlagSet(cmd command) *flag.FlagSet {
+	fs := flag.NewFlagSet(cmd.name, flag.ExitOnError)
+	fs.Usage = func() {
+		fmt.Fprintf(fs.Output(), "Usage: %s %s %s\n\n%s\n\n", os.Args[0], cmd.name, cmd.args, cmd.help)
+		fs.PrintDefaults()
+	}
+	return fs
+}
+
 func main() {
 	flag.Usage = func() {
 		fmt.Printf("Usage: %s [file]\n", os.Args[0])
+		fmt.Printf("       %s <command> [arguments]\n\n", os.Args[0])
+		fmt.Printf("Without a command, run an example transformation on the given flashmap.\n\n")
+		fmt.Printf("Commands:\n")
+		for _, cmd := range commands {
+			fmt.Printf("  %-14s %s\n", cmd.name, cmd.help)
+		}
+		fmt.Println()
+		fmt.Printf("Images can be local paths or URLs: file://, http://, https://, s3://, gs://,\n")
+		fmt.Printf("or flashrom://PROGRAMMER to read and write a flash chip with flashrom.\n\n")
 		flag.PrintDefaults()
 	}
+	flag.Var(defineFlag(parseOptions.Defines), "D", "define a constant for the flashmap files, as NAME=VALUE. Can be repeated")
+	flag.BoolVar(&allowRO, "allow-ro", false, "allow the commands to modify read-only sections, like WP_RO and its sub-sections")
+	flag.BoolVar(&stamp, "stamp", false, "write the version of the tool and the hashes of the input files at the start of the output flashmaps")
+	flag.BoolVar(&stampTime, "stamp-time", false, "also write the current time in the stamp, making the output not reproducible unless -reproducible is passed")
+	flag.BoolVar(&reproducible, "reproducible", false, "make the output depend only on the inputs, for reproducible builds: use SOURCE_DATE_EPOCH, if set, as the current time, and only the base names of the input files in stamps")
+	flag.Var(modeFlag{&parseOptions.Mode}, "parse-mode", "tolerance for duplicate names, overlapping sections and an omitted root size in the flashmap files: default, strict, rejecting them, or lenient, logging them as warnings")
+	flag.BoolVar(&parseOptions.Lossless, "lossless", false, "write numbers of the flashmap files in the base and unit they are written in")
 	flag.Parse()
+	if reproducible {
+		if err := parseSourceDate(); err != nil {
+			log.Fatal(err)
+		}
+	}
+	if cmd, ok := findCommand(flag.Arg(0)); ok {
+		if err := cmd.run(newFlagSet(cmd), flag.Args()[1:]); err != nil {
+			log.Fatal(err)
+		}
+		return
+	}
 	infile := "-"
 	if len(flag.Args()) > 0 {
 		infile = flag.Arg(0)
 	}
+	example(infile)
+}
+
+// example runs an example transformation on the flashmap in `infile`: it
+// removes RW_SECTION_B and gives the freed space to COREBOOT.
+func example(infile string) {
 	var (
 		fd  *os.File
 		err error
@@ -33,7 +140,7 @@ func main() {
 		}
 		defer fd.Close()
 	}
-	flash, err := fmap.Parse(fd)
+	flash, err := fmap.ParseWithOptions(fd, parseOptions)
 	if err != nil {
 		log.Fatal(err)
 	}
@@ -48,36 +155,14 @@ func main() {
 		log.Fatal("No SI_BIOS section found")
 	}
 
-	// after removing RW_SECTION_B, the COREBOOT section will be increased by
-	// this size
-	freeSpaceSize := biosSec.Size
-	if biosSec.Remove("RW_SECTION_B", false) {
-		log.Print("Removed RW_SECTION_B.")
-	} else {
-		log.Fatal("Could not find and remove RW_SECTION_B")
-	}
-
-	log.Print("Compacting BIOS sub-sections")
-	if biosSec.Defrag() {
-		log.Print("Successfully defragmented BIOS section")
-	}
-
-	log.Printf("Expanding WP_RO->RO_SECTION->COREBOOT by 0x%x", freeSpaceSize)
-	wpRO := biosSec.Sections[len(biosSec.Sections)-1]
-	if wpRO.Name != "WP_RO" {
-		log.Fatalf("Name is not WP_RO: got %s", wpRO.Name)
-	}
-	wpRO.Size += freeSpaceSize
-	roSection := wpRO.Sections[len(wpRO.Sections)-1]
-	if roSection.Name != "RO_SECTION" {
-		log.Fatalf("Name is not RO_SECTION: got %s", roSection.Name)
+	log.Print("Removing RW_SECTION_B and giving its space to WP_RO->RO_SECTION->COREBOOT")
+	violations, err := biosSec.RemoveAndAbsorb("RW_SECTION_B", "WP_RO/RO_SECTION/COREBOOT")
+	if err != nil {
+		log.Fatal(err)
 	}
-	roSection.Size += freeSpaceSize
-	payload := roSection.Sections[len(roSection.Sections)-1]
-	if payload.Name != "COREBOOT" {
-		log.Fatalf("Name is not COREBOOT: got %s", payload.Name)
+	for _, v := range violations {
+		log.Printf("%s: %v", v.Severity, v)
 	}
-	payload.Size += freeSpaceSize
 
 	log.Print("===================== AFTER =====================")
 	fmt.Println(flash.ToFlashmap())
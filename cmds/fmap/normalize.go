@@ -0,0 +1,50 @@
+package main
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"io/ioutil"
+	"log"
+
+	"github.com/insomniacslk/fmap/pkg/fmap"
+)
+
+// normalize covers the gaps of a flashmap with placeholder sections, or
+// removes the free regions with -strip, and prints the result.
+func normalize(fs *flag.FlagSet, args []string) error {
+	strip := fs.Bool("strip", false, "remove the free regions, like UNUSED_0, instead of adding them")
+	output := fs.String("o", "", "file to write the resulting flashmap to. If empty, write to standard output")
+	_ = fs.Parse(args)
+	if fs.NArg() != 1 {
+		fs.Usage()
+		return errors.New("expected exactly one flashmap file")
+	}
+
+	flash, err := parseLayout(fs.Arg(0))
+	if err != nil {
+		return err
+	}
+	var secs []*fmap.Section
+	if *strip {
+		secs, err = flash.StripUnused()
+	} else {
+		secs, err = flash.MaterializeGaps(nil)
+	}
+	if err != nil {
+		return err
+	}
+	for _, sec := range secs {
+		log.Printf("  %s (0x%x bytes)", sec.Name, sec.ByteSize())
+	}
+	if *strip {
+		log.Printf("%d free regions removed", len(secs))
+	} else {
+		log.Printf("%d gaps covered", len(secs))
+	}
+	if *output == "" {
+		fmt.Print(formatLayout(flash))
+		return nil
+	}
+	return ioutil.WriteFile(*output, []byte(formatLayout(flash)), 0644)
+}
@@ -0,0 +1,34 @@
+package main
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"log"
+)
+
+// overlay applies an overlay flashmap onto a base flashmap, and prints the
+// result.
+func overlay(fs *flag.FlagSet, args []string) error {
+	_ = fs.Parse(args)
+	if fs.NArg() != 2 {
+		fs.Usage()
+		return errors.New("expected a base and an override flashmap file")
+	}
+	base, err := parseLayout(fs.Arg(0))
+	if err != nil {
+		return err
+	}
+	override, err := parseLayout(fs.Arg(1))
+	if err != nil {
+		return err
+	}
+	if err := base.Overlay(override); err != nil {
+		return err
+	}
+	for _, v := range base.Validate() {
+		log.Printf("%s: %v", v.Severity, v)
+	}
+	fmt.Print(formatLayout(base))
+	return nil
+}
@@ -0,0 +1,91 @@
+package main
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/insomniacslk/fmap/pkg/fmap"
+)
+
+// readPaths reads the section paths listed in the file at `path`, one per
+// line, skipping empty lines.
+func readPaths(path string) ([]string, error) {
+	fd, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer fd.Close()
+	var paths []string
+	scanner := bufio.NewScanner(fd)
+	for scanner.Scan() {
+		if line := strings.TrimSpace(scanner.Text()); line != "" {
+			paths = append(paths, line)
+		}
+	}
+	return paths, scanner.Err()
+}
+
+// owners reports the owners that must approve the changes between two
+// flashmaps, or the changes to the sections listed with -paths.
+func owners(fs *flag.FlagSet, args []string) error {
+	pathsFile := fs.String("paths", "", "file listing the changed section paths, one per line, e.g. FLASH/RW_SECTION_A. If set, only the old flashmap is expected")
+	strict := fs.Bool("strict", false, "fail if a changed section has no owner")
+	asJSON := fs.Bool("json", false, "print the approvals as JSON")
+	_ = fs.Parse(args)
+	if (*pathsFile == "" && fs.NArg() != 2) || (*pathsFile != "" && fs.NArg() != 1) {
+		fs.Usage()
+		return errors.New("expected two flashmap files, or one with -paths")
+	}
+
+	// the owners of the old flashmap approve the changes, so that a change
+	// cannot approve itself by editing the owners
+	old, err := parseLayout(fs.Arg(0))
+	if err != nil {
+		return err
+	}
+	var paths []string
+	if *pathsFile != "" {
+		if paths, err = readPaths(*pathsFile); err != nil {
+			return err
+		}
+	} else {
+		updated, err := parseLayout(fs.Arg(1))
+		if err != nil {
+			return err
+		}
+		paths = fmap.ChangedPaths(fmap.Diff(old, updated))
+	}
+	approvals, unowned := old.Approvals(paths)
+	if *asJSON {
+		if approvals == nil {
+			approvals = []fmap.Approval{}
+		}
+		if unowned == nil {
+			unowned = []string{}
+		}
+		enc := json.NewEncoder(os.Stdout)
+		enc.SetIndent("", "  ")
+		if err := enc.Encode(struct {
+			Approvals []fmap.Approval `json:"approvals"`
+			Unowned   []string        `json:"unowned"`
+		}{approvals, unowned}); err != nil {
+			return err
+		}
+	} else {
+		for _, a := range approvals {
+			fmt.Println(a)
+		}
+		if len(unowned) > 0 {
+			fmt.Printf("(no owner): %s\n", strings.Join(unowned, ", "))
+		}
+	}
+	if *strict && len(unowned) > 0 {
+		return fmt.Errorf("%d changed sections have no owner", len(unowned))
+	}
+	return nil
+}
@@ -0,0 +1,386 @@
+package main
+
+import (
+	"crypto"
+	"crypto/ed25519"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"encoding/pem"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"log"
+	"os"
+	"strings"
+
+	"github.com/insomniacslk/fmap/pkg/fmap"
+	"gopkg.in/yaml.v2"
+)
+
+// releaseRules are the release requirements of a layout, read from the YAML
+// file passed to release-check with -rules, e.g.
+//
+//	required: [FMAP, GBB, COREBOOT]
+//	frozen: [WP_RO]
+//	budgets:
+//	  - section: COREBOOT
+//	    max_size: 4M
+//	    min_free: 64K
+//	  - section: RW_SECTION_A
+//	    max_growth: 128K
+type releaseRules struct {
+	// Required are the sections the layout must have.
+	Required []string `yaml:"required"`
+	// Frozen are the sections that must not change, with their
+	// sub-sections, compared to the baseline.
+	Frozen  []string     `yaml:"frozen"`
+	Budgets []budgetRule `yaml:"budgets"`
+}
+
+// budgetRule limits the size of a section. Sizes are in bytes, with an
+// optional unit, see parseSize, and are not checked if empty.
+type budgetRule struct {
+	Section string `yaml:"section"`
+	MaxSize string `yaml:"max_size"`
+	// MinFree is the minimum space of the section not covered by
+	// sub-sections, or by free regions, see fmap.Section.FreeSpace.
+	MinFree string `yaml:"min_free"`
+	// MaxGrowth is how much the section can grow compared to the baseline.
+	MaxGrowth string `yaml:"max_growth"`
+}
+
+// readRules reads the release rules in the YAML file at `path`.
+func readRules(path string) (*releaseRules, error) {
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var rules releaseRules
+	if err := yaml.UnmarshalStrict(data, &rules); err != nil {
+		return nil, fmt.Errorf("%s: %v", path, err)
+	}
+	return &rules, nil
+}
+
+// releaseCheck is the result of a step of release-check.
+type releaseCheck struct {
+	Name     string   `json:"name"`
+	Pass     bool     `json:"pass"`
+	Messages []string `json:"messages,omitempty"`
+}
+
+// failf records a failure of the check.
+func (c *releaseCheck) failf(format string, args ...interface{}) {
+	c.Pass = false
+	c.Messages = append(c.Messages, fmt.Sprintf(format, args...))
+}
+
+// notef records a message that does not make the check fail.
+func (c *releaseCheck) notef(format string, args ...interface{}) {
+	c.Messages = append(c.Messages, fmt.Sprintf(format, args...))
+}
+
+// releaseManifest describes the released image.
+type releaseManifest struct {
+	// Layout is the summary of the layout, see fmap.Summary.
+	Layout      string             `json:"layout"`
+	Fingerprint string             `json:"fingerprint"`
+	ImageSHA256 string             `json:"image_sha256"`
+	Sections    []fmap.SectionHash `json:"sections"`
+}
+
+// releaseReport is the artifact written by release-check.
+type releaseReport struct {
+	Pass     bool             `json:"pass"`
+	Checks   []*releaseCheck  `json:"checks"`
+	Manifest *releaseManifest `json:"manifest,omitempty"`
+	// Signature is the base64 signature of the JSON encoding of the
+	// manifest, made with the key passed with -key.
+	Signature string `json:"signature,omitempty"`
+}
+
+// checkValidation validates the structure of the layout.
+func checkValidation(flash *fmap.Section) *releaseCheck {
+	c := &releaseCheck{Name: "validate", Pass: true}
+	for _, v := range flash.Validate() {
+		if v.Severity == fmap.SeverityError {
+			c.failf("%v", v)
+		} else {
+			c.notef("%s: %v", v.Severity, v)
+		}
+	}
+	return c
+}
+
+// checkRules checks the required sections and the budgets of the rules, the
+// growths against `baseline` if not nil.
+func checkRules(flash, baseline *fmap.Section, rules *releaseRules) *releaseCheck {
+	c := &releaseCheck{Name: "rules", Pass: true}
+	for _, name := range rules.Required {
+		if _, err := flash.Lookup(name, true); err != nil {
+			c.failf("required section %s is missing", name)
+		}
+	}
+	for _, b := range rules.Budgets {
+		sec, err := flash.Lookup(b.Section, true)
+		if err != nil {
+			c.failf("budget for %s: %v", b.Section, err)
+			continue
+		}
+		if b.MaxSize != "" {
+			maxSize, err := parseSize(b.MaxSize)
+			if err != nil {
+				c.failf("budget for %s: max_size: %v", b.Section, err)
+			} else if sec.ByteSize() > maxSize {
+				c.failf("%s is 0x%x bytes, over its budget of 0x%x bytes", b.Section, sec.ByteSize(), maxSize)
+			}
+		}
+		if b.MinFree != "" {
+			minFree, err := parseSize(b.MinFree)
+			if err != nil {
+				c.failf("budget for %s: min_free: %v", b.Section, err)
+			} else if sec.FreeSpace() < minFree {
+				c.failf("%s has 0x%x free bytes, less than the required 0x%x bytes", b.Section, sec.FreeSpace(), minFree)
+			}
+		}
+		if b.MaxGrowth != "" {
+			maxGrowth, err := parseSize(b.MaxGrowth)
+			if err != nil {
+				c.failf("budget for %s: max_growth: %v", b.Section, err)
+				continue
+			}
+			if baseline == nil {
+				c.failf("budget for %s: max_growth requires a baseline", b.Section)
+				continue
+			}
+			old, err := baseline.Lookup(b.Section, true)
+			if err != nil {
+				c.notef("%s is not in the baseline, skipping max_growth", b.Section)
+				continue
+			}
+			if growth := sec.ByteSize() - old.ByteSize(); growth > maxGrowth {
+				c.failf("%s grew by 0x%x bytes since the baseline, more than the allowed 0x%x bytes", b.Section, growth, maxGrowth)
+			}
+		}
+	}
+	return c
+}
+
+// checkBaseline reports the changes since `baseline`, and fails if any
+// frozen section or any of its sub-sections changed.
+func checkBaseline(flash, baseline *fmap.Section, frozen []string) *releaseCheck {
+	c := &releaseCheck{Name: "baseline", Pass: true}
+	var frozenPaths []string
+	for _, name := range frozen {
+		sec, err := baseline.Lookup(name, true)
+		if err != nil {
+			c.failf("frozen section %s is not in the baseline", name)
+			continue
+		}
+		frozenPaths = append(frozenPaths, sec.Path())
+	}
+	for _, change := range fmap.Diff(baseline, flash) {
+		isFrozen := false
+		for _, p := range frozenPaths {
+			if change.Path == p || strings.HasPrefix(change.Path, p+"/") {
+				isFrozen = true
+				break
+			}
+		}
+		if isFrozen {
+			c.failf("frozen section changed: %v", change)
+		} else {
+			c.notef("%v", change)
+		}
+	}
+	return c
+}
+
+// checkImage checks that the image matches the layout: that it has the size
+// of the flash, and that the areas of its binary FMAP have the ranges of the
+// sections with the same names.
+func checkImage(flash *fmap.Section, image fmap.Image) *releaseCheck {
+	c := &releaseCheck{Name: "image", Pass: true}
+	size, err := image.Size()
+	if err != nil {
+		c.failf("%v", err)
+		return c
+	}
+	if size != flash.ByteSize() {
+		c.failf("%s is 0x%x bytes, but the layout describes 0x%x bytes", image.Name(), size, flash.ByteSize())
+	}
+	var names []string
+	for _, sec := range allSections(flash) {
+		names = append(names, sec.Name)
+	}
+	lookups, err := flash.SimulateBootLookup(image, names)
+	if err != nil {
+		c.failf("%v", err)
+		return c
+	}
+	for _, l := range lookups {
+		if !l.OK() {
+			c.failf("%v", l)
+		}
+	}
+	return c
+}
+
+// imageManifest returns the manifest of the image described by `flash`.
+func imageManifest(flash *fmap.Section, image fmap.Image) (*releaseManifest, error) {
+	size, err := image.Size()
+	if err != nil {
+		return nil, err
+	}
+	h := sha256.New()
+	if _, err := io.Copy(h, io.NewSectionReader(image, 0, size)); err != nil {
+		return nil, err
+	}
+	report, err := flash.Hash(image)
+	if err != nil {
+		return nil, err
+	}
+	sm := flash.Summary()
+	return &releaseManifest{
+		Layout:      sm.String(),
+		Fingerprint: sm.Fingerprint,
+		ImageSHA256: hex.EncodeToString(h.Sum(nil)),
+		Sections:    report.Sections,
+	}, nil
+}
+
+// signManifest signs the JSON encoding of the manifest with the PKCS #8
+// private key in the PEM file at `keyPath`, e.g. an Ed25519 key generated
+// with `openssl genpkey -algorithm ed25519`.
+func signManifest(m *releaseManifest, keyPath string) (string, error) {
+	data, err := ioutil.ReadFile(keyPath)
+	if err != nil {
+		return "", err
+	}
+	block, _ := pem.Decode(data)
+	if block == nil {
+		return "", fmt.Errorf("%s: no PEM data found", keyPath)
+	}
+	key, err := x509.ParsePKCS8PrivateKey(block.Bytes)
+	if err != nil {
+		return "", fmt.Errorf("%s: %v", keyPath, err)
+	}
+	signer, ok := key.(crypto.Signer)
+	if !ok {
+		return "", fmt.Errorf("%s: unsupported key type %T", keyPath, key)
+	}
+	msg, err := json.Marshal(m)
+	if err != nil {
+		return "", err
+	}
+	// Ed25519 signs the message itself, the other algorithms its hash
+	digest, opts := msg, crypto.SignerOpts(crypto.Hash(0))
+	if _, ok := key.(ed25519.PrivateKey); !ok {
+		sum := sha256.Sum256(msg)
+		digest, opts = sum[:], crypto.SHA256
+	}
+	sig, err := signer.Sign(rand.Reader, digest, opts)
+	if err != nil {
+		return "", err
+	}
+	return base64.StdEncoding.EncodeToString(sig), nil
+}
+
+// releaseCheckCmd runs all the release checks of a layout and of its image,
+// and writes a single report with the result and the manifest of the image.
+func releaseCheckCmd(fs *flag.FlagSet, args []string) error {
+	layout := fs.String("layout", "", "flashmap file of the release (required)")
+	imagePath := fs.String("image", "", "flash image of the release. If empty, the image checks and the manifest are skipped")
+	rulesPath := fs.String("rules", "", "YAML file with the required sections, the frozen sections and the size budgets")
+	baselinePath := fs.String("baseline", "", "flashmap file of the previous release, to compare the layout against")
+	keyPath := fs.String("key", "", "PEM file with a PKCS #8 private key to sign the manifest with")
+	output := fs.String("o", "", "file to write the JSON report to. If empty, write to standard output")
+	_ = fs.Parse(args)
+	if fs.NArg() != 0 || *layout == "" {
+		fs.Usage()
+		return errors.New("expected a layout and no arguments")
+	}
+	if *keyPath != "" && *imagePath == "" {
+		return errors.New("-key requires an image to sign the manifest of")
+	}
+
+	flash, err := parseLayout(*layout)
+	if err != nil {
+		return err
+	}
+	var baseline *fmap.Section
+	if *baselinePath != "" {
+		if baseline, err = parseLayout(*baselinePath); err != nil {
+			return err
+		}
+	}
+	report := releaseReport{Checks: []*releaseCheck{checkValidation(flash)}}
+	if *rulesPath != "" {
+		rules, err := readRules(*rulesPath)
+		if err != nil {
+			return err
+		}
+		report.Checks = append(report.Checks, checkRules(flash, baseline, rules))
+		if baseline != nil {
+			report.Checks = append(report.Checks, checkBaseline(flash, baseline, rules.Frozen))
+		}
+	} else if baseline != nil {
+		report.Checks = append(report.Checks, checkBaseline(flash, baseline, nil))
+	}
+	if *imagePath != "" {
+		image, err := fmap.OpenImage(*imagePath, false)
+		if err != nil {
+			return err
+		}
+		defer image.Close()
+		report.Checks = append(report.Checks, checkImage(flash, image))
+		c := &releaseCheck{Name: "manifest", Pass: true}
+		if report.Manifest, err = imageManifest(flash, image); err != nil {
+			c.failf("%v", err)
+		} else if *keyPath != "" {
+			if report.Signature, err = signManifest(report.Manifest, *keyPath); err != nil {
+				return err
+			}
+			c.notef("signed with %s", *keyPath)
+		}
+		report.Checks = append(report.Checks, c)
+	}
+
+	report.Pass = true
+	failed := 0
+	for _, c := range report.Checks {
+		status := "pass"
+		if !c.Pass {
+			status = "FAIL"
+			report.Pass = false
+			failed++
+		}
+		log.Printf("%s: %s", c.Name, status)
+		for _, msg := range c.Messages {
+			log.Printf("  %s", msg)
+		}
+	}
+	data, err := json.MarshalIndent(report, "", "  ")
+	if err != nil {
+		return err
+	}
+	data = append(data, '\n')
+	if *output == "" {
+		_, err = os.Stdout.Write(data)
+	} else {
+		err = ioutil.WriteFile(*output, data, 0644)
+	}
+	if err != nil {
+		return err
+	}
+	if failed > 0 {
+		return fmt.Errorf("release check failed: %d of %d checks failed", failed, len(report.Checks))
+	}
+	return nil
+}
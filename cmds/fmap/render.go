@@ -0,0 +1,39 @@
+package main
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"io/ioutil"
+)
+
+// render draws a flashmap as a proportional flash bar, in SVG or in a
+// standalone HTML page.
+func render(fs *flag.FlagSet, args []string) error {
+	format := fs.String("format", "svg", "output format: svg or html")
+	output := fs.String("o", "", "file to write the picture to. If empty, write to standard output")
+	_ = fs.Parse(args)
+	if fs.NArg() != 1 {
+		fs.Usage()
+		return errors.New("expected exactly one flashmap file")
+	}
+
+	flash, err := parseLayout(fs.Arg(0))
+	if err != nil {
+		return err
+	}
+	var out string
+	switch *format {
+	case "svg":
+		out = flash.ToSVG()
+	case "html":
+		out = flash.ToHTML()
+	default:
+		return fmt.Errorf("unknown format %q", *format)
+	}
+	if *output == "" {
+		fmt.Print(out)
+		return nil
+	}
+	return ioutil.WriteFile(*output, []byte(out), 0644)
+}
@@ -0,0 +1,58 @@
+package main
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"io/ioutil"
+	"log"
+
+	"github.com/insomniacslk/fmap/pkg/fmap"
+)
+
+// scale rewrites a flashmap for a flash of another size, and prints the
+// result.
+func scale(fs *flag.FlagSet, args []string) error {
+	newSize := fs.String("size", "", "size of the new flash, e.g. 32M (required)")
+	var flexible sectionsFlag
+	fs.Var(&flexible, "flexible", "name, or shell pattern, of a section that absorbs the difference of size. Can be repeated. If omitted, the free regions, the FREE sections and the CBFS ones")
+	align := fs.String("align", "0", "round the share of every flexible section down to a multiple of this many bytes, e.g. 4K")
+	output := fs.String("o", "", "file to write the resulting flashmap to. If empty, write to standard output")
+	_ = fs.Parse(args)
+	if fs.NArg() != 1 || *newSize == "" {
+		fs.Usage()
+		return errors.New("expected a flashmap file and a size")
+	}
+	n, err := parseSize(*newSize)
+	if err != nil {
+		return err
+	}
+	policy := fmap.ScalePolicy{Flexible: flexible}
+	if policy.Align, err = parseSize(*align); err != nil {
+		return err
+	}
+
+	flash, err := parseLayout(fs.Arg(0))
+	if err != nil {
+		return err
+	}
+	violations, err := flash.Scale(n, policy)
+	if err != nil {
+		return err
+	}
+	failed := false
+	for _, v := range violations {
+		log.Printf("%s: %v", v.Severity, v)
+		if v.Severity == fmap.SeverityError {
+			failed = true
+		}
+	}
+	if failed {
+		return errors.New("the scaled layout is not valid")
+	}
+	if *output == "" {
+		fmt.Print(formatLayout(flash))
+		return nil
+	}
+	return ioutil.WriteFile(*output, []byte(formatLayout(flash)), 0644)
+}
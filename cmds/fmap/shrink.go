@@ -0,0 +1,95 @@
+package main
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"io/ioutil"
+	"log"
+	"strings"
+
+	"github.com/insomniacslk/fmap/pkg/fmap"
+)
+
+// sectionsFlag is a flag.Value collecting section names.
+type sectionsFlag []string
+
+func (s *sectionsFlag) String() string {
+	return strings.Join(*s, " ")
+}
+
+func (s *sectionsFlag) Set(name string) error {
+	*s = append(*s, name)
+	return nil
+}
+
+// shrink measures the trailing erased space of sections of a flash image, and
+// prints the shrinks that would reclaim it, or applies them and prints the
+// resulting flashmap.
+func shrink(fs *flag.FlagSet, args []string) error {
+	var sections sectionsFlag
+	fs.Var(&sections, "section", "name of a section to shrink. Can be repeated. If omitted, consider all the leaf sections that can be modified")
+	layout := fs.String("layout", "", "flashmap file describing the image. If empty, use the FMAP embedded in the image")
+	headroom := fs.String("headroom", "0", "bytes added to the size of the content of every section")
+	align := fs.String("align", "0", "round the sizes up to a multiple of this many bytes")
+	apply := fs.Bool("apply", false, "apply the shrinks and print the resulting flashmap")
+	output := fs.String("o", "", "file to write the resulting flashmap to with -apply. If empty, write to standard output")
+	_ = fs.Parse(args)
+	if fs.NArg() != 1 {
+		fs.Usage()
+		return errors.New("expected exactly one image file")
+	}
+	opts, err := parseFitOptions(*headroom, *align)
+	if err != nil {
+		return err
+	}
+
+	image, err := fmap.OpenImage(fs.Arg(0), false)
+	if err != nil {
+		return err
+	}
+	defer image.Close()
+	flash, err := imageLayout(*layout, image)
+	if err != nil {
+		return err
+	}
+	if len(sections) == 0 {
+		for _, sec := range allSections(flash) {
+			if len(sec.Sections) == 0 && (allowRO || !sec.IsReadOnly()) {
+				sections = append(sections, sec.Name)
+			}
+		}
+	}
+	shrinks, err := flash.ProposeShrinks(image, sections, opts)
+	if err != nil {
+		return err
+	}
+	total := int64(0)
+	for _, sh := range shrinks {
+		log.Print(sh)
+		total += sh.Reclaimed()
+	}
+	log.Printf("%d sections can be shrunk, reclaiming 0x%x bytes", len(shrinks), total)
+	if !*apply {
+		return nil
+	}
+	violations, err := flash.ApplyShrinks(shrinks)
+	if err != nil {
+		return err
+	}
+	failed := false
+	for _, v := range violations {
+		log.Printf("%s: %v", v.Severity, v)
+		if v.Severity == fmap.SeverityError {
+			failed = true
+		}
+	}
+	if failed {
+		return errors.New("the shrunk layout is not valid")
+	}
+	if *output == "" {
+		fmt.Print(formatLayout(flash))
+		return nil
+	}
+	return ioutil.WriteFile(*output, []byte(formatLayout(flash)), 0644)
+}
@@ -0,0 +1,104 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+	"text/tabwriter"
+
+	"github.com/insomniacslk/fmap/pkg/fmap"
+)
+
+// parseSize parses a size in bytes, with an optional k/K or m/M unit as in
+// flashmap files, e.g. "64K".
+func parseSize(s string) (int64, error) {
+	mult := int64(1)
+	switch {
+	case strings.HasSuffix(s, "k"), strings.HasSuffix(s, "K"):
+		mult, s = 1024, s[:len(s)-1]
+	case strings.HasSuffix(s, "m"), strings.HasSuffix(s, "M"):
+		mult, s = 1024*1024, s[:len(s)-1]
+	}
+	n, err := strconv.ParseInt(s, 0, 64)
+	if err != nil || n < 0 || n > (1<<62)/mult {
+		return 0, fmt.Errorf("invalid size %q", s)
+	}
+	return n * mult, nil
+}
+
+// gapJSON is a gap in the JSON output of stats.
+type gapJSON struct {
+	Path     string `json:"path"`
+	Offset   int64  `json:"offset"`
+	Absolute int64  `json:"absolute"`
+	Size     int64  `json:"size"`
+	Unused   string `json:"unused,omitempty"`
+}
+
+// stats prints the utilization of the sections of a flashmap, and its free
+// space.
+func stats(fs *flag.FlagSet, args []string) error {
+	minSize := fs.String("min", "0", "only print the gaps of at least this size, e.g. 64K")
+	asJSON := fs.Bool("json", false, "print the statistics as JSON")
+	_ = fs.Parse(args)
+	if fs.NArg() != 1 {
+		fs.Usage()
+		return errors.New("expected exactly one flashmap file")
+	}
+	minBytes, err := parseSize(*minSize)
+	if err != nil {
+		return err
+	}
+
+	flash, err := parseLayout(fs.Arg(0))
+	if err != nil {
+		return err
+	}
+	sections := flash.Stats()
+	var gaps []fmap.Gap
+	for _, g := range flash.Gaps() {
+		if g.Size >= minBytes {
+			gaps = append(gaps, g)
+		}
+	}
+	if *asJSON {
+		out := struct {
+			Sections []fmap.SectionStats `json:"sections"`
+			Gaps     []gapJSON           `json:"gaps"`
+		}{Sections: sections, Gaps: []gapJSON{}}
+		for _, g := range gaps {
+			gj := gapJSON{Path: g.Parent.Path(), Offset: g.Offset, Absolute: g.Absolute, Size: g.Size}
+			if g.Unused != nil {
+				gj.Unused = g.Unused.Name
+			}
+			out.Gaps = append(out.Gaps, gj)
+		}
+		enc := json.NewEncoder(os.Stdout)
+		enc.SetIndent("", "  ")
+		return enc.Encode(out)
+	}
+
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, strings.Join([]string{"SECTION", "OFFSET", "SIZE", "USED", "FREE", "%USED", "%PARENT"}, "\t"))
+	for _, st := range sections {
+		name := st.Path[strings.LastIndex(st.Path, "/")+1:]
+		fmt.Fprintf(w, "%s%s\t0x%x\t0x%x\t0x%x\t0x%x\t%.1f\t%.1f\n", strings.Repeat("  ", st.Depth), name, st.Offset, st.Size, st.Used, st.Free, st.PercentUsed(), st.PercentOfParent)
+	}
+	if err := w.Flush(); err != nil {
+		return err
+	}
+	total := sections[0]
+	fmt.Printf("Total: 0x%x bytes, 0x%x used (%.1f%%), 0x%x free, %d sections\n", total.Size, total.Used, total.PercentUsed(), total.Free, len(sections)-1)
+	fmt.Println("Gaps:")
+	for _, g := range gaps {
+		fmt.Printf("  %s\n", g)
+	}
+	if len(gaps) == 0 {
+		fmt.Println("  none")
+	}
+	return nil
+}
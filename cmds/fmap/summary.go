@@ -0,0 +1,22 @@
+package main
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+)
+
+// summary prints a one-line summary of a flashmap.
+func summary(fs *flag.FlagSet, args []string) error {
+	_ = fs.Parse(args)
+	if fs.NArg() != 1 {
+		fs.Usage()
+		return errors.New("expected exactly one flashmap file")
+	}
+	flash, err := parseLayout(fs.Arg(0))
+	if err != nil {
+		return err
+	}
+	fmt.Println(flash.Summary())
+	return nil
+}
@@ -0,0 +1,113 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+
+	"github.com/insomniacslk/fmap/pkg/fmap"
+)
+
+// violationJSON is a violation in the JSON output of validate and lint.
+type violationJSON struct {
+	// Rule is the name of the lint rule, see fmap.LintRule.
+	Rule     string `json:"rule,omitempty"`
+	Severity string `json:"severity"`
+	Path     string `json:"path"`
+	Message  string `json:"message"`
+	// Span is the location of the section in the flashmap file, if known.
+	Span string `json:"span,omitempty"`
+}
+
+// String returns the violation in the form of fmap.Violation.Error, prefixed
+// with the rule, if any.
+func (v violationJSON) String() string {
+	s := v.Path
+	if v.Span != "" {
+		s += " (" + v.Span + ")"
+	}
+	s += ": " + v.Message
+	if v.Rule != "" {
+		s = v.Rule + ": " + s
+	}
+	return s
+}
+
+// toViolationJSON returns the JSON representation of a violation.
+func toViolationJSON(v fmap.Violation) violationJSON {
+	vj := violationJSON{Severity: v.Severity.String(), Path: v.Path, Message: v.Message}
+	if sp := v.Section.Span(); sp.IsValid() {
+		vj.Span = sp.String()
+	}
+	return vj
+}
+
+// printViolations prints the violations as text, or as JSON if `asJSON` is
+// true, and returns an error if any of them is an error.
+func printViolations(violations []violationJSON, asJSON bool) error {
+	errs := 0
+	for _, v := range violations {
+		if v.Severity == fmap.SeverityError.String() {
+			errs++
+		}
+	}
+	if asJSON {
+		if violations == nil {
+			violations = []violationJSON{}
+		}
+		enc := json.NewEncoder(os.Stdout)
+		enc.SetIndent("", "  ")
+		if err := enc.Encode(violations); err != nil {
+			return err
+		}
+	} else {
+		for _, v := range violations {
+			fmt.Printf("%s: %s\n", v.Severity, v)
+		}
+	}
+	if errs > 0 {
+		return fmt.Errorf("%d errors, %d warnings", errs, len(violations)-errs)
+	}
+	return nil
+}
+
+// zeroSizePolicies are the values of the -zero-size flag of validate.
+var zeroSizePolicies = map[string]fmap.ZeroSizePolicy{
+	"allow": fmap.ZeroSizeAllow,
+	"warn":  fmap.ZeroSizeWarn,
+	"error": fmap.ZeroSizeError,
+}
+
+// validate runs all the structural checks on a flashmap, and fails if any of
+// them finds an error.
+func validate(fs *flag.FlagSet, args []string) error {
+	align := fs.String("align", "0", "also check that the starts and the sizes of the sections are multiples of this many bytes, e.g. 4K")
+	zeroSize := fs.String("zero-size", "allow", "how to report zero-size sections: allow, warn or error")
+	asJSON := fs.Bool("json", false, "print the findings as JSON")
+	_ = fs.Parse(args)
+	if fs.NArg() != 1 {
+		fs.Usage()
+		return errors.New("expected exactly one flashmap file")
+	}
+	opts := fmap.ValidateOptions{DuplicateNames: true}
+	var err error
+	if opts.Align, err = parseSize(*align); err != nil {
+		return err
+	}
+	var ok bool
+	if opts.ZeroSize, ok = zeroSizePolicies[*zeroSize]; !ok {
+		return fmt.Errorf("invalid zero-size policy %q: must be allow, warn or error", *zeroSize)
+	}
+
+	flash, err := parseLayout(fs.Arg(0))
+	if err != nil {
+		return err
+	}
+	var violations []violationJSON
+	for _, v := range flash.ValidateWith(opts) {
+		violations = append(violations, toViolationJSON(v))
+	}
+	return printViolations(violations, *asJSON)
+}
@@ -0,0 +1,58 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"log"
+	"os"
+
+	"github.com/insomniacslk/fmap/pkg/fmap"
+)
+
+// verify compares a flashmap with the binary FMAP embedded in a flash image.
+func verify(fs *flag.FlagSet, args []string) error {
+	asJSON := fs.Bool("json", false, "print the mismatches as JSON")
+	_ = fs.Parse(args)
+	if fs.NArg() != 2 {
+		fs.Usage()
+		return errors.New("expected a flashmap file and an image file")
+	}
+	flash, err := parseLayout(fs.Arg(0))
+	if err != nil {
+		return err
+	}
+	image, err := fmap.OpenImage(fs.Arg(1), false)
+	if err != nil {
+		return err
+	}
+	defer image.Close()
+	embedded, offset, err := fmap.ScanImage(image)
+	if err != nil {
+		return fmt.Errorf("%s: %v", image.Name(), err)
+	}
+	log.Printf("Found FMAP at offset 0x%x", offset)
+	mismatches, err := flash.VerifyFMAP(embedded)
+	if err != nil {
+		return err
+	}
+	if *asJSON {
+		if mismatches == nil {
+			mismatches = []fmap.FMAPMismatch{}
+		}
+		enc := json.NewEncoder(os.Stdout)
+		enc.SetIndent("", "  ")
+		if err := enc.Encode(mismatches); err != nil {
+			return err
+		}
+	} else {
+		for _, m := range mismatches {
+			fmt.Println(m)
+		}
+	}
+	if len(mismatches) > 0 {
+		return fmt.Errorf("%d mismatches between %s and the FMAP of %s", len(mismatches), fs.Arg(0), image.Name())
+	}
+	return nil
+}
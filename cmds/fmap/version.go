@@ -0,0 +1,79 @@
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"os"
+	"runtime/debug"
+	"strings"
+
+	"github.com/insomniacslk/fmap/pkg/fmap"
+)
+
+// version and commit can be set at build time with
+// -ldflags "-X main.version=... -X main.commit=...". If not set, the version
+// is taken from the build information embedded by the Go toolchain.
+var (
+	version string
+	commit  string
+)
+
+// versionInfo describes the fmap tool and its capabilities.
+type versionInfo struct {
+	Version         string   `json:"version"`
+	Commit          string   `json:"commit"`
+	Formats         []string `json:"formats"`
+	GrammarFeatures []string `json:"grammar_features"`
+	Backends        []string `json:"backends"`
+	Commands        []string `json:"commands"`
+}
+
+// getVersionInfo returns the version information of the fmap tool.
+func getVersionInfo() versionInfo {
+	info := versionInfo{
+		Version:         version,
+		Commit:          commit,
+		Formats:         fmap.Formats,
+		GrammarFeatures: fmap.GrammarFeatures,
+		Backends:        fmap.Backends(),
+	}
+	if bi, ok := debug.ReadBuildInfo(); ok {
+		if info.Version == "" {
+			info.Version = bi.Main.Version
+		}
+	}
+	if info.Version == "" {
+		info.Version = "(devel)"
+	}
+	for _, cmd := range commands {
+		info.Commands = append(info.Commands, cmd.name)
+	}
+	return info
+}
+
+// printVersion prints the version information of the fmap tool.
+func printVersion(fs *flag.FlagSet, args []string) error {
+	format := fs.String("format", "text", "output format: text or json")
+	_ = fs.Parse(args)
+	info := getVersionInfo()
+	switch *format {
+	case "json":
+		enc := json.NewEncoder(os.Stdout)
+		enc.SetIndent("", "  ")
+		return enc.Encode(info)
+	case "text":
+		fmt.Printf("fmap %s", info.Version)
+		if info.Commit != "" {
+			fmt.Printf(" (commit %s)", info.Commit)
+		}
+		fmt.Println()
+		fmt.Printf("formats: %s\n", strings.Join(info.Formats, ", "))
+		fmt.Printf("grammar features: %s\n", strings.Join(info.GrammarFeatures, ", "))
+		fmt.Printf("image backends: %s\n", strings.Join(info.Backends, ", "))
+		fmt.Printf("commands: %s\n", strings.Join(info.Commands, ", "))
+		return nil
+	default:
+		return fmt.Errorf("unknown format %q", *format)
+	}
+}
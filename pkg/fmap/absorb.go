@@ -0,0 +1,76 @@
+package fmap
+
+import (
+	"fmt"
+	"strings"
+)
+
+// childPath returns the chain of sections named by `path`, relative to `s`,
+// made of the names, or aliases, of a sub-section of `s` and of its
+// descendants separated by "/", e.g. "WP_RO/RO_SECTION/COREBOOT". It returns a
+// *NotFoundError if a section does not exist.
+func childPath(s *Section, path string) ([]*Section, error) {
+	var chain []*Section
+	parent := s
+	for _, name := range strings.Split(path, "/") {
+		var found *Section
+		for _, sec := range parent.Sections {
+			if matchNames(sec, func(n string) bool { return n == name }) {
+				found = sec
+				break
+			}
+		}
+		if found == nil {
+			return nil, &NotFoundError{Name: name}
+		}
+		chain = append(chain, found)
+		parent = found
+	}
+	return chain, nil
+}
+
+// RemoveAndAbsorb removes the sub-section `name` of `s`, defragments `s`, and
+// grows the chain of sections `absorber` by the size of the removed section,
+// so that they take the freed space. `absorber` is a sub-section of `s`
+// followed by some of its descendants, separated by "/", e.g.
+// "WP_RO/RO_SECTION/COREBOOT" to give the space of a removed RW section to
+// the CBFS of the RO section. The siblings following a grown section are
+// pushed forward. It returns the violations of the resulting layout, see
+// Validate. A *NotFoundError is returned if a section does not exist, and
+// nothing is changed if any of the sections is protected, see
+// ProtectReadOnly.
+func (s *Section) RemoveAndAbsorb(name, absorber string) ([]Violation, error) {
+	removed, _, _ := findFunc(s, name, false)
+	if removed == nil {
+		return nil, &NotFoundError{Name: name}
+	}
+	chain, err := childPath(s, absorber)
+	if err != nil {
+		return nil, err
+	}
+	if chain[0] == removed {
+		return nil, sectionErrorf(removed, "cannot absorb a section into itself")
+	}
+	op := fmt.Sprintf("RemoveAndAbsorb(%s, %s)", name, absorber)
+	for _, sec := range append([]*Section{removed}, chain...) {
+		if err := checkWritable(sec, op); err != nil {
+			return nil, err
+		}
+	}
+
+	freed := size(removed)
+	pinned := pinProtected(s)
+	if _, err := s.Delete(name, false); err != nil {
+		unpinProtected(pinned)
+		return nil, err
+	}
+	s.Defrag(false)
+	t := s.record(op)
+	for _, sec := range chain {
+		setSize(sec, size(sec)+freed)
+		sec.touch(t)
+	}
+	pushForward(s, t)
+	unpinProtected(pinned)
+	return s.Validate(), nil
+}
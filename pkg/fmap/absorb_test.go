@@ -0,0 +1,70 @@
+package fmap
+
+import (
+	"errors"
+	"os"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestRemoveAndAbsorb(t *testing.T) {
+	fd, err := os.Open("test_data/chromeos.fmd")
+	require.NoError(t, err)
+	f, err := Parse(fd)
+	require.NoError(t, err)
+
+	bios := f.Find("SI_BIOS", false)
+	violations, err := bios.RemoveAndAbsorb("RW_SECTION_B", "WP_RO/RO_SECTION/COREBOOT")
+	require.NoError(t, err)
+	assert.Empty(t, violations)
+	assert.Nil(t, f.Find("RW_SECTION_B", true))
+
+	wpRO := f.Find("WP_RO", true)
+	assert.Equal(t, int64(0x618000), *wpRO.Start)
+	assert.Equal(t, int64(0x7e8000), wpRO.ByteSize())
+	assert.Equal(t, int64(0x7d8000), f.Find("RO_SECTION", true).ByteSize())
+	coreboot := f.Find("COREBOOT", true)
+	assert.Equal(t, int64(0x6e8000), coreboot.ByteSize())
+	assert.Equal(t, "RemoveAndAbsorb(RW_SECTION_B, WP_RO/RO_SECTION/COREBOOT)", coreboot.Provenance()[0].Op)
+	assert.Empty(t, f.Validate())
+}
+
+func TestRemoveAndAbsorbPush(t *testing.T) {
+	f, err := Parse(strings.NewReader("FLASH 0x4000 {\n\tA@0x0 0x1000\n\tB@0x1000 1k\n\tC@0x2000 0x1000\n}"))
+	require.NoError(t, err)
+
+	violations, err := f.RemoveAndAbsorb("C", "B")
+	require.NoError(t, err)
+	assert.Empty(t, violations)
+	assert.Equal(t, "FLASH 0x4000 {\n\tA@0x0 0x1000\n\tB@0x1000 5k\n}\n", f.ToFlashmap())
+
+	f, err = Parse(strings.NewReader("FLASH 0x4000 {\n\tA@0x0 0x1000\n\tB@0x1000 0x1000\n\tC@0x2000 0x1000\n}"))
+	require.NoError(t, err)
+	violations, err = f.RemoveAndAbsorb("A", "B")
+	require.NoError(t, err)
+	assert.Empty(t, violations)
+	assert.Equal(t, "FLASH 0x4000 {\n\tB@0x0 0x2000\n\tC@0x2000 0x1000\n}\n", f.ToFlashmap())
+}
+
+func TestRemoveAndAbsorbErrors(t *testing.T) {
+	fd, err := os.Open("test_data/chromeos.fmd")
+	require.NoError(t, err)
+	f, err := Parse(fd)
+	require.NoError(t, err)
+	bios := f.Find("SI_BIOS", false)
+
+	_, err = bios.RemoveAndAbsorb("NONEXISTING", "WP_RO")
+	require.True(t, errors.Is(err, ErrSectionNotFound))
+	_, err = bios.RemoveAndAbsorb("RW_SECTION_B", "WP_RO/NONEXISTING")
+	require.True(t, errors.Is(err, ErrSectionNotFound))
+	_, err = bios.RemoveAndAbsorb("RW_SECTION_B", "RW_SECTION_B")
+	require.Error(t, err)
+
+	f.ProtectReadOnly(true)
+	_, err = bios.RemoveAndAbsorb("RW_SECTION_B", "WP_RO/RO_SECTION/COREBOOT")
+	require.True(t, errors.Is(err, ErrReadOnly))
+	assert.NotNil(t, f.Find("RW_SECTION_B", true))
+}
@@ -0,0 +1,131 @@
+package fmap
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+)
+
+// AlignChange is a change of the start or of the size of a section made by
+// Align.
+type AlignChange struct {
+	// Path is the path of the section, see Section.Path.
+	Path    string
+	Section *Section
+	// OldStart and NewStart are relative to the parent section.
+	OldStart int64
+	NewStart int64
+	// OldSize and NewSize are in bytes.
+	OldSize int64
+	NewSize int64
+}
+
+// String returns a description of the change.
+func (c AlignChange) String() string {
+	var changes []string
+	if c.OldStart != c.NewStart {
+		changes = append(changes, fmt.Sprintf("start 0x%x -> 0x%x", c.OldStart, c.NewStart))
+	}
+	if c.OldSize != c.NewSize {
+		changes = append(changes, fmt.Sprintf("size 0x%x -> 0x%x", c.OldSize, c.NewSize))
+	}
+	return c.Path + ": " + strings.Join(changes, ", ")
+}
+
+// alignUp rounds `n` up to a multiple of `block`.
+func alignUp(n, block int64) int64 {
+	if r := n % block; r != 0 {
+		return n + block - r
+	}
+	return n
+}
+
+// Align rounds the sections of the tree `s` to the erase block size of the
+// flash, `block`, e.g. 4K or 64K, so that every section can be erased and
+// flashed on its own: the starts, relative to the root, are rounded up, and
+// so are the sizes. The sub-sections of each section are processed by start,
+// and those that would overlap the previous sibling once it is rounded are
+// pushed after it. A section that would then overlap a protected sibling is
+// left as it is. Parents are not grown to fit their sub-sections, and
+// neither is the root. Protected read-only sections, see ProtectReadOnly, and
+// their sub-sections, are not changed, and neither are markers, see IsMarker,
+// which mark a given offset. The sections left misaligned, and those that no
+// longer fit their parent, are reported by ValidateWith with
+// ValidateOptions.Align. The changes are returned in pre-order, and are not
+// applied if `dryRun` is true. An error is returned if `block` is not
+// positive.
+func (s *Section) Align(block int64, dryRun bool) ([]AlignChange, error) {
+	if block <= 0 {
+		return nil, errors.New("the erase block size must be positive")
+	}
+	var (
+		t       Transform
+		changes []AlignChange
+	)
+	alignChildren(s, s.Name, 0, block, dryRun, func() Transform {
+		if t.Step == 0 {
+			t = s.record(fmt.Sprintf("Align(0x%x)", block))
+		}
+		return t
+	}, &changes)
+	return changes, nil
+}
+
+// alignChildren implements Align for the sub-sections of `s`, whose path is
+// `path` and whose start relative to the root is `base` once aligned,
+// recursively, and appends the changes to `changes`.
+func alignChildren(s *Section, path string, base, block int64, dryRun bool, step func() Transform, changes *[]AlignChange) {
+	secs, starts := sortedChildren(s)
+	newStarts := make(map[*Section]int64, len(secs))
+	newSizes := make(map[*Section]int64, len(secs))
+	changed := false
+	end := int64(0)
+	for idx, sec := range secs {
+		start, sz := starts[idx], size(sec)
+		if !sec.IsMarker() && !sec.isProtected() {
+			if start < end {
+				start = end
+			}
+			start = alignUp(base+start, block) - base
+			sz = alignUp(sz, block)
+			// protected siblings can't be pushed, so the section is left
+			// as it is if it would overlap one of them
+			for j, other := range secs {
+				if j != idx && other.isProtected() && !other.IsMarker() && start < starts[j]+size(other) && starts[j] < start+sz {
+					start, sz = starts[idx], size(sec)
+					break
+				}
+			}
+		}
+		if start != starts[idx] || sz != size(sec) {
+			changed = true
+		}
+		newStarts[sec], newSizes[sec] = start, sz
+		if !sec.IsMarker() && start+sz > end {
+			end = start + sz
+		}
+	}
+
+	oldStarts := childStarts(s)
+	for idx, sec := range s.Sections {
+		secPath := path + "/" + sec.Name
+		start, sz := newStarts[sec], newSizes[sec]
+		if start != oldStarts[idx] || sz != size(sec) {
+			*changes = append(*changes, AlignChange{Path: secPath, Section: sec, OldStart: oldStarts[idx], NewStart: start, OldSize: size(sec), NewSize: sz})
+			if !dryRun {
+				if sz != size(sec) {
+					setSize(sec, sz)
+				}
+				sec.touch(step())
+			}
+		}
+		// the starts become explicit, as the previous siblings may move or
+		// grow
+		if changed && !dryRun {
+			sec.Start = &start
+		}
+		if !sec.isProtected() {
+			alignChildren(sec, secPath, base+start, block, dryRun, step, changes)
+		}
+	}
+}
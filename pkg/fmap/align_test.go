@@ -0,0 +1,108 @@
+package fmap
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+const misalignedLayout = `FLASH 0x10000 {
+	A 0x800
+	B 0x1800 {
+		B1@0x100 0x100
+	}
+	MARK@0x2100 0
+	C@0x3000 4k
+	D@0x5000 0x1000
+}`
+
+func TestAlign(t *testing.T) {
+	f, err := ParseString(misalignedLayout)
+	require.NoError(t, err)
+	before := f.ToFlashmap()
+
+	changes, err := f.Align(0x1000, true)
+	require.NoError(t, err)
+	var msgs []string
+	for _, c := range changes {
+		msgs = append(msgs, c.String())
+	}
+	assert.Equal(t, []string{
+		"FLASH/A: size 0x800 -> 0x1000",
+		"FLASH/B: start 0x800 -> 0x1000, size 0x1800 -> 0x2000",
+		"FLASH/B/B1: start 0x100 -> 0x1000, size 0x100 -> 0x1000",
+	}, msgs)
+	assert.Equal(t, before, f.ToFlashmap())
+	assert.Empty(t, f.Provenance())
+
+	_, err = f.Align(0x1000, false)
+	require.NoError(t, err)
+	assert.Equal(t, `FLASH 0x10000 {
+	A@0x0 0x1000
+	B@0x1000 0x2000 {
+		B1@0x1000 0x1000
+	}
+	MARK@0x2100 0x0
+	C@0x3000 4k
+	D@0x5000 0x1000
+}
+`, f.ToFlashmap())
+	assert.Equal(t, "Align(0x1000)", f.Find("B1", true).Provenance()[0].Op)
+	assert.Empty(t, f.Find("MARK", false).Provenance())
+	// only the marker is left misaligned
+	violations := f.ValidateWith(ValidateOptions{Align: 0x1000})
+	require.Equal(t, 1, len(violations))
+	assert.Equal(t, "FLASH/MARK", violations[0].Path)
+
+	changes, err = f.Align(0x1000, false)
+	require.NoError(t, err)
+	assert.Empty(t, changes)
+
+	_, err = f.Align(0, false)
+	assert.Error(t, err)
+}
+
+func TestAlignProtected(t *testing.T) {
+	f, err := ParseString(`FLASH 0x10000 {
+	RW 0x800
+	RW_X@0x1800 0x800
+	WP_RO 0x1800 {
+		FMAP 0x800
+	}
+	RW_B 0x800
+}`)
+	require.NoError(t, err)
+	f.ProtectReadOnly(true)
+
+	changes, err := f.Align(0x1000, false)
+	require.NoError(t, err)
+	var msgs []string
+	for _, c := range changes {
+		msgs = append(msgs, c.String())
+	}
+	// RW_X would overlap WP_RO once aligned
+	assert.Equal(t, []string{
+		"FLASH/RW: size 0x800 -> 0x1000",
+		"FLASH/RW_B: start 0x3800 -> 0x4000, size 0x800 -> 0x1000",
+	}, msgs)
+	assert.Equal(t, `FLASH 0x10000 {
+	RW@0x0 0x1000
+	RW_X@0x1800 0x800
+	WP_RO@0x2000 0x1800 {
+		FMAP 0x800
+	}
+	RW_B@0x4000 0x1000
+}
+`, f.ToFlashmap())
+	msgs = nil
+	for _, v := range f.ValidateWith(ValidateOptions{Align: 0x1000}) {
+		msgs = append(msgs, v.Path+": "+v.Message)
+	}
+	assert.Equal(t, []string{
+		"FLASH/RW_X: start 0x1800 is not aligned to 0x1000",
+		"FLASH/RW_X: size 0x800 is not a multiple of 0x1000",
+		"FLASH/WP_RO: size 0x1800 is not a multiple of 0x1000",
+		"FLASH/WP_RO/FMAP: size 0x800 is not a multiple of 0x1000",
+	}, msgs)
+}
@@ -0,0 +1,68 @@
+package fmap
+
+import "github.com/insomniacslk/fmap/pkg/fmap/syntax"
+
+// fromSyntaxSection returns the section described by the syntax tree `ss`,
+// with its sub-sections. The expressions are not evaluated yet, see
+// evalExprs, and the includes are not expanded, see resolveIncludes.
+func fromSyntaxSection(ss *syntax.Section) *Section {
+	s := &Section{
+		Name:      ss.Name,
+		StartExpr: fromSyntaxExpr(ss.Start),
+		SizeExpr:  fromSyntaxExpr(ss.Size),
+		Pos:       ss.Pos,
+		EndPos:    ss.EndPos,
+	}
+	for _, fl := range ss.Flags {
+		s.Flags = append(s.Flags, Flag(fl))
+	}
+	for _, a := range ss.Attributes {
+		s.Attributes = append(s.Attributes, &Attribute{Key: a.Key, Value: a.Value})
+	}
+	for _, inc := range ss.Includes {
+		s.Includes = append(s.Includes, fromSyntaxInclude(inc))
+	}
+	for _, sec := range ss.Sections {
+		s.Sections = append(s.Sections, fromSyntaxSection(sec))
+	}
+	return s
+}
+
+// fromSyntaxDefine returns the constant definition described by `sd`.
+func fromSyntaxDefine(sd *syntax.Define) *Define {
+	return &Define{Name: sd.Name, Expr: fromSyntaxExpr(sd.Expr), Pos: sd.Pos}
+}
+
+// fromSyntaxInclude returns the include directive described by `si`.
+func fromSyntaxInclude(si *syntax.Include) *Include {
+	return &Include{Path: si.Path, Pos: si.Pos}
+}
+
+// fromSyntaxExpr returns the expression described by `se`, or nil if it is
+// nil.
+func fromSyntaxExpr(se *syntax.Expr) *Expr {
+	if se == nil {
+		return nil
+	}
+	e := &Expr{Left: fromSyntaxTerm(se.Left)}
+	for _, op := range se.Right {
+		e.Right = append(e.Right, &ExprOp{Op: op.Op, Term: fromSyntaxTerm(op.Term)})
+	}
+	return e
+}
+
+func fromSyntaxTerm(st *syntax.Term) *Term {
+	t := &Term{Left: fromSyntaxFactor(st.Left)}
+	for _, op := range st.Right {
+		t.Right = append(t.Right, &TermOp{Op: op.Op, Factor: fromSyntaxFactor(op.Factor)})
+	}
+	return t
+}
+
+func fromSyntaxFactor(sf *syntax.Factor) *Factor {
+	f := &Factor{Unit: sf.Unit, Const: sf.Const, Sub: fromSyntaxExpr(sf.Sub)}
+	if sf.Number != nil {
+		f.Number = &Number{Value: sf.Number.Value, Base: sf.Number.Base}
+	}
+	return f
+}
@@ -0,0 +1,124 @@
+package fmap
+
+import (
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// Attribute is a key=value pair of metadata attached to a section. Attributes
+// are written in square brackets after the flags, e.g.
+// `COREBOOT(CBFS)[alias=BOOT_STUB]@0x0 1M`. A key may appear more than once.
+type Attribute struct {
+	Key   string
+	Value string
+}
+
+// Attribute keys with a special meaning.
+const (
+	// AttrAlias declares an alternative name for a section.
+	AttrAlias = "alias"
+	// AttrDeprecated marks a section as deprecated. Its value is a hint
+	// about what replaces the section, e.g. the name of the new section.
+	AttrDeprecated = "deprecated"
+	// AttrReadOnly marks a section, and its sub-sections, as immutable in
+	// the field if its value is true, see IsReadOnly.
+	AttrReadOnly = "readonly"
+	// AttrOwner names a team or a person that must approve the changes to
+	// a section and to its sub-sections, see Owners. It can be repeated.
+	AttrOwner = "owner"
+	// AttrContent records the content of the leaf sections of a fixture,
+	// see GenerateFixture.
+	AttrContent = "content"
+)
+
+// bareValueRe matches the attribute values that can be written without
+// quotes, i.e. identifiers and integers.
+var bareValueRe = regexp.MustCompile(`^([A-Za-z_][A-Za-z0-9_]*|0[xX][0-9a-fA-F]+|[0-9]+)$`)
+
+// String returns the text representation of the attribute.
+func (a *Attribute) String() string {
+	if bareValueRe.MatchString(a.Value) {
+		return a.Key + "=" + a.Value
+	}
+	return a.Key + "=" + strconv.Quote(a.Value)
+}
+
+// formatAttributes returns the text representation of a list of attributes,
+// or an empty string if there are none.
+func formatAttributes(attrs []*Attribute) string {
+	if len(attrs) == 0 {
+		return ""
+	}
+	items := make([]string, 0, len(attrs))
+	for _, a := range attrs {
+		items = append(items, a.String())
+	}
+	return "[" + strings.Join(items, " ") + "]"
+}
+
+// Attribute returns the value of the first attribute with the given key, and
+// whether it was found.
+func (s *Section) Attribute(key string) (string, bool) {
+	for _, a := range s.Attributes {
+		if a.Key == key {
+			return a.Value, true
+		}
+	}
+	return "", false
+}
+
+// AttributeValues returns the values of all the attributes with the given key.
+func (s *Section) AttributeValues(key string) []string {
+	var values []string
+	for _, a := range s.Attributes {
+		if a.Key == key {
+			values = append(values, a.Value)
+		}
+	}
+	return values
+}
+
+// SetAttribute appends an attribute to the section.
+func (s *Section) SetAttribute(key, value string) {
+	s.Attributes = append(s.Attributes, &Attribute{Key: key, Value: value})
+}
+
+// Aliases returns the alternative names of the section, declared with the
+// "alias" attribute. Lookups by name also match aliases, so that layouts can
+// rename sections without breaking tools that use legacy names.
+func (s *Section) Aliases() []string {
+	return s.AttributeValues(AttrAlias)
+}
+
+// hasName returns true if the section is called `name`, or has `name` as an
+// alias.
+func (s *Section) hasName(name string) bool {
+	if s.Name == name {
+		return true
+	}
+	for _, alias := range s.Aliases() {
+		if alias == name {
+			return true
+		}
+	}
+	return false
+}
+
+// Deprecated returns the replacement hint of a deprecated section, and whether
+// the section is deprecated.
+func (s *Section) Deprecated() (string, bool) {
+	return s.Attribute(AttrDeprecated)
+}
+
+// Deprecate marks the section as deprecated, with a hint about what replaces
+// it.
+func (s *Section) Deprecate(replacement string) {
+	for _, a := range s.Attributes {
+		if a.Key == AttrDeprecated {
+			a.Value = replacement
+			return
+		}
+	}
+	s.SetAttribute(AttrDeprecated, replacement)
+}
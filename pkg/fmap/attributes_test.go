@@ -0,0 +1,58 @@
+package fmap
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+const aliasedLayout = `FLASH 0x400000 {
+	RO_SECTION 0x200000 {
+		COREBOOT(CBFS)[alias=BOOT_STUB alias=RO_CBFS owner="firmware team"] 0x200000
+	}
+	RW_SECTION 0x200000
+}
+`
+
+func TestAttributes(t *testing.T) {
+	f, err := Parse(strings.NewReader(aliasedLayout))
+	require.NoError(t, err)
+
+	cb := f.Find("COREBOOT", true)
+	require.NotNil(t, cb)
+	assert.Equal(t, Flags{FlagCBFS}, cb.Flags)
+	assert.Equal(t, []string{"BOOT_STUB", "RO_CBFS"}, cb.Aliases())
+	owner, ok := cb.Attribute("owner")
+	assert.True(t, ok)
+	assert.Equal(t, "firmware team", owner)
+	_, ok = cb.Attribute("nonexisting")
+	assert.False(t, ok)
+
+	assert.Equal(t, "FLASH 0x400000 {\n\tRO_SECTION 0x200000 {\n\t\tCOREBOOT(CBFS)[alias=BOOT_STUB alias=RO_CBFS owner=\"firmware team\"] 0x200000\n\t}\n\tRW_SECTION 0x200000\n}\n", f.ToFlashmap())
+}
+
+func TestAliasLookup(t *testing.T) {
+	f, err := Parse(strings.NewReader(aliasedLayout))
+	require.NoError(t, err)
+	cb := f.Find("COREBOOT", true)
+	require.NotNil(t, cb)
+
+	assert.Equal(t, cb, f.Find("BOOT_STUB", true))
+	assert.Equal(t, cb, f.Find("RO_CBFS", true))
+	assert.Nil(t, f.Find("BOOT_STUB", false))
+	found := f.Search("boot-stub", SearchOptions{Recursive: true, IgnoreCase: true, IgnoreSeparators: true})
+	require.Equal(t, 1, len(found))
+	assert.Equal(t, cb, found[0])
+
+	require.True(t, f.Remove("BOOT_STUB", true))
+	assert.Nil(t, f.Find("COREBOOT", true))
+}
+
+func TestSetAttribute(t *testing.T) {
+	s := Section{Name: "COREBOOT", Size: 1, Unit: "M"}
+	s.SetAttribute(AttrAlias, "BOOT_STUB")
+	s.SetAttribute("align", "0x1000")
+	assert.Equal(t, "COREBOOT[alias=BOOT_STUB align=0x1000] 1M\n", s.ToFlashmap())
+}
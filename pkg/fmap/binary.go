@@ -0,0 +1,325 @@
+package fmap
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"sort"
+)
+
+// Constants describing the binary FMAP format, as defined by the flashmap
+// specification, version 1.1.
+const (
+	// Signature is the magic string that starts every binary FMAP.
+	Signature = "__FMAP__"
+	// VersionMajor and VersionMinor are the FMAP format version emitted by
+	// ToBinary.
+	VersionMajor = 1
+	VersionMinor = 1
+	// NameLen is the size of the name fields, including the NUL terminator.
+	NameLen = 32
+	// ScanAlignment is the alignment of the offsets at which ScanImage looks
+	// for a binary FMAP.
+	ScanAlignment = 16
+
+	headerSize = 56
+	areaSize   = 42
+)
+
+// ErrNoFMAP is returned by ScanImage if no valid FMAP is found in the image.
+var ErrNoFMAP = errors.New("no FMAP found")
+
+// AreaFlags are the flags associated with each area of a binary FMAP.
+type AreaFlags uint16
+
+// Area flags, as defined by the flashmap specification.
+const (
+	AreaStatic AreaFlags = 1 << iota
+	AreaCompressed
+	AreaReadOnly
+	AreaPreserve
+)
+
+// binaryHeader is the on-flash layout of the FMAP header.
+type binaryHeader struct {
+	Signature [8]byte
+	VerMajor  uint8
+	VerMinor  uint8
+	Base      uint64
+	Size      uint32
+	Name      [NameLen]byte
+	NAreas    uint16
+}
+
+// binaryArea is the on-flash layout of a single FMAP area.
+type binaryArea struct {
+	Offset uint32
+	Size   uint32
+	Name   [NameLen]byte
+	Flags  uint16
+}
+
+// binaryName converts the name of a section into a NUL-terminated FMAP name
+// field.
+func binaryName(s *Section) ([NameLen]byte, error) {
+	var ret [NameLen]byte
+	if len(s.Name) >= NameLen {
+		return ret, sectionErrorf(s, "name is too long: must be at most %d characters", NameLen-1)
+	}
+	copy(ret[:], s.Name)
+	return ret, nil
+}
+
+// areaFlags returns the binary FMAP flags for a section.
+func areaFlags(s *Section) AreaFlags {
+	var flags AreaFlags
+	if s.IsPreserve() {
+		flags |= AreaPreserve
+	}
+	return flags
+}
+
+// walkOffsets calls `f` for every sub-section of `s`, recursively and in
+// pre-order, with the offset of the sub-section relative to the start of `s`.
+func walkOffsets(s *Section, base int64, f func(sec *Section, offset int64) error) error {
+	starts := childStarts(s)
+	for idx, sec := range s.Sections {
+		if err := f(sec, base+starts[idx]); err != nil {
+			return err
+		}
+		if err := walkOffsets(sec, base+starts[idx], f); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// ToBinary returns the binary FMAP representation of the section tree. The
+// section is used as the root of the flash: its name and start become the FMAP
+// name and base address, and all of its sub-sections, at any depth, become
+// areas with offsets relative to the base.
+func (s *Section) ToBinary() ([]byte, error) {
+	hdr, areas, err := toAreas(s)
+	if err != nil {
+		return nil, err
+	}
+	var buf bytes.Buffer
+	if err := binary.Write(&buf, binary.LittleEndian, &hdr); err != nil {
+		return nil, err
+	}
+	if err := binary.Write(&buf, binary.LittleEndian, areas); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// toAreas returns the header and the areas of the binary FMAP representation
+// of the section tree, see ToBinary.
+func toAreas(s *Section) (binaryHeader, []binaryArea, error) {
+	hdr := binaryHeader{
+		VerMajor: VersionMajor,
+		VerMinor: VersionMinor,
+	}
+	copy(hdr.Signature[:], Signature)
+	if s.Start != nil {
+		if *s.Start < 0 {
+			return hdr, nil, sectionErrorf(s, "negative start 0x%x", *s.Start)
+		}
+		hdr.Base = uint64(*s.Start)
+	}
+	if size(s) < 0 || size(s) > math.MaxUint32 {
+		return hdr, nil, sectionErrorf(s, "size 0x%x does not fit in 32 bits", size(s))
+	}
+	hdr.Size = uint32(size(s))
+	name, err := binaryName(s)
+	if err != nil {
+		return hdr, nil, err
+	}
+	hdr.Name = name
+
+	var areas []binaryArea
+	err = walkOffsets(s, 0, func(sec *Section, offset int64) error {
+		if offset < 0 || offset > math.MaxUint32 {
+			return sectionErrorf(sec, "offset 0x%x does not fit in 32 bits", offset)
+		}
+		if size(sec) < 0 || size(sec) > math.MaxUint32 {
+			return sectionErrorf(sec, "size 0x%x does not fit in 32 bits", size(sec))
+		}
+		name, err := binaryName(sec)
+		if err != nil {
+			return err
+		}
+		areas = append(areas, binaryArea{
+			Offset: uint32(offset),
+			Size:   uint32(size(sec)),
+			Name:   name,
+			Flags:  uint16(areaFlags(sec)),
+		})
+		return nil
+	})
+	if err != nil {
+		return hdr, nil, err
+	}
+	if len(areas) > math.MaxUint16 {
+		return hdr, nil, fmt.Errorf("too many areas: %d", len(areas))
+	}
+	hdr.NAreas = uint16(len(areas))
+	return hdr, areas, nil
+}
+
+// parseName converts a NUL-terminated FMAP name field to a string.
+func parseName(name [NameLen]byte) (string, error) {
+	idx := bytes.IndexByte(name[:], 0)
+	if idx < 0 {
+		return "", errors.New("name is not NUL-terminated")
+	}
+	return string(name[:idx]), nil
+}
+
+// decodeBinary decodes the header and the areas, in the order they are
+// listed, of a binary FMAP.
+func decodeBinary(data []byte) (binaryHeader, []binaryArea, error) {
+	var hdr binaryHeader
+	r := bytes.NewReader(data)
+	if err := binary.Read(r, binary.LittleEndian, &hdr); err != nil {
+		return hdr, nil, fmt.Errorf("cannot read FMAP header: %v", err)
+	}
+	if string(hdr.Signature[:]) != Signature {
+		return hdr, nil, fmt.Errorf("invalid FMAP signature %q", hdr.Signature[:])
+	}
+	if hdr.VerMajor != VersionMajor {
+		return hdr, nil, fmt.Errorf("unsupported FMAP version %d.%d", hdr.VerMajor, hdr.VerMinor)
+	}
+	areas := make([]binaryArea, hdr.NAreas)
+	if err := binary.Read(r, binary.LittleEndian, areas); err != nil {
+		return hdr, nil, fmt.Errorf("cannot read %d FMAP areas: %v", hdr.NAreas, err)
+	}
+	return hdr, areas, nil
+}
+
+// FromBinary parses a binary FMAP and returns the corresponding section tree.
+// The flat list of areas is turned back into a hierarchy by range
+// containment: each area becomes a sub-section of the smallest area, listed
+// before it, that contains it. Starts are relative to the parent section.
+func FromBinary(data []byte) (*Section, error) {
+	hdr, areas, err := decodeBinary(data)
+	if err != nil {
+		return nil, err
+	}
+	return fromAreas(hdr, areas)
+}
+
+// fromAreas returns the section tree of a FMAP header and its areas, see
+// FromBinary.
+func fromAreas(hdr binaryHeader, areas []binaryArea) (*Section, error) {
+	name, err := parseName(hdr.Name)
+	if err != nil {
+		return nil, fmt.Errorf("invalid FMAP name: %v", err)
+	}
+	if hdr.Base > math.MaxInt64 {
+		return nil, fmt.Errorf("base address 0x%x does not fit in 63 bits", hdr.Base)
+	}
+	base := int64(hdr.Base)
+	root := &Section{Name: name, Start: &base, Size: int64(hdr.Size)}
+	// sort by offset, and put larger areas first so that parents come before
+	// their children. Areas with the same range keep the order they had in
+	// the FMAP.
+	sortAreas(areas)
+	type frame struct {
+		sec    *Section
+		offset int64
+	}
+	stack := []frame{{sec: root, offset: 0}}
+	for _, area := range areas {
+		name, err := parseName(area.Name)
+		if err != nil {
+			return nil, fmt.Errorf("invalid area name: %v", err)
+		}
+		offset, length := int64(area.Offset), int64(area.Size)
+		// find the innermost enclosing section. Markers are in the
+		// section whose range contains their offset, and enclose nothing
+		for len(stack) > 1 {
+			top := stack[len(stack)-1]
+			if offset >= top.offset && offset+length <= top.offset+top.sec.Size && (length > 0 || offset < top.offset+top.sec.Size) {
+				break
+			}
+			stack = stack[:len(stack)-1]
+		}
+		parent := stack[len(stack)-1]
+		start := offset - parent.offset
+		sec := &Section{Name: name, Start: &start, Size: length}
+		if AreaFlags(area.Flags)&AreaPreserve != 0 {
+			sec.AddFlag(FlagPreserve)
+		}
+		parent.sec.Sections = append(parent.sec.Sections, sec)
+		if length > 0 {
+			stack = append(stack, frame{sec: sec, offset: offset})
+		}
+	}
+	root.Link()
+	return root, nil
+}
+
+// sortAreas sorts areas by offset, and larger areas first, keeping the order
+// of the areas with the same range.
+func sortAreas(areas []binaryArea) {
+	sort.SliceStable(areas, func(i, j int) bool {
+		if areas[i].Offset != areas[j].Offset {
+			return areas[i].Offset < areas[j].Offset
+		}
+		return areas[i].Size > areas[j].Size
+	})
+}
+
+// ScanImage scans a flash image for a binary FMAP, looking for its signature
+// at every offset aligned to ScanAlignment. Candidates whose header or areas
+// cannot be decoded are skipped. It returns the parsed FMAP and the offset in
+// the image where it was found, or ErrNoFMAP if no valid FMAP is present.
+func ScanImage(r io.ReaderAt) (*Section, int64, error) {
+	const chunkSize = 64 * 1024
+	buf := make([]byte, chunkSize)
+	for base := int64(0); ; base += chunkSize {
+		n, err := r.ReadAt(buf, base)
+		if err != nil && err != io.EOF {
+			return nil, 0, err
+		}
+		for off := 0; off+len(Signature) <= n; off += ScanAlignment {
+			if string(buf[off:off+len(Signature)]) != Signature {
+				continue
+			}
+			if sec, err := readFMAP(r, base+int64(off)); err == nil {
+				return sec, base + int64(off), nil
+			}
+		}
+		if n < chunkSize {
+			return nil, 0, ErrNoFMAP
+		}
+	}
+}
+
+// readFMAP reads and parses the binary FMAP at the given offset of an image.
+func readFMAP(r io.ReaderAt, offset int64) (*Section, error) {
+	data, err := readBinary(r, offset)
+	if err != nil {
+		return nil, err
+	}
+	return FromBinary(data)
+}
+
+// readBinary reads the bytes of the binary FMAP at the given offset of an
+// image, as many as its header says.
+func readBinary(r io.ReaderAt, offset int64) ([]byte, error) {
+	hdr := make([]byte, headerSize)
+	if _, err := r.ReadAt(hdr, offset); err != nil {
+		return nil, err
+	}
+	nareas := int(binary.LittleEndian.Uint16(hdr[headerSize-2:]))
+	data := make([]byte, headerSize+nareas*areaSize)
+	if _, err := r.ReadAt(data, offset); err != nil {
+		return nil, err
+	}
+	return data, nil
+}
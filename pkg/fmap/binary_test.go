@@ -0,0 +1,139 @@
+package fmap
+
+import (
+	"bytes"
+	"encoding/binary"
+	"os"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestToBinary(t *testing.T) {
+	f, err := Parse(strings.NewReader(`FLASH@0xff000000 0x10000 {
+	RO@0x0 0x8000 {
+		FMAP 0x800
+		COREBOOT(CBFS) 0x7800
+	}
+	RW_NVRAM(PRESERVE)@0xc000 0x4000
+}`))
+	require.NoError(t, err)
+	data, err := f.ToBinary()
+	require.NoError(t, err)
+
+	want := []byte("__FMAP__")
+	want = append(want, 1, 1)
+	want = append(want, 0x00, 0x00, 0x00, 0xff, 0, 0, 0, 0)
+	want = append(want, 0x00, 0x00, 0x01, 0x00)
+	want = append(want, append([]byte("FLASH"), make([]byte, 27)...)...)
+	want = append(want, 4, 0)
+	area := func(offset, size uint32, name string, flags uint16) {
+		var buf bytes.Buffer
+		require.NoError(t, binary.Write(&buf, binary.LittleEndian, offset))
+		require.NoError(t, binary.Write(&buf, binary.LittleEndian, size))
+		buf.WriteString(name)
+		buf.Write(make([]byte, 32-len(name)))
+		require.NoError(t, binary.Write(&buf, binary.LittleEndian, flags))
+		want = append(want, buf.Bytes()...)
+	}
+	area(0x0, 0x8000, "RO", 0)
+	area(0x0, 0x800, "FMAP", 0)
+	area(0x800, 0x7800, "COREBOOT", 0)
+	area(0xc000, 0x4000, "RW_NVRAM", uint16(AreaPreserve))
+	assert.Equal(t, want, data)
+}
+
+func TestToBinaryChromeOS(t *testing.T) {
+	fd, err := os.Open("test_data/chromeos.fmd")
+	require.NoError(t, err)
+	defer fd.Close()
+	f, err := Parse(fd)
+	require.NoError(t, err)
+	data, err := f.ToBinary()
+	require.NoError(t, err)
+	// 56 bytes of header, 42 bytes for each of the 33 areas
+	require.Equal(t, 56+42*33, len(data))
+	assert.Equal(t, []byte(Signature), data[:8])
+	assert.Equal(t, uint64(0xff000000), binary.LittleEndian.Uint64(data[10:18]))
+	assert.Equal(t, uint32(0x1000000), binary.LittleEndian.Uint32(data[18:22]))
+	assert.Equal(t, uint16(33), binary.LittleEndian.Uint16(data[54:56]))
+}
+
+func TestToBinaryNameTooLong(t *testing.T) {
+	f := Section{
+		Name: "FLASH",
+		Size: 0x1000,
+		Sections: []*Section{
+			{Name: strings.Repeat("A", 32), Size: 0x1000},
+		},
+	}
+	_, err := f.ToBinary()
+	require.Error(t, err)
+}
+
+func TestFromBinary(t *testing.T) {
+	fd, err := os.Open("test_data/chromeos.fmd")
+	require.NoError(t, err)
+	defer fd.Close()
+	f, err := Parse(fd)
+	require.NoError(t, err)
+	data, err := f.ToBinary()
+	require.NoError(t, err)
+
+	f2, err := FromBinary(data)
+	require.NoError(t, err)
+	assert.Equal(t, "FLASH", f2.Name)
+	require.NotNil(t, f2.Start)
+	assert.Equal(t, int64(0xff000000), *f2.Start)
+	assert.Equal(t, int64(0x1000000), f2.Size)
+	fwMainA := f2.Find("FW_MAIN_A", true)
+	require.NotNil(t, fwMainA)
+	assert.Equal(t, int64(0x10000), *fwMainA.Start)
+	assert.Equal(t, int64(0x3d7fc0), fwMainA.Size)
+	data2, err := f2.ToBinary()
+	require.NoError(t, err)
+	assert.Equal(t, data, data2)
+}
+
+func TestFromBinaryPreserve(t *testing.T) {
+	f, err := Parse(strings.NewReader("FLASH 0x2000 {\n\tRW_NVRAM(PRESERVE) 0x1000\n}\n"))
+	require.NoError(t, err)
+	data, err := f.ToBinary()
+	require.NoError(t, err)
+	f2, err := FromBinary(data)
+	require.NoError(t, err)
+	assert.Equal(t, "FLASH@0x0 0x2000 {\n\tRW_NVRAM(PRESERVE)@0x0 0x1000\n}\n", f2.ToFlashmap())
+}
+
+func TestFromBinaryInvalid(t *testing.T) {
+	_, err := FromBinary([]byte("__FMAP_"))
+	require.Error(t, err)
+	_, err = FromBinary(append([]byte("__NOPE__"), make([]byte, 48)...))
+	require.Error(t, err)
+}
+
+func TestScanImage(t *testing.T) {
+	f, err := Parse(strings.NewReader("FLASH@0x0 0x100000 {\n\tFMAP@0x20000 0x800\n}\n"))
+	require.NoError(t, err)
+	blob, err := f.ToBinary()
+	require.NoError(t, err)
+
+	image := bytes.Repeat([]byte{0xff}, 0x100000)
+	// an unaligned signature, and an aligned one with a broken header
+	copy(image[0x1003:], Signature)
+	copy(image[0x2000:], Signature)
+	copy(image[0x20000:], blob)
+
+	found, offset, err := ScanImage(bytes.NewReader(image))
+	require.NoError(t, err)
+	assert.Equal(t, int64(0x20000), offset)
+	assert.Equal(t, f.ToFlashmap(), found.ToFlashmap())
+}
+
+func TestScanImageNotFound(t *testing.T) {
+	image := bytes.Repeat([]byte{0xff}, 0x30000)
+	_, _, err := ScanImage(bytes.NewReader(image))
+	assert.Equal(t, ErrNoFMAP, err)
+}
@@ -0,0 +1,96 @@
+package fmap
+
+import (
+	"fmt"
+	"io"
+)
+
+// BootLookupNames are the names of the regions that firmware commonly looks
+// up at boot time, checked by `fmap bootcheck` by default.
+var BootLookupNames = []string{"FMAP", "COREBOOT", "VBLOCK_A"}
+
+// BootLookup is the result of looking up a region by name both in the binary
+// FMAP of an image, as firmware does at boot time, and in the text layout.
+type BootLookup struct {
+	Name string
+	// Found is true if the binary FMAP has an area with the name, and Offset
+	// and Size are then its range.
+	Found  bool
+	Offset int64
+	Size   int64
+	// InLayout is true if the layout has a section with the name, and
+	// LayoutOffset and LayoutSize are then its range.
+	InLayout     bool
+	LayoutOffset int64
+	LayoutSize   int64
+}
+
+// OK returns true if the binary FMAP and the layout agree on the region:
+// either both have it, with the same range, or neither does.
+func (l BootLookup) OK() bool {
+	if l.Found != l.InLayout {
+		return false
+	}
+	return l.Offset == l.LayoutOffset && l.Size == l.LayoutSize
+}
+
+// String returns a description of the lookup.
+func (l BootLookup) String() string {
+	switch {
+	case !l.Found && !l.InLayout:
+		return fmt.Sprintf("%s: not found in the FMAP nor in the layout", l.Name)
+	case !l.Found:
+		return fmt.Sprintf("%s: not found in the FMAP, but the layout has 0x%x-0x%x", l.Name, l.LayoutOffset, l.LayoutOffset+l.LayoutSize)
+	case !l.InLayout:
+		return fmt.Sprintf("%s: found in the FMAP at 0x%x-0x%x, but not in the layout", l.Name, l.Offset, l.Offset+l.Size)
+	case l.OK():
+		return fmt.Sprintf("%s: ok, 0x%x-0x%x", l.Name, l.Offset, l.Offset+l.Size)
+	default:
+		return fmt.Sprintf("%s: the FMAP has 0x%x-0x%x, but the layout has 0x%x-0x%x", l.Name, l.Offset, l.Offset+l.Size, l.LayoutOffset, l.LayoutOffset+l.LayoutSize)
+	}
+}
+
+// SimulateBootLookup looks up the regions `names` the way coreboot does at
+// boot time, and compares them with the layout `s`, to catch skew between the
+// text layout and the binary FMAP embedded in an image. Like coreboot, it
+// reads the binary FMAP at the start of the FMAP section, not wherever it can
+// be found in the image, and it returns the first area, in the order they are
+// listed, whose name matches exactly. The layout is searched for the first
+// section with the name, in pre-order. Offsets in the image are relative to
+// the start of `s`. An error is returned if there is no valid FMAP at the
+// start of the FMAP section. Mismatches are not errors, see BootLookup.OK.
+func (s *Section) SimulateBootLookup(image io.ReaderAt, names []string) ([]BootLookup, error) {
+	fmapSec, err := s.Lookup("FMAP", true)
+	if err != nil {
+		return nil, err
+	}
+	fmapOffset, _ := offsetOf(s, fmapSec)
+	data, err := readBinary(image, fmapOffset)
+	if err != nil {
+		return nil, sectionErrorf(fmapSec, "no valid FMAP at 0x%x: %v", fmapOffset, err)
+	}
+	_, areas, err := decodeBinary(data)
+	if err != nil {
+		return nil, sectionErrorf(fmapSec, "no valid FMAP at 0x%x: %v", fmapOffset, err)
+	}
+
+	var lookups []BootLookup
+	for _, name := range names {
+		l := BootLookup{Name: name}
+		for _, area := range areas {
+			if areaName, err := parseName(area.Name); err == nil && areaName == name {
+				l.Found, l.Offset, l.Size = true, int64(area.Offset), int64(area.Size)
+				break
+			}
+		}
+		_ = walkOffsets(s, 0, func(sec *Section, offset int64) error {
+			if sec.Name != name {
+				return nil
+			}
+			l.InLayout, l.LayoutOffset, l.LayoutSize = true, offset, size(sec)
+			return io.EOF
+		})
+		lookups = append(lookups, l)
+	}
+	return lookups, nil
+}
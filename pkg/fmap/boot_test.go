@@ -0,0 +1,72 @@
+package fmap
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+const bootLayout = `FLASH 0x10000 {
+	RW_A@0x0 0x4000 {
+		VBLOCK_A@0x0 0x1000
+		FW_MAIN_A@0x1000 0x3000
+	}
+	RO@0x8000 0x8000 {
+		FMAP@0x0 0x1000
+		COREBOOT@0x1000 0x7000
+	}
+}`
+
+// bootImage returns an image for the layout with its binary FMAP at the start
+// of the FMAP section.
+func bootImage(t *testing.T, layout string) []byte {
+	f, err := Parse(strings.NewReader(layout))
+	require.NoError(t, err)
+	data, err := f.ToBinary()
+	require.NoError(t, err)
+	image := bytes.Repeat([]byte{0xff}, 0x10000)
+	copy(image[0x8000:], data)
+	return image
+}
+
+func TestSimulateBootLookup(t *testing.T) {
+	f, err := Parse(strings.NewReader(bootLayout))
+	require.NoError(t, err)
+	image := bootImage(t, bootLayout)
+
+	lookups, err := f.SimulateBootLookup(bytes.NewReader(image), append(BootLookupNames, "MISSING"))
+	require.NoError(t, err)
+	require.Equal(t, 4, len(lookups))
+	for _, l := range lookups {
+		assert.True(t, l.OK(), l.String())
+	}
+	assert.Equal(t, "COREBOOT: ok, 0x9000-0x10000", lookups[1].String())
+	assert.Equal(t, "MISSING: not found in the FMAP nor in the layout", lookups[3].String())
+
+	// the text layout was changed, but not the image
+	f.Find("COREBOOT", true).Size = 0x6000
+	f.Find("VBLOCK_A", true).Name = "VBLOCK"
+	lookups, err = f.SimulateBootLookup(bytes.NewReader(image), BootLookupNames)
+	require.NoError(t, err)
+	assert.True(t, lookups[0].OK())
+	assert.False(t, lookups[1].OK())
+	assert.Equal(t, "COREBOOT: the FMAP has 0x9000-0x10000, but the layout has 0x9000-0xf000", lookups[1].String())
+	assert.False(t, lookups[2].OK())
+	assert.Equal(t, "VBLOCK_A: found in the FMAP at 0x0-0x1000, but not in the layout", lookups[2].String())
+}
+
+func TestSimulateBootLookupNoFMAP(t *testing.T) {
+	f, err := Parse(strings.NewReader(bootLayout))
+	require.NoError(t, err)
+	image := bootImage(t, bootLayout)
+
+	// the FMAP was moved in the layout
+	start := int64(0x1000)
+	f.Find("FMAP", true).Start = &start
+	_, err = f.SimulateBootLookup(bytes.NewReader(image), BootLookupNames)
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "no valid FMAP at 0x9000")
+}
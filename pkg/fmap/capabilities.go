@@ -0,0 +1,42 @@
+package fmap
+
+// Formats lists the flashmap formats supported by this package, for both
+// input and output.
+var Formats = []string{
+	"fmd",         // text flashmap descriptor, see Parse and ToFlashmap
+	"binary",      // binary FMAP, see FromBinary and ToBinary
+	"json",        // see MarshalJSON and UnmarshalJSON
+	"yaml",        // see ToYAML and FromYAML
+	"family",      // board family definitions, input only, see ParseFamily
+	"fmap_decode", // output of the legacy fmap_decode tool, input only, see ParseFmapDecode
+	"ifd",         // regions of the Intel Flash Descriptor of an image, input only, see ReadIFD and FromIFD
+	"ifdtool",     // regions listed by ifdtool -d, input only, see ParseIfdtoolDump and FromIFD
+	"cheader",     // C header of fmaptool -h, output only, see ToCHeader
+	"fmap_config", // flat region list of fmaptool, output only, see ToFmapConfig
+	"dump_fmap",   // default listing of futility dump_fmap, see ToDumpFmap and ParseDumpFmap
+	"dump_fmap_p", // parseable listing of dump_fmap -p, see ToDumpFmap and ParseDumpFmap
+	"dump_fmap_h", // human-readable tree of dump_fmap -h, output only, see ToDumpFmap
+	"dot",         // Graphviz DOT, output only, see ToDOT
+	"svg",         // proportional picture of the flash, output only, see ToSVG
+	"html",        // standalone page with the picture and a table, output only, see ToHTML
+}
+
+// GrammarFeatures lists the extensions to the basic fmd grammar supported by
+// the parser, so that tools can check for them before relying on them.
+var GrammarFeatures = []string{
+	"units",       // sizes with k/K/m/M units
+	"flags",       // multiple space-separated flags, e.g. (CBFS PRESERVE)
+	"comments",    // C and C++ style comments
+	"attributes",  // [key=value] section attributes
+	"aliases",     // [alias=NAME] attribute
+	"deprecated",  // [deprecated=HINT] attribute
+	"readonly",    // [readonly=true] attribute
+	"owner",       // [owner=NAME] attribute, see Owners and Approvals
+	"overlay",     // [overlay=MODE] attribute, used by Overlay
+	"crlf",        // CRLF line endings and byte order marks
+	"fill",        // omitted sizes, taking the remaining space
+	"expressions", // arithmetic expressions for starts and sizes
+	"constants",   // define NAME EXPR, referenced as $NAME
+	"include",     // include "file.fmd" in section bodies
+	"dialects",    // vendor keywords, attributes and hooks, see RegisterDialect
+}
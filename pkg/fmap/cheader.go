@@ -0,0 +1,63 @@
+package fmap
+
+import (
+	"fmt"
+	"strings"
+)
+
+// cHex formats `n` like the %#x conversion of C, which omits the prefix of 0.
+func cHex(n int64) string {
+	if n == 0 {
+		return "0"
+	}
+	return fmt.Sprintf("%#x", n)
+}
+
+// ToCHeader returns a C header with the offsets and sizes of the sections,
+// like the one generated by coreboot's fmaptool -h: FMAP_OFFSET and FMAP_SIZE
+// are the offset of the FMAP section and the size of the binary FMAP, see
+// ToBinary, and every sub-section, at any depth, gets a
+// FMAP_SECTION_<NAME>_START and a FMAP_SECTION_<NAME>_SIZE define, with its
+// offset relative to the root. An error is returned if two sections have the
+// same name, as the defines would clash, or if the binary FMAP cannot be
+// generated.
+func (s *Section) ToCHeader() (string, error) {
+	bin, err := s.ToBinary()
+	if err != nil {
+		return "", err
+	}
+	var b strings.Builder
+	b.WriteString("#ifndef FMAPTOOL_GENERATED_HEADER_H_\n")
+	b.WriteString("#define FMAPTOOL_GENERATED_HEADER_H_\n\n")
+	sections := flatten(s)[1:]
+	for _, fs := range sections {
+		if fs.Section.Name == "FMAP" {
+			fmt.Fprintf(&b, "#define FMAP_OFFSET %s\n", cHex(fs.Offset))
+			fmt.Fprintf(&b, "#define FMAP_SIZE %s\n\n", cHex(int64(len(bin))))
+			break
+		}
+	}
+	seen := make(map[string]*Section)
+	for _, fs := range sections {
+		if other, ok := seen[fs.Section.Name]; ok {
+			return "", sectionErrorf(fs.Section, "the name %s is also used by %s", fs.Section.Name, other.Path())
+		}
+		seen[fs.Section.Name] = fs.Section
+		fmt.Fprintf(&b, "#define FMAP_SECTION_%s_START %s\n", fs.Section.Name, cHex(fs.Offset))
+		fmt.Fprintf(&b, "#define FMAP_SECTION_%s_SIZE %s\n", fs.Section.Name, cHex(size(fs.Section)))
+	}
+	b.WriteString("\n#endif\n")
+	return b.String(), nil
+}
+
+// ToFmapConfig returns the flat list of the sub-sections, at any depth, in
+// pre-order, like the region list of coreboot's fmaptool: one "NAME START
+// SIZE" line per section, with its offset relative to the root and its size
+// in bytes, in hexadecimal like the defines of ToCHeader.
+func (s *Section) ToFmapConfig() string {
+	var b strings.Builder
+	for _, fs := range flatten(s)[1:] {
+		fmt.Fprintf(&b, "%s %s %s\n", fs.Section.Name, cHex(fs.Offset), cHex(size(fs.Section)))
+	}
+	return b.String()
+}
@@ -0,0 +1,67 @@
+package fmap
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestToCHeader(t *testing.T) {
+	f, err := Parse(strings.NewReader(`FLASH@0xff000000 0x10000 {
+	WP_RO 0x8000 {
+		FMAP 0x1000
+		GBB 0x7000
+	}
+	RW_A 0x8000
+}`))
+	require.NoError(t, err)
+	header, err := f.ToCHeader()
+	require.NoError(t, err)
+	assert.Equal(t, `#ifndef FMAPTOOL_GENERATED_HEADER_H_
+#define FMAPTOOL_GENERATED_HEADER_H_
+
+#define FMAP_OFFSET 0
+#define FMAP_SIZE 0xe0
+
+#define FMAP_SECTION_WP_RO_START 0
+#define FMAP_SECTION_WP_RO_SIZE 0x8000
+#define FMAP_SECTION_FMAP_START 0
+#define FMAP_SECTION_FMAP_SIZE 0x1000
+#define FMAP_SECTION_GBB_START 0x1000
+#define FMAP_SECTION_GBB_SIZE 0x7000
+#define FMAP_SECTION_RW_A_START 0x8000
+#define FMAP_SECTION_RW_A_SIZE 0x8000
+
+#endif
+`, header)
+
+	dup, err := Parse(strings.NewReader(`FLASH 0x2000 {
+	A 0x1000 {
+		X 0x1000
+	}
+	B 0x1000 {
+		X 0x1000
+	}
+}`))
+	require.NoError(t, err)
+	_, err = dup.ToCHeader()
+	assert.Error(t, err)
+}
+
+func TestToFmapConfig(t *testing.T) {
+	f, err := Parse(strings.NewReader(`FLASH 0x10000 {
+	WP_RO 0x8000 {
+		FMAP 0x1000
+		GBB 0x7000
+	}
+	RW_A 0x8000
+}`))
+	require.NoError(t, err)
+	assert.Equal(t, `WP_RO 0 0x8000
+FMAP 0 0x1000
+GBB 0x1000 0x7000
+RW_A 0x8000 0x8000
+`, f.ToFmapConfig())
+}
@@ -0,0 +1,93 @@
+package fmap
+
+// Clone returns a deep copy of the section tree rooted at `s`, so that a
+// transformation can be tried on the copy and compared with the original. The
+// copy shares nothing with the original: starts, flags, attributes,
+// expressions, constant definitions, provenance and parse warnings are
+// copied, and the copy is a root section with its own journal, so that
+// transforms applied to either tree are not recorded in the other one. The
+// read-only protection of `s`, see ProtectReadOnly, is kept.
+func (s *Section) Clone() *Section {
+	copies := make(map[*Section]*Section)
+	c := clone(s, copies)
+	j := &journal{}
+	if s.journal != nil {
+		*j = *s.journal
+	}
+	setJournal(c, j)
+	c.parseWarnings = nil
+	for _, w := range s.parseWarnings {
+		if sec, ok := copies[w.Section]; ok {
+			w.Section = sec
+		}
+		c.parseWarnings = append(c.parseWarnings, w)
+	}
+	return c
+}
+
+// clone returns a deep copy of a section tree, without parent, sharing the
+// journal of `s`. If `copies` is not nil, the copy of every section is
+// recorded in it.
+func clone(s *Section, copies map[*Section]*Section) *Section {
+	c := *s
+	c.Flags = append(Flags(nil), s.Flags...)
+	if s.Start != nil {
+		start := *s.Start
+		c.Start = &start
+	}
+	c.Attributes = nil
+	for _, a := range s.Attributes {
+		c.SetAttribute(a.Key, a.Value)
+	}
+	c.StartExpr, c.SizeExpr = cloneExpr(s.StartExpr), cloneExpr(s.SizeExpr)
+	c.Includes = nil
+	for _, inc := range s.Includes {
+		inc := *inc
+		c.Includes = append(c.Includes, &inc)
+	}
+	c.Defines = nil
+	for _, d := range s.Defines {
+		c.Defines = append(c.Defines, &Define{Name: d.Name, Expr: cloneExpr(d.Expr), Pos: d.Pos})
+	}
+	c.Sections = nil
+	for _, sec := range s.Sections {
+		c.Sections = append(c.Sections, clone(sec, copies))
+	}
+	c.provenance = append([]Transform(nil), s.provenance...)
+	c.parent = nil
+	link(&c)
+	if copies != nil {
+		copies[s] = &c
+	}
+	return &c
+}
+
+// cloneExpr returns a deep copy of an expression, or nil if it is nil.
+func cloneExpr(e *Expr) *Expr {
+	if e == nil {
+		return nil
+	}
+	c := &Expr{Left: cloneTerm(e.Left)}
+	for _, op := range e.Right {
+		c.Right = append(c.Right, &ExprOp{Op: op.Op, Term: cloneTerm(op.Term)})
+	}
+	return c
+}
+
+func cloneTerm(t *Term) *Term {
+	c := &Term{Left: cloneFactor(t.Left)}
+	for _, op := range t.Right {
+		c.Right = append(c.Right, &TermOp{Op: op.Op, Factor: cloneFactor(op.Factor)})
+	}
+	return c
+}
+
+func cloneFactor(f *Factor) *Factor {
+	c := *f
+	if f.Number != nil {
+		n := *f.Number
+		c.Number = &n
+	}
+	c.Sub = cloneExpr(f.Sub)
+	return &c
+}
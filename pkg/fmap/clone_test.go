@@ -0,0 +1,56 @@
+package fmap
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestClone(t *testing.T) {
+	f, err := ParseString(`define RO 0x2000
+FLASH 0x4000 {
+	RO_SECTION(CBFS)[owner=firmware]@0 $RO {
+		FMAP 0x1000
+	}
+	RW@$RO 0x2000
+}`)
+	require.NoError(t, err)
+	f.ProtectReadOnly(true)
+	c := f.Clone()
+	assert.Equal(t, f.ToFlashmap(), c.ToFlashmap())
+	assert.Nil(t, c.Parent())
+	assert.Equal(t, c, c.Find("FMAP", true).Root())
+	assert.Equal(t, f.Find("FMAP", true).Span(), c.Find("FMAP", true).Span())
+
+	// changing the copy leaves the original alone
+	ro := c.Find("RO_SECTION", false)
+	*ro.Start = 0x100
+	ro.Flags[0] = "PRESERVE"
+	ro.Attributes[0].Value = "nobody"
+	ro.SizeExpr.Left.Left.Const = "OTHER"
+	c.Defines[0].Expr.Left.Left.Number.Value = 1
+	require.NoError(t, c.Find("RW", false).Insert(&Section{Name: "NVRAM", Size: 0x100}, AtOffset(0)))
+	assert.Equal(t, `define RO 0x2000
+
+FLASH 0x4000 {
+	RO_SECTION(CBFS)[owner=firmware]@0x0 $RO {
+		FMAP 0x1000
+	}
+	RW@$RO 0x2000
+}
+`, f.ToFlashmap())
+	assert.Empty(t, f.Find("RW", false).Provenance())
+	assert.Len(t, c.Find("RW", false).Provenance(), 1)
+	assert.True(t, c.protectRO)
+}
+
+func TestCloneParseWarnings(t *testing.T) {
+	f, err := ParseWithOptions(strings.NewReader("FLASH 0x1000 {\n\tA 0x800\n\tA 0x800\n}"), ParseOptions{Mode: ParseLenient})
+	require.NoError(t, err)
+	c := f.Clone()
+	require.Len(t, c.ParseWarnings(), 1)
+	assert.Equal(t, c.Sections[1], c.ParseWarnings()[0].Section)
+	assert.Equal(t, f.Sections[1], f.ParseWarnings()[0].Section)
+}
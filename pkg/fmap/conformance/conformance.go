@@ -0,0 +1,160 @@
+// Package conformance provides a table of test cases describing the flashmap
+// grammar and its normalized serialization, as implemented by package fmap.
+// Forks and alternative implementations can run the cases to verify that they
+// handle the same inputs the same way.
+package conformance
+
+import (
+	"testing"
+
+	"github.com/insomniacslk/fmap/pkg/fmap"
+)
+
+// Case is a conformance test case.
+type Case struct {
+	Name  string
+	Input string
+	// Want is the expected normalized serialization of Input. It is ignored
+	// if Invalid is true.
+	Want string
+	// Invalid is true if Input must be rejected.
+	Invalid bool
+}
+
+// Implementation is a flashmap implementation under test.
+type Implementation interface {
+	// Normalize parses a flashmap and returns its normalized serialization.
+	Normalize(input string) (string, error)
+}
+
+// Reference is the reference Implementation, backed by package fmap.
+type Reference struct{}
+
+// Normalize implements Implementation.
+func (Reference) Normalize(input string) (string, error) {
+	flash, err := fmap.ParseString(input)
+	if err != nil {
+		return "", err
+	}
+	return flash.ToFlashmap(), nil
+}
+
+// Cases are the conformance test cases.
+var Cases = []Case{
+	{
+		Name:  "single section",
+		Input: "FLASH 0x1000",
+		Want:  "FLASH 0x1000\n",
+	},
+	{
+		Name:  "decimal size",
+		Input: "FLASH 4096",
+		Want:  "FLASH 0x1000\n",
+	},
+	{
+		Name:  "units",
+		Input: "FLASH 16M {\n\tA 4k\n\tB 4K\n\tC 1m\n}",
+		Want:  "FLASH 16M {\n\tA 4k\n\tB 4K\n\tC 1m\n}\n",
+	},
+	{
+		Name:  "start",
+		Input: "FLASH@0xff000000 0x1000000",
+		Want:  "FLASH@0xff000000 0x1000000\n",
+	},
+	{
+		Name:  "nesting",
+		Input: "FLASH 0x2000 { RO 0x1000 { FMAP 0x800 } RW 0x1000 }",
+		Want:  "FLASH 0x2000 {\n\tRO 0x1000 {\n\t\tFMAP 0x800\n\t}\n\tRW 0x1000\n}\n",
+	},
+	{
+		Name:  "annotation",
+		Input: "FLASH 0x1000 {\n\tCOREBOOT(CBFS)@0x0 0x1000\n}",
+		Want:  "FLASH 0x1000 {\n\tCOREBOOT(CBFS)@0x0 0x1000\n}\n",
+	},
+	{
+		Name:  "multiple flags",
+		Input: "FLASH 0x1000 {\n\tRW_NVRAM(CBFS PRESERVE) 0x1000\n}",
+		Want:  "FLASH 0x1000 {\n\tRW_NVRAM(CBFS PRESERVE) 0x1000\n}\n",
+	},
+	{
+		Name:  "attributes",
+		Input: "FLASH 0x1000 {\n\tCOREBOOT(CBFS)[alias=BOOT_STUB owner=\"fw team\"] 0x1000\n}",
+		Want:  "FLASH 0x1000 {\n\tCOREBOOT(CBFS)[alias=BOOT_STUB owner=\"fw team\"] 0x1000\n}\n",
+	},
+	{
+		Name:  "comments",
+		Input: "// layout\nFLASH 0x1000 { /* the only section */ A 0x1000 }",
+		Want:  "FLASH 0x1000 {\n\tA 0x1000\n}\n",
+	},
+	{
+		Name:  "windows line endings",
+		Input: "\xef\xbb\xbfFLASH 0x1000 {\r\n\tA 0x1000  \r\n}\r\n",
+		Want:  "FLASH 0x1000 {\n\tA 0x1000\n}\n",
+	},
+	{
+		Name:  "omitted size",
+		Input: "FLASH 0x4000 {\n\tRO_FMAP 0x1000\n\tCOREBOOT(CBFS)\n\tRW_NVRAM 0x1000\n}",
+		Want:  "FLASH 0x4000 {\n\tRO_FMAP 0x1000\n\tCOREBOOT(CBFS)\n\tRW_NVRAM 0x1000\n}\n",
+	},
+	{
+		Name:  "expressions",
+		Input: "FLASH 16M {\n\tSI_DESC 4k + 0x100\n\tSI_BIOS@0x200000 16M - 2M\n}",
+		Want:  "FLASH 16M {\n\tSI_DESC 4k + 0x100\n\tSI_BIOS@0x200000 16M - 2M\n}\n",
+	},
+	{
+		Name:    "omitted root size",
+		Input:   "FLASH@0x0",
+		Invalid: true,
+	},
+	{
+		Name:    "several omitted sizes",
+		Input:   "FLASH 0x1000 { A B }",
+		Invalid: true,
+	},
+	{
+		Name:    "unterminated block",
+		Input:   "FLASH 0x1000 {\n\tA 0x1000\n",
+		Invalid: true,
+	},
+	{
+		Name:    "invalid unit",
+		Input:   "FLASH 4G",
+		Invalid: true,
+	},
+	{
+		Name:    "invalid start",
+		Input:   "FLASH@ 0x1000",
+		Invalid: true,
+	},
+}
+
+// Run runs all the conformance cases against an implementation, as subtests
+// of `t`. For valid inputs, it also checks that normalizing the normalized
+// output is a no-op, i.e. that the serialization round-trips.
+func Run(t *testing.T, impl Implementation) {
+	for _, c := range Cases {
+		c := c
+		t.Run(c.Name, func(t *testing.T) {
+			got, err := impl.Normalize(c.Input)
+			if c.Invalid {
+				if err == nil {
+					t.Fatalf("expected an error, got %q", got)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if got != c.Want {
+				t.Fatalf("unexpected normalized output:\ngot:  %q\nwant: %q", got, c.Want)
+			}
+			again, err := impl.Normalize(got)
+			if err != nil {
+				t.Fatalf("cannot parse normalized output: %v", err)
+			}
+			if again != got {
+				t.Fatalf("normalized output does not round-trip:\ngot:  %q\nwant: %q", again, got)
+			}
+		})
+	}
+}
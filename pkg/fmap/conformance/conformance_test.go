@@ -0,0 +1,9 @@
+package conformance
+
+import (
+	"testing"
+)
+
+func TestReference(t *testing.T) {
+	Run(t, Reference{})
+}
@@ -0,0 +1,158 @@
+package fmap
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/alecthomas/participle/lexer"
+	"github.com/insomniacslk/fmap/pkg/fmap/syntax"
+)
+
+// Define is a named constant, written as "define NAME EXPR" before the root
+// section, e.g. "define ROM_SIZE 16M". Constants are referenced in the start
+// and size expressions as "$NAME", and a definition can reference the
+// constants defined before it.
+type Define struct {
+	Name string
+	Expr *Expr
+
+	Pos lexer.Position
+}
+
+// String returns the definition as it is written in a fmd file.
+func (d *Define) String() string {
+	return d.format(newFormatter())
+}
+
+// format writes the definition with the formatter `fm`.
+func (d *Define) format(fm *formatter) string {
+	return "define " + d.Name + " " + d.Expr.format(fm)
+}
+
+// ParseOptions controls how ParseWithOptions parses a fmd file.
+type ParseOptions struct {
+	// Defines are constants, as name and expression, that override the
+	// definitions in the file with the same name, and can be referenced by
+	// them. This is the equivalent of the -D option of a compiler.
+	Defines map[string]string
+	// Lossless makes the parser remember how the numbers are written, in
+	// hexadecimal, decimal or with a unit, so that ToFlashmap writes them the
+	// same way, also for starts and sizes changed after parsing if their
+	// new values are still multiples of the unit. Otherwise numbers are
+	// written in hexadecimal, or in decimal with their unit.
+	Lossless bool
+	// Dialects are the names of the registered dialects whose keywords,
+	// attributes and hooks are enabled, see RegisterDialect.
+	Dialects []string
+	// Mode is the tolerance for duplicate names, overlapping sub-sections
+	// and an omitted root size, see ParseMode.
+	Mode ParseMode
+}
+
+// factors calls `f` for every factor of the expression, recursively.
+func (e *Expr) factors(f func(*Factor) error) error {
+	terms := []*Term{e.Left}
+	for _, op := range e.Right {
+		terms = append(terms, op.Term)
+	}
+	for _, t := range terms {
+		factors := []*Factor{t.Left}
+		for _, op := range t.Right {
+			factors = append(factors, op.Factor)
+		}
+		for _, fa := range factors {
+			if fa.Sub != nil {
+				if err := fa.Sub.factors(f); err != nil {
+					return err
+				}
+			} else if err := f(fa); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// bindConsts sets the value of the constants referenced by the expression.
+func (e *Expr) bindConsts(consts map[string]int64) error {
+	return e.factors(func(fa *Factor) error {
+		if fa.Const == "" {
+			return nil
+		}
+		v, ok := consts[fa.Const]
+		if !ok {
+			return fmt.Errorf("undefined constant %s", fa.Const)
+		}
+		fa.value = v
+		return nil
+	})
+}
+
+// evalDefines evaluates the constants defined in a file and the ones in the
+// options, and returns their values, and the definitions in effect, that are
+// the ones in the file, replaced by the options, followed by the ones only in
+// the options sorted by name.
+func evalDefines(defines []*Define, opts ParseOptions) (map[string]int64, []*Define, error) {
+	consts := make(map[string]int64)
+	overrides := make(map[string]*Define)
+	for name, value := range opts.Defines {
+		se, err := syntax.ParseExpr(value)
+		if err != nil {
+			return nil, nil, fmt.Errorf("constant %s: %v", name, err)
+		}
+		e := fromSyntaxExpr(se)
+		v, err := e.Value()
+		if err != nil {
+			return nil, nil, fmt.Errorf("constant %s: %v", name, err)
+		}
+		if !opts.Lossless {
+			e.forgetBases()
+		}
+		consts[name] = v
+		overrides[name] = &Define{Name: name, Expr: e}
+	}
+	var effective []*Define
+	for _, d := range defines {
+		if o, ok := overrides[d.Name]; ok {
+			effective = append(effective, o)
+			delete(overrides, d.Name)
+			continue
+		}
+		if err := d.Expr.bindConsts(consts); err != nil {
+			return nil, nil, fmt.Errorf("%d:%d: constant %s: %v", d.Pos.Line, d.Pos.Column, d.Name, err)
+		}
+		v, err := d.Expr.Value()
+		if err != nil {
+			return nil, nil, fmt.Errorf("%d:%d: constant %s: %v", d.Pos.Line, d.Pos.Column, d.Name, err)
+		}
+		if !opts.Lossless {
+			d.Expr.forgetBases()
+		}
+		consts[d.Name] = v
+		effective = append(effective, d)
+	}
+	var names []string
+	for name := range overrides {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		effective = append(effective, overrides[name])
+	}
+	return consts, effective, nil
+}
+
+// formatDefines returns the definitions as they are written at the start of a
+// fmd file, followed by an empty line.
+func formatDefines(defines []*Define, fm *formatter) string {
+	if len(defines) == 0 {
+		return ""
+	}
+	var b strings.Builder
+	for _, d := range defines {
+		b.WriteString(d.format(fm) + "\n")
+	}
+	b.WriteString("\n")
+	return b.String()
+}
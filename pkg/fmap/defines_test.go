@@ -0,0 +1,64 @@
+package fmap
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+const definesLayout = `define ROM_SIZE 16M
+define RW_SIZE ($ROM_SIZE - 0x200000) / 0x2
+
+FLASH $ROM_SIZE {
+	SI_DESC 0x200000
+	RW_SECTION_A $RW_SIZE
+	RW_SECTION_B@0x200000 + $RW_SIZE $RW_SIZE
+}
+`
+
+func TestDefines(t *testing.T) {
+	f, err := Parse(strings.NewReader(definesLayout))
+	require.NoError(t, err)
+	assert.Equal(t, int64(0x1000000), f.ByteSize())
+	assert.Equal(t, int64(0x700000), f.Find("RW_SECTION_A", false).Size)
+	b := f.Find("RW_SECTION_B", false)
+	assert.Equal(t, int64(0x900000), *b.Start)
+	assert.Equal(t, int64(0x700000), b.Size)
+	assert.NoError(t, f.CheckCoverage())
+	assert.Equal(t, definesLayout, f.ToFlashmap())
+}
+
+func TestDefinesOverride(t *testing.T) {
+	f, err := ParseWithOptions(strings.NewReader(definesLayout), ParseOptions{
+		Defines: map[string]string{"ROM_SIZE": "8M", "UNUSED": "4k"},
+	})
+	require.NoError(t, err)
+	assert.Equal(t, int64(0x800000), f.ByteSize())
+	assert.Equal(t, int64(0x300000), f.Find("RW_SECTION_A", false).Size)
+	assert.NoError(t, f.CheckCoverage())
+	assert.True(t, strings.HasPrefix(f.ToFlashmap(), "define ROM_SIZE 8M\ndefine RW_SIZE ($ROM_SIZE - 0x200000) / 0x2\ndefine UNUSED 4k\n\nFLASH $ROM_SIZE {\n"))
+}
+
+func TestDefinesOnlyOptions(t *testing.T) {
+	f, err := ParseWithOptions(strings.NewReader("FLASH $ROM_SIZE"), ParseOptions{
+		Defines: map[string]string{"ROM_SIZE": "0x1000 * 4"},
+	})
+	require.NoError(t, err)
+	assert.Equal(t, int64(0x4000), f.ByteSize())
+}
+
+func TestDefinesErrors(t *testing.T) {
+	_, err := Parse(strings.NewReader("FLASH $ROM_SIZE"))
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "section FLASH (1): undefined constant ROM_SIZE")
+
+	_, err = Parse(strings.NewReader("define A $B\ndefine B 4k\nFLASH $A"))
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "1:1: constant A: undefined constant B")
+
+	_, err = ParseWithOptions(strings.NewReader("FLASH 4k"), ParseOptions{Defines: map[string]string{"A": "4k +"}})
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "constant A")
+}
@@ -0,0 +1,185 @@
+package fmap
+
+// DefragStrategy selects how DefragWith removes the free space between
+// sections.
+type DefragStrategy int
+
+// Defragmentation strategies.
+const (
+	// DefragCompact moves every section right after its previous sibling,
+	// so that the free space of each section ends up after its last
+	// sub-section. This is what Defrag does.
+	DefragCompact DefragStrategy = iota
+	// DefragMinimizeMoves leaves the free space of each section in a single
+	// range, anywhere between its sub-sections, choosing the one that
+	// minimizes the number of bytes whose position in the flash changes: the
+	// sub-sections before it are moved towards the start of the section,
+	// and the ones after it towards the end. This keeps the image updates
+	// and the partial flashes that follow a layout change small. Sections
+	// whose sub-sections overlap are left as they are.
+	DefragMinimizeMoves
+)
+
+// String returns the name of the strategy.
+func (st DefragStrategy) String() string {
+	switch st {
+	case DefragCompact:
+		return "Compact"
+	case DefragMinimizeMoves:
+		return "MinimizeMoves"
+	default:
+		return "Unknown"
+	}
+}
+
+// DefragWith is like Defrag, with the given strategy. Unknown strategies
+// don't move any section.
+func (s *Section) DefragWith(strategy DefragStrategy, dryRun bool) []Move {
+	if strategy == DefragCompact {
+		return s.Defrag(dryRun)
+	}
+	var (
+		t     Transform
+		moves []Move
+	)
+	if strategy == DefragMinimizeMoves {
+		defragMinimal(s, s.Name, dryRun, func() Transform {
+			if t.Step == 0 {
+				t = s.record("Defrag(" + strategy.String() + ")")
+			}
+			return t
+		}, &moves)
+	}
+	return moves
+}
+
+// MovedBytes returns the number of bytes whose position in the flash changes
+// with the moves, counting the bytes of nested sections once.
+func MovedBytes(moves []Move) int64 {
+	moved := make(map[*Section]bool, len(moves))
+	for _, m := range moves {
+		moved[m.Section] = true
+	}
+	var total int64
+	for _, m := range moves {
+		nested := false
+		for p := m.Section.parent; p != nil; p = p.parent {
+			if moved[p] {
+				nested = true
+				break
+			}
+		}
+		if !nested {
+			total += size(m.Section)
+		}
+	}
+	return total
+}
+
+// packSegment returns the new starts of the sections `secs`, sorted by start,
+// moved within the range [lo, hi) so that the free space of the range is in a
+// single place, moving as few bytes as possible.
+func packSegment(secs []*Section, starts []int64, lo, hi int64) []int64 {
+	n := len(secs)
+	prefix := make([]int64, n+1)
+	for i, sec := range secs {
+		prefix[i+1] = prefix[i] + size(sec)
+	}
+	// the sections before `k` are packed at the start of the range, and the
+	// others at its end. If they don't fit, they are all packed at the start
+	minK := 0
+	if prefix[n] > hi-lo {
+		minK = n
+	}
+	best, bestCost := []int64(nil), int64(-1)
+	for k := n; k >= minK; k-- {
+		newStarts := make([]int64, n)
+		cost := int64(0)
+		for i := range secs {
+			if i < k {
+				newStarts[i] = lo + prefix[i]
+			} else {
+				newStarts[i] = hi - (prefix[n] - prefix[i])
+			}
+			if newStarts[i] != starts[i] {
+				cost += size(secs[i])
+			}
+		}
+		if bestCost < 0 || cost < bestCost {
+			best, bestCost = newStarts, cost
+		}
+	}
+	return best
+}
+
+// defragMinimal implements DefragMinimizeMoves for the sub-sections of `s`,
+// whose path is `path`, recursively, and appends the moves to `moves`. The
+// sections are not modified if `dryRun` is true.
+func defragMinimal(s *Section, path string, dryRun bool, step func() Transform, moves *[]Move) {
+	sorted, sortedStarts := sortedChildren(s)
+	// markers stay where they are
+	var (
+		secs   []*Section
+		starts []int64
+	)
+	for i, sec := range sorted {
+		if !sec.IsMarker() {
+			secs, starts = append(secs, sec), append(starts, sortedStarts[i])
+		}
+	}
+	newStarts := make(map[*Section]int64, len(secs))
+	overlap := false
+	for i := 1; i < len(secs); i++ {
+		if starts[i] < starts[i-1]+size(secs[i-1]) {
+			overlap = true
+		}
+	}
+	if !overlap {
+		// protected sections stay in place, and split the range of `s`
+		// into segments that are packed independently
+		lo, first := int64(0), 0
+		for i := 0; i <= len(secs); i++ {
+			if i < len(secs) && !secs[i].isProtected() {
+				continue
+			}
+			hi := size(s)
+			if i < len(secs) {
+				hi = starts[i]
+			}
+			for j, st := range packSegment(secs[first:i], starts[first:i], lo, hi) {
+				newStarts[secs[first+j]] = st
+			}
+			if i < len(secs) {
+				lo, first = starts[i]+size(secs[i]), i+1
+			}
+		}
+	}
+
+	oldStarts := childStarts(s)
+	changed := false
+	for idx, sec := range s.Sections {
+		if st, ok := newStarts[sec]; ok && st != oldStarts[idx] {
+			changed = true
+		}
+	}
+	for idx, sec := range s.Sections {
+		secPath := path + "/" + sec.Name
+		if st, ok := newStarts[sec]; ok && st != oldStarts[idx] {
+			*moves = append(*moves, Move{Path: secPath, Section: sec, OldStart: oldStarts[idx], NewStart: st})
+			if !dryRun {
+				sec.touch(step())
+			}
+		}
+		// the starts become explicit, as the previous siblings may move
+		if changed && !dryRun {
+			st, ok := newStarts[sec]
+			if !ok {
+				st = oldStarts[idx]
+			}
+			sec.Start = &st
+		}
+		if !sec.isProtected() {
+			defragMinimal(sec, secPath, dryRun, step, moves)
+		}
+	}
+}
@@ -0,0 +1,69 @@
+package fmap
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+const defragLayout = `FLASH 0x10000 {
+	A@0x0 0x1000
+	B@0x2000 0x1000
+	C@0x8000 0x4000 {
+		C1@0x1000 0x1000
+	}
+	D@0xc000 0x4000
+}`
+
+func TestDefragMinimizeMoves(t *testing.T) {
+	f, err := Parse(strings.NewReader(defragLayout))
+	require.NoError(t, err)
+
+	// compacting moves B, C and D, while only B needs to move to leave a
+	// single free range before C
+	compact := f.DefragWith(DefragCompact, true)
+	assert.Equal(t, int64(0x9000), MovedBytes(compact))
+
+	moves := f.DefragWith(DefragMinimizeMoves, false)
+	var got []string
+	for _, m := range moves {
+		got = append(got, m.String())
+	}
+	assert.Equal(t, []string{"FLASH/B: 0x2000 -> 0x1000", "FLASH/C/C1: 0x1000 -> 0x0"}, got)
+	assert.Equal(t, int64(0x2000), MovedBytes(moves))
+	assert.Equal(t, `FLASH 0x10000 {
+	A@0x0 0x1000
+	B@0x1000 0x1000
+	C@0x8000 0x4000 {
+		C1@0x0 0x1000
+	}
+	D@0xc000 0x4000
+}
+`, f.ToFlashmap())
+	assert.Equal(t, "Defrag(MinimizeMoves)", f.Find("B", false).Provenance()[0].Op)
+	assert.Empty(t, f.DefragWith(DefragMinimizeMoves, false))
+}
+
+func TestDefragMinimizeMovesSingleRange(t *testing.T) {
+	// the free space is already in a single range, at the start
+	f, err := Parse(strings.NewReader("FLASH 0x10000 { A@0x1000 0x1000 B 0xe000 }"))
+	require.NoError(t, err)
+	assert.Equal(t, 1, len(f.Defrag(true)))
+	assert.Empty(t, f.DefragWith(DefragMinimizeMoves, false))
+
+	// nothing changes in dry-run mode
+	f, err = Parse(strings.NewReader(defragLayout))
+	require.NoError(t, err)
+	assert.Equal(t, 2, len(f.DefragWith(DefragMinimizeMoves, true)))
+	assert.Equal(t, int64(0x2000), *f.Find("B", false).Start)
+}
+
+func TestMovedBytes(t *testing.T) {
+	f, err := Parse(strings.NewReader(defragLayout))
+	require.NoError(t, err)
+	c, c1 := f.Find("C", false), f.Find("C1", true)
+	assert.Equal(t, int64(0x4000), MovedBytes([]Move{{Section: c}, {Section: c1}}))
+	assert.Equal(t, int64(0), MovedBytes(nil))
+}
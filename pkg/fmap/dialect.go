@@ -0,0 +1,226 @@
+package fmap
+
+import (
+	"bytes"
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// Dialect is a vendor-specific extension of the fmd grammar, registered with
+// RegisterDialect and enabled by name with ParseOptions.Dialects, so that a
+// single parser can read the layouts of heterogeneous trees.
+type Dialect struct {
+	// Name identifies the dialect in ParseOptions.Dialects.
+	Name string
+	// Keywords are the extra directives of the dialect, by keyword. A line
+	// of the file whose first word is a keyword is a directive, see
+	// Directive: it is removed before parsing, and passed to the handler
+	// afterwards. Directives can be written before the root section or in
+	// a section body.
+	Keywords map[string]KeywordHandler
+	// Attributes are the extra attributes of the dialect, by key. The
+	// handler is called for every section that has the attribute.
+	Attributes map[string]AttributeHandler
+	// PostParse, if not nil, is called with the root section once the file
+	// is parsed, after the directives and the attributes are handled.
+	PostParse func(root *Section) error
+}
+
+// Directive is a line of a fmd file handled by a dialect, e.g.
+// "board_id 0x1234" for the "board_id" keyword.
+type Directive struct {
+	Keyword string
+	// Args are the space-separated words that follow the keyword, up to the
+	// end of the line or to a // comment.
+	Args []string
+	Line int
+	// Section is the innermost section whose body contains the directive, or
+	// nil if the directive is outside of the root section.
+	Section *Section
+}
+
+// KeywordHandler handles a directive, see Dialect.Keywords.
+type KeywordHandler func(d Directive) error
+
+// AttributeHandler handles the value of an attribute of a section, see
+// Dialect.Attributes.
+type AttributeHandler func(sec *Section, value string) error
+
+// dialects are the registered dialects, by name.
+var dialects = make(map[string]*Dialect)
+
+// RegisterDialect makes a dialect available to the parser. It is meant to be
+// called from the init function of the package implementing the dialect, and
+// panics if the name is empty or already registered, or if a keyword is
+// reserved by the core grammar.
+func RegisterDialect(d Dialect) {
+	if d.Name == "" {
+		panic("fmap: RegisterDialect with an empty name")
+	}
+	if _, ok := dialects[d.Name]; ok {
+		panic("fmap: RegisterDialect called twice for dialect " + d.Name)
+	}
+	for kw := range d.Keywords {
+		if kw == "define" || kw == "include" {
+			panic(fmt.Sprintf("fmap: dialect %s: keyword %q is reserved", d.Name, kw))
+		}
+	}
+	dialects[d.Name] = &d
+}
+
+// Dialects returns the names of the registered dialects, sorted.
+func Dialects() []string {
+	var names []string
+	for name := range dialects {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// lookupDialects returns the registered dialects with the given names.
+func lookupDialects(names []string) ([]*Dialect, error) {
+	var ret []*Dialect
+	for _, name := range names {
+		d, ok := dialects[name]
+		if !ok {
+			return nil, fmt.Errorf("unknown dialect %q", name)
+		}
+		ret = append(ret, d)
+	}
+	return ret, nil
+}
+
+// dialectDirective is a directive extracted from the source, with the dialect
+// handling it.
+type dialectDirective struct {
+	Directive
+	handler KeywordHandler
+}
+
+// extractDirectives removes the directive lines of the dialects from `data`,
+// leaving them empty so that the positions of the other tokens don't change,
+// and returns them. Lines in block comments are left untouched.
+func extractDirectives(data []byte, ds []*Dialect) ([]byte, []dialectDirective, error) {
+	if len(ds) == 0 {
+		return data, nil, nil
+	}
+	handlers := make(map[string]KeywordHandler)
+	for _, d := range ds {
+		for kw, h := range d.Keywords {
+			if _, ok := handlers[kw]; ok {
+				return nil, nil, fmt.Errorf("dialect %s: keyword %q is defined by another dialect", d.Name, kw)
+			}
+			handlers[kw] = h
+		}
+	}
+	var directives []dialectDirective
+	inComment := false
+	lines := bytes.Split(data, []byte("\n"))
+	for idx, line := range lines {
+		startsInComment := inComment
+		inComment = endsInComment(string(line), inComment)
+		if startsInComment {
+			continue
+		}
+		text := string(line)
+		if i := strings.Index(text, "//"); i >= 0 {
+			text = text[:i]
+		}
+		words := strings.Fields(text)
+		if len(words) == 0 {
+			continue
+		}
+		h, ok := handlers[words[0]]
+		if !ok {
+			continue
+		}
+		directives = append(directives, dialectDirective{
+			Directive: Directive{Keyword: words[0], Args: words[1:], Line: idx + 1},
+			handler:   h,
+		})
+		lines[idx] = nil
+	}
+	return bytes.Join(lines, []byte("\n")), directives, nil
+}
+
+// endsInComment returns whether a block comment is still open at the end of
+// `line`, given whether one was open at its start.
+func endsInComment(line string, inComment bool) bool {
+	for {
+		if inComment {
+			i := strings.Index(line, "*/")
+			if i < 0 {
+				return true
+			}
+			line, inComment = line[i+2:], false
+			continue
+		}
+		block, comment := strings.Index(line, "/*"), strings.Index(line, "//")
+		if block < 0 || (comment >= 0 && comment < block) {
+			return false
+		}
+		line, inComment = line[block+2:], true
+	}
+}
+
+// innermostSection returns the innermost section of the tree rooted at `s`,
+// parsed from `filename`, whose span contains `line`, or nil.
+func innermostSection(s *Section, filename string, line int) *Section {
+	if s.span.Filename != filename || line <= s.span.StartLine || line > s.span.EndLine {
+		return nil
+	}
+	for _, sec := range s.Sections {
+		if found := innermostSection(sec, filename, line); found != nil {
+			return found
+		}
+	}
+	return s
+}
+
+// applyDialects calls the handlers of the directives, the attribute handlers
+// and the post-parse hooks of the dialects on the parsed tree rooted at `s`.
+func applyDialects(s *Section, filename string, ds []*Dialect, directives []dialectDirective) error {
+	for _, d := range directives {
+		d.Section = innermostSection(s, filename, d.Line)
+		if err := d.handler(d.Directive); err != nil {
+			return fmt.Errorf("%d: %s: %v", d.Line, d.Keyword, err)
+		}
+	}
+	for _, d := range ds {
+		if len(d.Attributes) == 0 {
+			continue
+		}
+		if err := walkAttributes(s, d); err != nil {
+			return err
+		}
+	}
+	for _, d := range ds {
+		if d.PostParse == nil {
+			continue
+		}
+		if err := d.PostParse(s); err != nil {
+			return fmt.Errorf("dialect %s: %v", d.Name, err)
+		}
+	}
+	return nil
+}
+
+// walkAttributes calls the attribute handlers of the dialect `d` for `s` and
+// its sub-sections, recursively.
+func walkAttributes(s *Section, d *Dialect) error {
+	for _, a := range s.Attributes {
+		if h, ok := d.Attributes[a.Key]; ok {
+			if err := h(s, a.Value); err != nil {
+				return sectionErrorf(s, "attribute %s: %v", a.Key, err)
+			}
+		}
+	}
+	for _, sec := range s.Sections {
+		if err := walkAttributes(sec, d); err != nil {
+			return err
+		}
+	}
+	return nil
+}
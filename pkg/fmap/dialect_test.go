@@ -0,0 +1,82 @@
+package fmap
+
+import (
+	"errors"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestDialect(t *testing.T) {
+	var directives []Directive
+	var packed []string
+	postParsed := false
+	RegisterDialect(Dialect{
+		Name: "test-vendor",
+		Keywords: map[string]KeywordHandler{
+			"board_id": func(d Directive) error {
+				directives = append(directives, d)
+				return nil
+			},
+		},
+		Attributes: map[string]AttributeHandler{
+			"packing": func(sec *Section, value string) error {
+				packed = append(packed, sec.Name+"="+value)
+				return nil
+			},
+		},
+		PostParse: func(root *Section) error {
+			postParsed = true
+			return nil
+		},
+	})
+	defer delete(dialects, "test-vendor")
+	assert.Contains(t, Dialects(), "test-vendor")
+
+	data := `board_id 0x1234 rev2 // the board
+FLASH 0x2000 {
+	/*
+	board_id commented out
+	*/
+	RO[packing=lz4] 0x1000 {
+		board_id 7
+	}
+	RW 0x1000
+}`
+	f, err := ParseWithOptions(strings.NewReader(data), ParseOptions{Dialects: []string{"test-vendor"}})
+	require.NoError(t, err)
+	require.Equal(t, 2, len(directives))
+	assert.Equal(t, Directive{Keyword: "board_id", Args: []string{"0x1234", "rev2"}, Line: 1}, directives[0])
+	assert.Equal(t, 7, directives[1].Line)
+	assert.Equal(t, f.Find("RO", false), directives[1].Section)
+	assert.Equal(t, []string{"RO=lz4"}, packed)
+	assert.True(t, postParsed)
+	// the positions of the other lines are preserved
+	assert.Equal(t, 9, f.Find("RW", false).Span().StartLine)
+
+	// without the dialect, the directives are syntax errors
+	_, err = Parse(strings.NewReader(data))
+	assert.Error(t, err)
+
+	_, err = ParseWithOptions(strings.NewReader(data), ParseOptions{Dialects: []string{"nope"}})
+	assert.EqualError(t, err, `unknown dialect "nope"`)
+
+	assert.Panics(t, func() { RegisterDialect(Dialect{Name: "test-vendor"}) })
+	defer delete(dialects, "x")
+	assert.Panics(t, func() { RegisterDialect(Dialect{Name: "x", Keywords: map[string]KeywordHandler{"define": nil}}) })
+}
+
+func TestDialectErrors(t *testing.T) {
+	errBad := errors.New("bad board")
+	RegisterDialect(Dialect{
+		Name: "test-strict",
+		Keywords: map[string]KeywordHandler{
+			"board_id": func(d Directive) error { return errBad },
+		},
+	})
+	defer delete(dialects, "test-strict")
+	_, err := ParseWithOptions(strings.NewReader("FLASH 0x1000 {\n\tboard_id 1\n}"), ParseOptions{Dialects: []string{"test-strict"}})
+	assert.EqualError(t, err, "2: board_id: bad board")
+}
@@ -0,0 +1,117 @@
+package fmap
+
+import "fmt"
+
+// ChangeKind is the kind of a Change between two flashmaps.
+type ChangeKind string
+
+// Kinds of changes reported by Diff.
+const (
+	Added   ChangeKind = "added"
+	Removed ChangeKind = "removed"
+	Resized ChangeKind = "resized"
+	Moved   ChangeKind = "moved"
+)
+
+// Change is a difference between two flashmaps, affecting the section at
+// Path. Offsets are relative to the root section, and sizes are in bytes.
+// For added sections only the new values are set, for removed sections only
+// the old ones.
+type Change struct {
+	Kind      ChangeKind `json:"kind"`
+	Path      string     `json:"path"`
+	OldOffset int64      `json:"old_offset"`
+	OldSize   int64      `json:"old_size"`
+	NewOffset int64      `json:"new_offset"`
+	NewSize   int64      `json:"new_size"`
+}
+
+// String returns a human-readable description of the change.
+func (c Change) String() string {
+	switch c.Kind {
+	case Added:
+		return fmt.Sprintf("added %s at 0x%x, size 0x%x", c.Path, c.NewOffset, c.NewSize)
+	case Removed:
+		return fmt.Sprintf("removed %s at 0x%x, size 0x%x", c.Path, c.OldOffset, c.OldSize)
+	case Resized:
+		return fmt.Sprintf("resized %s from 0x%x to 0x%x", c.Path, c.OldSize, c.NewSize)
+	case Moved:
+		return fmt.Sprintf("moved %s from 0x%x to 0x%x", c.Path, c.OldOffset, c.NewOffset)
+	default:
+		return fmt.Sprintf("%s %s", c.Kind, c.Path)
+	}
+}
+
+// flatSection is a section of a tree, with its path and its offset relative
+// to the root.
+type flatSection struct {
+	Path    string
+	Offset  int64
+	Section *Section
+}
+
+// flatten returns the root section and all of its sub-sections, in pre-order,
+// with their paths and offsets relative to the root.
+func flatten(s *Section) []flatSection {
+	ret := []flatSection{{Path: s.Name, Offset: 0, Section: s}}
+	var visit func(s *Section, path string, base int64)
+	visit = func(s *Section, path string, base int64) {
+		starts := childStarts(s)
+		for idx, sec := range s.Sections {
+			secPath := path + "/" + sec.Name
+			ret = append(ret, flatSection{Path: secPath, Offset: base + starts[idx], Section: sec})
+			visit(sec, secPath, base+starts[idx])
+		}
+	}
+	visit(s, s.Name, 0)
+	return ret
+}
+
+// Diff returns the semantic differences between two flashmaps. Sections are
+// matched by path: sections only present in `a` are reported as removed,
+// sections only present in `b` as added, and sections present in both as
+// resized and/or moved if their size or offset differs. If several sections
+// have the same path, only the first one is considered.
+func Diff(a, b *Section) []Change {
+	oldSections, newSections := flatten(a), flatten(b)
+	index := func(sections []flatSection) map[string]flatSection {
+		ret := make(map[string]flatSection, len(sections))
+		for _, fs := range sections {
+			if _, ok := ret[fs.Path]; !ok {
+				ret[fs.Path] = fs
+			}
+		}
+		return ret
+	}
+	oldByPath, newByPath := index(oldSections), index(newSections)
+
+	var changes []Change
+	for _, o := range oldSections {
+		if oldByPath[o.Path].Section != o.Section {
+			continue
+		}
+		n, ok := newByPath[o.Path]
+		if !ok {
+			changes = append(changes, Change{Kind: Removed, Path: o.Path, OldOffset: o.Offset, OldSize: size(o.Section)})
+			continue
+		}
+		c := Change{Path: o.Path, OldOffset: o.Offset, OldSize: size(o.Section), NewOffset: n.Offset, NewSize: size(n.Section)}
+		if c.OldSize != c.NewSize {
+			c.Kind = Resized
+			changes = append(changes, c)
+		}
+		if c.OldOffset != c.NewOffset {
+			c.Kind = Moved
+			changes = append(changes, c)
+		}
+	}
+	for _, n := range newSections {
+		if newByPath[n.Path].Section != n.Section {
+			continue
+		}
+		if _, ok := oldByPath[n.Path]; !ok {
+			changes = append(changes, Change{Kind: Added, Path: n.Path, NewOffset: n.Offset, NewSize: size(n.Section)})
+		}
+	}
+	return changes
+}
@@ -0,0 +1,55 @@
+package fmap
+
+import (
+	"encoding/json"
+	"os"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestDiff(t *testing.T) {
+	fd1, err := os.Open("test_data/chromeos.fmd")
+	require.NoError(t, err)
+	defer fd1.Close()
+	a, err := Parse(fd1)
+	require.NoError(t, err)
+	fd2, err := os.Open("test_data/chromeos_defragmented.fmd")
+	require.NoError(t, err)
+	defer fd2.Close()
+	b, err := Parse(fd2)
+	require.NoError(t, err)
+
+	changes := Diff(a, b)
+	var got []string
+	for _, c := range changes {
+		got = append(got, c.String())
+	}
+	assert.Equal(t, []string{
+		"removed FLASH/SI_BIOS/RW_SECTION_A at 0x200000, size 0x3e8000",
+		"removed FLASH/SI_BIOS/RW_SECTION_A/VBLOCK_A at 0x200000, size 0x10000",
+		"removed FLASH/SI_BIOS/RW_SECTION_A/FW_MAIN_A at 0x210000, size 0x3d7fc0",
+		"removed FLASH/SI_BIOS/RW_SECTION_A/RW_FWID_A at 0x5e7fc0, size 0x40",
+	}, got[:4])
+	assert.Equal(t, "moved FLASH/SI_BIOS/RW_SECTION_B from 0x5e8000 to 0x200000", got[4])
+	assert.Empty(t, Diff(a, a))
+}
+
+func TestDiffAddedResized(t *testing.T) {
+	a := Section{Name: "FLASH", Size: 0x2000, Sections: []*Section{
+		{Name: "A", Size: 0x1000},
+	}}
+	b := Section{Name: "FLASH", Size: 0x2000, Sections: []*Section{
+		{Name: "A", Size: 0x800},
+		{Name: "B", Size: 0x800},
+	}}
+	changes := Diff(&a, &b)
+	require.Equal(t, 2, len(changes))
+	assert.Equal(t, Change{Kind: Resized, Path: "FLASH/A", OldSize: 0x1000, NewSize: 0x800}, changes[0])
+	assert.Equal(t, Change{Kind: Added, Path: "FLASH/B", NewOffset: 0x800, NewSize: 0x800}, changes[1])
+
+	data, err := json.Marshal(changes[1])
+	require.NoError(t, err)
+	assert.Equal(t, `{"kind":"added","path":"FLASH/B","old_offset":0,"old_size":0,"new_offset":2048,"new_size":2048}`, string(data))
+}
@@ -0,0 +1,54 @@
+package fmap
+
+import (
+	"fmt"
+	"strings"
+)
+
+// ToDOT returns the hierarchy of the section tree in the Graphviz DOT
+// language, e.g. to render it with `dot -Tsvg` for documentation and reviews.
+// Every section is a node labeled with its name, flags, range relative to the
+// root and size, with an edge from its parent. Read-only sections are filled
+// in grey, and free regions, see IsUnused, are dashed.
+func (s *Section) ToDOT() string {
+	var b strings.Builder
+	fmt.Fprintf(&b, "digraph %q {\n", s.Name)
+	b.WriteString("\trankdir=LR;\n")
+	b.WriteString("\tnode [shape=box, fontname=monospace];\n")
+	n := 0
+	var visit func(sec *Section, offset int64, parent string)
+	visit = func(sec *Section, offset int64, parent string) {
+		id := fmt.Sprintf("n%d", n)
+		n++
+		label := sec.Name
+		if len(sec.Flags) > 0 {
+			label += "(" + sec.Flags.String() + ")"
+		}
+		label += fmt.Sprintf("\\n0x%x-0x%x\\n0x%x bytes", offset, offset+size(sec), size(sec))
+		var attrs []string
+		switch {
+		case sec.IsReadOnly():
+			attrs = append(attrs, "style=filled", "fillcolor=lightgrey")
+		case sec.IsUnused():
+			attrs = append(attrs, "style=dashed")
+		}
+		fmt.Fprintf(&b, "\t%s [label=\"%s\"%s];\n", id, label, dotAttrs(attrs))
+		if parent != "" {
+			fmt.Fprintf(&b, "\t%s -> %s;\n", parent, id)
+		}
+		for idx, st := range childStarts(sec) {
+			visit(sec.Sections[idx], offset+st, id)
+		}
+	}
+	visit(s, 0, "")
+	b.WriteString("}\n")
+	return b.String()
+}
+
+// dotAttrs returns the node attributes `attrs` to append to a label.
+func dotAttrs(attrs []string) string {
+	if len(attrs) == 0 {
+		return ""
+	}
+	return ", " + strings.Join(attrs, ", ")
+}
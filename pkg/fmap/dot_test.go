@@ -0,0 +1,34 @@
+package fmap
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestToDOT(t *testing.T) {
+	f, err := Parse(strings.NewReader(`FLASH 0x10000 {
+	WP_RO 0x8000 {
+		FMAP 0x1000
+		RO_UNUSED 0x7000
+	}
+	RW_MAIN(CBFS PRESERVE) 0x8000
+}`))
+	require.NoError(t, err)
+	assert.Equal(t, `digraph "FLASH" {
+	rankdir=LR;
+	node [shape=box, fontname=monospace];
+	n0 [label="FLASH\n0x0-0x10000\n0x10000 bytes"];
+	n1 [label="WP_RO\n0x0-0x8000\n0x8000 bytes", style=filled, fillcolor=lightgrey];
+	n0 -> n1;
+	n2 [label="FMAP\n0x0-0x1000\n0x1000 bytes", style=filled, fillcolor=lightgrey];
+	n1 -> n2;
+	n3 [label="RO_UNUSED\n0x1000-0x8000\n0x7000 bytes", style=filled, fillcolor=lightgrey];
+	n1 -> n3;
+	n4 [label="RW_MAIN(CBFS PRESERVE)\n0x8000-0x10000\n0x8000 bytes"];
+	n0 -> n4;
+}
+`, f.ToDOT())
+}
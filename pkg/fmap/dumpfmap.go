@@ -0,0 +1,208 @@
+package fmap
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+)
+
+// DumpFmapFormat is an output format of the dump_fmap command of ChromeOS
+// futility, see ToDumpFmap.
+type DumpFmapFormat int
+
+// dump_fmap output formats.
+const (
+	// DumpFmapDefault is the default output of dump_fmap: the header fields,
+	// then the area number, area_offset, area_size and area_name of every
+	// area, one per line.
+	DumpFmapDefault DumpFmapFormat = iota
+	// DumpFmapParseable is the output of dump_fmap -p: one "NAME OFFSET
+	// SIZE" line per area, in decimal.
+	DumpFmapParseable
+	// DumpFmapHuman is the output of dump_fmap -h: the tree of the areas,
+	// with their start, end and size in hexadecimal, indented by nesting.
+	// As dump_fmap rebuilds the tree from the ranges of the areas, so does
+	// this format, see FromBinary.
+	DumpFmapHuman
+)
+
+// ToDumpFmap returns the listing of the areas of the binary FMAP of the
+// section tree, see ToBinary, in one of the output formats of dump_fmap, so
+// that the scripts parsing them can be fed from a flashmap. The "hit at"
+// line that dump_fmap prints when scanning an image is omitted. An error is
+// returned if the binary FMAP cannot be generated.
+func (s *Section) ToDumpFmap(format DumpFmapFormat) (string, error) {
+	hdr, areas, err := toAreas(s)
+	if err != nil {
+		return "", err
+	}
+	var b strings.Builder
+	switch format {
+	case DumpFmapDefault:
+		fmt.Fprintf(&b, "fmap_signature   %s\n", Signature)
+		fmt.Fprintf(&b, "fmap_version:    %d.%d\n", hdr.VerMajor, hdr.VerMinor)
+		fmt.Fprintf(&b, "fmap_base:       0x%x\n", hdr.Base)
+		fmt.Fprintf(&b, "fmap_size:       0x%08x (%d)\n", hdr.Size, hdr.Size)
+		fmt.Fprintf(&b, "fmap_name:       %s\n", s.Name)
+		fmt.Fprintf(&b, "fmap_nareas:     %d\n", hdr.NAreas)
+		for idx, a := range areas {
+			name, _ := parseName(a.Name)
+			fmt.Fprintf(&b, "area:            %d\n", idx+1)
+			fmt.Fprintf(&b, "area_offset:     0x%08x\n", a.Offset)
+			fmt.Fprintf(&b, "area_size:       0x%08x (%d)\n", a.Size, a.Size)
+			fmt.Fprintf(&b, "area_name:       %s\n", name)
+		}
+	case DumpFmapParseable:
+		for _, a := range areas {
+			name, _ := parseName(a.Name)
+			fmt.Fprintf(&b, "%s %d %d\n", name, a.Offset, a.Size)
+		}
+	case DumpFmapHuman:
+		back, err := fromAreas(hdr, append([]binaryArea(nil), areas...))
+		if err != nil {
+			return "", err
+		}
+		b.WriteString("# name                     start       end         size\n")
+		for _, fs := range flatten(back)[1:] {
+			indent := strings.Repeat("  ", strings.Count(fs.Path, "/")-1)
+			fmt.Fprintf(&b, "%s%-25s  %08x    %08x    %08x\n", indent, fs.Section.Name, fs.Offset, fs.Offset+size(fs.Section), size(fs.Section))
+		}
+	default:
+		return "", fmt.Errorf("unknown dump_fmap format %d", int(format))
+	}
+	return b.String(), nil
+}
+
+// dumpFmapRootName is the name of the root section of the flashmaps parsed
+// from the output of dump_fmap -p, which does not print the FMAP header.
+const dumpFmapRootName = "FLASH"
+
+// ParseDumpFmap parses a listing of dump_fmap, in the default format or in
+// the parseable one of dump_fmap -p, see DumpFmapFormat, and returns the
+// corresponding section tree, rebuilding the hierarchy by range containment
+// as FromBinary does for a binary FMAP. The format is detected from the first
+// line, and the "hit at" line printed when scanning an image is ignored. As
+// dump_fmap -p does not print the FMAP header, the root section of its
+// listings is called FLASH, starts at 0 and ends with the last area. Flags are
+// not part of the listings, so none is set. Empty lines are ignored.
+func ParseDumpFmap(r io.Reader) (*Section, error) {
+	var (
+		hdr       binaryHeader
+		areas     []binaryArea
+		fields    map[string]string
+		parseable bool
+		areaLine  int
+		nareas    = -1
+		lines     = 0
+	)
+	copy(hdr.Signature[:], Signature)
+	hdr.VerMajor, hdr.VerMinor = VersionMajor, VersionMinor
+	// endArea adds the area whose fields were read so far, if any
+	endArea := func() error {
+		if fields == nil {
+			return nil
+		}
+		area, err := parseFmapDecodeArea(fields)
+		if err != nil {
+			return fmt.Errorf("%d: %v", areaLine, err)
+		}
+		areas, fields = append(areas, area), nil
+		return nil
+	}
+	scanner := bufio.NewScanner(r)
+	for lineno := 1; scanner.Scan(); lineno++ {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "hit at ") {
+			continue
+		}
+		words := strings.Fields(line)
+		lines++
+		if lines == 1 {
+			parseable = words[0] != "fmap_signature"
+		}
+		if parseable {
+			if len(words) != 3 {
+				return nil, fmt.Errorf("%d: expected NAME OFFSET SIZE", lineno)
+			}
+			area, err := parseFmapDecodeArea(map[string]string{"area_name": words[0], "area_offset": words[1], "area_size": words[2]})
+			if err != nil {
+				return nil, fmt.Errorf("%d: %v", lineno, err)
+			}
+			areas = append(areas, area)
+			if end := uint64(area.Offset) + uint64(area.Size); end > uint64(hdr.Size) {
+				if end > uint64(^uint32(0)) {
+					return nil, fmt.Errorf("%d: area ends past 32 bits", lineno)
+				}
+				hdr.Size = uint32(end)
+			}
+			continue
+		}
+
+		key, value := strings.TrimSuffix(words[0], ":"), ""
+		if len(words) > 1 {
+			value = words[1]
+		}
+		var err error
+		switch key {
+		case "fmap_signature":
+			if value != Signature {
+				err = fmt.Errorf("invalid FMAP signature %q", value)
+			}
+		case "fmap_version":
+			var major, minor uint64
+			parts := strings.SplitN(value, ".", 2)
+			if major, err = strconv.ParseUint(parts[0], 10, 8); err == nil && len(parts) == 2 {
+				minor, err = strconv.ParseUint(parts[1], 10, 8)
+			}
+			if err != nil || len(parts) != 2 {
+				err = fmt.Errorf("invalid fmap_version %q", value)
+			}
+			hdr.VerMajor, hdr.VerMinor = uint8(major), uint8(minor)
+		case "fmap_base":
+			hdr.Base, err = parseFmapDecodeUint(map[string]string{key: value}, key, 64)
+		case "fmap_size":
+			var n uint64
+			n, err = parseFmapDecodeUint(map[string]string{key: value}, key, 32)
+			hdr.Size = uint32(n)
+		case "fmap_name":
+			hdr.Name, err = fmapDecodeName(value)
+		case "fmap_nareas":
+			var n uint64
+			n, err = parseFmapDecodeUint(map[string]string{key: value}, key, 16)
+			nareas = int(n)
+		case "area":
+			if err := endArea(); err != nil {
+				return nil, err
+			}
+			fields, areaLine = make(map[string]string), lineno
+		case "area_offset", "area_size", "area_name":
+			if fields == nil {
+				err = fmt.Errorf("%s before the area number", key)
+			} else {
+				fields[key] = value
+			}
+		default:
+			err = fmt.Errorf("unknown field %q", key)
+		}
+		if err != nil {
+			return nil, fmt.Errorf("%d: %v", lineno, err)
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+	if lines == 0 {
+		return nil, ErrNoFMAP
+	}
+	if err := endArea(); err != nil {
+		return nil, err
+	}
+	if parseable {
+		hdr.Name, _ = fmapDecodeName(dumpFmapRootName)
+	} else if nareas >= 0 && nareas != len(areas) {
+		return nil, fmt.Errorf("the header lists %d areas, but %d are present", nareas, len(areas))
+	}
+	return fromAreas(hdr, areas)
+}
@@ -0,0 +1,136 @@
+package fmap
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+const dumpFmapLayout = `FLASH@0xff000000 0x10000 {
+	WP_RO 0x8000 {
+		FMAP 0x1000
+		GBB 0x7000
+	}
+	RW_A(PRESERVE) 0x8000
+}`
+
+func TestToDumpFmap(t *testing.T) {
+	f, err := ParseString(dumpFmapLayout)
+	require.NoError(t, err)
+
+	out, err := f.ToDumpFmap(DumpFmapDefault)
+	require.NoError(t, err)
+	assert.Equal(t, `fmap_signature   __FMAP__
+fmap_version:    1.1
+fmap_base:       0xff000000
+fmap_size:       0x00010000 (65536)
+fmap_name:       FLASH
+fmap_nareas:     4
+area:            1
+area_offset:     0x00000000
+area_size:       0x00008000 (32768)
+area_name:       WP_RO
+area:            2
+area_offset:     0x00000000
+area_size:       0x00001000 (4096)
+area_name:       FMAP
+area:            3
+area_offset:     0x00001000
+area_size:       0x00007000 (28672)
+area_name:       GBB
+area:            4
+area_offset:     0x00008000
+area_size:       0x00008000 (32768)
+area_name:       RW_A
+`, out)
+
+	out, err = f.ToDumpFmap(DumpFmapParseable)
+	require.NoError(t, err)
+	assert.Equal(t, "WP_RO 0 32768\nFMAP 0 4096\nGBB 4096 28672\nRW_A 32768 32768\n", out)
+
+	out, err = f.ToDumpFmap(DumpFmapHuman)
+	require.NoError(t, err)
+	assert.Equal(t, `# name                     start       end         size
+WP_RO                      00000000    00008000    00008000
+  FMAP                       00000000    00001000    00001000
+  GBB                        00001000    00008000    00007000
+RW_A                       00008000    00010000    00008000
+`, out)
+
+	_, err = f.ToDumpFmap(DumpFmapFormat(42))
+	assert.Error(t, err)
+}
+
+func TestToDumpFmapRebuiltNesting(t *testing.T) {
+	// B is listed in A, but dump_fmap nests it in C, the smallest area that
+	// contains it
+	f, err := ParseString(`FLASH 0x4000 {
+	A 0x4000 {
+		C 0x2000
+		B@0x1000 0x1000
+	}
+}`)
+	require.NoError(t, err)
+	out, err := f.ToDumpFmap(DumpFmapHuman)
+	require.NoError(t, err)
+	assert.Equal(t, `# name                     start       end         size
+A                          00000000    00004000    00004000
+  C                          00000000    00002000    00002000
+    B                          00001000    00002000    00001000
+`, out)
+
+	losses, err := f.Fidelity("dump_fmap_h")
+	require.NoError(t, err)
+	assert.Contains(t, losses, Loss{Kind: LossNesting, Path: "FLASH/A/B", Message: "nested in FLASH/A, read back in FLASH/A/C"})
+}
+
+func TestParseDumpFmap(t *testing.T) {
+	f, err := ParseString(dumpFmapLayout)
+	require.NoError(t, err)
+	want := `FLASH@0xff000000 0x10000 {
+	WP_RO@0x0 0x8000 {
+		FMAP@0x0 0x1000
+		GBB@0x1000 0x7000
+	}
+	RW_A@0x8000 0x8000
+}
+`
+	out, err := f.ToDumpFmap(DumpFmapDefault)
+	require.NoError(t, err)
+	back, err := ParseDumpFmap(strings.NewReader("hit at 0x00000000\n" + out))
+	require.NoError(t, err)
+	assert.Equal(t, want, back.ToFlashmap())
+	assert.Equal(t, back, back.Find("GBB", true).Root())
+
+	// the header is not printed with -p
+	out, err = f.ToDumpFmap(DumpFmapParseable)
+	require.NoError(t, err)
+	back, err = ParseDumpFmap(strings.NewReader(out))
+	require.NoError(t, err)
+	assert.Equal(t, strings.Replace(want, "@0xff000000", "@0x0", 1), back.ToFlashmap())
+}
+
+func TestParseDumpFmapErrors(t *testing.T) {
+	header := "fmap_signature   __FMAP__\nfmap_version:    1.1\nfmap_base:       0x0\nfmap_size:       0x00001000 (4096)\nfmap_name:       FLASH\nfmap_nareas:     1\n"
+	for _, tc := range []struct {
+		dump string
+		err  string
+	}{
+		{"", "no FMAP found"},
+		{"fmap_signature   __FMAQ__", `1: invalid FMAP signature "__FMAQ__"`},
+		{"fmap_signature   __FMAP__\nfmap_version:    one", `2: invalid fmap_version "one"`},
+		{header, "the header lists 1 areas, but 0 are present"},
+		{header + "area_name:       A", "7: area_name before the area number"},
+		{header + "area:            1\narea_offset:     0x0\narea_name:       A", "7: missing area_size"},
+		{header + "area:            1\narea_flags:      static", `8: unknown field "area_flags"`},
+		{header + "A 0 16", `7: unknown field "A"`},
+		{"A 0 16\nB 16", "2: expected NAME OFFSET SIZE"},
+		{"A 0 0x100000000", `1: invalid area_size "0x100000000"`},
+	} {
+		_, err := ParseDumpFmap(strings.NewReader(tc.dump))
+		require.Error(t, err, tc.dump)
+		assert.Contains(t, err.Error(), tc.err)
+	}
+}
@@ -0,0 +1,288 @@
+package fmap
+
+import (
+	"fmt"
+	"regexp"
+)
+
+// sectionNameRe matches the names the parser accepts for sections.
+var sectionNameRe = regexp.MustCompile(`^[A-Za-z_][A-Za-z0-9_]*$`)
+
+// findName returns a section of the tree rooted at `s`, other than `except`,
+// called `name` or having it as an alias, or nil.
+func findName(s, except *Section, name string) *Section {
+	if s != except && s.hasName(name) {
+		return s
+	}
+	for _, sec := range s.Sections {
+		if found := findName(sec, except, name); found != nil {
+			return found
+		}
+	}
+	return nil
+}
+
+// checkNewName returns an error about `sec` if `name` is not a valid section
+// name, or if it is used by a section of the tree of `sec` other than
+// `except`.
+func checkNewName(sec, except *Section, name string) error {
+	if !sectionNameRe.MatchString(name) || name == "define" || name == "include" {
+		return sectionErrorf(sec, "invalid section name %q", name)
+	}
+	if other := findName(sec.Root(), except, name); other != nil {
+		return sectionErrorf(sec, "cannot use the name %s: it is used by %s", name, other.Path())
+	}
+	return nil
+}
+
+// Rename renames the first section called `oldName`, at any depth, to
+// `newName`. The new name must be a valid identifier, and must not be the
+// name or an alias of another section of the tree, so that lookups by name
+// stay unambiguous. A *NotFoundError is returned if there is no such section.
+// Protected read-only sections cannot be renamed, see ProtectReadOnly.
+func (s *Section) Rename(oldName, newName string) error {
+	sec, _, _ := findFunc(s, oldName, true)
+	if sec == nil {
+		return &NotFoundError{Name: oldName}
+	}
+	if err := checkNewName(sec, sec, newName); err != nil {
+		return err
+	}
+	op := fmt.Sprintf("Rename(%s, %s)", oldName, newName)
+	if err := checkWritable(sec, op); err != nil {
+		return err
+	}
+	sec.Name = newName
+	sec.touch(s.record(op))
+	return nil
+}
+
+// Move moves the first section called `name`, at any depth, to the section
+// `newParentPath`, made of the names of a sub-section of `s` and of its
+// descendants separated by "/", e.g. "RW_SECTION_A", or `s` itself if empty.
+// The section keeps its offset in the flash, so it must be in the range of
+// the new parent, and must not overlap with its new siblings, see Insert. The
+// siblings it leaves keep their starts. A *NotFoundError is returned if a
+// section does not exist, and nothing is changed if the move fails, or if it
+// would modify a protected section, see ProtectReadOnly.
+func (s *Section) Move(name, newParentPath string) error {
+	sec, idx, parent := findFunc(s, name, true)
+	if sec == nil {
+		return &NotFoundError{Name: name}
+	}
+	newParent := s
+	if newParentPath != "" {
+		chain, err := childPath(s, newParentPath)
+		if err != nil {
+			return err
+		}
+		newParent = chain[len(chain)-1]
+	}
+	if newParent == parent {
+		return nil
+	}
+	for p := newParent; p != nil; p = p.parent {
+		if p == sec {
+			return sectionErrorf(sec, "cannot move a section into itself")
+		}
+	}
+	op := fmt.Sprintf("Move(%s, %s)", name, newParentPath)
+	for _, sc := range []*Section{sec, parent} {
+		if err := checkWritable(sc, op); err != nil {
+			return err
+		}
+	}
+	offset, _ := offsetOf(s, sec)
+	parentOffset, _ := offsetOf(s, newParent)
+	if offset < parentOffset || offset+size(sec) > parentOffset+size(newParent) {
+		return sectionErrorf(sec, "range 0x%x-0x%x is outside of %s at 0x%x-0x%x", offset, offset+size(sec), newParent.Name, parentOffset, parentOffset+size(newParent))
+	}
+
+	// detach the section, keeping the starts of the following siblings, and
+	// remember the previous state to restore it if the insertion fails
+	oldSections := append([]*Section(nil), parent.Sections...)
+	oldStarts := make([]*int64, len(parent.Sections))
+	for i, st := range childStarts(parent) {
+		oldStarts[i] = parent.Sections[i].Start
+		if i > idx && parent.Sections[i].Start == nil {
+			st := st
+			parent.Sections[i].Start = &st
+		}
+	}
+	secStart := sec.Start
+	parent.Sections = append(parent.Sections[:idx:idx], parent.Sections[idx+1:]...)
+	sec.parent = nil
+
+	t, err := newParent.insert(sec, AtOffset(offset-parentOffset), op)
+	if err != nil {
+		parent.Sections = oldSections
+		for i, st := range oldStarts {
+			parent.Sections[i].Start = st
+		}
+		sec.parent, sec.Start = parent, secStart
+		return err
+	}
+	parent.touch(t)
+	return nil
+}
+
+// reorderByStart sorts the sub-sections of `s` by start, recursively, and
+// returns whether any was reordered.
+func reorderByStart(s *Section, step func() Transform) bool {
+	changed := false
+	secs, _ := sortedChildren(s)
+	for idx, sec := range secs {
+		if s.Sections[idx] == sec {
+			continue
+		}
+		// the starts become explicit, as the previous siblings change
+		for i, st := range childStarts(s) {
+			if s.Sections[i].Start == nil {
+				st := st
+				s.Sections[i].Start = &st
+			}
+		}
+		s.Sections = secs
+		s.touch(step())
+		changed = true
+		break
+	}
+	for _, sec := range s.Sections {
+		if reorderByStart(sec, step) {
+			changed = true
+		}
+	}
+	return changed
+}
+
+// ReorderByStart sorts the sub-sections of every section of the tree by
+// start, so that the order of the text representation matches the order in
+// the flash. Sections with the same start keep their order. It returns true
+// if any section was reordered. Reordering does not change the offsets of the
+// sections, so protected read-only sections are reordered too.
+func (s *Section) ReorderByStart() bool {
+	var t Transform
+	return reorderByStart(s, func() Transform {
+		if t.Step == 0 {
+			t = s.record("ReorderByStart()")
+		}
+		return t
+	})
+}
+
+// Split divides the first leaf section called `name`, at any depth, into two
+// adjacent sections called `newNames`: the first one spans the first `offset`
+// bytes of the section, and the second one the rest, e.g. to carve a VPD
+// region out of the end of a blob. The first section is the original one,
+// renamed and resized, and the second one gets its flags and attributes,
+// except the aliases, and is placed right after the first one. The section is
+// left unchanged if the offset is not strictly inside it, if a name is used
+// by another section, or if it is protected, see ProtectReadOnly. A
+// *NotFoundError is returned if there is no such section.
+func (s *Section) Split(name string, offset int64, newNames [2]string) error {
+	sec, idx, parent := findFunc(s, name, true)
+	if sec == nil {
+		return &NotFoundError{Name: name}
+	}
+	if len(sec.Sections) > 0 {
+		return sectionErrorf(sec, "cannot split a section with sub-sections")
+	}
+	if offset <= 0 || offset >= size(sec) {
+		return sectionErrorf(sec, "split offset 0x%x is not inside the section (0x%x bytes)", offset, size(sec))
+	}
+	if newNames[0] == newNames[1] {
+		return sectionErrorf(sec, "the split sections must have different names, got %s twice", newNames[0])
+	}
+	for _, n := range newNames {
+		if err := checkNewName(sec, sec, n); err != nil {
+			return err
+		}
+	}
+	op := fmt.Sprintf("Split(%s, 0x%x, %s, %s)", name, offset, newNames[0], newNames[1])
+	if err := checkWritable(sec, op); err != nil {
+		return err
+	}
+
+	second := &Section{
+		Name:   newNames[1],
+		Flags:  append(Flags(nil), sec.Flags...),
+		Unit:   sec.Unit,
+		parent: parent,
+	}
+	setSize(second, size(sec)-offset)
+	for _, a := range sec.Attributes {
+		if a.Key != AttrAlias {
+			second.SetAttribute(a.Key, a.Value)
+		}
+	}
+	sec.Name = newNames[0]
+	setSize(sec, offset)
+	parent.Sections = append(parent.Sections[:idx+1], append([]*Section{second}, parent.Sections[idx+1:]...)...)
+	setJournal(second, s.journal)
+	t := s.record(op)
+	sec.touch(t)
+	second.touch(t)
+	parent.touch(t)
+	return nil
+}
+
+// Merge combines the adjacent sibling sections `nameA` and `nameB`, the first
+// ones with these names at any depth, into the one of the two that comes
+// first in the flash, which keeps its name, flags and attributes, and grows
+// to cover both. The sub-sections of the other one are moved into it, keeping
+// their offsets in the flash. The sections are left unchanged if they are not
+// adjacent siblings, or if they are protected, see ProtectReadOnly. A
+// *NotFoundError is returned if a section does not exist.
+func (s *Section) Merge(nameA, nameB string) error {
+	a, idxA, parent := findFunc(s, nameA, true)
+	if a == nil {
+		return &NotFoundError{Name: nameA}
+	}
+	b, idxB, parentB := findFunc(s, nameB, true)
+	if b == nil {
+		return &NotFoundError{Name: nameB}
+	}
+	if a == b {
+		return sectionErrorf(a, "cannot merge a section with itself")
+	}
+	if parent != parentB {
+		return sectionErrorf(b, "cannot merge with %s: the sections are not siblings", a.Name)
+	}
+	starts := childStarts(parent)
+	if starts[idxB] < starts[idxA] {
+		a, b, idxA, idxB = b, a, idxB, idxA
+	}
+	if starts[idxA]+size(a) != starts[idxB] {
+		return sectionErrorf(b, "cannot merge with %s: the sections are not adjacent", a.Name)
+	}
+	op := fmt.Sprintf("Merge(%s, %s)", nameA, nameB)
+	for _, sec := range []*Section{a, b} {
+		if err := checkWritable(sec, op); err != nil {
+			return err
+		}
+	}
+
+	t := s.record(op)
+	for i, st := range childStarts(b) {
+		child := b.Sections[i]
+		st += size(a)
+		child.Start = &st
+		child.parent = a
+		child.touch(t)
+		a.Sections = append(a.Sections, child)
+	}
+	// the sections following the removed one keep their starts, unless the
+	// merged section is right before them
+	for i, st := range starts {
+		if i > idxB && idxB != idxA+1 && parent.Sections[i].Start == nil {
+			st := st
+			parent.Sections[i].Start = &st
+		}
+	}
+	setSize(a, size(a)+size(b))
+	parent.Sections = append(parent.Sections[:idxB:idxB], parent.Sections[idxB+1:]...)
+	b.parent, b.Sections = nil, nil
+	a.touch(t)
+	parent.touch(t)
+	return nil
+}
@@ -0,0 +1,163 @@
+package fmap
+
+import (
+	"errors"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+const editLayout = `FLASH 0x10000 {
+	RO 0x8000 {
+		FMAP 0x1000
+		RO_VPD[alias=VPD] 0x1000
+	}
+	RW 0x8000 {
+		RW_A 0x4000
+	}
+}`
+
+func TestRename(t *testing.T) {
+	f, err := Parse(strings.NewReader(editLayout))
+	require.NoError(t, err)
+
+	require.NoError(t, f.Rename("RW_A", "RW_SECTION_A"))
+	sec := f.Find("RW_SECTION_A", true)
+	require.NotNil(t, sec)
+	assert.Equal(t, "Rename(RW_A, RW_SECTION_A)", sec.Provenance()[0].Op)
+
+	err = f.Rename("RW_SECTION_A", "VPD")
+	assert.EqualError(t, err, "section RW_SECTION_A (7, introduced by Rename(RW_A, RW_SECTION_A) at step 1): cannot use the name VPD: it is used by FLASH/RO/RO_VPD")
+	assert.Error(t, f.Rename("RW_SECTION_A", "1ST"))
+	assert.Error(t, f.Rename("RW_SECTION_A", "include"))
+	assert.True(t, errors.Is(f.Rename("NOPE", "X"), ErrSectionNotFound))
+
+	f.ProtectReadOnly(true)
+	f.Find("RO", false).SetAttribute(AttrReadOnly, "true")
+	assert.True(t, errors.Is(f.Rename("FMAP", "X"), ErrReadOnly))
+}
+
+func TestMove(t *testing.T) {
+	f, err := Parse(strings.NewReader(`FLASH 0x10000 {
+	WP_RO 0x8000 {
+		FMAP 0x1000
+	}
+	RO_VPD@0x1000 0x1000
+	RW@0x8000 0x8000 {
+		RW_A 0x4000
+	}
+}`))
+	require.NoError(t, err)
+	assert.Equal(t, 1, len(f.Validate()))
+
+	// the section keeps its offset, which is not in RW
+	err = f.Move("RO_VPD", "RW")
+	assert.EqualError(t, err, "section RO_VPD (5): range 0x1000-0x2000 is outside of RW at 0x8000-0x10000")
+	assert.Equal(t, f, f.Find("RO_VPD", true).Parent())
+
+	require.NoError(t, f.Move("RO_VPD", "WP_RO"))
+	assert.Equal(t, `FLASH 0x10000 {
+	WP_RO 0x8000 {
+		FMAP 0x1000
+		RO_VPD@0x1000 0x1000
+	}
+	RW@0x8000 0x8000 {
+		RW_A 0x4000
+	}
+}
+`, f.ToFlashmap())
+	assert.Empty(t, f.Validate())
+	assert.Equal(t, "Move(RO_VPD, WP_RO)", f.Provenance()[0].Op)
+
+	// the section would overlap with its new siblings
+	err = f.Move("RW_A", "")
+	assert.EqualError(t, err, "section RW_A (7): range 0x8000-0xc000 overlaps with RW at 0x8000-0x10000")
+	assert.Equal(t, f.Find("RW", false), f.Find("RW_A", true).Parent())
+
+	assert.EqualError(t, f.Move("WP_RO", "WP_RO/FMAP"), "section WP_RO (2-4, introduced by Move(RO_VPD, WP_RO) at step 1): cannot move a section into itself")
+	assert.True(t, errors.Is(f.Move("NOPE", ""), ErrSectionNotFound))
+	assert.True(t, errors.Is(f.Move("FMAP", "NOPE"), ErrSectionNotFound))
+
+	f.ProtectReadOnly(true)
+	assert.True(t, errors.Is(f.Move("FMAP", ""), ErrReadOnly))
+}
+
+func TestReorderByStart(t *testing.T) {
+	f, err := Parse(strings.NewReader(`FLASH 0x3000 {
+	C@0x2000 0x1000
+	A@0x0 0x1000
+	B 0x1000
+}`))
+	require.NoError(t, err)
+
+	assert.True(t, f.ReorderByStart())
+	assert.Equal(t, `FLASH 0x3000 {
+	A@0x0 0x1000
+	B@0x1000 0x1000
+	C@0x2000 0x1000
+}
+`, f.ToFlashmap())
+	assert.Equal(t, "ReorderByStart()", f.Provenance()[0].Op)
+	assert.False(t, f.ReorderByStart())
+}
+
+func TestSplit(t *testing.T) {
+	f, err := Parse(strings.NewReader(`FLASH 0x10000 {
+	RW_LEGACY(PRESERVE)[alias=LEGACY owner=fw] 64k
+}`))
+	require.NoError(t, err)
+
+	require.NoError(t, f.Split("LEGACY", 0xc000, [2]string{"RW_LEGACY", "RW_VPD"}))
+	assert.Equal(t, `FLASH 0x10000 {
+	RW_LEGACY(PRESERVE)[alias=LEGACY owner=fw] 48k
+	RW_VPD(PRESERVE)[owner=fw] 16k
+}
+`, f.ToFlashmap())
+	assert.Equal(t, "Split(LEGACY, 0xc000, RW_LEGACY, RW_VPD)", f.Find("RW_VPD", false).Provenance()[0].Op)
+	assert.NoError(t, f.CheckCoverage())
+
+	for _, tc := range []struct {
+		offset int64
+		names  [2]string
+		err    string
+	}{
+		{0, [2]string{"A", "B"}, "split offset 0x0 is not inside the section (0x4000 bytes)"},
+		{0x4000, [2]string{"A", "B"}, "split offset 0x4000 is not inside the section"},
+		{0x1000, [2]string{"A", "A"}, "got A twice"},
+		{0x1000, [2]string{"A", "RW_LEGACY"}, "cannot use the name RW_LEGACY: it is used by FLASH/RW_LEGACY"},
+		{0x1000, [2]string{"A", "B C"}, `invalid section name "B C"`},
+	} {
+		err := f.Split("RW_VPD", tc.offset, tc.names)
+		require.Error(t, err)
+		assert.Contains(t, err.Error(), tc.err)
+	}
+	assert.Error(t, f.Split("FLASH", 0x1000, [2]string{"A", "B"}))
+}
+
+func TestMerge(t *testing.T) {
+	f, err := Parse(strings.NewReader(`FLASH 0x10000 {
+	RW_B@0x4000 0x4000 {
+		FW_B 0x4000
+	}
+	RW_A@0x0 0x4000
+	RW_C@0x8000 0x8000
+}`))
+	require.NoError(t, err)
+
+	assert.EqualError(t, f.Merge("RW_A", "RW_C"), "section RW_C (6): cannot merge with RW_A: the sections are not adjacent")
+	assert.EqualError(t, f.Merge("RW_A", "FW_B"), "section FW_B (3): cannot merge with RW_A: the sections are not siblings")
+
+	// the first one in the flash is RW_A
+	require.NoError(t, f.Merge("RW_B", "RW_A"))
+	assert.Equal(t, `FLASH 0x10000 {
+	RW_A@0x0 0x8000 {
+		FW_B@0x4000 0x4000
+	}
+	RW_C@0x8000 0x8000
+}
+`, f.ToFlashmap())
+	assert.Equal(t, f.Find("RW_A", false), f.Find("FW_B", true).Parent())
+	assert.Nil(t, f.Find("RW_B", true))
+}
@@ -0,0 +1,118 @@
+package fmap
+
+import "sort"
+
+// EqualOptions are the options of Equal.
+type EqualOptions struct {
+	// IgnoreUnits compares the sizes in bytes only, so that 4k and 0x1000
+	// are equal.
+	IgnoreUnits bool
+	// IgnoreFlags and IgnoreAttributes ignore the flags and the attributes
+	// of the sections.
+	IgnoreFlags      bool
+	IgnoreAttributes bool
+	// IgnoreOrder compares the sub-sections of each section ordered by start
+	// and name, instead of in the order they are listed, and the flags and
+	// attributes as sets.
+	IgnoreOrder bool
+}
+
+// Equal returns true if the section trees rooted at `s` and `other` describe
+// the same layout: sections with the same names, sizes in bytes, starts
+// relative to their parents, units, flags and attributes, and the same
+// sub-sections, compared recursively. Starts are compared once resolved, so
+// an implicit start is equal to the explicit start with the same value, and
+// the starts of the roots are compared only if both are set. How the numbers
+// are written, the source spans and the provenance are ignored.
+func (s *Section) Equal(other *Section, opts EqualOptions) bool {
+	if s.Start != nil && other.Start != nil && *s.Start != *other.Start {
+		return false
+	}
+	return equal(s, other, opts)
+}
+
+// equal implements Equal for sections whose starts were already compared.
+func equal(a, b *Section, opts EqualOptions) bool {
+	if a.Name != b.Name || size(a) != size(b) || len(a.Sections) != len(b.Sections) {
+		return false
+	}
+	if !opts.IgnoreUnits && a.Unit != b.Unit {
+		return false
+	}
+	if !opts.IgnoreFlags && !equalStrings(flagStrings(a.Flags), flagStrings(b.Flags), opts.IgnoreOrder) {
+		return false
+	}
+	if !opts.IgnoreAttributes && !equalStrings(attributeStrings(a.Attributes), attributeStrings(b.Attributes), opts.IgnoreOrder) {
+		return false
+	}
+	aSecs, aStarts := a.Sections, childStarts(a)
+	bSecs, bStarts := b.Sections, childStarts(b)
+	if opts.IgnoreOrder {
+		aSecs, aStarts = sortedByStartAndName(a)
+		bSecs, bStarts = sortedByStartAndName(b)
+	}
+	for idx := range aSecs {
+		if aStarts[idx] != bStarts[idx] || !equal(aSecs[idx], bSecs[idx], opts) {
+			return false
+		}
+	}
+	return true
+}
+
+// sortedByStartAndName returns the sub-sections of `s` and their starts,
+// ordered by start and, for the same start, by name.
+func sortedByStartAndName(s *Section) ([]*Section, []int64) {
+	secs, starts := s.Sections, childStarts(s)
+	order := make([]int, len(secs))
+	for idx := range order {
+		order[idx] = idx
+	}
+	sort.SliceStable(order, func(i, j int) bool {
+		if starts[order[i]] != starts[order[j]] {
+			return starts[order[i]] < starts[order[j]]
+		}
+		return secs[order[i]].Name < secs[order[j]].Name
+	})
+	retSecs := make([]*Section, len(order))
+	retStarts := make([]int64, len(order))
+	for i, idx := range order {
+		retSecs[i], retStarts[i] = secs[idx], starts[idx]
+	}
+	return retSecs, retStarts
+}
+
+func flagStrings(flags Flags) []string {
+	ret := make([]string, len(flags))
+	for idx, fl := range flags {
+		ret[idx] = string(fl)
+	}
+	return ret
+}
+
+func attributeStrings(attrs []*Attribute) []string {
+	ret := make([]string, len(attrs))
+	for idx, a := range attrs {
+		ret[idx] = a.String()
+	}
+	return ret
+}
+
+// equalStrings returns true if `a` and `b` have the same elements, in the
+// same order unless `anyOrder` is set.
+func equalStrings(a, b []string, anyOrder bool) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	if anyOrder {
+		a = append([]string(nil), a...)
+		b = append([]string(nil), b...)
+		sort.Strings(a)
+		sort.Strings(b)
+	}
+	for idx := range a {
+		if a[idx] != b[idx] {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,57 @@
+package fmap
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestEqual(t *testing.T) {
+	for _, tc := range []struct {
+		name  string
+		a, b  string
+		opts  EqualOptions
+		equal bool
+	}{
+		{"same", "FLASH 0x2000 {\n\tA 0x1000\n\tB 0x1000\n}", "FLASH 0x2000 {\n\tA 0x1000\n\tB 0x1000\n}", EqualOptions{}, true},
+		{"resolved starts", "FLASH 0x2000 {\n\tA 0x1000\n\tB 0x1000\n}", "FLASH 0x2000 {\n\tA@0 4096\n\tB@0x800 + 0x800 0x1000\n}", EqualOptions{}, true},
+		{"define", "define SZ 0x1000\nFLASH 0x2000 {\n\tA $SZ\n}", "FLASH 0x2000 {\n\tA 0x1000\n}", EqualOptions{}, true},
+		{"sizes differ", "FLASH 0x2000 {\n\tA 0x1000\n}", "FLASH 0x2000 {\n\tA 0x800\n}", EqualOptions{IgnoreUnits: true, IgnoreOrder: true}, false},
+		{"starts differ", "FLASH 0x2000 {\n\tA@0 0x1000\n}", "FLASH 0x2000 {\n\tA@0x1000 0x1000\n}", EqualOptions{}, false},
+		{"root starts differ", "FLASH@0 0x2000", "FLASH@0x1000 0x2000", EqualOptions{}, false},
+		{"root start omitted", "FLASH@0 0x2000", "FLASH 0x2000", EqualOptions{}, true},
+		{"names differ", "FLASH 0x2000 {\n\tA 0x1000\n}", "FLASH 0x2000 {\n\tB 0x1000\n}", EqualOptions{}, false},
+		{"units", "FLASH 8k", "FLASH 0x2000", EqualOptions{}, false},
+		{"ignore units", "FLASH 8k", "FLASH 0x2000", EqualOptions{IgnoreUnits: true}, true},
+		{"flags", "FLASH 0x2000 {\n\tA(CBFS) 0x1000\n}", "FLASH 0x2000 {\n\tA 0x1000\n}", EqualOptions{}, false},
+		{"ignore flags", "FLASH 0x2000 {\n\tA(CBFS) 0x1000\n}", "FLASH 0x2000 {\n\tA 0x1000\n}", EqualOptions{IgnoreFlags: true}, true},
+		{"attributes", "FLASH 0x2000 {\n\tA[owner=fw] 0x1000\n}", "FLASH 0x2000 {\n\tA 0x1000\n}", EqualOptions{}, false},
+		{"ignore attributes", "FLASH 0x2000 {\n\tA[owner=fw] 0x1000\n}", "FLASH 0x2000 {\n\tA 0x1000\n}", EqualOptions{IgnoreAttributes: true}, true},
+		{"order", "FLASH 0x2000 {\n\tA@0 0x1000\n\tB@0x1000 0x1000\n}", "FLASH 0x2000 {\n\tB@0x1000 0x1000\n\tA@0 0x1000\n}", EqualOptions{}, false},
+		{"ignore order", "FLASH 0x2000 {\n\tA@0 0x1000\n\tB@0x1000 0x1000\n}", "FLASH 0x2000 {\n\tB@0x1000 0x1000\n\tA@0 0x1000\n}", EqualOptions{IgnoreOrder: true}, true},
+		{"flag order", "FLASH 0x2000 {\n\tA(CBFS PRESERVE) 0x1000\n}", "FLASH 0x2000 {\n\tA(PRESERVE CBFS) 0x1000\n}", EqualOptions{}, false},
+		{"ignore flag order", "FLASH 0x2000 {\n\tA(CBFS PRESERVE) 0x1000\n}", "FLASH 0x2000 {\n\tA(PRESERVE CBFS) 0x1000\n}", EqualOptions{IgnoreOrder: true}, true},
+		{"nested", "FLASH 0x2000 {\n\tA 0x2000 {\n\t\tB 0x1000\n\t}\n}", "FLASH 0x2000 {\n\tA 0x2000 {\n\t\tB@0x1000 0x1000\n\t}\n}", EqualOptions{}, false},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			a, err := ParseString(tc.a)
+			require.NoError(t, err)
+			b, err := ParseString(tc.b)
+			require.NoError(t, err)
+			assert.Equal(t, tc.equal, a.Equal(b, tc.opts))
+			assert.Equal(t, tc.equal, b.Equal(a, tc.opts))
+		})
+	}
+}
+
+func TestEqualBinary(t *testing.T) {
+	f, err := ParseString("FLASH@0 0x4000 {\n\tRO 8k {\n\t\tFMAP 0x1000\n\t}\n\tRW_NVRAM(PRESERVE) 0x2000\n}")
+	require.NoError(t, err)
+	bin, err := f.ToBinary()
+	require.NoError(t, err)
+	back, err := FromBinary(bin)
+	require.NoError(t, err)
+	assert.False(t, f.Equal(back, EqualOptions{}))
+	assert.True(t, f.Equal(back, EqualOptions{IgnoreUnits: true}))
+}
@@ -0,0 +1,32 @@
+package fmap
+
+import (
+	"errors"
+	"fmt"
+
+	"github.com/insomniacslk/fmap/pkg/fmap/syntax"
+)
+
+// ParseError is a syntax error in a fmd file, with the position and the text
+// of the offending token, see package syntax.
+type ParseError = syntax.ParseError
+
+// ErrSectionNotFound is matched, via errors.Is, by the errors returned when a
+// section cannot be found.
+var ErrSectionNotFound = errors.New("section not found")
+
+// NotFoundError is returned by lookup and mutation operations when the
+// requested section does not exist.
+type NotFoundError struct {
+	Name string
+}
+
+// Error implements the error interface.
+func (e *NotFoundError) Error() string {
+	return fmt.Sprintf("section %s not found", e.Name)
+}
+
+// Is makes NotFoundError match ErrSectionNotFound.
+func (e *NotFoundError) Is(target error) bool {
+	return target == ErrSectionNotFound
+}
@@ -0,0 +1,46 @@
+package fmap
+
+import (
+	"errors"
+	"os"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestLookup(t *testing.T) {
+	fd, err := os.Open("test_data/chromeos.fmd")
+	require.NoError(t, err)
+	defer fd.Close()
+	f, err := Parse(fd)
+	require.NoError(t, err)
+
+	sec, err := f.Lookup("FW_MAIN_A", true)
+	require.NoError(t, err)
+	assert.Equal(t, "FW_MAIN_A", sec.Name)
+
+	_, err = f.Lookup("FW_MAIN_A", false)
+	require.Error(t, err)
+	assert.True(t, errors.Is(err, ErrSectionNotFound))
+	var nerr *NotFoundError
+	require.True(t, errors.As(err, &nerr))
+	assert.Equal(t, "FW_MAIN_A", nerr.Name)
+	assert.Equal(t, "section FW_MAIN_A not found", err.Error())
+}
+
+func TestDelete(t *testing.T) {
+	fd, err := os.Open("test_data/chromeos.fmd")
+	require.NoError(t, err)
+	defer fd.Close()
+	f, err := Parse(fd)
+	require.NoError(t, err)
+
+	sec, err := f.Delete("RW_MISC", true)
+	require.NoError(t, err)
+	assert.Equal(t, "RW_MISC", sec.Name)
+	assert.Nil(t, f.Find("RW_MISC", true))
+
+	_, err = f.Delete("RW_MISC", true)
+	assert.True(t, errors.Is(err, ErrSectionNotFound))
+}
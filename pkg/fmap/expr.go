@@ -0,0 +1,313 @@
+package fmap
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"strings"
+)
+
+// Expr is an arithmetic expression used for the start and size of a section,
+// e.g. "0x1000000 - 0x200000" or "4k + 0x100". Expressions support the +, -,
+// * and / operators with the usual precedence, and parentheses. The parser
+// evaluates them into Section.Start and Section.Size, and keeps them in
+// Section.StartExpr and Section.SizeExpr so that ToFlashmap can write them
+// back.
+type Expr struct {
+	Left  *Term
+	Right []*ExprOp
+}
+
+// ExprOp is an addition or subtraction in an Expr.
+type ExprOp struct {
+	Op   string
+	Term *Term
+}
+
+// Term is a product of factors in an Expr.
+type Term struct {
+	Left  *Factor
+	Right []*TermOp
+}
+
+// TermOp is a multiplication or division in a Term.
+type TermOp struct {
+	Op     string
+	Factor *Factor
+}
+
+// Factor is a number, optionally followed by a unit, a reference to a
+// constant, or a parenthesized expression.
+type Factor struct {
+	Number *Number
+	Unit   string
+	Const  string
+	Sub    *Expr
+
+	// value of the constant, set by the parser
+	value int64
+}
+
+// Number is an integer literal in an expression, with the base it is written
+// in.
+type Number struct {
+	Value int64
+	// Base is 2, 8, 10 or 16. It is 0 if the base is not known, or was
+	// forgotten by the parser because the file was not parsed in lossless
+	// mode, and the number is then written in hexadecimal, or in decimal if it
+	// has a unit.
+	Base int
+}
+
+// formatNumber writes `v`, followed by `unit`, in the given base. An unknown
+// base is hexadecimal for numbers without unit, and decimal otherwise.
+func formatNumber(v int64, base int, unit string) string {
+	if base == 0 {
+		base = 16
+		if unit != "" {
+			base = 10
+		}
+	}
+	switch base {
+	case 2:
+		return fmt.Sprintf("0b%b%s", v, unit)
+	case 8:
+		return fmt.Sprintf("0%o%s", v, unit)
+	case 10:
+		return fmt.Sprintf("%d%s", v, unit)
+	default:
+		return fmt.Sprintf("0x%x%s", v, unit)
+	}
+}
+
+// numberFormat is the representation of a number in a fmd file, as the base
+// and the unit it is written in.
+type numberFormat struct {
+	base int
+	unit string
+}
+
+// format writes `v`, in bytes, in the format. A value that is not a multiple
+// of the unit is written in hexadecimal bytes. It returns false if the format
+// is unknown.
+func (f numberFormat) format(v int64) (string, bool) {
+	switch {
+	case f.base == 0:
+		return "", false
+	case f.unit == "":
+		return formatNumber(v, f.base, ""), true
+	case v%unitSize(f.unit) == 0:
+		return formatNumber(v/unitSize(f.unit), f.base, f.unit), true
+	default:
+		return formatNumber(v, 16, ""), true
+	}
+}
+
+// errDivisionByZero is returned when evaluating a division by zero.
+var errDivisionByZero = errors.New("division by zero")
+
+// errOverflow is returned when a computation overflows an int64.
+var errOverflow = errors.New("integer overflow")
+
+// addInt64 returns a + b, or errOverflow if it overflows.
+func addInt64(a, b int64) (int64, error) {
+	c := a + b
+	if (b > 0 && c < a) || (b < 0 && c > a) {
+		return 0, errOverflow
+	}
+	return c, nil
+}
+
+// mulInt64 returns a * b, or errOverflow if it overflows.
+func mulInt64(a, b int64) (int64, error) {
+	if a == 0 || b == 0 {
+		return 0, nil
+	}
+	c := a * b
+	if c/b != a || (a == -1 && b == math.MinInt64) || (b == -1 && a == math.MinInt64) {
+		return 0, errOverflow
+	}
+	return c, nil
+}
+
+// Value evaluates the expression.
+func (e *Expr) Value() (int64, error) {
+	ret, err := e.Left.Value()
+	if err != nil {
+		return 0, err
+	}
+	for _, op := range e.Right {
+		v, err := op.Term.Value()
+		if err != nil {
+			return 0, err
+		}
+		if op.Op == "-" {
+			if v == math.MinInt64 {
+				return 0, errOverflow
+			}
+			v = -v
+		}
+		if ret, err = addInt64(ret, v); err != nil {
+			return 0, err
+		}
+	}
+	return ret, nil
+}
+
+// Value evaluates the term.
+func (t *Term) Value() (int64, error) {
+	ret, err := t.Left.Value()
+	if err != nil {
+		return 0, err
+	}
+	for _, op := range t.Right {
+		v, err := op.Factor.Value()
+		if err != nil {
+			return 0, err
+		}
+		if op.Op == "*" {
+			if ret, err = mulInt64(ret, v); err != nil {
+				return 0, err
+			}
+		} else {
+			if v == 0 {
+				return 0, errDivisionByZero
+			}
+			ret /= v
+		}
+	}
+	return ret, nil
+}
+
+// Value evaluates the factor, in bytes.
+func (f *Factor) Value() (int64, error) {
+	switch {
+	case f.Sub != nil:
+		return f.Sub.Value()
+	case f.Const != "":
+		return f.value, nil
+	default:
+		return mulInt64(f.Number.Value, unitSize(f.Unit))
+	}
+}
+
+// String returns the expression as it can be written in a fmd file.
+func (e *Expr) String() string {
+	return e.format(newFormatter())
+}
+
+// String returns the term as it can be written in a fmd file.
+func (t *Term) String() string {
+	return t.format(newFormatter())
+}
+
+// String returns the factor as it can be written in a fmd file. Numbers are
+// written in the base they were parsed in, see Number.
+func (f *Factor) String() string {
+	return f.format(newFormatter())
+}
+
+// format writes the expression with the formatter `fm`.
+func (e *Expr) format(fm *formatter) string {
+	var b strings.Builder
+	b.WriteString(e.Left.format(fm))
+	for _, op := range e.Right {
+		b.WriteString(" " + op.Op + " " + op.Term.format(fm))
+	}
+	return b.String()
+}
+
+// format writes the term with the formatter `fm`.
+func (t *Term) format(fm *formatter) string {
+	var b strings.Builder
+	b.WriteString(t.Left.format(fm))
+	for _, op := range t.Right {
+		b.WriteString(" " + op.Op + " " + op.Factor.format(fm))
+	}
+	return b.String()
+}
+
+// format writes the factor with the formatter `fm`, whose base is used for
+// the numbers without unit whose base is not known.
+func (f *Factor) format(fm *formatter) string {
+	switch {
+	case f.Sub != nil:
+		return "(" + f.Sub.format(fm) + ")"
+	case f.Const != "":
+		return "$" + f.Const
+	case f.Number.Base == 0 && f.Unit == "":
+		return formatNumber(f.Number.Value, fm.base, "")
+	default:
+		return formatNumber(f.Number.Value, f.Number.Base, f.Unit)
+	}
+}
+
+// number returns the factor of the expression if it is a single number, and
+// false otherwise.
+func (e *Expr) number() (*Factor, bool) {
+	if len(e.Right) > 0 || len(e.Left.Right) > 0 || e.Left.Left.Number == nil {
+		return nil, false
+	}
+	return e.Left.Left, true
+}
+
+// forgetBases resets the base of the numbers of the expression, so that they
+// are written in the default base.
+func (e *Expr) forgetBases() {
+	_ = e.factors(func(fa *Factor) error {
+		if fa.Number != nil {
+			fa.Number.Base = 0
+		}
+		return nil
+	})
+}
+
+// evalExprs evaluates the start and size expressions of `s` and of its
+// sub-sections, with the given constants. A size that is a single number keeps
+// its unit, while the other expressions are evaluated in bytes. In lossless
+// mode, the format of starts and sizes that are a single number is remembered,
+// otherwise the bases of the numbers are forgotten.
+func evalExprs(s *Section, consts map[string]int64, lossless bool) error {
+	for _, e := range []*Expr{s.StartExpr, s.SizeExpr} {
+		if e == nil {
+			continue
+		}
+		if err := e.bindConsts(consts); err != nil {
+			return sectionErrorf(s, "%v", err)
+		}
+		if !lossless {
+			e.forgetBases()
+		}
+	}
+	if s.StartExpr != nil {
+		start, err := s.StartExpr.Value()
+		if err != nil {
+			return sectionErrorf(s, "invalid start %s: %v", s.StartExpr, err)
+		}
+		s.Start = &start
+		if f, ok := s.StartExpr.number(); ok && lossless {
+			s.startFormat = numberFormat{base: f.Number.Base, unit: f.Unit}
+		}
+	}
+	if s.SizeExpr != nil {
+		size, err := s.SizeExpr.Value()
+		if err != nil {
+			return sectionErrorf(s, "invalid size %s: %v", s.SizeExpr, err)
+		}
+		if f, ok := s.SizeExpr.number(); ok {
+			s.Size, s.Unit = f.Number.Value, f.Unit
+			if lossless {
+				s.sizeFormat = numberFormat{base: f.Number.Base, unit: f.Unit}
+			}
+		} else {
+			s.Size, s.Unit = size, ""
+		}
+	}
+	s.Fill = s.SizeExpr == nil
+	for _, sec := range s.Sections {
+		if err := evalExprs(sec, consts, lossless); err != nil {
+			return err
+		}
+	}
+	return nil
+}
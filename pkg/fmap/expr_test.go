@@ -0,0 +1,119 @@
+package fmap
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestExpressions(t *testing.T) {
+	layout := `FLASH 16M {
+	SI_DESC 4k + 0x100
+	SI_BIOS@0x200000 0x1000000 - 0x200000 {
+		RW_A@4k 2 * (0x10000 + 0x8000)
+		RW_B 0x30000 / 3
+	}
+}
+`
+	f, err := Parse(strings.NewReader(layout))
+	require.NoError(t, err)
+
+	desc := f.Find("SI_DESC", false)
+	assert.Equal(t, int64(0x1100), desc.Size)
+	assert.Equal(t, "", desc.Unit)
+	bios := f.Find("SI_BIOS", false)
+	require.NotNil(t, bios.Start)
+	assert.Equal(t, int64(0x200000), *bios.Start)
+	assert.Equal(t, int64(0xe00000), bios.Size)
+	a := f.Find("RW_A", true)
+	assert.Equal(t, int64(0x1000), *a.Start)
+	assert.Equal(t, int64(0x30000), a.Size)
+	assert.Equal(t, int64(0x10000), f.Find("RW_B", true).Size)
+	assert.Equal(t, int64(16), f.Size)
+	assert.Equal(t, "M", f.Unit)
+
+	assert.Equal(t, `FLASH 16M {
+	SI_DESC 4k + 0x100
+	SI_BIOS@0x200000 0x1000000 - 0x200000 {
+		RW_A@4k 0x2 * (0x10000 + 0x8000)
+		RW_B 0x30000 / 0x3
+	}
+}
+`, f.ToFlashmap())
+}
+
+func TestExpressionsChanged(t *testing.T) {
+	f, err := Parse(strings.NewReader("FLASH 0x2000 {\n\tA@0x100 + 0x100 0x800 + 0x800\n}"))
+	require.NoError(t, err)
+	a := f.Sections[0]
+	assert.Equal(t, "FLASH 0x2000 {\n\tA@0x100 + 0x100 0x800 + 0x800\n}\n", f.ToFlashmap())
+
+	// expressions that no longer evaluate to the values are not written
+	require.NotEmpty(t, f.Defrag(false))
+	a.Size = 0x2000
+	assert.Equal(t, "FLASH 0x2000 {\n\tA@0x0 0x2000\n}\n", f.ToFlashmap())
+}
+
+func TestExpressionErrors(t *testing.T) {
+	_, err := Parse(strings.NewReader("FLASH 0x2000 {\n\tA 0x1000 / (2 - 2)\n}"))
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "section A (2): invalid size 0x1000 / (0x2 - 0x2): division by zero")
+
+	_, err = Parse(strings.NewReader("FLASH 0x2000 {\n\tA 0x1000 +\n}"))
+	require.Error(t, err)
+
+	_, err = Parse(strings.NewReader("FLASH 0x7fffffffffffffff * 2"))
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "integer overflow")
+}
+
+func TestExpressionsLarge(t *testing.T) {
+	f, err := Parse(strings.NewReader("FLASH 8192M {\n\tA@4096M 4096M\n}"))
+	require.NoError(t, err)
+	assert.Equal(t, int64(8<<30), f.ByteSize())
+	assert.Equal(t, int64(4<<30), f.Sections[0].AbsoluteStart())
+	assert.Empty(t, f.Validate())
+}
+
+func TestExpressionParenthesized(t *testing.T) {
+	f, err := Parse(strings.NewReader("FLASH 0x2000 {\n\tA (0x800 + 0x800) * 2\n}"))
+	require.NoError(t, err)
+	assert.Empty(t, f.Sections[0].Flags)
+	assert.Equal(t, int64(0x2000), f.Sections[0].Size)
+}
+
+func TestLossless(t *testing.T) {
+	src := "FLASH 16M {\n\tA@0 4096\n\tB@4096 0x1000 + 1024\n\tC@8k 8k\n}\n"
+	f, err := ParseWithOptions(strings.NewReader(src), ParseOptions{Lossless: true})
+	require.NoError(t, err)
+	assert.Equal(t, "FLASH 16M {\n\tA@0 4096\n\tB@4096 0x1000 + 1024\n\tC@8k 8k\n}\n", f.ToFlashmap())
+
+	// changed values keep their format while they divide evenly
+	a, b, c := f.Sections[0], f.Sections[1], f.Sections[2]
+	a.Size = 2048
+	b.Size = 0x2000
+	c.Size, c.Unit = 0x3000, ""
+	start := int64(0x5000)
+	c.Start = &start
+	assert.Equal(t, "FLASH 16M {\n\tA@0 2048\n\tB@4096 0x2000\n\tC@20k 12k\n}\n", f.ToFlashmap())
+	c.Size = 0x3100
+	assert.Equal(t, "FLASH 16M {\n\tA@0 2048\n\tB@4096 0x2000\n\tC@20k 0x3100\n}\n", f.ToFlashmap())
+
+	f, err = ParseWithOptions(strings.NewReader(src), ParseOptions{})
+	require.NoError(t, err)
+	assert.Equal(t, "FLASH 16M {\n\tA@0x0 0x1000\n\tB@0x1000 0x1000 + 0x400\n\tC@8k 8k\n}\n", f.ToFlashmap())
+}
+
+func TestLosslessUnit(t *testing.T) {
+	f, err := ParseWithOptions(strings.NewReader("FLASH 0x40k {\n\tA 0x20k\n}\n"), ParseOptions{Lossless: true})
+	require.NoError(t, err)
+	assert.Equal(t, "FLASH 0x40k {\n\tA 0x20k\n}\n", f.ToFlashmap())
+
+	// the base is kept with the unit
+	f.Size = 0x80
+	assert.Equal(t, "FLASH 0x80k {\n\tA 0x20k\n}\n", f.ToFlashmap())
+	setSize(f.Sections[0], 0x1800)
+	assert.Equal(t, "FLASH 0x80k {\n\tA 0x6k\n}\n", f.ToFlashmap())
+}
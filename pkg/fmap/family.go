@@ -0,0 +1,150 @@
+package fmap
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"regexp"
+	"strings"
+)
+
+// Variant is a member of a board family, defined by a set of parameters.
+type Variant struct {
+	Name   string
+	Params map[string]string
+}
+
+// Family is a board family definition: a single flashmap structure shared by
+// all the variants of a board, where sizes and offsets can reference
+// per-variant parameters. A family file starts with an optional `defaults`
+// block and one `variant` block per variant, each containing `KEY = VALUE`
+// lines, followed by the shared flashmap, which references parameters as
+// ${KEY}:
+//
+//	defaults {
+//		RW_SIZE = 0x200000
+//	}
+//	variant SKU_8M {
+//		ROM_SIZE = 8M
+//	}
+//	variant SKU_16M {
+//		ROM_SIZE = 16M
+//		RW_SIZE = 0x600000
+//	}
+//	FLASH@0x0 ${ROM_SIZE} {
+//		RW ${RW_SIZE}
+//	}
+//
+// Lines starting with "//" or "#" in the header are comments.
+type Family struct {
+	Defaults map[string]string
+	Variants []Variant
+	// Template is the shared flashmap. The header lines are replaced by empty
+	// lines, so that line numbers are preserved in expanded layouts.
+	Template string
+}
+
+var (
+	familyBlockRe = regexp.MustCompile(`^(defaults|variant\s+([A-Za-z_][A-Za-z0-9_]*))\s*\{$`)
+	familyParamRe = regexp.MustCompile(`^([A-Za-z_][A-Za-z0-9_]*)\s*=\s*(\S+)$`)
+	familyRefRe   = regexp.MustCompile(`\$\{([A-Za-z_][A-Za-z0-9_]*)\}`)
+)
+
+// ParseFamily parses a board family definition.
+func ParseFamily(r io.Reader) (*Family, error) {
+	family := Family{Defaults: map[string]string{}}
+	var (
+		headerDone bool
+		params     map[string]string
+		template   []string
+	)
+	scanner := bufio.NewScanner(r)
+	for lineno := 1; scanner.Scan(); lineno++ {
+		line := scanner.Text()
+		if headerDone {
+			template = append(template, line)
+			continue
+		}
+		trimmed := strings.TrimSpace(line)
+		switch {
+		case params != nil && trimmed == "}":
+			params = nil
+		case params != nil && familyParamRe.MatchString(trimmed):
+			m := familyParamRe.FindStringSubmatch(trimmed)
+			params[m[1]] = m[2]
+		case params != nil:
+			return nil, fmt.Errorf("line %d: expected `KEY = VALUE` or `}`, got %q", lineno, trimmed)
+		case trimmed == "" || strings.HasPrefix(trimmed, "//") || strings.HasPrefix(trimmed, "#"):
+		case familyBlockRe.MatchString(trimmed):
+			m := familyBlockRe.FindStringSubmatch(trimmed)
+			if m[1] == "defaults" {
+				params = family.Defaults
+			} else {
+				for _, v := range family.Variants {
+					if v.Name == m[2] {
+						return nil, fmt.Errorf("line %d: duplicate variant %s", lineno, m[2])
+					}
+				}
+				family.Variants = append(family.Variants, Variant{Name: m[2], Params: map[string]string{}})
+				params = family.Variants[len(family.Variants)-1].Params
+			}
+		default:
+			// the shared flashmap starts here
+			headerDone = true
+			template = append(template, line)
+			continue
+		}
+		template = append(template, "")
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+	if params != nil {
+		return nil, fmt.Errorf("unterminated block at end of file")
+	}
+	if len(family.Variants) == 0 {
+		return nil, fmt.Errorf("no variants defined")
+	}
+	family.Template = strings.Join(template, "\n")
+	return &family, nil
+}
+
+// Variant returns the variant with the given name, and whether it exists.
+func (f *Family) Variant(name string) (Variant, bool) {
+	for _, v := range f.Variants {
+		if v.Name == name {
+			return v, true
+		}
+	}
+	return Variant{}, false
+}
+
+// Expand returns the concrete flashmap of a variant, substituting each
+// parameter reference with the value of the variant, or the default value,
+// parsed with the given options, see ParseWithOptions.
+func (f *Family) Expand(name string, opts ParseOptions) (*Section, error) {
+	v, ok := f.Variant(name)
+	if !ok {
+		return nil, fmt.Errorf("unknown variant %s", name)
+	}
+	var missing []string
+	text := familyRefRe.ReplaceAllStringFunc(f.Template, func(ref string) string {
+		key := familyRefRe.FindStringSubmatch(ref)[1]
+		if value, ok := v.Params[key]; ok {
+			return value
+		}
+		if value, ok := f.Defaults[key]; ok {
+			return value
+		}
+		missing = append(missing, key)
+		return ref
+	})
+	if len(missing) > 0 {
+		return nil, fmt.Errorf("variant %s: undefined parameters: %s", name, strings.Join(missing, ", "))
+	}
+	flash, err := ParseWithOptions(strings.NewReader(text), opts)
+	if err != nil {
+		return nil, fmt.Errorf("variant %s: %v", name, err)
+	}
+	return flash, nil
+}
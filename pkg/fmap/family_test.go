@@ -0,0 +1,67 @@
+package fmap
+
+import (
+	"os"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestFamily(t *testing.T) {
+	fd, err := os.Open("test_data/family.fmdf")
+	require.NoError(t, err)
+	defer fd.Close()
+	family, err := ParseFamily(fd)
+	require.NoError(t, err)
+	require.Equal(t, 2, len(family.Variants))
+	assert.Equal(t, "SKU_8M", family.Variants[0].Name)
+	assert.Equal(t, map[string]string{"RW_SIZE": "0x200000"}, family.Defaults)
+
+	f, err := family.Expand("SKU_8M", ParseOptions{})
+	require.NoError(t, err)
+	assert.Equal(t, "FLASH@0x0 8M {\n\tRW_SECTION_A@0x0 0x200000\n\tRW_SECTION_B@0x200000 0x200000\n\tWP_RO@0x400000 0x400000\n}\n", f.ToFlashmap())
+	assert.Empty(t, f.Validate())
+	// line numbers refer to the family file
+	assert.Equal(t, 18, f.Find("RW_SECTION_A", false).Span().StartLine)
+
+	f, err = family.Expand("SKU_16M", ParseOptions{})
+	require.NoError(t, err)
+	assert.Equal(t, "FLASH@0x0 16M {\n\tRW_SECTION_A@0x0 0x600000\n\tRW_SECTION_B@0x600000 0x600000\n\tWP_RO@0xc00000 0x400000\n}\n", f.ToFlashmap())
+
+	_, err = family.Expand("SKU_32M", ParseOptions{})
+	assert.Error(t, err)
+}
+
+func TestFamilyParseOptions(t *testing.T) {
+	family, err := ParseFamily(strings.NewReader("variant A {\n\tSIZE = 4k\n}\ndefine RO_SIZE 0x400\nFLASH ${SIZE} {\n\tRO $RO_SIZE {\n\t\tX 0x100\n\t}\n\tRW 0x400 {\n\t\tX 0x100\n\t}\n}\n"))
+	require.NoError(t, err)
+	f, err := family.Expand("A", ParseOptions{Defines: map[string]string{"RO_SIZE": "0x800"}, Lossless: true})
+	require.NoError(t, err)
+	assert.Equal(t, int64(0x800), f.Sections[0].Size)
+	assert.Contains(t, f.ToFlashmap(), "FLASH 4k {")
+
+	_, err = family.Expand("A", ParseOptions{Mode: ParseStrict})
+	assert.Error(t, err)
+}
+
+func TestFamilyUndefinedParameter(t *testing.T) {
+	family, err := ParseFamily(strings.NewReader("variant A {\n\tX = 1\n}\nFLASH ${SIZE}\n"))
+	require.NoError(t, err)
+	_, err = family.Expand("A", ParseOptions{})
+	require.Error(t, err)
+	assert.Equal(t, "variant A: undefined parameters: SIZE", err.Error())
+}
+
+func TestParseFamilyErrors(t *testing.T) {
+	for _, in := range []string{
+		"FLASH 0x1000\n",
+		"variant A {\n\tX = 1\n",
+		"variant A {\n\tX 1\n}\nFLASH 0x1000\n",
+		"variant A {\n}\nvariant A {\n}\nFLASH 0x1000\n",
+	} {
+		_, err := ParseFamily(strings.NewReader(in))
+		assert.Error(t, err, in)
+	}
+}
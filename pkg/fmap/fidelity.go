@@ -0,0 +1,189 @@
+package fmap
+
+import (
+	"fmt"
+	"path"
+	"strings"
+)
+
+// LossKind is the kind of information that a format cannot represent, see
+// Loss.
+type LossKind string
+
+// Kinds of losses reported by Fidelity.
+const (
+	// LossNesting is a section that is not a sub-section of the same parent
+	// once converted, because the format is flat or rebuilds the hierarchy
+	// from the ranges.
+	LossNesting LossKind = "nesting"
+	// LossFlags is a section whose flags, or some of them, are dropped.
+	LossFlags LossKind = "flags"
+	// LossAttributes is a section whose attributes are dropped.
+	LossAttributes LossKind = "attributes"
+	// LossUnit is a size written with a unit that is normalized to bytes.
+	LossUnit LossKind = "unit"
+	// LossStart is an implicit start, following the previous sibling, that
+	// is made explicit.
+	LossStart LossKind = "start"
+	// LossExpression is a start or size expression that is replaced by its
+	// value.
+	LossExpression LossKind = "expression"
+	// LossFill is a section taking the remaining space of its parent, whose
+	// size is made explicit.
+	LossFill LossKind = "fill"
+	// LossDefines are the constant definitions of the flashmap, which are
+	// dropped.
+	LossDefines LossKind = "defines"
+)
+
+// Loss is a piece of information of a flashmap that a format cannot
+// represent, and that a conversion to it discards.
+type Loss struct {
+	Kind LossKind `json:"kind"`
+	// Path is the path of the section, see Section.Path.
+	Path    string `json:"path"`
+	Message string `json:"message"`
+}
+
+// String returns a description of the loss.
+func (l Loss) String() string {
+	return l.Path + ": " + l.Message
+}
+
+// nestingFidelity is how a format represents the hierarchy of the sections.
+type nestingFidelity int
+
+const (
+	nestingKept nestingFidelity = iota
+	// the hierarchy is rebuilt from the ranges when reading the format back,
+	// see FromBinary
+	nestingRebuilt
+	// the sections are listed without their hierarchy
+	nestingFlat
+)
+
+// fidelity describes the information of a flashmap kept by a format.
+type fidelity struct {
+	nesting nestingFidelity
+	// keepFlag returns true for the flags kept by the format, nil if all
+	// of them are kept
+	keepFlag func(fl Flag) bool
+	// the other kinds of information kept by the format
+	attributes, units, implicitStarts, expressions, fill bool
+}
+
+// fidelities are the fidelities of the output formats, see Formats.
+var fidelities = map[string]fidelity{
+	"fmd":         {nesting: nestingKept, attributes: true, units: true, implicitStarts: true, expressions: true, fill: true},
+	"json":        {nesting: nestingKept, attributes: true, units: true, implicitStarts: true},
+	"yaml":        {nesting: nestingKept, attributes: true, units: true, implicitStarts: true},
+	"binary":      {nesting: nestingRebuilt, keepFlag: func(fl Flag) bool { return fl == FlagPreserve }},
+	"cheader":     {nesting: nestingFlat, keepFlag: func(Flag) bool { return false }},
+	"fmap_config": {nesting: nestingFlat, keepFlag: func(Flag) bool { return false }},
+	"dump_fmap":   {nesting: nestingFlat, keepFlag: func(Flag) bool { return false }},
+	"dump_fmap_p": {nesting: nestingFlat, keepFlag: func(Flag) bool { return false }},
+	"dump_fmap_h": {nesting: nestingRebuilt, keepFlag: func(Flag) bool { return false }},
+	"dot":         {nesting: nestingKept},
+	"svg":         {nesting: nestingKept},
+	"html":        {nesting: nestingKept},
+}
+
+// Fidelity returns the information of the flashmap that cannot be represented
+// in `format`, one of the output formats listed in Formats, and that a
+// conversion to it would discard: nesting lost in flat formats, or rebuilt
+// differently from the ranges in binary FMAPs, flags and attributes dropped,
+// units normalized to bytes, implicit starts and remaining-space sizes made
+// explicit, expressions and constants replaced by their values. The losses
+// are listed section by section in pre-order, and an error is returned for
+// an unknown format, or if the flashmap cannot be written in it.
+func (s *Section) Fidelity(format string) ([]Loss, error) {
+	fid, ok := fidelities[format]
+	if !ok {
+		return nil, fmt.Errorf("no fidelity information for format %q", format)
+	}
+	var rebuilt map[string]string
+	if fid.nesting == nestingRebuilt {
+		var err error
+		if rebuilt, err = rebuiltParents(s); err != nil {
+			return nil, err
+		}
+	}
+
+	var ret []Loss
+	if !fid.expressions && len(s.Defines) > 0 {
+		var names []string
+		for _, d := range s.Defines {
+			names = append(names, d.Name)
+		}
+		ret = append(ret, Loss{Kind: LossDefines, Path: s.Name, Message: "constants " + strings.Join(names, ", ") + " dropped"})
+	}
+	for idx, fs := range flatten(s) {
+		sec := fs.Section
+		loss := func(kind LossKind, format string, args ...interface{}) {
+			ret = append(ret, Loss{Kind: kind, Path: fs.Path, Message: fmt.Sprintf(format, args...)})
+		}
+		parent := path.Dir(fs.Path)
+		switch {
+		case idx == 0:
+		case fid.nesting == nestingFlat && parent != s.Name:
+			loss(LossNesting, "nested in %s, flattened", parent)
+		case fid.nesting == nestingRebuilt && rebuilt[rangeKey(fs)] != parent:
+			loss(LossNesting, "nested in %s, read back in %s", parent, rebuilt[rangeKey(fs)])
+		}
+		var dropped []string
+		for _, fl := range sec.Flags {
+			if fid.keepFlag != nil && !fid.keepFlag(fl) {
+				dropped = append(dropped, string(fl))
+			}
+		}
+		if len(dropped) > 0 {
+			loss(LossFlags, "flags %s dropped", strings.Join(dropped, " "))
+		}
+		if !fid.attributes && len(sec.Attributes) > 0 {
+			loss(LossAttributes, "attributes %s dropped", formatAttributes(sec.Attributes))
+		}
+		if !fid.expressions && sec.StartExpr != nil {
+			if _, ok := sec.StartExpr.number(); !ok {
+				loss(LossExpression, "start %s replaced by 0x%x", sec.StartExpr, *sec.Start)
+			}
+		}
+		if !fid.expressions && sec.SizeExpr != nil {
+			if _, ok := sec.SizeExpr.number(); !ok {
+				loss(LossExpression, "size %s replaced by 0x%x", sec.SizeExpr, size(sec))
+			}
+		}
+		if !fid.units && sec.Unit != "" {
+			loss(LossUnit, "size %d%s written in bytes as 0x%x", sec.Size, sec.Unit, size(sec))
+		}
+		if !fid.implicitStarts && idx > 0 && sec.Start == nil {
+			loss(LossStart, "implicit start written as 0x%x", fs.Offset)
+		}
+		if !fid.fill && idx > 0 && sec.Fill {
+			loss(LossFill, "remaining space of %s written as 0x%x", parent, size(sec))
+		}
+	}
+	return ret, nil
+}
+
+// rangeKey identifies a section of a flattened tree by name and range.
+func rangeKey(fs flatSection) string {
+	return fmt.Sprintf("%s@0x%x+0x%x", fs.Section.Name, fs.Offset, size(fs.Section))
+}
+
+// rebuiltParents returns the paths of the parents of the sections of `s`,
+// identified by rangeKey, once written to a binary FMAP and read back.
+func rebuiltParents(s *Section) (map[string]string, error) {
+	bin, err := s.ToBinary()
+	if err != nil {
+		return nil, err
+	}
+	back, err := FromBinary(bin)
+	if err != nil {
+		return nil, err
+	}
+	ret := make(map[string]string)
+	for _, fs := range flatten(back)[1:] {
+		ret[rangeKey(fs)] = path.Dir(fs.Path)
+	}
+	return ret, nil
+}
@@ -0,0 +1,89 @@
+package fmap
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+const fidelityLayout = `define RO_SIZE 0x4000
+FLASH 16k {
+	RO@0 $RO_SIZE - 0x1000 {
+		FMAP 0x1000
+		COREBOOT(CBFS PRESERVE)[owner=firmware]
+	}
+	RW@0x3000 1k
+	MARK@0x3800 0
+}`
+
+func fidelityMessages(t *testing.T, format string) []string {
+	f, err := Parse(strings.NewReader(fidelityLayout))
+	require.NoError(t, err)
+	losses, err := f.Fidelity(format)
+	require.NoError(t, err)
+	var ret []string
+	for _, l := range losses {
+		ret = append(ret, string(l.Kind)+" "+l.String())
+	}
+	return ret
+}
+
+func TestFidelity(t *testing.T) {
+	assert.Empty(t, fidelityMessages(t, "fmd"))
+	assert.Equal(t, []string{
+		"defines FLASH: constants RO_SIZE dropped",
+		"expression FLASH/RO: size $RO_SIZE - 0x1000 replaced by 0x3000",
+		"fill FLASH/RO/COREBOOT: remaining space of FLASH/RO written as 0x2000",
+	}, fidelityMessages(t, "json"))
+	assert.Equal(t, []string{
+		"defines FLASH: constants RO_SIZE dropped",
+		"unit FLASH: size 16k written in bytes as 0x4000",
+		"expression FLASH/RO: size $RO_SIZE - 0x1000 replaced by 0x3000",
+		"start FLASH/RO/FMAP: implicit start written as 0x0",
+		"flags FLASH/RO/COREBOOT: flags CBFS dropped",
+		"attributes FLASH/RO/COREBOOT: attributes [owner=firmware] dropped",
+		"start FLASH/RO/COREBOOT: implicit start written as 0x1000",
+		"fill FLASH/RO/COREBOOT: remaining space of FLASH/RO written as 0x2000",
+		"unit FLASH/RW: size 1k written in bytes as 0x400",
+	}, fidelityMessages(t, "binary"))
+	assert.Contains(t, fidelityMessages(t, "cheader"), "nesting FLASH/RO/FMAP: nested in FLASH/RO, flattened")
+	assert.Contains(t, fidelityMessages(t, "cheader"), "flags FLASH/RO/COREBOOT: flags CBFS PRESERVE dropped")
+
+	f, err := Parse(strings.NewReader(fidelityLayout))
+	require.NoError(t, err)
+	_, err = f.Fidelity("dts")
+	assert.Error(t, err)
+	// every output format has fidelity information
+	for _, format := range Formats {
+		if format == "family" || format == "fmap_decode" || format == "ifd" || format == "ifdtool" {
+			continue
+		}
+		_, err := f.Fidelity(format)
+		assert.NoError(t, err, format)
+	}
+}
+
+func TestFidelityBinaryNesting(t *testing.T) {
+	// B has the range of A, and is read back in A as it is listed after it,
+	// but the marker at the end of C is read back in FLASH
+	f, err := Parse(strings.NewReader(`FLASH 0x2000 {
+	A 0x1000 {
+		B 0x1000
+	}
+	C 0x1000 {
+		END@0x1000 0
+	}
+}`))
+	require.NoError(t, err)
+	losses, err := f.Fidelity("binary")
+	require.NoError(t, err)
+	var msgs []string
+	for _, l := range losses {
+		if l.Kind == LossNesting {
+			msgs = append(msgs, l.String())
+		}
+	}
+	assert.Equal(t, []string{"FLASH/C/END: nested in FLASH/C, read back in FLASH"}, msgs)
+}
@@ -0,0 +1,54 @@
+package fmap
+
+// resolveFills computes the size of the sub-sections of `s`, recursively, that
+// have Fill set. A filling section extends up to the start of the first
+// sibling placed after it with an explicit start, minus the siblings listed
+// in between, or up to the end of its parent. At most one sub-section per
+// level can fill.
+func resolveFills(s *Section) error {
+	if s.Fill && s.parent == nil {
+		return sectionErrorf(s, "size omitted on the root section")
+	}
+	fill := -1
+	for idx, sec := range s.Sections {
+		if !sec.Fill {
+			continue
+		}
+		if fill >= 0 {
+			return sectionErrorf(sec, "size omitted on more than one sub-section of %s, also on %s", s.Name, s.Sections[fill].Name)
+		}
+		fill = idx
+	}
+	if fill >= 0 {
+		sec := s.Sections[fill]
+		// the filling section has no size yet, so its start is the end of the
+		// previous sibling, and the following siblings up to the next explicit
+		// start pack right after it. It ends where the first of the other
+		// siblings placed after it starts, whatever the order they are listed
+		// in. Those listed before it that start where it does, like markers,
+		// are not after it
+		starts := childStarts(s)
+		start := starts[fill]
+		end, between := size(s), int64(0)
+		chain := fill + 1
+		for ; chain < len(s.Sections) && s.Sections[chain].Start == nil; chain++ {
+			between += size(s.Sections[chain])
+		}
+		for idx, st := range starts {
+			if (idx < fill && st > start || idx >= chain && st >= start) && st < end {
+				end = st
+			}
+		}
+		end -= between
+		if end < start {
+			return sectionErrorf(sec, "size omitted, but there is no space left in %s", s.Name)
+		}
+		sec.Size = end - start
+	}
+	for _, sec := range s.Sections {
+		if err := resolveFills(sec); err != nil {
+			return err
+		}
+	}
+	return nil
+}
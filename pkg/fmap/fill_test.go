@@ -0,0 +1,75 @@
+package fmap
+
+import (
+	"errors"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestFill(t *testing.T) {
+	f, err := Parse(strings.NewReader(`FLASH 16M {
+	SI_DESC 4k
+	SI_BIOS {
+		RW_SECTION_A 0x200000 {
+			VBLOCK_A 0x10000
+			FW_MAIN_A(CBFS)
+			RW_FWID_A 0x40
+		}
+		COREBOOT(CBFS)
+		FMAP@0xfef000 0x1000
+		WP_RO 0xf000
+	}
+}`))
+	require.NoError(t, err)
+
+	bios := f.Find("SI_BIOS", false)
+	assert.True(t, bios.Fill)
+	assert.Equal(t, int64(0xfff000), bios.Size)
+	main := f.Find("FW_MAIN_A", true)
+	assert.True(t, main.Fill)
+	assert.Equal(t, int64(0x200000-0x10000-0x40), main.Size)
+	cb := f.Find("COREBOOT", true)
+	assert.Equal(t, int64(0xfef000-0x200000), cb.Size)
+	assert.False(t, f.Find("FMAP", true).Fill)
+	assert.NoError(t, f.CheckCoverage())
+	assert.Contains(t, f.ToFlashmap(), "\t\tFW_MAIN_A(CBFS)\n")
+}
+
+func TestFillZeroSize(t *testing.T) {
+	f, err := Parse(strings.NewReader("FLASH 0x1000 {\n\tA 0\n\tB\n}"))
+	require.NoError(t, err)
+	assert.False(t, f.Sections[0].Fill)
+	assert.True(t, f.Sections[1].Fill)
+	assert.Equal(t, int64(0x1000), f.Sections[1].Size)
+	assert.Equal(t, "FLASH 0x1000 {\n\tA 0x0\n\tB\n}\n", f.ToFlashmap())
+}
+
+func TestFillUnordered(t *testing.T) {
+	f, err := ParseString("FLASH 0x4000 {\n\tC@0x3000 0x1000\n\tMARK@0x1000 0\n\tA@0x0 0x1000\n\tB\n}")
+	require.NoError(t, err)
+	assert.Equal(t, int64(0x2000), f.Find("B", false).Size)
+
+	f, err = ParseString("FLASH 0x4000 {\n\tA 0x1000\n\tB\n\tC 0x1000\n\tD@0x0 0x1000\n}")
+	require.NoError(t, err)
+	assert.Equal(t, int64(0x2000), f.Find("B", false).Size)
+}
+
+func TestFillErrors(t *testing.T) {
+	_, err := Parse(strings.NewReader("FLASH {\n\tA 0x1000\n}"))
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "size omitted on the root section")
+
+	_, err = Parse(strings.NewReader("FLASH 0x1000 {\n\tA[alias=X]\n\tB@0x0\n}"))
+	require.Error(t, err)
+	var serr *SectionError
+	require.True(t, errors.As(err, &serr))
+	assert.Equal(t, "B", serr.Name)
+	assert.Equal(t, 3, serr.Span.StartLine)
+
+	_, err = Parse(strings.NewReader("FLASH 0x1000 {\n\tA 0x800\n\tB\n\tC 0x1000\n}"))
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "no space left in FLASH")
+}
@@ -0,0 +1,284 @@
+package fmap
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// FitOptions controls how Fit computes the size of a section from the size of
+// its payload.
+type FitOptions struct {
+	// Headroom is the number of bytes added to the size of every payload, to
+	// leave room for it to grow.
+	Headroom int64
+	// Align rounds the sizes up to a multiple of it, if greater than 1.
+	Align int64
+}
+
+// size returns the size of a section fitting a payload of `length` bytes.
+func (o FitOptions) size(length int64) int64 {
+	length += o.Headroom
+	if o.Align > 1 && length%o.Align != 0 {
+		length += o.Align - length%o.Align
+	}
+	return length
+}
+
+// Fit resizes the sections named after the keys of `payloads`, at any depth,
+// to the size of their payloads in bytes, plus the headroom and alignment in
+// the options. The siblings following a grown section are pushed forward so
+// that they don't overlap it, and the layout is then defragmented, so that
+// growing sections take the free space of their parents. Parents are not
+// resized: the returned violations, see Validate, report the sections that no
+// longer fit. Protected read-only sections cannot be resized and are not
+// pushed, see ProtectReadOnly. A *NotFoundError is returned if a section does
+// not exist.
+func (s *Section) Fit(payloads map[string]int64, opts FitOptions) ([]Violation, error) {
+	var names []string
+	for name := range payloads {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	op := "Fit(" + strings.Join(names, ", ") + ")"
+	var targets []*Section
+	for _, name := range names {
+		sec, err := s.Lookup(name, true)
+		if err != nil {
+			return nil, err
+		}
+		if payloads[name] < 0 {
+			return nil, sectionErrorf(sec, "invalid payload size %d", payloads[name])
+		}
+		if err := checkWritable(sec, op); err != nil {
+			return nil, err
+		}
+		targets = append(targets, sec)
+	}
+
+	t := s.record(op)
+	pinned := pinProtected(s)
+	for idx, sec := range targets {
+		sec.Size, sec.Unit, sec.Fill = opts.size(payloads[names[idx]]), "", false
+		sec.touch(t)
+	}
+	pushForward(s, t)
+	s.Defrag(false)
+	unpinProtected(pinned)
+	return s.Validate(), nil
+}
+
+// FitCheck is the result of checking that a payload fits its section, see
+// CheckFit.
+type FitCheck struct {
+	Section *Section
+	// Payload is the size of the payload, and Required the size of the
+	// section it needs, with the headroom and alignment of the options.
+	Payload  int64
+	Required int64
+	// Slack is the space of the section left free by the payload, negative
+	// if the payload does not fit.
+	Slack int64
+}
+
+// OK returns true if the payload fits its section.
+func (c FitCheck) OK() bool {
+	return c.Slack >= 0
+}
+
+// String returns a description of the check.
+func (c FitCheck) String() string {
+	if c.OK() {
+		return fmt.Sprintf("%s: ok, 0x%x bytes in 0x%x, 0x%x bytes of slack", c.Section.Path(), c.Required, size(c.Section), c.Slack)
+	}
+	return fmt.Sprintf("%s: 0x%x bytes do not fit in 0x%x, 0x%x bytes over", c.Section.Path(), c.Required, size(c.Section), -c.Slack)
+}
+
+// CheckFit checks that the payloads fit the sections named after their keys,
+// at any depth, without changing the layout: the size a section needs for a
+// payload is the one Fit would give it, with the headroom and alignment of the
+// options. The checks are returned ordered by section name, and a payload
+// that does not fit is not an error, see FitCheck.OK. A *NotFoundError is
+// returned if a section does not exist.
+func (s *Section) CheckFit(payloads map[string]int64, opts FitOptions) ([]FitCheck, error) {
+	var names []string
+	for name := range payloads {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	var ret []FitCheck
+	for _, name := range names {
+		sec, err := s.Lookup(name, true)
+		if err != nil {
+			return nil, err
+		}
+		if payloads[name] < 0 {
+			return nil, sectionErrorf(sec, "invalid payload size %d", payloads[name])
+		}
+		required := opts.size(payloads[name])
+		ret = append(ret, FitCheck{Section: sec, Payload: payloads[name], Required: required, Slack: size(sec) - required})
+	}
+	return ret, nil
+}
+
+// GrowToFit grows the section `name`, at any depth, just enough to fit a
+// payload of `payload` bytes, plus the headroom and alignment of the options,
+// taking the space from the section `donor`, e.g. a free region, which
+// shrinks by the same amount. The sections between the two are moved towards
+// the donor, and the ancestors of either section that don't contain the
+// other one grow or shrink with it, so that the rest of the layout is
+// unchanged. The space is added at the end of the section if the donor
+// follows it, and at its start otherwise. Nothing is changed if the section
+// is already large enough. The donor must not have sub-sections, nor contain
+// or be part of the section. It returns the violations of the resulting
+// layout, see Validate, a *NotFoundError if a section does not exist, and
+// an error, without changing anything, if the donor is too small or if a
+// protected read-only section would change, see ProtectReadOnly.
+func (s *Section) GrowToFit(name string, payload int64, donor string, opts FitOptions) ([]Violation, error) {
+	target, err := s.Lookup(name, true)
+	if err != nil {
+		return nil, err
+	}
+	giver, err := s.Lookup(donor, true)
+	if err != nil {
+		return nil, err
+	}
+	if payload < 0 {
+		return nil, sectionErrorf(target, "invalid payload size %d", payload)
+	}
+	need := opts.size(payload) - size(target)
+	if need <= 0 {
+		return s.Validate(), nil
+	}
+	inTarget := map[*Section]bool{target: true}
+	for _, sec := range descendants(target) {
+		inTarget[sec] = true
+	}
+	if inTarget[giver] || isAncestor(giver, target) {
+		return nil, sectionErrorf(giver, "cannot take space from a section that contains or is part of %s", name)
+	}
+	if len(giver.Sections) > 0 {
+		return nil, sectionErrorf(giver, "cannot shrink a section with sub-sections")
+	}
+	if size(giver) < need {
+		return nil, sectionErrorf(giver, "only 0x%x bytes left to give to %s, 0x%x needed", size(giver), name, need)
+	}
+
+	// the bounds of the sections, outside of the section, between its end and
+	// the start of the donor, or between the end of the donor and its start,
+	// move towards the donor
+	extents := sectionExtents(s)
+	lo, hi, shift := extents[target].end, extents[giver].start, need
+	if extents[giver].start < extents[target].start {
+		lo, hi, shift = extents[giver].end, extents[target].start, -need
+	}
+	for sec, e := range extents {
+		if sec == s || inTarget[sec] && sec != target {
+			continue
+		}
+		for _, p := range []*int64{&e.start, &e.end} {
+			if *p >= lo && *p <= hi {
+				*p += shift
+			}
+		}
+		extents[sec] = e
+	}
+	if err := applyExtents(s, extents, fmt.Sprintf("GrowToFit(%s, 0x%x, %s)", name, payload, donor)); err != nil {
+		return nil, err
+	}
+	return s.Validate(), nil
+}
+
+// extent is the range of a section relative to the start of the root.
+type extent struct{ start, end int64 }
+
+// sectionExtents returns the ranges of the sections of the tree `s`.
+func sectionExtents(s *Section) map[*Section]extent {
+	ret := make(map[*Section]extent)
+	for _, fs := range flatten(s) {
+		ret[fs.Section] = extent{fs.Offset, fs.Offset + size(fs.Section)}
+	}
+	return ret
+}
+
+// applyExtents sets the sizes and the starts of the sections of the tree `s`
+// to the ranges of `extents`, keeping the implicit starts that still follow
+// their previous sibling, and records the changes as the operation `op`. The
+// start of `s` is not changed. Nothing is changed, and an error is returned,
+// if a protected read-only section would change, see ProtectReadOnly.
+func applyExtents(s *Section, extents map[*Section]extent, op string) error {
+	type change struct {
+		sec    *Section
+		start  *int64
+		length int64
+	}
+	var changes []change
+	if length := extents[s].end - extents[s].start; length != size(s) {
+		changes = append(changes, change{sec: s, length: length})
+	}
+	var collect func(parent *Section)
+	collect = func(parent *Section) {
+		implicit := int64(0)
+		for idx, sec := range parent.Sections {
+			start := extents[sec].start - extents[parent].start
+			length := extents[sec].end - extents[sec].start
+			c := change{sec: sec, length: length}
+			if sec.Start == nil && start != implicit || sec.Start != nil && *sec.Start != start {
+				c.start = &start
+			}
+			if c.start != nil || start != childStarts(parent)[idx] || length != size(sec) {
+				changes = append(changes, c)
+			}
+			implicit = start + length
+			collect(sec)
+		}
+	}
+	collect(s)
+	for _, c := range changes {
+		if err := checkWritable(c.sec, op); err != nil {
+			return err
+		}
+	}
+
+	t := s.record(op)
+	for _, c := range changes {
+		if c.start != nil {
+			c.sec.Start = c.start
+		}
+		if c.length != size(c.sec) {
+			setSize(c.sec, c.length)
+		}
+		c.sec.touch(t)
+	}
+	return nil
+}
+
+// isAncestor returns true if `a` is an ancestor of `s`.
+func isAncestor(a, s *Section) bool {
+	for sec := s.parent; sec != nil; sec = sec.parent {
+		if sec == a {
+			return true
+		}
+	}
+	return false
+}
+
+// pushForward moves the sub-sections of `s`, recursively, that start before
+// the end of their previous sibling right after it. Protected sections with an
+// explicit start are not moved, see pinProtected.
+func pushForward(s *Section, t Transform) {
+	end := int64(0)
+	for _, sec := range s.Sections {
+		start := end
+		if sec.Start != nil {
+			if *sec.Start < end && !sec.isProtected() {
+				sec.Start = &start
+				sec.touch(t)
+			} else {
+				start = *sec.Start
+			}
+		}
+		end = start + size(sec)
+		pushForward(sec, t)
+	}
+}
@@ -0,0 +1,174 @@
+package fmap
+
+import (
+	"errors"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+const fitLayout = `FLASH 0x10000 {
+	RO@0x0 0x8000 {
+		FMAP@0x0 0x1000
+		COREBOOT@0x1000 0x2000
+		GBB@0x3000 0x1000
+	}
+	RW@0x8000 0x8000 {
+		FW_MAIN@0x0 0x4000
+	}
+}`
+
+func TestFit(t *testing.T) {
+	f, err := Parse(strings.NewReader(fitLayout))
+	require.NoError(t, err)
+
+	violations, err := f.Fit(map[string]int64{"COREBOOT": 0x3800, "FW_MAIN": 0x1234}, FitOptions{Headroom: 0x100, Align: 0x1000})
+	require.NoError(t, err)
+	assert.Empty(t, violations)
+	assert.Equal(t, `FLASH 0x10000 {
+	RO@0x0 0x8000 {
+		FMAP@0x0 0x1000
+		COREBOOT@0x1000 0x4000
+		GBB@0x5000 0x1000
+	}
+	RW@0x8000 0x8000 {
+		FW_MAIN@0x0 0x2000
+	}
+}
+`, f.ToFlashmap())
+	assert.Contains(t, f.Find("GBB", true).Origin(), "introduced by Fit(COREBOOT, FW_MAIN) at step 1")
+}
+
+func TestFitOverflow(t *testing.T) {
+	f, err := Parse(strings.NewReader(fitLayout))
+	require.NoError(t, err)
+
+	violations, err := f.Fit(map[string]int64{"COREBOOT": 0x7000}, FitOptions{})
+	require.NoError(t, err)
+	require.Equal(t, 1, len(violations))
+	assert.Equal(t, "FLASH/RO/GBB", violations[0].Path)
+	assert.Equal(t, int64(0x7000), f.Find("COREBOOT", true).Size)
+}
+
+func TestFitErrors(t *testing.T) {
+	f, err := Parse(strings.NewReader(fitLayout))
+	require.NoError(t, err)
+
+	_, err = f.Fit(map[string]int64{"NONEXISTING": 0x1000}, FitOptions{})
+	require.True(t, errors.Is(err, ErrSectionNotFound))
+	_, err = f.Fit(map[string]int64{"GBB": -1}, FitOptions{})
+	require.Error(t, err)
+}
+
+func TestCheckFit(t *testing.T) {
+	f, err := Parse(strings.NewReader(fitLayout))
+	require.NoError(t, err)
+	checks, err := f.CheckFit(map[string]int64{"COREBOOT": 0x1800, "GBB": 0x1000}, FitOptions{Headroom: 0x100})
+	require.NoError(t, err)
+	require.Len(t, checks, 2)
+	assert.Equal(t, FitCheck{Section: f.Find("COREBOOT", true), Payload: 0x1800, Required: 0x1900, Slack: 0x700}, checks[0])
+	assert.True(t, checks[0].OK())
+	assert.Equal(t, "FLASH/RO/COREBOOT: ok, 0x1900 bytes in 0x2000, 0x700 bytes of slack", checks[0].String())
+	assert.False(t, checks[1].OK())
+	assert.Equal(t, "FLASH/RO/GBB: 0x1100 bytes do not fit in 0x1000, 0x100 bytes over", checks[1].String())
+	// the layout is not changed
+	assert.Equal(t, int64(0x1000), f.Find("GBB", true).ByteSize())
+
+	_, err = f.CheckFit(map[string]int64{"NONEXISTING": 1}, FitOptions{})
+	assert.True(t, errors.Is(err, ErrSectionNotFound))
+	_, err = f.CheckFit(map[string]int64{"GBB": -1}, FitOptions{})
+	assert.Error(t, err)
+}
+
+const growLayout = `FLASH 0x10000 {
+	RO 0x8000 {
+		FMAP 0x1000
+		COREBOOT 0x3000
+		GBB 0x1000
+	}
+	RW 0x6000 {
+		FW_MAIN 0x4000
+		VPD 0x2000
+	}
+	UNUSED 0x2000
+}`
+
+func TestGrowToFit(t *testing.T) {
+	// the donor follows the section
+	f, err := ParseString(growLayout)
+	require.NoError(t, err)
+	violations, err := f.GrowToFit("COREBOOT", 0x3700, "UNUSED", FitOptions{Headroom: 0x100})
+	require.NoError(t, err)
+	assert.Empty(t, violations)
+	assert.Equal(t, `FLASH 0x10000 {
+	RO 0x8800 {
+		FMAP 0x1000
+		COREBOOT 0x3800
+		GBB 0x1000
+	}
+	RW 0x6000 {
+		FW_MAIN 0x4000
+		VPD 0x2000
+	}
+	UNUSED 0x1800
+}
+`, f.ToFlashmap())
+	assert.Equal(t, "GrowToFit(COREBOOT, 0x3700, UNUSED)", f.Find("GBB", true).Provenance()[0].Op)
+
+	// the donor precedes the section, which grows at its start
+	f, err = ParseString(growLayout)
+	require.NoError(t, err)
+	_, err = f.GrowToFit("VPD", 0x2800, "FMAP", FitOptions{})
+	require.NoError(t, err)
+	assert.Equal(t, `FLASH 0x10000 {
+	RO 0x7800 {
+		FMAP 0x800
+		COREBOOT 0x3000
+		GBB 0x1000
+	}
+	RW 0x6800 {
+		FW_MAIN 0x4000
+		VPD 0x2800
+	}
+	UNUSED 0x2000
+}
+`, f.ToFlashmap())
+
+	// nothing to do
+	f, err = ParseString(growLayout)
+	require.NoError(t, err)
+	_, err = f.GrowToFit("COREBOOT", 0x100, "UNUSED", FitOptions{})
+	require.NoError(t, err)
+	assert.Empty(t, f.Find("COREBOOT", true).Provenance())
+}
+
+func TestGrowToFitErrors(t *testing.T) {
+	f, err := ParseString(growLayout)
+	require.NoError(t, err)
+	for _, tc := range []struct {
+		name, donor string
+		payload     int64
+		err         string
+	}{
+		{"COREBOOT", "UNUSED", 0x5100, "only 0x2000 bytes left to give to COREBOOT, 0x2100 needed"},
+		{"COREBOOT", "RO", 0x4000, "cannot take space from a section that contains or is part of COREBOOT"},
+		{"RO", "GBB", 0x9000, "cannot take space from a section that contains or is part of RO"},
+		{"COREBOOT", "RW", 0x4000, "cannot shrink a section with sub-sections"},
+		{"COREBOOT", "UNUSED", -1, "invalid payload size -1"},
+	} {
+		_, err := f.GrowToFit(tc.name, tc.payload, tc.donor, FitOptions{})
+		require.Error(t, err, tc.name)
+		assert.Contains(t, err.Error(), tc.err)
+	}
+	_, err = f.GrowToFit("NONEXISTING", 0, "UNUSED", FitOptions{})
+	assert.True(t, errors.Is(err, ErrSectionNotFound))
+
+	// GBB would move
+	f.Find("GBB", true).SetAttribute(AttrReadOnly, "true")
+	f.ProtectReadOnly(true)
+	_, err = f.GrowToFit("COREBOOT", 0x3800, "UNUSED", FitOptions{})
+	assert.True(t, errors.Is(err, ErrReadOnly))
+	assert.Equal(t, int64(0x3000), f.Find("COREBOOT", true).ByteSize())
+}
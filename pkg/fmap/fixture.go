@@ -0,0 +1,180 @@
+package fmap
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"math/rand"
+	"sort"
+)
+
+// FixtureOptions configure GenerateFixture.
+type FixtureOptions struct {
+	// Size is the size of the flash in bytes. It must be a multiple of
+	// Align.
+	Size int64
+	// Depth is the number of levels of sub-sections below the root, and
+	// FanOut the maximum number of sub-sections of a section.
+	Depth  int
+	FanOut int
+	// Align is the alignment of the starts and sizes of the sections, 4K if
+	// zero.
+	Align int64
+	// Seed selects the layout and the content: the same options always
+	// generate the same fixture.
+	Seed int64
+}
+
+// Contents of the leaf sections of a fixture, recorded in their "content"
+// attribute.
+const (
+	// ContentErased is erased flash, all 0xff.
+	ContentErased = "erased"
+	// ContentZero is all zeroes.
+	ContentZero = "zero"
+	// ContentRandom is pseudo-random bytes.
+	ContentRandom = "random"
+	// ContentPattern is the name of the section, repeated.
+	ContentPattern = "pattern"
+)
+
+var fixtureContents = []string{ContentErased, ContentZero, ContentRandom, ContentPattern}
+
+// Fixture is a synthetic layout with a matching flash image, see
+// GenerateFixture.
+type Fixture struct {
+	Layout *Section
+	Image  []byte
+	// Hashes are the hashes of the sections of the image, see Hash.
+	Hashes *HashReport
+}
+
+// GenerateFixture generates a synthetic layout and a matching flash image with
+// known properties, for the integration tests of flash tooling that cannot
+// use proprietary images. The root section, FLASH, starts with a FMAP section
+// holding the binary FMAP of the layout, see ToBinary, and the rest of the
+// flash is split into sections up to the given depth, with random aligned
+// sizes. Some sections don't cover their parent fully, leaving gaps, which
+// are erased in the image. The content of every other leaf is recorded in its
+// "content" attribute, see ContentErased and the other contents.
+func GenerateFixture(opts FixtureOptions) (*Fixture, error) {
+	if opts.Align == 0 {
+		opts.Align = 0x1000
+	}
+	if opts.Align < 0 || opts.Size <= 0 || opts.Size%opts.Align != 0 {
+		return nil, fmt.Errorf("the size 0x%x must be a positive multiple of the alignment 0x%x", opts.Size, opts.Align)
+	}
+	if opts.Depth < 1 || opts.FanOut < 1 {
+		return nil, errors.New("the depth and the fan-out must be at least 1")
+	}
+	// the FMAP section must hold an area for every possible section
+	areas, level := int64(1), int64(1)
+	for d := 0; d < opts.Depth; d++ {
+		level *= int64(opts.FanOut)
+		areas += level
+		if areas > 0xffff {
+			return nil, errors.New("too many sections, the FMAP cannot describe them")
+		}
+	}
+	fmapSize := (headerSize + areas*areaSize + opts.Align - 1) / opts.Align * opts.Align
+	if fmapSize >= opts.Size {
+		return nil, fmt.Errorf("the size 0x%x is too small for a FMAP of 0x%x bytes", opts.Size, fmapSize)
+	}
+
+	rng := rand.New(rand.NewSource(opts.Seed))
+	root := &Section{Name: "FLASH", Size: opts.Size}
+	root.Sections = append(root.Sections, &Section{Name: "FMAP", Size: fmapSize})
+	g := fixtureGenerator{rng: rng, opts: opts}
+	g.split(root, "S", opts.Size-fmapSize, fmapSize, opts.Depth)
+
+	layout, err := ParseString(root.ToFlashmap())
+	if err != nil {
+		return nil, err
+	}
+	image, err := g.image(layout)
+	if err != nil {
+		return nil, err
+	}
+	hashes, err := layout.Hash(bytes.NewReader(image))
+	if err != nil {
+		return nil, err
+	}
+	return &Fixture{Layout: layout, Image: image, Hashes: hashes}, nil
+}
+
+// fixtureGenerator implements GenerateFixture.
+type fixtureGenerator struct {
+	rng  *rand.Rand
+	opts FixtureOptions
+}
+
+// split adds to `s` up to FanOut sub-sections named after `prefix`, covering
+// the `space` bytes at `start`, and splits them in turn to `depth` levels.
+func (g *fixtureGenerator) split(s *Section, prefix string, space, start int64, depth int) {
+	units := space / g.opts.Align
+	n := 1 + g.rng.Intn(g.opts.FanOut)
+	if int64(n) > units {
+		n = int(units)
+	}
+	if n == 0 {
+		return
+	}
+	// n-1 distinct cut points in the aligned units of the space
+	cuts := map[int64]bool{0: true, units: true}
+	for len(cuts) < n+1 {
+		cuts[1+g.rng.Int63n(units-1)] = true
+	}
+	var points []int64
+	for c := range cuts {
+		points = append(points, c)
+	}
+	sort.Slice(points, func(i, j int) bool { return points[i] < points[j] })
+	// sometimes leave the last part as a gap
+	if n > 1 && g.rng.Intn(4) == 0 {
+		points = points[:n]
+	}
+	for i := 0; i+1 < len(points); i++ {
+		sec := &Section{Name: fmt.Sprintf("%s%d", prefix, i), Size: (points[i+1] - points[i]) * g.opts.Align}
+		if i == 0 && start != 0 {
+			st := start
+			sec.Start = &st
+		}
+		s.Sections = append(s.Sections, sec)
+		if depth > 1 && g.rng.Intn(3) > 0 {
+			g.split(sec, sec.Name+"_", sec.Size, 0, depth-1)
+		}
+		if len(sec.Sections) == 0 {
+			sec.SetAttribute(AttrContent, fixtureContents[g.rng.Intn(len(fixtureContents))])
+		}
+	}
+}
+
+// image returns the flash image of the fixture `layout`.
+func (g *fixtureGenerator) image(layout *Section) ([]byte, error) {
+	image := make([]byte, size(layout))
+	for i := range image {
+		image[i] = 0xff
+	}
+	for _, fs := range flatten(layout) {
+		content, _ := fs.Section.Attribute(AttrContent)
+		data := image[fs.Offset : fs.Offset+size(fs.Section)]
+		switch content {
+		case ContentZero:
+			for i := range data {
+				data[i] = 0
+			}
+		case ContentRandom:
+			g.rng.Read(data)
+		case ContentPattern:
+			for i := range data {
+				data[i] = fs.Section.Name[i%len(fs.Section.Name)]
+			}
+		}
+	}
+	bin, err := layout.ToBinary()
+	if err != nil {
+		return nil, err
+	}
+	copy(image, bin)
+	return image, nil
+}
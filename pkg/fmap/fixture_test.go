@@ -0,0 +1,73 @@
+package fmap
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestGenerateFixture(t *testing.T) {
+	opts := FixtureOptions{Size: 0x100000, Depth: 3, FanOut: 4, Seed: 42}
+	fx, err := GenerateFixture(opts)
+	require.NoError(t, err)
+	assert.Equal(t, int64(0x100000), fx.Layout.ByteSize())
+	assert.Equal(t, 0x100000, len(fx.Image))
+	assert.Empty(t, fx.Layout.Validate())
+
+	// the image embeds the FMAP of the layout
+	bin, off, err := ScanImage(bytes.NewReader(fx.Image))
+	require.NoError(t, err)
+	assert.Equal(t, int64(0), off)
+	assert.Equal(t, len(flatten(fx.Layout))-1, len(bin.Sections))
+
+	// the content of the leaves is the recorded one
+	leaves := 0
+	for _, fs := range flatten(fx.Layout) {
+		content, ok := fs.Section.Attribute(AttrContent)
+		if !ok {
+			continue
+		}
+		leaves++
+		data := fx.Image[fs.Offset : fs.Offset+fs.Section.ByteSize()]
+		switch content {
+		case ContentErased:
+			assert.Equal(t, bytes.Repeat([]byte{0xff}, len(data)), data, fs.Path)
+		case ContentZero:
+			assert.Equal(t, make([]byte, len(data)), data, fs.Path)
+		case ContentPattern:
+			assert.Equal(t, fs.Section.Name, string(data[:len(fs.Section.Name)]), fs.Path)
+		case ContentRandom:
+		default:
+			t.Errorf("%s: unknown content %q", fs.Path, content)
+		}
+	}
+	assert.NotZero(t, leaves)
+
+	hashes, err := fx.Layout.Hash(bytes.NewReader(fx.Image))
+	require.NoError(t, err)
+	assert.Equal(t, hashes, fx.Hashes)
+
+	// the same options generate the same fixture
+	again, err := GenerateFixture(opts)
+	require.NoError(t, err)
+	assert.Equal(t, fx.Layout.ToFlashmap(), again.Layout.ToFlashmap())
+	assert.Equal(t, fx.Image, again.Image)
+	opts.Seed++
+	other, err := GenerateFixture(opts)
+	require.NoError(t, err)
+	assert.NotEqual(t, fx.Image, other.Image)
+}
+
+func TestGenerateFixtureErrors(t *testing.T) {
+	for _, opts := range []FixtureOptions{
+		{Size: 0x1800, Depth: 1, FanOut: 1},
+		{Size: 0x1000, Depth: 1, FanOut: 1},
+		{Size: 0x10000, Depth: 0, FanOut: 1},
+		{Size: 0x10000, Depth: 8, FanOut: 8},
+	} {
+		_, err := GenerateFixture(opts)
+		assert.Error(t, err, "%+v", opts)
+	}
+}
@@ -0,0 +1,73 @@
+package fmap
+
+import "strings"
+
+// Flag is a section flag, written in parentheses after the section name, e.g.
+// "FW_MAIN_A(CBFS)". Multiple flags are separated by spaces, e.g.
+// "RW_NVRAM(CBFS PRESERVE)".
+type Flag string
+
+// Section flags known to coreboot.
+const (
+	// FlagCBFS marks a section that contains a CBFS.
+	FlagCBFS Flag = "CBFS"
+	// FlagPreserve marks a section whose content must be preserved across
+	// firmware updates. It maps to AreaPreserve in binary FMAPs.
+	FlagPreserve Flag = "PRESERVE"
+)
+
+// Flags is a set of section flags, in the order they were written.
+type Flags []Flag
+
+// Has returns true if the set contains the given flag.
+func (f Flags) Has(flag Flag) bool {
+	for _, fl := range f {
+		if fl == flag {
+			return true
+		}
+	}
+	return false
+}
+
+// String returns the flags separated by spaces, as written in fmd files.
+func (f Flags) String() string {
+	names := make([]string, 0, len(f))
+	for _, fl := range f {
+		names = append(names, string(fl))
+	}
+	return strings.Join(names, " ")
+}
+
+// HasFlag returns true if the section has the given flag.
+func (s *Section) HasFlag(flag Flag) bool {
+	return s.Flags.Has(flag)
+}
+
+// IsCBFS returns true if the section has the CBFS flag.
+func (s *Section) IsCBFS() bool {
+	return s.HasFlag(FlagCBFS)
+}
+
+// IsPreserve returns true if the section has the PRESERVE flag.
+func (s *Section) IsPreserve() bool {
+	return s.HasFlag(FlagPreserve)
+}
+
+// AddFlag adds a flag to the section, unless it already has it.
+func (s *Section) AddFlag(flag Flag) {
+	if !s.HasFlag(flag) {
+		s.Flags = append(s.Flags, flag)
+	}
+}
+
+// RemoveFlag removes a flag from the section. It returns false if the section
+// did not have it.
+func (s *Section) RemoveFlag(flag Flag) bool {
+	for idx, fl := range s.Flags {
+		if fl == flag {
+			s.Flags = append(s.Flags[:idx:idx], s.Flags[idx+1:]...)
+			return true
+		}
+	}
+	return false
+}
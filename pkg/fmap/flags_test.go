@@ -0,0 +1,69 @@
+package fmap
+
+import (
+	"encoding/json"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestFlags(t *testing.T) {
+	f, err := Parse(strings.NewReader(`FLASH 0x2000 {
+	COREBOOT(CBFS) 0x1000
+	RW_NVRAM(CBFS PRESERVE) 0x1000
+}`))
+	require.NoError(t, err)
+
+	cb := f.Find("COREBOOT", false)
+	assert.Equal(t, Flags{FlagCBFS}, cb.Flags)
+	assert.True(t, cb.IsCBFS())
+	assert.False(t, cb.IsPreserve())
+
+	nvram := f.Find("RW_NVRAM", false)
+	assert.Equal(t, Flags{FlagCBFS, FlagPreserve}, nvram.Flags)
+	assert.True(t, nvram.IsCBFS())
+	assert.True(t, nvram.IsPreserve())
+	assert.False(t, f.IsCBFS())
+	assert.Equal(t, "FLASH 0x2000 {\n\tCOREBOOT(CBFS) 0x1000\n\tRW_NVRAM(CBFS PRESERVE) 0x1000\n}\n", f.ToFlashmap())
+}
+
+func TestAddRemoveFlag(t *testing.T) {
+	f, err := Parse(strings.NewReader("FLASH 0x1000 {\n\tRW_NVRAM 0x1000\n}"))
+	require.NoError(t, err)
+	nvram := f.Find("RW_NVRAM", false)
+
+	nvram.AddFlag(FlagPreserve)
+	nvram.AddFlag(FlagCBFS)
+	nvram.AddFlag(FlagPreserve)
+	assert.Equal(t, Flags{FlagPreserve, FlagCBFS}, nvram.Flags)
+	assert.Equal(t, "FLASH 0x1000 {\n\tRW_NVRAM(PRESERVE CBFS) 0x1000\n}\n", f.ToFlashmap())
+
+	assert.True(t, nvram.RemoveFlag(FlagPreserve))
+	assert.False(t, nvram.RemoveFlag(FlagPreserve))
+	assert.Equal(t, Flags{FlagCBFS}, nvram.Flags)
+	assert.True(t, nvram.RemoveFlag(FlagCBFS))
+	assert.Equal(t, "FLASH 0x1000 {\n\tRW_NVRAM 0x1000\n}\n", f.ToFlashmap())
+}
+
+func TestFlagsSerialization(t *testing.T) {
+	f, err := Parse(strings.NewReader("FLASH 0x2000 {\n\tRW_NVRAM(CBFS PRESERVE) 0x1000\n}"))
+	require.NoError(t, err)
+
+	data, err := json.Marshal(f.Sections[0])
+	require.NoError(t, err)
+	assert.Equal(t, `{"name":"RW_NVRAM","annotation":"CBFS PRESERVE","start":null,"size":4096,"unit":"","flags":["CBFS","PRESERVE"],"attributes":[],"children":[]}`, string(data))
+
+	var sec Section
+	require.NoError(t, json.Unmarshal(data, &sec))
+	assert.Equal(t, Flags{FlagCBFS, FlagPreserve}, sec.Flags)
+	require.NoError(t, json.Unmarshal([]byte(`{"name":"RW_NVRAM","annotation":"PRESERVE","size":4096}`), &sec))
+	assert.Equal(t, Flags{FlagPreserve}, sec.Flags)
+
+	bin, err := f.ToBinary()
+	require.NoError(t, err)
+	f2, err := FromBinary(bin)
+	require.NoError(t, err)
+	assert.Equal(t, Flags{FlagPreserve}, f2.Sections[0].Flags)
+}
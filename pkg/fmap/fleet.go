@@ -0,0 +1,59 @@
+package fmap
+
+import "fmt"
+
+// Deviation is a section of a device whose hash differs from the golden one.
+type Deviation struct {
+	Device string `json:"device"`
+	Path   string `json:"path"`
+	// Want is the golden hash, or empty if the section is not in the golden
+	// report.
+	Want string `json:"want"`
+	// Got is the hash reported by the device, or empty if the device does
+	// not report the section.
+	Got string `json:"got"`
+}
+
+// String returns a human readable description of the deviation.
+func (d Deviation) String() string {
+	switch {
+	case d.Want == "":
+		return fmt.Sprintf("%s: unexpected section %s", d.Device, d.Path)
+	case d.Got == "":
+		return fmt.Sprintf("%s: missing section %s", d.Device, d.Path)
+	default:
+		return fmt.Sprintf("%s: %s has hash %s, want %s", d.Device, d.Path, d.Got, d.Want)
+	}
+}
+
+// CompareFleet compares the hash reports of many devices against a golden
+// report, and returns the sections that deviate, device by device in the order
+// of the reports, and section by section in the order of the golden report
+// followed by the sections that are only reported by the device. Sections are
+// matched by path. Reports using a different algorithm than the golden one
+// can't be compared and return an error.
+func CompareFleet(golden *HashReport, reports []*HashReport) ([]Deviation, error) {
+	var ret []Deviation
+	for _, report := range reports {
+		if report.Algorithm != golden.Algorithm {
+			return nil, fmt.Errorf("device %s: hash algorithm %s does not match the golden %s", report.Device, report.Algorithm, golden.Algorithm)
+		}
+		got := make(map[string]string, len(report.Sections))
+		for _, sh := range report.Sections {
+			got[sh.Path] = sh.Hash
+		}
+		want := make(map[string]bool, len(golden.Sections))
+		for _, sh := range golden.Sections {
+			want[sh.Path] = true
+			if h := got[sh.Path]; h != sh.Hash {
+				ret = append(ret, Deviation{Device: report.Device, Path: sh.Path, Want: sh.Hash, Got: h})
+			}
+		}
+		for _, sh := range report.Sections {
+			if !want[sh.Path] {
+				ret = append(ret, Deviation{Device: report.Device, Path: sh.Path, Got: sh.Hash})
+			}
+		}
+	}
+	return ret, nil
+}
@@ -0,0 +1,49 @@
+package fmap
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestCompareFleet(t *testing.T) {
+	f, err := Parse(strings.NewReader(imageLayout))
+	require.NoError(t, err)
+	image := testImage()
+	golden, err := f.Hash(bytes.NewReader(image))
+	require.NoError(t, err)
+
+	good, err := f.Hash(bytes.NewReader(image))
+	require.NoError(t, err)
+	good.Device = "good"
+
+	tampered := append([]byte(nil), image...)
+	tampered[0x3000] = 0xff
+	bad, err := f.Hash(bytes.NewReader(tampered))
+	require.NoError(t, err)
+	bad.Device = "bad"
+
+	// a device with a different layout
+	other := &HashReport{Device: "other", Algorithm: HashAlgorithmSHA256}
+	for _, sh := range golden.Sections {
+		if sh.Path != "FLASH/RO/FMAP" {
+			other.Sections = append(other.Sections, sh)
+		}
+	}
+	other.Sections = append(other.Sections, SectionHash{Path: "FLASH/RW_NVRAM", Hash: "00"})
+
+	deviations, err := CompareFleet(golden, []*HashReport{good, bad, other})
+	require.NoError(t, err)
+	require.Equal(t, 4, len(deviations))
+	assert.Equal(t, Deviation{Device: "bad", Path: "FLASH", Want: golden.Sections[0].Hash, Got: bad.Sections[0].Hash}, deviations[0])
+	assert.Equal(t, "bad", deviations[1].Device)
+	assert.Equal(t, "FLASH/RW_VPD", deviations[1].Path)
+	assert.Equal(t, "other: missing section FLASH/RO/FMAP", deviations[2].String())
+	assert.Equal(t, "other: unexpected section FLASH/RW_NVRAM", deviations[3].String())
+
+	_, err = CompareFleet(golden, []*HashReport{{Device: "md5", Algorithm: "md5"}})
+	require.Error(t, err)
+}
@@ -1,57 +1,89 @@
 package fmap
 
 import (
+	"bytes"
+	"errors"
 	"fmt"
 	"io"
 	"io/ioutil"
-	"log"
+	"math"
+	"os"
 	"strings"
 
-	"github.com/alecthomas/participle"
+	"github.com/alecthomas/participle/lexer"
+	"github.com/insomniacslk/fmap/pkg/fmap/syntax"
 )
 
-// Section represents a generic flashmap section. This is also used for the text
-// parser to read a flashmap file.
+// Section represents a generic flashmap section. The parser builds the
+// sections of a flashmap file from its syntax tree, see package syntax.
 type Section struct {
-	Name       string     `@Ident`
-	Annotation *string    `("(" { @Ident } ")")?`
-	Start      *int       `("@" @Int)?`
-	Size       int        `@Int`
-	Unit       string     `@("k"|"K"|"m"|"M")?`
-	Sections   []*Section `("{" { @@ } "}")*`
+	Name       string
+	Flags      Flags
+	Attributes []*Attribute
+	StartExpr  *Expr
+	SizeExpr   *Expr
+	Includes   []*Include
+	Sections   []*Section
+
+	// Defines are the constant definitions in effect when parsing the file,
+	// set on the root section only. See Define.
+	Defines []*Define
+
+	// Start, Size and Unit are evaluated by the parser from StartExpr and
+	// SizeExpr. Start is relative to the parent section, and nil if omitted.
+	// The size in bytes is Size multiplied by the unit, see ByteSize.
+	Start *int64
+	Size  int64
+	Unit  string
+
+	// Fill is true if the size was omitted in the source, meaning that the
+	// section takes the remaining space in its parent. The parser computes
+	// the size, and at most one sub-section per level can fill.
+	Fill bool
+
+	// Pos and EndPos are set by the parser to the position of the first
+	// token of the section and of the first token following it.
+	Pos    lexer.Position
+	EndPos lexer.Position
+
+	// formats of the start and the size in the source, remembered by the
+	// parser in lossless mode
+	startFormat numberFormat
+	sizeFormat  numberFormat
+
+	// protectRO is true if the read-only sections of the tree are
+	// protected, set on the root section only. See ProtectReadOnly.
+	protectRO bool
+
+	// parseWarnings are the problems tolerated by the parser in lenient
+	// mode, set on the root section only. See ParseWarnings.
+	parseWarnings []Violation
+
+	parent     *Section
+	span       Span
+	journal    *journal
+	provenance []Transform
+
+	// absolute offset cached by ResolveOffsets, valid while the journal is
+	// at step absStep
+	absStart int64
+	absStep  int
+	absValid bool
 }
 
-// ToFlashmap returns the text representation of the Section struct.
-func (s *Section) ToFlashmap() string {
-	return s.Indent("\t", 0)
+// ToFlashmap returns the text representation of the Section struct. By
+// default sub-sections are indented with tabs, in the order they are in the
+// tree, and numbers are written in hexadecimal, unless they were written with
+// a unit or parsed in lossless mode, see ParseOptions. The options change
+// this style, see FormatOption.
+func (s *Section) ToFlashmap(opts ...FormatOption) string {
+	return newFormatter(opts...).format(s, 0)
 }
 
 // Indent indents a section with the given prefix string and indentation level.
 // This is suitable to print nested sections to be serialized to text file.
 func (s *Section) Indent(prefix string, level int) string {
-	indent := strings.Repeat(prefix, level)
-	ret := indent + s.Name
-	if s.Annotation != nil {
-		ret += "(" + *s.Annotation + ")"
-	}
-	if s.Start != nil {
-		ret += fmt.Sprintf("@0x%x", *s.Start)
-	}
-	if s.Unit != "" {
-		ret += fmt.Sprintf(" %d%s", s.Size, s.Unit)
-	} else {
-		ret += fmt.Sprintf(" 0x%x", s.Size)
-	}
-	if len(s.Sections) > 0 {
-		ret += " {\n"
-		for _, sec := range s.Sections {
-			ret += sec.Indent(prefix, level+1)
-		}
-		ret += indent + "}\n"
-	} else {
-		ret += "\n"
-	}
-	return ret
+	return newFormatter(WithIndent(prefix)).format(s, level)
 }
 
 // FindFunction is a function type that receives a Section, its index in the
@@ -59,13 +91,13 @@ func (s *Section) Indent(prefix string, level int) string {
 type FindFunction func(sec *Section, idx int, parent *Section) interface{}
 
 // findFunc is a support function for FindFunc, that searches recursively for a
-// section by name, and, if found, returns the section, its index in the
-// parent's sections, and the parent. If no section by that name is found, the
-// returned section is `nil`.
+// section by name or alias, and, if found, returns the section, its index in
+// the parent's sections, and the parent. If no section by that name is found,
+// the returned section is `nil`.
 // If `recursive` is true, search also in sub-sections.
 func findFunc(s *Section, name string, recursive bool) (*Section, int, *Section) {
 	for idx, sec := range s.Sections {
-		if sec.Name == name {
+		if sec.hasName(name) {
 			return sec, idx, s
 		}
 	}
@@ -94,13 +126,18 @@ func (s *Section) FindFunc(name string, recursive bool, f FindFunction) interfac
 // the given name is found, only the first one is returned.
 // If no section is found, it returns `nil`.
 func (s *Section) Find(name string, recursive bool) *Section {
-	ret := s.FindFunc(name, recursive, func(s *Section, _ int, _ *Section) interface{} {
-		return s
-	})
-	if sec, ok := ret.(*Section); ok {
-		return sec
+	sec, _ := s.Lookup(name, recursive)
+	return sec
+}
+
+// Lookup is like Find, but returns a *NotFoundError, matching
+// ErrSectionNotFound, if no section with the given name exists.
+func (s *Section) Lookup(name string, recursive bool) (*Section, error) {
+	sec, _, _ := findFunc(s, name, recursive)
+	if sec == nil {
+		return nil, &NotFoundError{Name: name}
 	}
-	panic("not a section")
+	return sec, nil
 }
 
 // Remove removes a sub-section from the current section. If `recursive` is
@@ -109,68 +146,335 @@ func (s *Section) Find(name string, recursive bool) *Section {
 // This function returns true if the section was found and removed, false
 // otherwise.
 func (s *Section) Remove(name string, recursive bool) bool {
-	ret := s.FindFunc(name, recursive, func(sec *Section, idx int, parent *Section) interface{} {
-		if sec == nil {
-			return false
-		}
-		parent.Sections = append(parent.Sections[:idx], parent.Sections[idx+1:]...)
-		return true
-	})
-	if removed, ok := ret.(bool); ok {
-		return removed
+	_, err := s.Delete(name, recursive)
+	return err == nil
+}
+
+// Delete is like Remove, but returns the removed section, or a
+// *NotFoundError, matching ErrSectionNotFound, if no section with the given
+// name exists. Protected read-only sections cannot be removed, see
+// ProtectReadOnly.
+func (s *Section) Delete(name string, recursive bool) (*Section, error) {
+	sec, idx, parent := findFunc(s, name, recursive)
+	if sec == nil {
+		return nil, &NotFoundError{Name: name}
 	}
-	panic("not a boolean")
+	if err := checkWritable(sec, "Remove("+name+")"); err != nil {
+		return nil, err
+	}
+	parent.Sections = append(parent.Sections[:idx], parent.Sections[idx+1:]...)
+	parent.touch(s.record("Remove(" + name + ")"))
+	sec.parent = nil
+	return sec, nil
 }
 
-// size returns the size in bytes of a section, taking the unit into account
-func size(s *Section) int {
-	switch s.Unit {
+// RemoveLeavingHole is like Delete, but replaces the removed section with a
+// free region section of the same start and size, so that the offsets of the
+// following sections don't change, e.g. when downstream tools depend on
+// them. The hole is called `holeName`, or NAME_UNUSED if empty, and must be
+// recognized as a free region, see IsUnused. It takes the place of the
+// removed section in the tree, so Defrag and Insert can later reclaim it.
+func (s *Section) RemoveLeavingHole(name string, recursive bool, holeName string) (*Section, error) {
+	sec, idx, parent := findFunc(s, name, recursive)
+	if sec == nil {
+		return nil, &NotFoundError{Name: name}
+	}
+	if holeName == "" {
+		holeName = sec.Name + "_UNUSED"
+	}
+	hole := &Section{Name: holeName, Size: sec.Size, Unit: sec.Unit, Fill: sec.Fill, parent: parent}
+	if !hole.IsUnused() {
+		return nil, sectionErrorf(sec, "hole name %s is not a free region name, like UNUSED or %s_UNUSED", holeName, sec.Name)
+	}
+	if err := checkNewName(sec, sec, holeName); err != nil {
+		return nil, err
+	}
+	op := "Remove(" + name + ", " + holeName + ")"
+	if err := checkWritable(sec, op); err != nil {
+		return nil, err
+	}
+	if sec.Start != nil {
+		start := *sec.Start
+		hole.Start = &start
+	}
+	parent.Sections[idx] = hole
+	setJournal(hole, s.journal)
+	t := s.record(op)
+	hole.touch(t)
+	parent.touch(t)
+	sec.parent = nil
+	return sec, nil
+}
+
+// unitSize returns the number of bytes represented by one unit of the given
+// size unit.
+func unitSize(unit string) int64 {
+	switch unit {
 	case "k", "K":
-		return s.Size * 1024
+		return 1024
 	case "m", "M":
-		return s.Size * 1024 * 1024
+		return 1024 * 1024
 	default:
-		return s.Size
+		return 1
 	}
 }
 
-func defrag(s *Section) bool {
-	hasChanged := false
-	start := 0
-	for _, sec := range s.Sections {
-		if sec.Start != nil && *sec.Start > start {
-			log.Printf("Compacting section %s", sec.Name)
-			// needs to be compacted
-			hasChanged = true
-			*sec.Start = start
+// size returns the size in bytes of a section, taking the unit into account.
+// Sizes that overflow an int64 are clamped, and reported by Validate.
+func size(s *Section) int64 {
+	n, err := mulInt64(s.Size, unitSize(s.Unit))
+	if err != nil {
+		if s.Size < 0 {
+			return math.MinInt64
 		}
+		return math.MaxInt64
+	}
+	return n
+}
+
+// ByteSize returns the size of the section in bytes, taking the unit into
+// account.
+func (s *Section) ByteSize() int64 {
+	return size(s)
+}
+
+// childStarts returns the starts of the sub-sections of `s`, relative to `s`.
+// Sections without an explicit start are placed right after their previous
+// sibling.
+func childStarts(s *Section) []int64 {
+	starts := make([]int64, len(s.Sections))
+	start := int64(0)
+	for idx, sec := range s.Sections {
+		if sec.Start != nil {
+			start = *sec.Start
+		}
+		starts[idx] = start
 		start += size(sec)
-		if yes := defrag(sec); yes {
-			hasChanged = true
+	}
+	return starts
+}
+
+// Move is a change of the start of a section made by Defrag.
+type Move struct {
+	// Path is the path of the section, see Section.Path.
+	Path    string
+	Section *Section
+	// OldStart and NewStart are relative to the parent section.
+	OldStart int64
+	NewStart int64
+}
+
+// String returns a description of the move.
+func (m Move) String() string {
+	return fmt.Sprintf("%s: 0x%x -> 0x%x", m.Path, m.OldStart, m.NewStart)
+}
+
+// defrag compacts the sub-sections of `s`, whose path is `path`,
+// recursively, and appends the moves to `moves`. The sections are not modified
+// if `dryRun` is true.
+func defrag(s *Section, path string, dryRun bool, step func() Transform, moves *[]Move) {
+	// the sub-sections are compacted by start, which is not the order they
+	// are listed in if some of them are out of order. In that case the starts
+	// become explicit, as the previous siblings of those placed after them
+	// may move
+	secs, starts := sortedChildren(s)
+	ordered := true
+	for idx, sec := range secs {
+		if sec != s.Sections[idx] {
+			ordered = false
+		}
+	}
+	start := int64(0)
+	for idx, sec := range secs {
+		if sec.IsMarker() {
+			// markers stay where they are
+			continue
+		}
+		secStart, explicit := starts[idx], !ordered || sec.Start != nil
+		if !ordered && sec.Start == nil && !dryRun {
+			sec.Start = &secStart
 		}
+		if sec.isProtected() {
+			// protected sections stay in place, even if their start is
+			// implicit, and the following ones are compacted after them
+			if secStart > start {
+				if sec.Start == nil && !dryRun {
+					sec.Start = &secStart
+				}
+				start = secStart
+			}
+			start += size(sec)
+			continue
+		}
+		secPath := path + "/" + sec.Name
+		if explicit && secStart > start {
+			// needs to be compacted
+			*moves = append(*moves, Move{Path: secPath, Section: sec, OldStart: secStart, NewStart: start})
+			if !dryRun {
+				*sec.Start = start
+				sec.touch(step())
+			}
+		}
+		start += size(sec)
+		defrag(sec, secPath, dryRun, step, moves)
 	}
-	return hasChanged
 }
 
 // Defrag defragments a flashmap so that no intermediate empty spaces are left.
-// This function returns true if any change was made, false otherwise.
-func (s *Section) Defrag() bool {
-	return defrag(s)
+// The sub-sections of each section are compacted in the order of their
+// starts, even if they are listed out of order. Protected read-only sections
+// are not moved, see ProtectReadOnly, and neither are markers with an explicit
+// start, see IsMarker. This function returns the moves of the sections, in
+// pre-order, which are empty if no change was needed. If `dryRun` is true,
+// the moves are computed but not applied.
+func (s *Section) Defrag(dryRun bool) []Move {
+	// all the moves of a single defragmentation share the same step
+	var (
+		t     Transform
+		moves []Move
+	)
+	defrag(s, s.Name, dryRun, func() Transform {
+		if t.Step == 0 {
+			t = s.record("Defrag()")
+		}
+		return t
+	}, &moves)
+	return moves
+}
+
+// utf8BOM is the UTF-8 encoded byte order mark that some editors prepend to
+// text files.
+var utf8BOM = []byte{0xef, 0xbb, 0xbf}
+
+// normalize strips a leading UTF-8 byte order mark, converts Windows (\r\n) and
+// old Mac (\r) line endings to \n, and removes trailing whitespace from every
+// line, so that files edited on other platforms parse the same way.
+func normalize(data []byte) []byte {
+	data = bytes.TrimPrefix(data, utf8BOM)
+	data = bytes.Replace(data, []byte("\r\n"), []byte("\n"), -1)
+	data = bytes.Replace(data, []byte("\r"), []byte("\n"), -1)
+	lines := bytes.Split(data, []byte("\n"))
+	for idx, line := range lines {
+		lines[idx] = bytes.TrimRight(line, " \t")
+	}
+	return bytes.Join(lines, []byte("\n"))
 }
 
 // Parse parses a flashmap from an io.Reader and returns a Section object.
+// Byte order marks, CRLF line endings and trailing whitespace are tolerated.
+// Sections that omit the size take the remaining space of their parent, see
+// Section.Fill. Constants can be defined at the start of the file, see Define.
+// Syntax errors are returned as a *ParseError, with the name of the file if
+// the reader has one, e.g. an *os.File.
 func Parse(fd io.Reader) (*Section, error) {
-	parser, err := participle.Build(&Section{})
+	return ParseWithOptions(fd, ParseOptions{})
+}
+
+// ParseString parses a flashmap from a string, see Parse. Relative include
+// paths are resolved from the current directory.
+func ParseString(s string) (*Section, error) {
+	return Parse(strings.NewReader(s))
+}
+
+// ParseBytes parses a flashmap from a byte slice, see Parse. Relative include
+// paths are resolved from the current directory.
+func ParseBytes(data []byte) (*Section, error) {
+	return Parse(bytes.NewReader(data))
+}
+
+// ParseFile parses the flashmap file at `path`, see Parse. The spans of the
+// sections refer to the file, relative include paths are resolved from its
+// directory, and the errors that don't name the file already are wrapped with
+// its path.
+func ParseFile(path string) (*Section, error) {
+	fd, err := os.Open(path)
 	if err != nil {
 		return nil, err
 	}
+	defer fd.Close()
+	flash, err := Parse(fd)
+	if err != nil {
+		var (
+			se *SectionError
+			pe *ParseError
+		)
+		if errors.As(err, &se) && se.Span.IsValid() || errors.As(err, &pe) && pe.Filename != "" {
+			return nil, err
+		}
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+	return flash, nil
+}
+
+// namedReader is a reader with the name of the file it reads, for the
+// positions of the syntax tree, see lexer.NameOfReader.
+type namedReader struct {
+	io.Reader
+	name string
+}
+
+func (r namedReader) Name() string { return r.name }
+
+// ParseWithOptions is like Parse, with options controlling parsing.
+func ParseWithOptions(fd io.Reader, opts ParseOptions) (*Section, error) {
 	data, err := ioutil.ReadAll(fd)
 	if err != nil {
 		return nil, err
 	}
-	flash := Section{}
-	if err := parser.ParseString(string(data), &flash); err != nil {
+	data = normalize(data)
+	ds, err := lookupDialects(opts.Dialects)
+	if err != nil {
 		return nil, err
 	}
+	data, directives, err := extractDirectives(data, ds)
+	if err != nil {
+		return nil, err
+	}
+	filename := lexer.NameOfReader(fd)
+	f, err := syntax.Parse(namedReader{Reader: bytes.NewReader(data), name: filename})
+	if err != nil {
+		return nil, err
+	}
+	var fileDefines []*Define
+	for _, d := range f.Defines {
+		fileDefines = append(fileDefines, fromSyntaxDefine(d))
+	}
+	consts, defines, err := evalDefines(fileDefines, opts)
+	if err != nil {
+		return nil, err
+	}
+	flash := *fromSyntaxSection(f.Flash)
+	flash.Defines = defines
+	tokens, err := syntax.Lex(bytes.NewReader(data))
+	if err != nil {
+		return nil, err
+	}
+	resolveSpans(&flash, filename, tokens)
+	if err := resolveIncludes(&flash, filename); err != nil {
+		return nil, err
+	}
+	if err := evalExprs(&flash, consts, opts.Lossless); err != nil {
+		return nil, err
+	}
+	setJournal(&flash, &journal{})
+	flash.Link()
+	if opts.Mode == ParseLenient {
+		flash.parseWarnings = inferRootSize(&flash)
+	}
+	if err := resolveFills(&flash); err != nil {
+		return nil, err
+	}
+	if err := applyDialects(&flash, filename, ds, directives); err != nil {
+		return nil, err
+	}
+	if opts.Mode != ParseDefault {
+		warnings, err := checkParseMode(&flash, opts.Mode)
+		if err != nil {
+			return nil, err
+		}
+		if opts.Mode == ParseLenient {
+			flash.parseWarnings = append(flash.parseWarnings, warnings...)
+		}
+	}
 	return &flash, nil
 }
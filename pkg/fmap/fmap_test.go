@@ -1,8 +1,12 @@
 package fmap
 
 import (
+	"bytes"
+	"errors"
 	"io/ioutil"
 	"os"
+	"strings"
+	"sync"
 	"testing"
 
 	"github.com/stretchr/testify/assert"
@@ -16,37 +20,37 @@ func TestParse(t *testing.T) {
 	require.NoError(t, err)
 	require.NotNil(t, f)
 	require.NotNil(t, f.Start)
-	require.Equal(t, 0xff000000, *f.Start)
-	require.Equal(t, 0x1000000, f.Size)
+	require.Equal(t, int64(0xff000000), *f.Start)
+	require.Equal(t, int64(0x1000000), f.Size)
 
 	// check SI_ALL section
 	require.Equal(t, 2, len(f.Sections))
 	require.NotNil(t, f.Sections[0])
 	assert.Equal(t, "SI_ALL", f.Sections[0].Name)
 	require.NotNil(t, f.Sections[0].Start)
-	assert.Equal(t, 0x0, *f.Sections[0].Start)
-	assert.Equal(t, 0x200000, f.Sections[0].Size)
+	assert.Equal(t, int64(0x0), *f.Sections[0].Start)
+	assert.Equal(t, int64(0x200000), f.Sections[0].Size)
 	assert.Equal(t, "", f.Sections[0].Unit)
 	// check SI_ALL's subsections
 	require.Equal(t, 2, len(f.Sections[0].Sections))
 	require.NotNil(t, f.Sections[0].Sections[0])
 	require.Equal(t, "SI_DESC", f.Sections[0].Sections[0].Name)
-	assert.Equal(t, 0x0, *f.Sections[0].Sections[0].Start)
-	assert.Equal(t, 4, f.Sections[0].Sections[0].Size)
+	assert.Equal(t, int64(0x0), *f.Sections[0].Sections[0].Start)
+	assert.Equal(t, int64(4), f.Sections[0].Sections[0].Size)
 	assert.Equal(t, "k", f.Sections[0].Sections[0].Unit)
 	require.NotNil(t, f.Sections[0].Sections[1])
 	assert.Equal(t, "SI_ME", f.Sections[0].Sections[1].Name)
 	require.NotNil(t, f.Sections[0].Sections[1].Start)
-	assert.Equal(t, 0x1000, *f.Sections[0].Sections[1].Start)
-	assert.Equal(t, 0x1ff000, f.Sections[0].Sections[1].Size)
+	assert.Equal(t, int64(0x1000), *f.Sections[0].Sections[1].Start)
+	assert.Equal(t, int64(0x1ff000), f.Sections[0].Sections[1].Size)
 	assert.Equal(t, "", f.Sections[0].Sections[1].Unit)
 
 	// check SI_BIOS section
 	require.NotNil(t, f.Sections[1])
 	assert.Equal(t, "SI_BIOS", f.Sections[1].Name)
 	require.NotNil(t, f.Sections[1].Start)
-	assert.Equal(t, 0x200000, *f.Sections[1].Start)
-	assert.Equal(t, 0xe00000, f.Sections[1].Size)
+	assert.Equal(t, int64(0x200000), *f.Sections[1].Start)
+	assert.Equal(t, int64(0xe00000), f.Sections[1].Size)
 }
 
 func TestParseParseError(t *testing.T) {
@@ -54,6 +58,80 @@ func TestParseParseError(t *testing.T) {
 	require.NoError(t, err)
 	_, err = Parse(fd)
 	require.Error(t, err)
+	var pe *ParseError
+	require.True(t, errors.As(err, &pe))
+	assert.Equal(t, ParseError{
+		Filename: "test_data/chromeos_bad_syntax.fmd",
+		Line:     16,
+		Column:   4,
+		Token:    ".",
+		Message:  `unexpected token "." (expected "}")`,
+	}, *pe)
+
+	// without a file name, and at the end of the file
+	_, err = ParseString("FLASH 0x1000 {\n\tA 0x100\n")
+	require.True(t, errors.As(err, &pe))
+	assert.Equal(t, "", pe.Filename)
+	assert.Equal(t, "", pe.Token)
+	assert.Equal(t, 3, pe.Line)
+}
+
+func TestParseConcurrent(t *testing.T) {
+	data, err := ioutil.ReadFile("test_data/chromeos.fmd")
+	require.NoError(t, err)
+	opts := ParseOptions{Defines: map[string]string{"X": "0x10"}}
+	want, err := ParseWithOptions(bytes.NewReader(data), opts)
+	require.NoError(t, err)
+
+	// the parsers are shared by all the parses
+	var wg sync.WaitGroup
+	results := make([]string, 8)
+	for idx := range results {
+		wg.Add(1)
+		go func(idx int) {
+			defer wg.Done()
+			f, err := ParseWithOptions(bytes.NewReader(data), opts)
+			if err == nil {
+				results[idx] = f.ToFlashmap()
+			}
+		}(idx)
+	}
+	wg.Wait()
+	for _, got := range results {
+		assert.Equal(t, want.ToFlashmap(), got)
+	}
+}
+
+func TestParseFile(t *testing.T) {
+	f, err := ParseFile("test_data/chromeos.fmd")
+	require.NoError(t, err)
+	assert.Equal(t, "test_data/chromeos.fmd", f.Span().Filename)
+
+	data, err := ioutil.ReadFile("test_data/chromeos.fmd")
+	require.NoError(t, err)
+	fb, err := ParseBytes(data)
+	require.NoError(t, err)
+	fs, err := ParseString(string(data))
+	require.NoError(t, err)
+	assert.Equal(t, f.ToFlashmap(), fb.ToFlashmap())
+	assert.Equal(t, f.ToFlashmap(), fs.ToFlashmap())
+	assert.Equal(t, "", fs.Span().Filename)
+
+	_, err = ParseFile("test_data/chromeos_bad_syntax.fmd")
+	assert.EqualError(t, err, `test_data/chromeos_bad_syntax.fmd:16:4: unexpected token "." (expected "}")`)
+	_, err = ParseFile("test_data/missing.fmd")
+	assert.True(t, os.IsNotExist(err))
+
+	// section errors already name the file
+	dir, err := ioutil.TempDir("", "fmap")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+	bad := dir + "/bad.fmd"
+	require.NoError(t, ioutil.WriteFile(bad, []byte("FLASH 0x100 {\n\tA@$X 0x10\n}\n"), 0644))
+	_, err = ParseFile(bad)
+	var se *SectionError
+	require.True(t, errors.As(err, &se))
+	assert.Equal(t, "section A ("+bad+":2): undefined constant X", err.Error())
 }
 
 func TestParseUnmodified(t *testing.T) {
@@ -121,6 +199,35 @@ func TestRemove(t *testing.T) {
 	require.True(t, f.Remove("RW_MISC", true))
 }
 
+func TestRemoveLeavingHole(t *testing.T) {
+	f, err := Parse(strings.NewReader(`FLASH 0x10000 {
+	RO 0x4000
+	RW_LEGACY 16K
+	RW 0x8000
+}`))
+	require.NoError(t, err)
+
+	removed, err := f.RemoveLeavingHole("RW_LEGACY", false, "")
+	require.NoError(t, err)
+	assert.Equal(t, "RW_LEGACY", removed.Name)
+	assert.Nil(t, removed.Parent())
+	assert.Equal(t, `FLASH 0x10000 {
+	RO 0x4000
+	RW_LEGACY_UNUSED 16K
+	RW 0x8000
+}
+`, f.ToFlashmap())
+	assert.Equal(t, int64(0x8000), f.Find("RW", false).AbsoluteStart())
+	assert.Equal(t, "Remove(RW_LEGACY, RW_LEGACY_UNUSED)", f.Find("RW_LEGACY_UNUSED", false).Provenance()[0].Op)
+
+	_, err = f.RemoveLeavingHole("RO", false, "FREE")
+	assert.Error(t, err)
+	_, err = f.RemoveLeavingHole("RO", false, "RW_LEGACY_UNUSED")
+	assert.Error(t, err)
+	_, err = f.RemoveLeavingHole("NOPE", false, "")
+	assert.True(t, errors.Is(err, ErrSectionNotFound))
+}
+
 func TestRemoveNonExisting(t *testing.T) {
 	fd, err := os.Open("test_data/chromeos.fmd")
 	require.NoError(t, err)
@@ -152,8 +259,8 @@ func TestDefragNoOp(t *testing.T) {
 	require.NoError(t, err)
 	require.NotNil(t, f)
 
-	// do nothing, defrag should return false
-	assert.False(t, f.Defrag())
+	// do nothing, defrag should return no moves
+	assert.Empty(t, f.Defrag(false))
 }
 
 func TestDefragResize(t *testing.T) {
@@ -163,11 +270,57 @@ func TestDefragResize(t *testing.T) {
 	require.NoError(t, err)
 	require.NotNil(t, f)
 
-	// resize a section, defrag should return true
+	// resize a section, defrag should move the following one
 	rwvpd := f.Find("RW_VPD", true)
 	require.NotNil(t, rwvpd)
 	rwvpd.Size /= 2
-	assert.True(t, f.Defrag())
+	nvram := f.Find("RW_NVRAM", true)
+	assert.Equal(t, []Move{{Path: "FLASH/SI_BIOS/RW_MISC/RW_NVRAM", Section: nvram, OldStart: 0x2a000, NewStart: 0x29000}}, f.Defrag(false))
+	assert.Equal(t, int64(0x29000), *nvram.Start)
+	assert.Equal(t, "FLASH/SI_BIOS/RW_MISC/RW_NVRAM: 0x2a000 -> 0x29000", Move{Path: "FLASH/SI_BIOS/RW_MISC/RW_NVRAM", OldStart: 0x2a000, NewStart: 0x29000}.String())
+}
+
+func TestDefragDryRun(t *testing.T) {
+	fd, err := os.Open("test_data/chromeos.fmd")
+	require.NoError(t, err)
+	f, err := Parse(fd)
+	require.NoError(t, err)
+
+	require.True(t, f.Remove("RW_SECTION_A", true))
+	before := f.ToFlashmap()
+	moves := f.Defrag(true)
+	require.Equal(t, 5, len(moves))
+	assert.Equal(t, "FLASH/SI_BIOS/RW_SECTION_B: 0x3e8000 -> 0x0", moves[0].String())
+	assert.Equal(t, before, f.ToFlashmap())
+	assert.Empty(t, f.Find("RW_SECTION_B", true).Provenance())
+}
+
+func TestDefragUnordered(t *testing.T) {
+	f, err := ParseString(`FLASH 0x10000 {
+	C@0x8000 0x1000
+	A@0x1000 0x1000
+	B 0x1000
+	D@0x4000 0x1000
+}`)
+	require.NoError(t, err)
+
+	moves := f.Defrag(true)
+	require.Equal(t, 4, len(moves))
+	assert.Equal(t, "FLASH/A: 0x1000 -> 0x0", moves[0].String())
+	assert.Equal(t, "FLASH/B: 0x2000 -> 0x1000", moves[1].String())
+	assert.Equal(t, "FLASH/D: 0x4000 -> 0x2000", moves[2].String())
+	assert.Equal(t, "FLASH/C: 0x8000 -> 0x3000", moves[3].String())
+	assert.Nil(t, f.Find("B", false).Start)
+
+	assert.Equal(t, moves, f.Defrag(false))
+	assert.Equal(t, `FLASH 0x10000 {
+	C@0x3000 0x1000
+	A@0x0 0x1000
+	B@0x1000 0x1000
+	D@0x2000 0x1000
+}
+`, f.ToFlashmap())
+	assert.Empty(t, f.Validate())
 }
 
 func TestDefragRemove(t *testing.T) {
@@ -181,6 +334,36 @@ func TestDefragRemove(t *testing.T) {
 	want, err := ioutil.ReadFile("test_data/chromeos_defragmented.fmd")
 	require.NoError(t, err)
 	require.NotNil(t, f.Remove("RW_SECTION_A", true))
-	require.True(t, f.Defrag())
+	require.NotEmpty(t, f.Defrag(false))
 	assert.Equal(t, string(want), f.ToFlashmap())
 }
+
+func TestParseWindowsLineEndings(t *testing.T) {
+	data, err := ioutil.ReadFile("test_data/chromeos.fmd")
+	require.NoError(t, err)
+	want, err := Parse(bytes.NewReader(data))
+	require.NoError(t, err)
+
+	// BOM, CRLF line endings and trailing whitespace
+	crlf := append([]byte{0xef, 0xbb, 0xbf}, bytes.Replace(data, []byte("\n"), []byte(" \t\r\n"), -1)...)
+	f, err := Parse(bytes.NewReader(crlf))
+	require.NoError(t, err)
+	assert.Equal(t, want.ToFlashmap(), f.ToFlashmap())
+
+	// old Mac line endings
+	cr := bytes.Replace(data, []byte("\n"), []byte("\r"), -1)
+	f, err = Parse(bytes.NewReader(cr))
+	require.NoError(t, err)
+	assert.Equal(t, want.ToFlashmap(), f.ToFlashmap())
+}
+
+func TestNormalize(t *testing.T) {
+	in := []byte("\xef\xbb\xbfFLASH 4k {\r\n\tA 2k  \r\n\tB 2k\t\r}\r\n")
+	assert.Equal(t, "FLASH 4k {\n\tA 2k\n\tB 2k\n}\n", string(normalize(in)))
+}
+
+func TestByteSize(t *testing.T) {
+	assert.Equal(t, int64(0x1000), (&Section{Size: 4, Unit: "k"}).ByteSize())
+	assert.Equal(t, int64(0x200000), (&Section{Size: 2, Unit: "M"}).ByteSize())
+	assert.Equal(t, int64(0x1234), (&Section{Size: 0x1234}).ByteSize())
+}
@@ -0,0 +1,180 @@
+package fmap
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// fmapDecodeFieldRe matches a key="value" field of the output of fmap_decode.
+var fmapDecodeFieldRe = regexp.MustCompile(`(\w+)="([^"]*)"`)
+
+// fmapDecodeFlags are the names fmap_decode uses for the area flags.
+var fmapDecodeFlags = map[string]AreaFlags{
+	"static":     AreaStatic,
+	"compressed": AreaCompressed,
+	"ro":         AreaReadOnly,
+	"preserve":   AreaPreserve,
+}
+
+// parseFmapDecodeUint parses the number in the field `key` of a line of the
+// output of fmap_decode.
+func parseFmapDecodeUint(fields map[string]string, key string, bits int) (uint64, error) {
+	v, ok := fields[key]
+	if !ok {
+		return 0, fmt.Errorf("missing %s", key)
+	}
+	n, err := strconv.ParseUint(v, 0, bits)
+	if err != nil {
+		return 0, fmt.Errorf("invalid %s %q: %v", key, v, err)
+	}
+	return n, nil
+}
+
+// fmapDecodeName converts a name of the output of fmap_decode to a FMAP name
+// field.
+func fmapDecodeName(name string) ([NameLen]byte, error) {
+	var ret [NameLen]byte
+	if len(name) >= NameLen {
+		return ret, fmt.Errorf("name %q is too long: must be at most %d characters", name, NameLen-1)
+	}
+	copy(ret[:], name)
+	return ret, nil
+}
+
+// ParseFmapDecode parses the output of the fmap_decode utility of the
+// original flashmap project, made of a header line followed by one line per
+// area of key="value" fields, e.g.
+//
+//	fmap_signature="0x5f5f50414d465f5f" fmap_ver_major="1" fmap_ver_minor="0" fmap_base="0x00000000ff800000" fmap_size="0x800000" fmap_name="FMAP" fmap_nareas="2"
+//	area_offset="0x00000000" area_size="0x00400000" area_name="RO" area_flags_raw="0x02" area_flags="static"
+//
+// and returns the corresponding section tree, as FromBinary does for a
+// binary FMAP. Empty lines are ignored.
+func ParseFmapDecode(r io.Reader) (*Section, error) {
+	var (
+		hdr    binaryHeader
+		areas  []binaryArea
+		seen   bool
+		nareas = -1
+	)
+	scanner := bufio.NewScanner(r)
+	for lineno := 1; scanner.Scan(); lineno++ {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" {
+			continue
+		}
+		fields := make(map[string]string)
+		for _, m := range fmapDecodeFieldRe.FindAllStringSubmatch(line, -1) {
+			fields[m[1]] = m[2]
+		}
+		if _, ok := fields["fmap_signature"]; ok {
+			if seen {
+				return nil, fmt.Errorf("%d: more than one FMAP header", lineno)
+			}
+			seen = true
+			if err := parseFmapDecodeHeader(fields, &hdr, &nareas); err != nil {
+				return nil, fmt.Errorf("%d: %v", lineno, err)
+			}
+			continue
+		}
+		if _, ok := fields["area_offset"]; !ok {
+			return nil, fmt.Errorf("%d: expected a FMAP header or an area", lineno)
+		}
+		if !seen {
+			return nil, fmt.Errorf("%d: area before the FMAP header", lineno)
+		}
+		area, err := parseFmapDecodeArea(fields)
+		if err != nil {
+			return nil, fmt.Errorf("%d: %v", lineno, err)
+		}
+		areas = append(areas, area)
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+	if !seen {
+		return nil, ErrNoFMAP
+	}
+	if nareas >= 0 && nareas != len(areas) {
+		return nil, fmt.Errorf("the header lists %d areas, but %d are present", nareas, len(areas))
+	}
+	return fromAreas(hdr, areas)
+}
+
+// parseFmapDecodeHeader parses the fields of the header line of the output of
+// fmap_decode into `hdr`, and the number of areas it lists, if any, into
+// `nareas`.
+func parseFmapDecodeHeader(fields map[string]string, hdr *binaryHeader, nareas *int) error {
+	sig, err := parseFmapDecodeUint(fields, "fmap_signature", 64)
+	if err != nil {
+		return err
+	}
+	// the signature is printed as a little-endian number
+	for i := range hdr.Signature {
+		hdr.Signature[i] = byte(sig >> (8 * uint(i)))
+	}
+	if string(hdr.Signature[:]) != Signature {
+		return fmt.Errorf("invalid FMAP signature 0x%x", sig)
+	}
+	if hdr.Base, err = parseFmapDecodeUint(fields, "fmap_base", 64); err != nil {
+		return err
+	}
+	n, err := parseFmapDecodeUint(fields, "fmap_size", 32)
+	if err != nil {
+		return err
+	}
+	hdr.Size = uint32(n)
+	if hdr.Name, err = fmapDecodeName(fields["fmap_name"]); err != nil {
+		return err
+	}
+	if _, ok := fields["fmap_nareas"]; ok {
+		n, err := parseFmapDecodeUint(fields, "fmap_nareas", 16)
+		if err != nil {
+			return err
+		}
+		*nareas = int(n)
+	}
+	return nil
+}
+
+// parseFmapDecodeArea parses the fields of an area line of the output of
+// fmap_decode. The flags are taken from area_flags_raw if present, otherwise
+// from the comma-separated names of area_flags.
+func parseFmapDecodeArea(fields map[string]string) (binaryArea, error) {
+	var area binaryArea
+	offset, err := parseFmapDecodeUint(fields, "area_offset", 32)
+	if err != nil {
+		return area, err
+	}
+	sz, err := parseFmapDecodeUint(fields, "area_size", 32)
+	if err != nil {
+		return area, err
+	}
+	area.Offset, area.Size = uint32(offset), uint32(sz)
+	if area.Name, err = fmapDecodeName(fields["area_name"]); err != nil {
+		return area, err
+	}
+	if _, ok := fields["area_flags_raw"]; ok {
+		flags, err := parseFmapDecodeUint(fields, "area_flags_raw", 16)
+		if err != nil {
+			return area, err
+		}
+		area.Flags = uint16(flags)
+		return area, nil
+	}
+	for _, name := range strings.Split(fields["area_flags"], ",") {
+		if name = strings.TrimSpace(name); name == "" {
+			continue
+		}
+		flag, ok := fmapDecodeFlags[name]
+		if !ok {
+			return area, fmt.Errorf("unknown area flag %q", name)
+		}
+		area.Flags |= uint16(flag)
+	}
+	return area, nil
+}
@@ -0,0 +1,52 @@
+package fmap
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestParseFmapDecode(t *testing.T) {
+	dump := `fmap_signature="0x5f5f50414d465f5f" fmap_ver_major="1" fmap_ver_minor="0" fmap_base="0x00000000ff800000" fmap_size="0x10000" fmap_name="FLASH" fmap_nareas="4"
+area_offset="0x00000000" area_size="0x00008000" area_name="RO" area_flags_raw="0x01" area_flags="static"
+area_offset="0x00000000" area_size="0x00000800" area_name="FMAP" area_flags_raw="0x00" area_flags=""
+area_offset="0x00008000" area_size="0x00004000" area_name="RW" area_flags_raw="0x00" area_flags=""
+area_offset="0x0000c000" area_size="0x00004000" area_name="RW_NVRAM" area_flags="static,preserve"
+
+`
+	f, err := ParseFmapDecode(strings.NewReader(dump))
+	require.NoError(t, err)
+	assert.Equal(t, `FLASH@0xff800000 0x10000 {
+	RO@0x0 0x8000 {
+		FMAP@0x0 0x800
+	}
+	RW@0x8000 0x4000
+	RW_NVRAM(PRESERVE)@0xc000 0x4000
+}
+`, f.ToFlashmap())
+	assert.Equal(t, f, f.Find("FMAP", true).Root())
+}
+
+func TestParseFmapDecodeErrors(t *testing.T) {
+	header := `fmap_signature="0x5f5f50414d465f5f" fmap_base="0x0" fmap_size="0x1000" fmap_name="FLASH" fmap_nareas="1"` + "\n"
+	for _, tc := range []struct {
+		dump string
+		err  string
+	}{
+		{"", "no FMAP found"},
+		{`area_offset="0x0" area_size="0x10" area_name="A"`, "1: area before the FMAP header"},
+		{header + "garbage", "2: expected a FMAP header or an area"},
+		{header + header, "2: more than one FMAP header"},
+		{`fmap_signature="0x1234" fmap_base="0x0" fmap_size="0x1000" fmap_name="FLASH"`, "1: invalid FMAP signature 0x1234"},
+		{header, "the header lists 1 areas, but 0 are present"},
+		{header + `area_offset="0x0" area_size="0x10" area_name="A" area_flags="fast"`, `2: unknown area flag "fast"`},
+		{header + `area_offset="0x0" area_name="A"`, "2: missing area_size"},
+		{header + `area_offset="0x100000000" area_size="0x10" area_name="A"`, `2: invalid area_offset "0x100000000"`},
+	} {
+		_, err := ParseFmapDecode(strings.NewReader(tc.dump))
+		require.Error(t, err, tc.dump)
+		assert.Contains(t, err.Error(), tc.err)
+	}
+}
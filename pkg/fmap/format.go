@@ -0,0 +1,202 @@
+package fmap
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// FormatOption is an option of ToFlashmap, changing the style of the output.
+type FormatOption func(*formatter)
+
+// WithIndent indents the sub-sections with `prefix`, instead of a tab.
+func WithIndent(prefix string) FormatOption {
+	return func(f *formatter) {
+		f.indent = prefix
+	}
+}
+
+// WithDecimal writes in decimal, instead of hexadecimal, the numbers whose
+// format is not known.
+func WithDecimal() FormatOption {
+	return func(f *formatter) {
+		f.base = 10
+	}
+}
+
+// WithHumanUnits writes the sizes whose format is not known with the largest
+// unit they are a multiple of, e.g. "4M" instead of "0x400000".
+func WithHumanUnits() FormatOption {
+	return func(f *formatter) {
+		f.humanUnits = true
+	}
+}
+
+// WithAlignedColumns aligns the starts and the sizes of sibling sections in
+// columns.
+func WithAlignedColumns() FormatOption {
+	return func(f *formatter) {
+		f.alignColumns = true
+	}
+}
+
+// WithSortByStart writes sibling sections in order of start, instead of the
+// order they are in the tree. The tree is not modified.
+func WithSortByStart() FormatOption {
+	return func(f *formatter) {
+		f.sortByStart = true
+	}
+}
+
+// formatter writes section trees in fmd format, in the style set by the
+// options.
+type formatter struct {
+	indent       string
+	base         int
+	humanUnits   bool
+	alignColumns bool
+	sortByStart  bool
+	stamp        *Stamp
+}
+
+// newFormatter returns a formatter with the default style, changed by the
+// options.
+func newFormatter(opts ...FormatOption) *formatter {
+	f := formatter{indent: "\t", base: 16}
+	for _, opt := range opts {
+		opt(&f)
+	}
+	return &f
+}
+
+// format writes the section `s`, indented at the given level, and the stamp
+// and the definitions before it if it is at level 0.
+func (f *formatter) format(s *Section, level int) string {
+	ret := ""
+	if level == 0 {
+		if f.stamp != nil {
+			ret = f.stamp.String()
+		}
+		ret += formatDefines(s.Defines, f)
+	}
+	return ret + f.section(s, level, 0, 0)
+}
+
+// columns returns the name of `s`, with its indentation, flags and attributes,
+// its start and its size, as written in a fmd file.
+func (f *formatter) columns(s *Section, level int) (string, string, string) {
+	head := strings.Repeat(f.indent, level) + s.Name
+	if len(s.Flags) > 0 {
+		head += "(" + s.Flags.String() + ")"
+	}
+	head += formatAttributes(s.Attributes)
+	start := ""
+	if s.Start != nil {
+		start = f.start(s)
+	}
+	return head, start, f.size(s)
+}
+
+// section writes the section `s`, indented at the given level, and its
+// sub-sections. The name and the start are padded to the given widths.
+func (f *formatter) section(s *Section, level, headWidth, startWidth int) string {
+	head, start, size := f.columns(s, level)
+	ret := pad(head, headWidth) + pad(start, startWidth)
+	// if filling, the size is implied by the parent and the siblings
+	if s.Fill {
+		ret = strings.TrimRight(ret, " ")
+	} else {
+		ret += " " + size
+	}
+	if len(s.Sections) == 0 {
+		return ret + "\n"
+	}
+	ret += " {\n"
+	sections := s.Sections
+	if f.sortByStart {
+		starts := childStarts(s)
+		order := make([]int, len(sections))
+		for idx := range order {
+			order[idx] = idx
+		}
+		sort.SliceStable(order, func(i, j int) bool {
+			return starts[order[i]] < starts[order[j]]
+		})
+		sections = make([]*Section, len(order))
+		for i, idx := range order {
+			sections[i] = s.Sections[idx]
+		}
+	}
+	headWidth, startWidth = 0, 0
+	if f.alignColumns {
+		for _, sec := range sections {
+			head, start, _ := f.columns(sec, level+1)
+			if len(head) > headWidth {
+				headWidth = len(head)
+			}
+			if len(start) > startWidth {
+				startWidth = len(start)
+			}
+		}
+	}
+	for _, sec := range sections {
+		ret += f.section(sec, level+1, headWidth, startWidth)
+	}
+	return ret + strings.Repeat(f.indent, level) + "}\n"
+}
+
+// pad pads `s` with spaces to the given width.
+func pad(s string, width int) string {
+	if len(s) >= width {
+		return s
+	}
+	return s + strings.Repeat(" ", width-len(s))
+}
+
+// plainNumber returns true if the expression is a single number without unit
+// whose base is not known, which is written like any other number.
+func plainNumber(e *Expr) bool {
+	fa, ok := e.number()
+	return ok && fa.Number.Base == 0 && fa.Unit == ""
+}
+
+// start returns the start of the section, with the "@" prefix, as written in
+// a fmd file. The start expression is used if it still evaluates to the
+// start, and otherwise the format of the start in the source, if remembered.
+func (f *formatter) start(s *Section) string {
+	if s.StartExpr != nil && !plainNumber(s.StartExpr) {
+		if v, err := s.StartExpr.Value(); err == nil && v == *s.Start {
+			return "@" + s.StartExpr.format(f)
+		}
+	}
+	if str, ok := s.startFormat.format(*s.Start); ok {
+		return "@" + str
+	}
+	return "@" + formatNumber(*s.Start, f.base, "")
+}
+
+// size returns the size of the section as written in a fmd file. The size
+// expression is used if it still evaluates to the size, and otherwise the
+// unit of the section, or the format of the size in the source, if
+// remembered.
+func (f *formatter) size(s *Section) string {
+	if s.SizeExpr != nil && !plainNumber(s.SizeExpr) {
+		if v, err := s.SizeExpr.Value(); err == nil && v == size(s) {
+			return s.SizeExpr.format(f)
+		}
+	}
+	if str, ok := s.sizeFormat.format(size(s)); ok {
+		return str
+	}
+	if s.Unit != "" {
+		return fmt.Sprintf("%d%s", s.Size, s.Unit)
+	}
+	if f.humanUnits {
+		for _, unit := range []string{"M", "k"} {
+			if n := unitSize(unit); s.Size != 0 && s.Size%n == 0 {
+				return formatNumber(s.Size/n, 10, unit)
+			}
+		}
+	}
+	return formatNumber(s.Size, f.base, "")
+}
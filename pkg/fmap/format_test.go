@@ -0,0 +1,63 @@
+package fmap
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+const formatLayout = `FLASH 0x400000 {
+	RW_SECTION(CBFS)@0x200000 0x200000
+	RO@0x0 0x100000 {
+		FMAP@0x0 0x800
+		GBB@0x800 4k
+		COREBOOT
+	}
+}`
+
+func TestToFlashmapOptions(t *testing.T) {
+	f, err := Parse(strings.NewReader(formatLayout))
+	require.NoError(t, err)
+	assert.Equal(t, formatLayout+"\n", f.ToFlashmap())
+
+	assert.Equal(t, `FLASH 4194304 {
+  RW_SECTION(CBFS)@2097152 2097152
+  RO@0 1048576 {
+    FMAP@0 2048
+    GBB@2048 4k
+    COREBOOT
+  }
+}
+`, f.ToFlashmap(WithIndent("  "), WithDecimal()))
+
+	assert.Equal(t, `FLASH 4M {
+	RO@0x0 1M {
+		FMAP@0x0 2k
+		GBB@0x800 4k
+		COREBOOT
+	}
+	RW_SECTION(CBFS)@0x200000 2M
+}
+`, f.ToFlashmap(WithHumanUnits(), WithSortByStart()))
+
+	assert.Equal(t, `FLASH 0x400000 {
+	RW_SECTION(CBFS)@0x200000 0x200000
+	RO              @0x0      0x100000 {
+		FMAP    @0x0   0x800
+		GBB     @0x800 4k
+		COREBOOT
+	}
+}
+`, f.ToFlashmap(WithAlignedColumns()))
+
+	// the tree is not modified
+	assert.Equal(t, "RW_SECTION", f.Sections[0].Name)
+}
+
+func TestToFlashmapOptionsExpressions(t *testing.T) {
+	f, err := Parse(strings.NewReader("define SIZE 0x1000\n\nFLASH $SIZE * 2 {\n\tA@0x10 0x800 + 0x800\n}"))
+	require.NoError(t, err)
+	assert.Equal(t, "define SIZE 4096\n\nFLASH $SIZE * 2 {\n\tA@16 2048 + 2048\n}\n", f.ToFlashmap(WithDecimal()))
+}
@@ -0,0 +1,260 @@
+package fmap
+
+import (
+	"fmt"
+	"strings"
+)
+
+// Gap is a range of a section that none of its sub-sections cover, or a free
+// region section, see IsUnused, as returned by Gaps.
+type Gap struct {
+	// Parent is the section the range is in.
+	Parent *Section
+	// Offset is the start of the range relative to Parent, and Absolute its
+	// start relative to the section Gaps was called on.
+	Offset   int64
+	Absolute int64
+	Size     int64
+	// Unused is the free region section covering the range, or nil if the
+	// range is not allocated at all.
+	Unused *Section
+}
+
+// String returns a description of the gap.
+func (g Gap) String() string {
+	ret := fmt.Sprintf("%s: 0x%x-0x%x (0x%x bytes at 0x%x)", g.Parent.Path(), g.Offset, g.Offset+g.Size, g.Size, g.Absolute)
+	if g.Unused != nil {
+		ret += ", in " + g.Unused.Name
+	}
+	return ret
+}
+
+// gaps appends the gaps of `s`, at offset `abs`, and of its sub-sections,
+// recursively, to `ret`.
+func gaps(s *Section, abs int64, ret *[]Gap) {
+	if len(s.Sections) == 0 {
+		return
+	}
+	secs, starts := sortedChildren(s)
+	cursor := int64(0)
+	for idx, sec := range secs {
+		if starts[idx] > cursor {
+			*ret = append(*ret, Gap{Parent: s, Offset: cursor, Absolute: abs + cursor, Size: starts[idx] - cursor})
+		}
+		if sec.IsUnused() && size(sec) > 0 {
+			*ret = append(*ret, Gap{Parent: s, Offset: starts[idx], Absolute: abs + starts[idx], Size: size(sec), Unused: sec})
+		}
+		if end := starts[idx] + size(sec); end > cursor {
+			cursor = end
+		}
+	}
+	if cursor < size(s) {
+		*ret = append(*ret, Gap{Parent: s, Offset: cursor, Absolute: abs + cursor, Size: size(s) - cursor})
+	}
+	starts = childStarts(s)
+	for idx, sec := range s.Sections {
+		gaps(sec, abs+starts[idx], ret)
+	}
+}
+
+// Gaps returns the free space of the tree rooted at `s`: the ranges of the
+// sections with sub-sections that none of them cover, between them or after
+// the last one, and the free region sections, see IsUnused. The gaps are
+// listed section by section in pre-order, and by offset within a section.
+// Leaf sections have no gaps, as they are allocated as a whole.
+func (s *Section) Gaps() []Gap {
+	var ret []Gap
+	gaps(s, 0, &ret)
+	return ret
+}
+
+// FreeSpace returns the total size of the gaps of the tree rooted at `s`, see
+// Gaps.
+func (s *Section) FreeSpace() int64 {
+	var total int64
+	for _, g := range s.Gaps() {
+		total += g.Size
+	}
+	return total
+}
+
+// LargestGap returns the largest gap of the tree rooted at `s`, see Gaps, and
+// false if there is none. Among gaps of the same size, the first one is
+// returned.
+func (s *Section) LargestGap() (Gap, bool) {
+	var (
+		ret   Gap
+		found bool
+	)
+	for _, g := range s.Gaps() {
+		if !found || g.Size > ret.Size {
+			ret, found = g, true
+		}
+	}
+	return ret, found
+}
+
+// SectionStats are the utilization statistics of a section, see Stats.
+type SectionStats struct {
+	Path  string `json:"path"`
+	Depth int    `json:"depth"`
+	// Offset is relative to the section Stats was called on.
+	Offset int64 `json:"offset"`
+	Size   int64 `json:"size"`
+	// Free is the size of the gaps of the section, see Gaps, or its size
+	// if it is a free region, see IsUnused, and Used the rest.
+	Used int64 `json:"used"`
+	Free int64 `json:"free"`
+	// PercentOfParent is the size of the section relative to the size of
+	// its parent, or 100 for the root.
+	PercentOfParent float64 `json:"percent_of_parent"`
+}
+
+// PercentUsed returns the used bytes of the section, in percent of its size.
+func (st SectionStats) PercentUsed() float64 {
+	if st.Size <= 0 {
+		return 0
+	}
+	return float64(st.Used) * 100 / float64(st.Size)
+}
+
+// Stats returns the utilization statistics of `s`, which are the totals of
+// the tree, and of its sub-sections, in pre-order.
+func (s *Section) Stats() []SectionStats {
+	var ret []SectionStats
+	for _, fs := range flatten(s) {
+		sec := fs.Section
+		st := SectionStats{
+			Path:            fs.Path,
+			Depth:           strings.Count(fs.Path, "/"),
+			Offset:          fs.Offset,
+			Size:            size(sec),
+			PercentOfParent: 100,
+		}
+		if sec.IsUnused() {
+			st.Free = size(sec)
+		} else {
+			st.Free = sec.FreeSpace()
+		}
+		if st.Used = st.Size - st.Free; st.Used < 0 {
+			st.Used = 0
+		}
+		if sec != s && sec.parent != nil && size(sec.parent) > 0 {
+			st.PercentOfParent = float64(size(sec)) * 100 / float64(size(sec.parent))
+		}
+		ret = append(ret, st)
+	}
+	return ret
+}
+
+// GapNamer returns the name of the placeholder section of the gap `g`, the
+// `idx`-th one materialized by MaterializeGaps.
+type GapNamer func(g Gap, idx int) string
+
+// defaultGapName names the placeholders UNUSED_0, UNUSED_1, and so on.
+func defaultGapName(g Gap, idx int) string {
+	return fmt.Sprintf("UNUSED_%d", idx)
+}
+
+// MaterializeGaps adds a placeholder section for every range of the tree
+// rooted at `s` that no section covers, see Gaps, so that downstream flashing
+// and auditing tools see a fully covered flash. The placeholders are named by
+// `name`, or UNUSED_0, UNUSED_1, and so on if nil, and the names must be
+// recognized as free regions, see IsUnused, so that StripUnused can remove
+// them. It returns the placeholders. Nothing is changed if a name is invalid
+// or already used, or if a gap is in a protected section, see
+// ProtectReadOnly.
+func (s *Section) MaterializeGaps(name GapNamer) ([]*Section, error) {
+	if name == nil {
+		name = defaultGapName
+	}
+	const op = "MaterializeGaps()"
+	var (
+		holes []*Section
+		gaps  []Gap
+		names = make(map[string]bool)
+	)
+	for _, g := range s.Gaps() {
+		if g.Unused != nil {
+			continue
+		}
+		hole := &Section{Name: name(g, len(holes)), Size: g.Size, parent: g.Parent}
+		if !hole.IsUnused() {
+			return nil, sectionErrorf(g.Parent, "placeholder name %s is not a free region name, like UNUSED_0", hole.Name)
+		}
+		if names[hole.Name] {
+			return nil, sectionErrorf(g.Parent, "placeholder name %s is used twice", hole.Name)
+		}
+		if err := checkNewName(g.Parent, nil, hole.Name); err != nil {
+			return nil, err
+		}
+		if err := checkWritable(g.Parent, op); err != nil {
+			return nil, err
+		}
+		names[hole.Name] = true
+		holes, gaps = append(holes, hole), append(gaps, g)
+	}
+	if len(holes) == 0 {
+		return nil, nil
+	}
+	t := s.record(op)
+	for idx, hole := range holes {
+		place(gaps[idx].Parent, hole, gaps[idx].Offset, t)
+	}
+	return holes, nil
+}
+
+// stripUnused removes the free region sub-sections of `s`, recursively, and
+// appends them to `removed`.
+func stripUnused(s *Section, step func() Transform, removed *[]*Section) {
+	starts := childStarts(s)
+	var kept []*Section
+	stripped := false
+	for idx, sec := range s.Sections {
+		if sec.IsUnused() {
+			stripped = true
+			sec.parent = nil
+			*removed = append(*removed, sec)
+			continue
+		}
+		// the sections after a removed one keep their starts
+		if stripped && sec.Start == nil {
+			st := starts[idx]
+			sec.Start = &st
+		}
+		kept = append(kept, sec)
+	}
+	if stripped {
+		s.Sections = kept
+		s.touch(step())
+	}
+	for _, sec := range s.Sections {
+		stripUnused(sec, step, removed)
+	}
+}
+
+// StripUnused removes all the free region sections, see IsUnused, of the tree
+// rooted at `s`, like the placeholders added by MaterializeGaps, without
+// moving the other sections. It returns the removed sections. Nothing is
+// changed if a free region is in a protected section, see ProtectReadOnly.
+func (s *Section) StripUnused() ([]*Section, error) {
+	const op = "StripUnused()"
+	for _, fs := range flatten(s) {
+		if fs.Section != s && fs.Section.IsUnused() {
+			if err := checkWritable(fs.Section, op); err != nil {
+				return nil, err
+			}
+		}
+	}
+	var (
+		t       Transform
+		removed []*Section
+	)
+	stripUnused(s, func() Transform {
+		if t.Step == 0 {
+			t = s.record(op)
+		}
+		return t
+	}, &removed)
+	return removed, nil
+}
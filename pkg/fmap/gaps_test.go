@@ -0,0 +1,156 @@
+package fmap
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestGaps(t *testing.T) {
+	f, err := Parse(strings.NewReader(`FLASH 0x20000 {
+	RO 0x8000 {
+		FMAP 0x1000
+		RO_UNUSED 0x3000
+		GBB@0x5000 0x1000
+	}
+	RW@0x10000 0x8000 {
+		RW_A 0x4000
+	}
+}`))
+	require.NoError(t, err)
+
+	var got []string
+	for _, g := range f.Gaps() {
+		got = append(got, g.String())
+	}
+	assert.Equal(t, []string{
+		"FLASH: 0x8000-0x10000 (0x8000 bytes at 0x8000)",
+		"FLASH: 0x18000-0x20000 (0x8000 bytes at 0x18000)",
+		"FLASH/RO: 0x1000-0x4000 (0x3000 bytes at 0x1000), in RO_UNUSED",
+		"FLASH/RO: 0x4000-0x5000 (0x1000 bytes at 0x4000)",
+		"FLASH/RO: 0x6000-0x8000 (0x2000 bytes at 0x6000)",
+		"FLASH/RW: 0x4000-0x8000 (0x4000 bytes at 0x14000)",
+	}, got)
+	assert.Equal(t, int64(0x1a000), f.FreeSpace())
+
+	g, ok := f.LargestGap()
+	require.True(t, ok)
+	assert.Equal(t, int64(0x8000), g.Absolute)
+
+	// the gaps of a sub-tree are relative to it
+	rw := f.Find("RW", false)
+	assert.Equal(t, []Gap{{Parent: rw, Offset: 0x4000, Absolute: 0x4000, Size: 0x4000}}, rw.Gaps())
+
+	leaf := &Section{Name: "LEAF", Size: 0x1000}
+	assert.Empty(t, leaf.Gaps())
+	_, ok = leaf.LargestGap()
+	assert.False(t, ok)
+}
+
+func TestStats(t *testing.T) {
+	f, err := Parse(strings.NewReader(`FLASH 0x20000 {
+	WP_RO 0x10000 {
+		FMAP 0x1000
+		RO_UNUSED 0x3000
+	}
+	RW 0x8000
+}`))
+	require.NoError(t, err)
+
+	stats := f.Stats()
+	require.Equal(t, 5, len(stats))
+	assert.Equal(t, SectionStats{Path: "FLASH", Size: 0x20000, Used: 0x9000, Free: 0x17000, PercentOfParent: 100}, stats[0])
+	assert.Equal(t, SectionStats{Path: "FLASH/WP_RO", Depth: 1, Size: 0x10000, Used: 0x1000, Free: 0xf000, PercentOfParent: 50}, stats[1])
+	assert.Equal(t, SectionStats{Path: "FLASH/WP_RO/RO_UNUSED", Depth: 2, Offset: 0x1000, Size: 0x3000, Free: 0x3000, PercentOfParent: 18.75}, stats[3])
+	assert.Equal(t, SectionStats{Path: "FLASH/RW", Depth: 1, Offset: 0x10000, Size: 0x8000, Used: 0x8000, PercentOfParent: 25}, stats[4])
+	assert.Equal(t, 6.25, stats[1].PercentUsed())
+}
+
+func TestMaterializeGaps(t *testing.T) {
+	f, err := Parse(strings.NewReader(`FLASH 0x20000 {
+	RO 0x8000 {
+		FMAP 0x1000
+		RO_UNUSED 0x3000
+		GBB 0x1000
+		RO_TAIL 0x1000
+	}
+	RW@0x10000 0x8000 {
+		RW_A 0x4000
+	}
+}`))
+	require.NoError(t, err)
+	offsets := func() map[string]int64 {
+		ret := make(map[string]int64)
+		for _, fs := range flatten(f) {
+			ret[fs.Path] = fs.Offset
+		}
+		return ret
+	}
+	before := offsets()
+
+	holes, err := f.MaterializeGaps(nil)
+	require.NoError(t, err)
+	var names []string
+	for _, h := range holes {
+		names = append(names, h.Path())
+	}
+	assert.Equal(t, []string{"FLASH/UNUSED_0", "FLASH/UNUSED_1", "FLASH/RO/UNUSED_2", "FLASH/RW/UNUSED_3"}, names)
+	for _, g := range f.Gaps() {
+		assert.NotNil(t, g.Unused, g.String())
+	}
+	assert.Equal(t, int64(0x19000), f.FreeSpace())
+	for path, off := range before {
+		assert.Equal(t, off, offsets()[path], path)
+	}
+	assert.Equal(t, int64(0x18000), offsets()["FLASH/UNUSED_1"])
+	assert.Equal(t, int64(0x6000), offsets()["FLASH/RO/UNUSED_2"])
+
+	// nothing left to materialize
+	holes, err = f.MaterializeGaps(nil)
+	require.NoError(t, err)
+	assert.Empty(t, holes)
+
+	removed, err := f.StripUnused()
+	require.NoError(t, err)
+	assert.Equal(t, 5, len(removed))
+	assert.Equal(t, before["FLASH/RO/GBB"], offsets()["FLASH/RO/GBB"])
+	assert.Equal(t, before["FLASH/RO/RO_TAIL"], offsets()["FLASH/RO/RO_TAIL"])
+	assert.Nil(t, f.Find("RO_UNUSED", true))
+	assert.Equal(t, 5, len(f.Gaps()))
+}
+
+func TestMaterializeGapsNames(t *testing.T) {
+	f, err := Parse(strings.NewReader(`FLASH 0x4000 {
+	A 0x1000
+	B@0x2000 0x1000
+}`))
+	require.NoError(t, err)
+
+	_, err = f.MaterializeGaps(func(g Gap, idx int) string { return "HOLE" })
+	assert.Error(t, err)
+	_, err = f.MaterializeGaps(func(g Gap, idx int) string { return "SPARE_UNUSED" })
+	assert.Error(t, err)
+	assert.Equal(t, 2, len(f.Sections))
+
+	holes, err := f.MaterializeGaps(func(g Gap, idx int) string {
+		return fmt.Sprintf("GAP_%X_UNUSED", g.Absolute)
+	})
+	require.NoError(t, err)
+	require.Equal(t, 2, len(holes))
+	assert.Equal(t, "GAP_1000_UNUSED", holes[0].Name)
+	assert.Equal(t, "GAP_3000_UNUSED", holes[1].Name)
+
+	ro, err := Parse(strings.NewReader(`FLASH 0x4000 {
+	WP_RO 0x2000 {
+		RO_UNUSED 0x1000
+	}
+}`))
+	require.NoError(t, err)
+	ro.ProtectReadOnly(true)
+	_, err = ro.StripUnused()
+	assert.Error(t, err)
+	assert.NotNil(t, ro.Find("RO_UNUSED", true))
+}
@@ -0,0 +1,116 @@
+package fmap
+
+import (
+	"crypto/sha1"
+	"crypto/sha256"
+	"crypto/sha512"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"hash"
+	"io"
+	"sort"
+)
+
+// HashReport is the list of the hashes of every section of an image, as
+// written by `fmap hash`. Reports of many devices can be compared against a
+// golden one with CompareFleet.
+type HashReport struct {
+	// Device identifies the device the image was read from. It is optional.
+	Device    string        `json:"device"`
+	Algorithm string        `json:"algorithm"`
+	Sections  []SectionHash `json:"sections"`
+}
+
+// SectionHash is the hash of the bytes of a section of an image.
+type SectionHash struct {
+	Path   string `json:"path"`
+	Offset int64  `json:"offset"`
+	Size   int64  `json:"size"`
+	Hash   string `json:"hash"`
+}
+
+// Names of the hash algorithms in hash reports, see HashWith.
+const (
+	HashAlgorithmSHA1   = "sha1"
+	HashAlgorithmSHA256 = "sha256"
+	HashAlgorithmSHA384 = "sha384"
+	HashAlgorithmSHA512 = "sha512"
+)
+
+// hashAlgorithms are the hash algorithms supported by HashWith, by name.
+var hashAlgorithms = map[string]func() hash.Hash{
+	HashAlgorithmSHA1:   sha1.New,
+	HashAlgorithmSHA256: sha256.New,
+	HashAlgorithmSHA384: sha512.New384,
+	HashAlgorithmSHA512: sha512.New,
+}
+
+// HashAlgorithms returns the names of the hash algorithms supported by
+// HashWith, sorted.
+func HashAlgorithms() []string {
+	var names []string
+	for name := range hashAlgorithms {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// Hash computes the SHA-256 hash of every section of the tree rooted at `s`,
+// including `s` itself, in pre-order, reading them from a flash image. Offsets
+// in the image are relative to the start of `s`.
+func (s *Section) Hash(image io.ReaderAt) (*HashReport, error) {
+	return s.HashWith(image, HashAlgorithmSHA256)
+}
+
+// HashWith is like Hash, using the hash algorithm called `algorithm`, one of
+// HashAlgorithms.
+func (s *Section) HashWith(image io.ReaderAt, algorithm string) (*HashReport, error) {
+	newHash, ok := hashAlgorithms[algorithm]
+	if !ok {
+		return nil, fmt.Errorf("unknown hash algorithm %q", algorithm)
+	}
+	report := HashReport{Algorithm: algorithm}
+	for _, fs := range flatten(s) {
+		length := size(fs.Section)
+		h := newHash()
+		n, err := io.Copy(h, io.NewSectionReader(image, int64(fs.Offset), int64(length)))
+		if err != nil {
+			return nil, err
+		}
+		if n < int64(length) {
+			return nil, sectionErrorf(fs.Section, "range 0x%x-0x%x extends past the end of the image", fs.Offset, fs.Offset+length)
+		}
+		report.Sections = append(report.Sections, SectionHash{
+			Path:   fs.Path,
+			Offset: fs.Offset,
+			Size:   length,
+			Hash:   hex.EncodeToString(h.Sum(nil)),
+		})
+	}
+	return &report, nil
+}
+
+// VerifyHashes hashes the sections of a flash image with the algorithm of
+// `manifest`, a hash report of a known image, see HashWith, and returns the
+// sections whose hash differs from the one in the manifest, or that are
+// only in one of them, as CompareFleet does with the device of the manifest.
+// Sections are matched by path.
+func (s *Section) VerifyHashes(image io.ReaderAt, manifest *HashReport) ([]Deviation, error) {
+	report, err := s.HashWith(image, manifest.Algorithm)
+	if err != nil {
+		return nil, err
+	}
+	report.Device = manifest.Device
+	return CompareFleet(manifest, []*HashReport{report})
+}
+
+// ReadHashReport decodes a JSON hash report.
+func ReadHashReport(r io.Reader) (*HashReport, error) {
+	var report HashReport
+	if err := json.NewDecoder(r).Decode(&report); err != nil {
+		return nil, err
+	}
+	return &report, nil
+}
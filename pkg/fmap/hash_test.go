@@ -0,0 +1,93 @@
+package fmap
+
+import (
+	"bytes"
+	"crypto/sha1"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func sha256Hex(data []byte) string {
+	sum := sha256.Sum256(data)
+	return hex.EncodeToString(sum[:])
+}
+
+func TestHash(t *testing.T) {
+	f, err := Parse(strings.NewReader(imageLayout))
+	require.NoError(t, err)
+	image := testImage()
+
+	report, err := f.Hash(bytes.NewReader(image))
+	require.NoError(t, err)
+	assert.Equal(t, HashAlgorithmSHA256, report.Algorithm)
+	require.Equal(t, 5, len(report.Sections))
+	assert.Equal(t, SectionHash{Path: "FLASH", Offset: 0, Size: 0x4000, Hash: sha256Hex(image[:0x4000])}, report.Sections[0])
+	assert.Equal(t, SectionHash{Path: "FLASH/RO/COREBOOT", Offset: 0x1000, Size: 0x1000, Hash: sha256Hex(image[0x1000:0x2000])}, report.Sections[3])
+	assert.Equal(t, "FLASH/RW_VPD", report.Sections[4].Path)
+
+	_, err = f.Hash(bytes.NewReader(image[:0x3000]))
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "range 0x0-0x4000 extends past the end of the image")
+}
+
+func TestHashWith(t *testing.T) {
+	f, err := Parse(strings.NewReader(imageLayout))
+	require.NoError(t, err)
+	image := testImage()
+
+	report, err := f.HashWith(bytes.NewReader(image), HashAlgorithmSHA1)
+	require.NoError(t, err)
+	assert.Equal(t, HashAlgorithmSHA1, report.Algorithm)
+	sum := sha1.Sum(image[0x1000:0x2000])
+	assert.Equal(t, hex.EncodeToString(sum[:]), report.Sections[3].Hash)
+	assert.Equal(t, []string{"sha1", "sha256", "sha384", "sha512"}, HashAlgorithms())
+
+	_, err = f.HashWith(bytes.NewReader(image), "crc32")
+	assert.EqualError(t, err, `unknown hash algorithm "crc32"`)
+}
+
+func TestVerifyHashes(t *testing.T) {
+	f, err := Parse(strings.NewReader(imageLayout))
+	require.NoError(t, err)
+	image := testImage()
+	manifest, err := f.HashWith(bytes.NewReader(image), HashAlgorithmSHA512)
+	require.NoError(t, err)
+	manifest.Device = "release-1"
+
+	deviations, err := f.VerifyHashes(bytes.NewReader(image), manifest)
+	require.NoError(t, err)
+	assert.Empty(t, deviations)
+
+	image[0x1000] ^= 0xff
+	deviations, err = f.VerifyHashes(bytes.NewReader(image), manifest)
+	require.NoError(t, err)
+	var paths []string
+	for _, d := range deviations {
+		assert.Equal(t, "release-1", d.Device)
+		paths = append(paths, d.Path)
+	}
+	assert.Equal(t, []string{"FLASH", "FLASH/RO", "FLASH/RO/COREBOOT"}, paths)
+}
+
+func TestReadHashReport(t *testing.T) {
+	f, err := Parse(strings.NewReader(imageLayout))
+	require.NoError(t, err)
+	report, err := f.Hash(bytes.NewReader(testImage()))
+	require.NoError(t, err)
+	report.Device = "dut1"
+
+	data, err := json.Marshal(report)
+	require.NoError(t, err)
+	report2, err := ReadHashReport(bytes.NewReader(data))
+	require.NoError(t, err)
+	assert.Equal(t, report, report2)
+
+	_, err = ReadHashReport(strings.NewReader("{"))
+	require.Error(t, err)
+}
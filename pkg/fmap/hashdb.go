@@ -0,0 +1,118 @@
+package fmap
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"io"
+	"path"
+	"sort"
+	"strings"
+	"time"
+)
+
+// HashDBEntry is a record of a hash database: the hash report of an image at
+// a point in time. A hash database is a file of JSON encoded entries, one per
+// line, so that new entries can be appended without rewriting it.
+type HashDBEntry struct {
+	Time  time.Time `json:"time"`
+	Image string    `json:"image"`
+	HashReport
+}
+
+// AppendHashDB writes an entry at the end of a hash database.
+func AppendHashDB(w io.Writer, entry *HashDBEntry) error {
+	data, err := json.Marshal(entry)
+	if err != nil {
+		return err
+	}
+	_, err = w.Write(append(data, '\n'))
+	return err
+}
+
+// ReadHashDB reads all the entries of a hash database. Empty lines are
+// ignored.
+func ReadHashDB(r io.Reader) ([]*HashDBEntry, error) {
+	var entries []*HashDBEntry
+	scanner := bufio.NewScanner(r)
+	// reports of large layouts don't fit in the default buffer
+	scanner.Buffer(nil, 64*1024*1024)
+	for line := 1; scanner.Scan(); line++ {
+		if strings.TrimSpace(scanner.Text()) == "" {
+			continue
+		}
+		var entry HashDBEntry
+		if err := json.Unmarshal(scanner.Bytes(), &entry); err != nil {
+			return nil, fmt.Errorf("line %d: %v", line, err)
+		}
+		entries = append(entries, &entry)
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+	return entries, nil
+}
+
+// HashRecord is the hash of a section of a device at a point in time, as
+// returned by QueryHashDB.
+type HashRecord struct {
+	Time   time.Time `json:"time"`
+	Device string    `json:"device"`
+	Image  string    `json:"image"`
+	Path   string    `json:"path"`
+	Hash   string    `json:"hash"`
+	// Changed is true if the hash differs from the previous record of the
+	// same device and section, or if there is no previous record.
+	Changed bool `json:"changed"`
+}
+
+// String returns a human readable description of the record.
+func (r HashRecord) String() string {
+	changed := ""
+	if r.Changed {
+		changed = " (changed)"
+	}
+	return fmt.Sprintf("%s %s %s %s %s%s", r.Time.Format(time.RFC3339), r.Device, r.Image, r.Path, r.Hash, changed)
+}
+
+// QueryHashDB returns the history of the hashes of the sections in a hash
+// database, sorted by time. If `device` is not empty, only the entries of that
+// device are considered. If `section` is not empty, only the sections whose
+// path, or whose name, matches the path.Match pattern `section` are returned.
+func QueryHashDB(entries []*HashDBEntry, device, section string) ([]HashRecord, error) {
+	if _, err := path.Match(section, ""); err != nil {
+		return nil, err
+	}
+	sorted := append([]*HashDBEntry(nil), entries...)
+	sort.SliceStable(sorted, func(i, j int) bool {
+		return sorted[i].Time.Before(sorted[j].Time)
+	})
+	var ret []HashRecord
+	last := make(map[string]string)
+	for _, entry := range sorted {
+		if device != "" && entry.Device != device {
+			continue
+		}
+		for _, sh := range entry.Sections {
+			if section != "" {
+				byPath, _ := path.Match(section, sh.Path)
+				byName, _ := path.Match(section, path.Base(sh.Path))
+				if !byPath && !byName {
+					continue
+				}
+			}
+			key := entry.Device + "\x00" + sh.Path
+			prev, ok := last[key]
+			last[key] = sh.Hash
+			ret = append(ret, HashRecord{
+				Time:    entry.Time,
+				Device:  entry.Device,
+				Image:   entry.Image,
+				Path:    sh.Path,
+				Hash:    sh.Hash,
+				Changed: !ok || prev != sh.Hash,
+			})
+		}
+	}
+	return ret, nil
+}
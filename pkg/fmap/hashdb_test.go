@@ -0,0 +1,65 @@
+package fmap
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestHashDB(t *testing.T) {
+	f, err := Parse(strings.NewReader(imageLayout))
+	require.NoError(t, err)
+	image := testImage()
+	updated := append([]byte(nil), image...)
+	updated[0x3000] = 0xff
+
+	t0 := time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC)
+	var db bytes.Buffer
+	for idx, img := range [][]byte{image, image, updated} {
+		report, err := f.Hash(bytes.NewReader(img))
+		require.NoError(t, err)
+		report.Device = "dut1"
+		entry := HashDBEntry{Time: t0.Add(time.Duration(idx) * time.Hour), Image: "image.bin", HashReport: *report}
+		require.NoError(t, AppendHashDB(&db, &entry))
+	}
+	assert.Equal(t, 3, strings.Count(db.String(), "\n"))
+
+	entries, err := ReadHashDB(&db)
+	require.NoError(t, err)
+	require.Equal(t, 3, len(entries))
+	assert.Equal(t, "dut1", entries[0].Device)
+	assert.Equal(t, t0, entries[0].Time)
+	assert.Equal(t, 5, len(entries[2].Sections))
+
+	records, err := QueryHashDB(entries, "", "RW_VPD")
+	require.NoError(t, err)
+	require.Equal(t, 3, len(records))
+	assert.Equal(t, "FLASH/RW_VPD", records[0].Path)
+	assert.True(t, records[0].Changed)
+	assert.False(t, records[1].Changed)
+	assert.True(t, records[2].Changed)
+	assert.NotEqual(t, records[0].Hash, records[2].Hash)
+
+	records, err = QueryHashDB(entries, "dut1", "FLASH/RO/*")
+	require.NoError(t, err)
+	assert.Equal(t, 6, len(records))
+	records, err = QueryHashDB(entries, "dut2", "")
+	require.NoError(t, err)
+	assert.Empty(t, records)
+	_, err = QueryHashDB(entries, "", "[")
+	require.Error(t, err)
+}
+
+func TestReadHashDBErrors(t *testing.T) {
+	entries, err := ReadHashDB(strings.NewReader("\n{\"device\":\"dut1\"}\n\n"))
+	require.NoError(t, err)
+	assert.Equal(t, 1, len(entries))
+
+	_, err = ReadHashDB(strings.NewReader("{\"device\":\"dut1\"}\n{\n"))
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "line 2")
+}
@@ -0,0 +1,214 @@
+package fmap
+
+import (
+	"bufio"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"regexp"
+	"sort"
+	"strconv"
+)
+
+const (
+	// IFDSignature is the signature of an Intel Flash Descriptor, at
+	// ifdSignatureOffset in the flash image.
+	IFDSignature       = 0x0ff0a55a
+	ifdSignatureOffset = 0x10
+	// ifdRegions is the number of regions read from a descriptor, the ones
+	// common to all the descriptor versions.
+	ifdRegions = 5
+)
+
+// ErrNoIFD is returned when a flash image, or a listing of ifdtool, has no
+// Intel Flash Descriptor.
+var ErrNoIFD = errors.New("no Intel Flash Descriptor found")
+
+// ifdRegionNames are the names of the sections of the descriptor regions, by
+// region number, as used by ifdtool and cbfstool.
+var ifdRegionNames = []string{
+	"SI_DESC", "SI_BIOS", "SI_ME", "SI_GBE", "SI_PDR", "SI_DEVICEEXT", "SI_BIOS2", "SI_RESERVED7",
+	"SI_EC", "SI_DEVICEEXT2", "SI_IE", "SI_10GBE0", "SI_10GBE1", "SI_RESERVED13", "SI_RESERVED14", "SI_PTT",
+}
+
+// IFDRegion is a region of the flash described by an Intel Flash Descriptor.
+type IFDRegion struct {
+	// Index is the number of the region in the descriptor, 0 for the
+	// descriptor itself and 1 for the BIOS.
+	Index int
+	// Name is the name of the section of the region, e.g. SI_BIOS.
+	Name        string
+	Start, Size int64
+}
+
+// String returns a description of the region.
+func (r IFDRegion) String() string {
+	return fmt.Sprintf("%s@0x%x 0x%x", r.Name, r.Start, r.Size)
+}
+
+// ifdRegion returns the region `idx` with the given base and inclusive limit,
+// and false if the region is unused, which descriptors mark with a base
+// above the limit.
+func ifdRegion(idx int, base, limit int64) (IFDRegion, bool, error) {
+	if idx < 0 || idx >= len(ifdRegionNames) {
+		return IFDRegion{}, false, fmt.Errorf("invalid descriptor region %d", idx)
+	}
+	if base > limit {
+		return IFDRegion{}, false, nil
+	}
+	return IFDRegion{Index: idx, Name: ifdRegionNames[idx], Start: base, Size: limit - base + 1}, true, nil
+}
+
+// ReadIFD reads the Intel Flash Descriptor at the start of a flash image, and
+// returns its used regions among the descriptor, BIOS, ME, GbE and platform
+// data ones, ordered by region number. It returns ErrNoIFD if the image has
+// no descriptor.
+func ReadIFD(r io.ReaderAt) ([]IFDRegion, error) {
+	var hdr [8]byte
+	if _, err := r.ReadAt(hdr[:], ifdSignatureOffset); err == io.EOF || err == io.ErrUnexpectedEOF {
+		return nil, ErrNoIFD
+	} else if err != nil {
+		return nil, err
+	}
+	if binary.LittleEndian.Uint32(hdr[:4]) != IFDSignature {
+		return nil, ErrNoIFD
+	}
+	// FLMAP0 holds bits 11:4 of the base of the region section
+	frba := int64((binary.LittleEndian.Uint32(hdr[4:]) >> 16 & 0xff) << 4)
+	var flreg [ifdRegions * 4]byte
+	if _, err := r.ReadAt(flreg[:], frba); err != nil {
+		return nil, fmt.Errorf("cannot read the descriptor regions at 0x%x: %v", frba, err)
+	}
+	var ret []IFDRegion
+	for idx := 0; idx < ifdRegions; idx++ {
+		// FLREGn holds bits 26:12 of the base and of the limit
+		reg := binary.LittleEndian.Uint32(flreg[4*idx:])
+		base := int64(reg&0x7fff) << 12
+		limit := int64(reg>>16&0x7fff)<<12 | 0xfff
+		if region, ok, _ := ifdRegion(idx, base, limit); ok {
+			ret = append(ret, region)
+		}
+	}
+	return ret, nil
+}
+
+var (
+	ifdtoolFileRe   = regexp.MustCompile(`^File .* is (\d+) bytes`)
+	ifdtoolRegionRe = regexp.MustCompile(`^\s*Flash Region (\d+) \([^)]*\):\s*([0-9a-fA-F]+) - ([0-9a-fA-F]+)`)
+)
+
+// ParseIfdtoolDump parses the output of ifdtool -d, and returns the used
+// regions of the descriptor it lists, ordered as listed, and the size of the
+// image given by its first line, or 0 if it is missing. The other lines are
+// ignored. It returns ErrNoIFD if no region is listed.
+func ParseIfdtoolDump(r io.Reader) ([]IFDRegion, int64, error) {
+	var (
+		ret    []IFDRegion
+		size   int64
+		listed bool
+	)
+	scanner := bufio.NewScanner(r)
+	for lineno := 1; scanner.Scan(); lineno++ {
+		line := scanner.Text()
+		if m := ifdtoolFileRe.FindStringSubmatch(line); m != nil {
+			n, err := strconv.ParseInt(m[1], 10, 64)
+			if err != nil {
+				return nil, 0, fmt.Errorf("%d: invalid image size %q", lineno, m[1])
+			}
+			size = n
+			continue
+		}
+		m := ifdtoolRegionRe.FindStringSubmatch(line)
+		if m == nil {
+			continue
+		}
+		listed = true
+		idx, err := strconv.Atoi(m[1])
+		if err != nil {
+			return nil, 0, fmt.Errorf("%d: invalid region number %q", lineno, m[1])
+		}
+		base, err := strconv.ParseInt(m[2], 16, 64)
+		if err != nil {
+			return nil, 0, fmt.Errorf("%d: invalid region base %q", lineno, m[2])
+		}
+		limit, err := strconv.ParseInt(m[3], 16, 64)
+		if err != nil {
+			return nil, 0, fmt.Errorf("%d: invalid region limit %q", lineno, m[3])
+		}
+		region, ok, err := ifdRegion(idx, base, limit)
+		if err != nil {
+			return nil, 0, fmt.Errorf("%d: %v", lineno, err)
+		}
+		if ok {
+			ret = append(ret, region)
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, 0, err
+	}
+	if !listed {
+		return nil, 0, ErrNoIFD
+	}
+	return ret, size, nil
+}
+
+// FromIFD returns the layout of a flash of `flashSize` bytes described by the
+// regions of an Intel Flash Descriptor, see ReadIFD and ParseIfdtoolDump: a
+// root section called FLASH with a sub-section per region, ordered by start.
+// If `flashSize` is 0, the flash ends with the last region. If `bios` is not
+// nil, it is the layout of the BIOS region only, which must have the size of
+// the SI_BIOS region: its sub-sections are copied into SI_BIOS and its
+// constants into the root. If `bios` has a start, the memory-mapped address
+// of the BIOS region, the root starts at the address of the whole flash. An
+// error is returned if regions overlap, or do not fit in the flash.
+func FromIFD(regions []IFDRegion, flashSize int64, bios *Section) (*Section, error) {
+	regions = append([]IFDRegion(nil), regions...)
+	sort.SliceStable(regions, func(i, j int) bool { return regions[i].Start < regions[j].Start })
+	var end int64
+	for idx, r := range regions {
+		if idx > 0 && r.Start < end {
+			return nil, fmt.Errorf("region %s overlaps %s", r, regions[idx-1])
+		}
+		end = r.Start + r.Size
+	}
+	if flashSize == 0 {
+		flashSize = end
+	} else if end > flashSize {
+		return nil, fmt.Errorf("regions end at 0x%x, past the end of the 0x%x bytes flash", end, flashSize)
+	}
+
+	root := &Section{Name: "FLASH", Size: flashSize}
+	var biosRegion *Section
+	for _, r := range regions {
+		start := r.Start
+		sec := &Section{Name: r.Name, Start: &start, Size: r.Size}
+		if r.Index == 1 {
+			biosRegion = sec
+		}
+		root.Sections = append(root.Sections, sec)
+	}
+	if bios != nil {
+		if biosRegion == nil {
+			return nil, errors.New("no BIOS region in the descriptor")
+		}
+		if size(bios) != biosRegion.Size {
+			return nil, fmt.Errorf("the BIOS layout is 0x%x bytes, but the BIOS region is 0x%x bytes", size(bios), biosRegion.Size)
+		}
+		c := clone(bios, nil)
+		biosRegion.Sections = c.Sections
+		root.Defines = c.Defines
+		if bios.Start != nil && *bios.Start >= *biosRegion.Start {
+			base := *bios.Start - *biosRegion.Start
+			root.Start = &base
+		}
+		// the copied sections keep their provenance, in a journal of their own
+		j := &journal{}
+		if bios.journal != nil {
+			*j = *bios.journal
+		}
+		setJournal(root, j)
+	}
+	root.Link()
+	return root, nil
+}
@@ -0,0 +1,122 @@
+package fmap
+
+import (
+	"bytes"
+	"encoding/binary"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// ifdImage returns a 16 MiB image with a descriptor whose region section is
+// at 0x40, with the given FLREG values.
+func ifdImage(flreg ...uint32) []byte {
+	image := make([]byte, 0x1000000)
+	binary.LittleEndian.PutUint32(image[0x10:], IFDSignature)
+	binary.LittleEndian.PutUint32(image[0x14:], 0x04<<16)
+	for idx, reg := range flreg {
+		binary.LittleEndian.PutUint32(image[0x40+4*idx:], reg)
+	}
+	return image
+}
+
+func TestReadIFD(t *testing.T) {
+	// descriptor, BIOS in the upper 8 MiB, ME, and unused GbE and PDR
+	image := ifdImage(0x00000000, 0x0fff0800, 0x07ff0001, 0x00007fff, 0x00007fff)
+	regions, err := ReadIFD(bytes.NewReader(image))
+	require.NoError(t, err)
+	assert.Equal(t, []IFDRegion{
+		{Index: 0, Name: "SI_DESC", Start: 0, Size: 0x1000},
+		{Index: 1, Name: "SI_BIOS", Start: 0x800000, Size: 0x800000},
+		{Index: 2, Name: "SI_ME", Start: 0x1000, Size: 0x7ff000},
+	}, regions)
+
+	_, err = ReadIFD(bytes.NewReader(make([]byte, 0x1000)))
+	assert.Equal(t, ErrNoIFD, err)
+	_, err = ReadIFD(bytes.NewReader(nil))
+	assert.Equal(t, ErrNoIFD, err)
+}
+
+const ifdtoolDump = `File image.bin is 16777216 bytes
+ICH Revision: 100 series Sunrisepoint
+FLMAP0:    0x00040003
+  NR:      0
+  FRBA:    0x40
+Found Region Section
+FLREG0:    0x00000000
+  Flash Region 0 (Flash Descriptor): 00000000 - 00000fff 
+FLREG1:    0x0fff0800
+  Flash Region 1 (BIOS): 00800000 - 00ffffff 
+FLREG2:    0x07ff0001
+  Flash Region 2 (Intel ME): 00001000 - 007fffff 
+FLREG3:    0x00007fff
+  Flash Region 3 (GbE): 07fff000 - 00000fff (unused)
+FLREG4:    0x00007fff
+  Flash Region 4 (Platform Data): 07fff000 - 00000fff (unused)
+`
+
+func TestParseIfdtoolDump(t *testing.T) {
+	regions, size, err := ParseIfdtoolDump(strings.NewReader(ifdtoolDump))
+	require.NoError(t, err)
+	assert.Equal(t, int64(0x1000000), size)
+	imageRegions, err := ReadIFD(bytes.NewReader(ifdImage(0x00000000, 0x0fff0800, 0x07ff0001, 0x00007fff, 0x00007fff)))
+	require.NoError(t, err)
+	assert.Equal(t, imageRegions, regions)
+
+	_, _, err = ParseIfdtoolDump(strings.NewReader("File image.bin is 16 bytes\n"))
+	assert.Equal(t, ErrNoIFD, err)
+	_, _, err = ParseIfdtoolDump(strings.NewReader("  Flash Region 16 (Reserved): 00000000 - 00000fff\n"))
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "1: invalid descriptor region 16")
+}
+
+func TestFromIFD(t *testing.T) {
+	regions := []IFDRegion{
+		{Index: 0, Name: "SI_DESC", Start: 0, Size: 0x1000},
+		{Index: 1, Name: "SI_BIOS", Start: 0x800000, Size: 0x800000},
+		{Index: 2, Name: "SI_ME", Start: 0x1000, Size: 0x7ff000},
+	}
+	f, err := FromIFD(regions, 0x1000000, nil)
+	require.NoError(t, err)
+	assert.Equal(t, `FLASH 0x1000000 {
+	SI_DESC@0x0 0x1000
+	SI_ME@0x1000 0x7ff000
+	SI_BIOS@0x800000 0x800000
+}
+`, f.ToFlashmap())
+
+	bios, err := ParseString(`FLASH@0xff800000 8M {
+	WP_RO 4M {
+		FMAP 0x1000
+	}
+	RW_A 4M
+}`)
+	require.NoError(t, err)
+	f, err = FromIFD(regions, 0x1000000, bios)
+	require.NoError(t, err)
+	assert.Equal(t, `FLASH@0xff000000 0x1000000 {
+	SI_DESC@0x0 0x1000
+	SI_ME@0x1000 0x7ff000
+	SI_BIOS@0x800000 0x800000 {
+		WP_RO 4M {
+			FMAP 0x1000
+		}
+		RW_A 4M
+	}
+}
+`, f.ToFlashmap())
+	assert.Equal(t, "FLASH/SI_BIOS/WP_RO/FMAP", f.Find("FMAP", true).Path())
+	// the BIOS layout is copied
+	assert.Equal(t, bios, bios.Find("FMAP", true).Root())
+
+	_, err = FromIFD(regions, 0x1000000, bios.Find("WP_RO", true))
+	assert.EqualError(t, err, "the BIOS layout is 0x400000 bytes, but the BIOS region is 0x800000 bytes")
+	_, err = FromIFD(regions[:1], 0, bios)
+	assert.EqualError(t, err, "no BIOS region in the descriptor")
+	_, err = FromIFD(regions, 0x800000, nil)
+	assert.EqualError(t, err, "regions end at 0x1000000, past the end of the 0x800000 bytes flash")
+	_, err = FromIFD(append(regions, IFDRegion{Index: 3, Name: "SI_GBE", Start: 0x2000, Size: 0x1000}), 0, nil)
+	assert.EqualError(t, err, "region SI_GBE@0x2000 0x1000 overlaps SI_ME@0x1000 0x7ff000")
+}
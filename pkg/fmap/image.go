@@ -0,0 +1,282 @@
+package fmap
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"sort"
+)
+
+// offsetOf returns the offset of `target` relative to the start of `s`, and
+// whether `target` is part of the tree rooted at `s`. The offset of `s` itself
+// is 0.
+func offsetOf(s, target *Section) (int64, bool) {
+	if s == target {
+		return 0, true
+	}
+	found, offset := false, int64(0)
+	_ = walkOffsets(s, 0, func(sec *Section, off int64) error {
+		if sec == target {
+			found, offset = true, off
+			return io.EOF
+		}
+		return nil
+	})
+	return offset, found
+}
+
+// ExtractSection reads the bytes of `sec`, which must be part of the tree
+// rooted at `s`, from a flash image. Offsets in the image are relative to the
+// start of `s`.
+func (s *Section) ExtractSection(image io.ReaderAt, sec *Section) ([]byte, error) {
+	offset, ok := offsetOf(s, sec)
+	if !ok {
+		return nil, fmt.Errorf("section %s is not part of %s", sec.Name, s.Name)
+	}
+	if size(sec) < 0 {
+		return nil, sectionErrorf(sec, "negative size %d", size(sec))
+	}
+	data := make([]byte, size(sec))
+	if _, err := image.ReadAt(data, offset); err != nil {
+		if err == io.EOF {
+			return nil, sectionErrorf(sec, "range 0x%x-0x%x extends past the end of the image", offset, offset+size(sec))
+		}
+		return nil, err
+	}
+	return data, nil
+}
+
+// Extract reads the bytes of the first section called `name`, at any depth,
+// from a flash image. It returns a *NotFoundError if there is no such section.
+func (s *Section) Extract(image io.ReaderAt, name string) ([]byte, error) {
+	sec, err := s.Lookup(name, true)
+	if err != nil {
+		return nil, err
+	}
+	return s.ExtractSection(image, sec)
+}
+
+// InjectSection writes `data` at the start of the range of `sec`, which must be
+// part of the tree rooted at `s`, in a flash image. It fails if the data is
+// larger than the section. If `pad` is true, the rest of the section is filled
+// with 0xff (the erased flash value), otherwise it is left untouched.
+// Protected read-only sections cannot be written, see ProtectReadOnly.
+func (s *Section) InjectSection(image io.WriterAt, sec *Section, data []byte, pad bool) error {
+	offset, ok := offsetOf(s, sec)
+	if !ok {
+		return fmt.Errorf("section %s is not part of %s", sec.Name, s.Name)
+	}
+	if err := checkWritable(sec, "Inject("+sec.Name+")"); err != nil {
+		return err
+	}
+	if size(sec) < 0 {
+		return sectionErrorf(sec, "negative size %d", size(sec))
+	}
+	if int64(len(data)) > size(sec) {
+		return sectionErrorf(sec, "payload of 0x%x bytes does not fit in 0x%x bytes", len(data), size(sec))
+	}
+	if pad {
+		padded := bytes.Repeat([]byte{0xff}, int(size(sec)))
+		copy(padded, data)
+		data = padded
+	}
+	_, err := image.WriteAt(data, offset)
+	return err
+}
+
+// Inject writes `data` into the first section called `name`, at any depth, in
+// a flash image. See InjectSection for details. It returns a *NotFoundError if
+// there is no such section.
+func (s *Section) Inject(image io.WriterAt, name string, data []byte, pad bool) error {
+	sec, err := s.Lookup(name, true)
+	if err != nil {
+		return err
+	}
+	return s.InjectSection(image, sec, data, pad)
+}
+
+// blankChunkSize is the size of the chunks in which BlankCheckSection reads
+// and WipeSection writes the sections.
+const blankChunkSize = 64 * 1024
+
+// BlankCheckSection returns true if `sec`, which must be part of the tree
+// rooted at `s`, is erased in a flash image: all of its bytes are 0xff. If it
+// is not, it also returns the offset of its first byte that is not 0xff,
+// relative to the start of `s`. Offsets in the image are relative to the
+// start of `s`.
+func (s *Section) BlankCheckSection(image io.ReaderAt, sec *Section) (bool, int64, error) {
+	offset, ok := offsetOf(s, sec)
+	if !ok {
+		return false, 0, fmt.Errorf("section %s is not part of %s", sec.Name, s.Name)
+	}
+	buf := make([]byte, blankChunkSize)
+	for pos, end := offset, offset+size(sec); pos < end; pos += int64(len(buf)) {
+		if end-pos < int64(len(buf)) {
+			buf = buf[:end-pos]
+		}
+		if _, err := image.ReadAt(buf, pos); err != nil {
+			if err == io.EOF {
+				return false, 0, sectionErrorf(sec, "range 0x%x-0x%x extends past the end of the image", offset, end)
+			}
+			return false, 0, err
+		}
+		for idx, b := range buf {
+			if b != 0xff {
+				return false, pos + int64(idx), nil
+			}
+		}
+	}
+	return true, 0, nil
+}
+
+// BlankCheck checks whether the first section called `name`, at any depth, is
+// erased in a flash image. See BlankCheckSection for details. It returns a
+// *NotFoundError if there is no such section.
+func (s *Section) BlankCheck(image io.ReaderAt, name string) (bool, int64, error) {
+	sec, err := s.Lookup(name, true)
+	if err != nil {
+		return false, 0, err
+	}
+	return s.BlankCheckSection(image, sec)
+}
+
+// WipeSection writes `value` over the whole range of `sec`, which must be part
+// of the tree rooted at `s`, in a flash image: 0xff to erase it, or 0 to
+// zero-fill it. Protected read-only sections cannot be written, see
+// ProtectReadOnly.
+func (s *Section) WipeSection(image io.WriterAt, sec *Section, value byte) error {
+	return s.WipeSections(image, []*Section{sec}, value)
+}
+
+// WipeSections is like WipeSection for several sections. Every section is
+// checked before writing any, so that nothing is written if one of them is
+// not part of `s` or is protected.
+func (s *Section) WipeSections(image io.WriterAt, secs []*Section, value byte) error {
+	offsets := make([]int64, len(secs))
+	for idx, sec := range secs {
+		offset, ok := offsetOf(s, sec)
+		if !ok {
+			return fmt.Errorf("section %s is not part of %s", sec.Name, s.Name)
+		}
+		if err := checkWritable(sec, fmt.Sprintf("Wipe(%s, 0x%02x)", sec.Name, value)); err != nil {
+			return err
+		}
+		offsets[idx] = offset
+	}
+	for idx, sec := range secs {
+		buf := bytes.Repeat([]byte{value}, blankChunkSize)
+		for pos, end := offsets[idx], offsets[idx]+size(sec); pos < end; pos += int64(len(buf)) {
+			if end-pos < int64(len(buf)) {
+				buf = buf[:end-pos]
+			}
+			if _, err := image.WriteAt(buf, pos); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// Wipe writes `value` over the first section called `name`, at any depth, in
+// a flash image. See WipeSection for details. It returns a *NotFoundError if
+// there is no such section.
+func (s *Section) Wipe(image io.WriterAt, name string, value byte) error {
+	sec, err := s.Lookup(name, true)
+	if err != nil {
+		return err
+	}
+	return s.WipeSection(image, sec, value)
+}
+
+// CopyRegion copies the bytes of the first section called `name`, at any
+// depth, from the image `src` described by `srcLayout` to the image `dst`
+// described by `dstLayout`, e.g. to preserve the VPD of a device across a
+// reflash. Each image is addressed with its own layout, so the section can be
+// at different offsets in the two images, but it must have the same size in
+// both. It returns a *NotFoundError if either layout has no such section.
+// Protected read-only sections of `dstLayout` cannot be written, see
+// ProtectReadOnly.
+func CopyRegion(dst io.WriterAt, dstLayout *Section, src io.ReaderAt, srcLayout *Section, name string) error {
+	return CopyRegions(dst, dstLayout, src, srcLayout, []string{name})
+}
+
+// CopyRegions is like CopyRegion for several sections. Every section is
+// looked up, checked and read before writing any, so that nothing is written
+// if one of them cannot be copied.
+func CopyRegions(dst io.WriterAt, dstLayout *Section, src io.ReaderAt, srcLayout *Section, names []string) error {
+	dstSecs := make([]*Section, len(names))
+	srcSecs := make([]*Section, len(names))
+	for idx, name := range names {
+		srcSec, err := srcLayout.Lookup(name, true)
+		if err != nil {
+			return err
+		}
+		dstSec, err := dstLayout.Lookup(name, true)
+		if err != nil {
+			return err
+		}
+		if size(srcSec) != size(dstSec) {
+			return sectionErrorf(dstSec, "size 0x%x does not match the size 0x%x of the source section", size(dstSec), size(srcSec))
+		}
+		if err := checkWritable(dstSec, "CopyRegion("+name+")"); err != nil {
+			return err
+		}
+		srcSecs[idx], dstSecs[idx] = srcSec, dstSec
+	}
+	data := make([][]byte, len(names))
+	for idx, sec := range srcSecs {
+		var err error
+		if data[idx], err = srcLayout.ExtractSection(src, sec); err != nil {
+			return err
+		}
+	}
+	for idx, sec := range dstSecs {
+		if err := dstLayout.InjectSection(dst, sec, data[idx], false); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Assemble builds a whole flash image described by `s` from the payloads of
+// its sections: every payload is written at the start of the first section
+// named after its key, at any depth, and the rest of the image is erased
+// (0xff). Payloads are written in pre-order, so the payload of a sub-section
+// overwrites its range in the payload of its parent, if both are given. It
+// fails if a payload is larger than its section, and returns a
+// *NotFoundError if a section does not exist.
+func (s *Section) Assemble(payloads map[string][]byte) ([]byte, error) {
+	var names []string
+	for name := range payloads {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	bySection := make(map[*Section][]byte)
+	for _, name := range names {
+		sec, err := s.Lookup(name, true)
+		if err != nil {
+			return nil, err
+		}
+		if int64(len(payloads[name])) > size(sec) {
+			return nil, sectionErrorf(sec, "payload of 0x%x bytes does not fit in 0x%x bytes", len(payloads[name]), size(sec))
+		}
+		bySection[sec] = payloads[name]
+	}
+	if size(s) < 0 {
+		return nil, sectionErrorf(s, "negative size %d", size(s))
+	}
+	image := bytes.Repeat([]byte{0xff}, int(size(s)))
+	err := walkOffsets(s, 0, func(sec *Section, offset int64) error {
+		if data, ok := bySection[sec]; ok {
+			if offset < 0 || offset+int64(len(data)) > int64(len(image)) {
+				return sectionErrorf(sec, "range 0x%x-0x%x extends past the end of the image", offset, offset+size(sec))
+			}
+			copy(image[offset:], data)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return image, nil
+}
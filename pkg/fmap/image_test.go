@@ -0,0 +1,242 @@
+package fmap
+
+import (
+	"bytes"
+	"errors"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+const imageLayout = `FLASH 0x4000 {
+	RO 0x2000 {
+		FMAP 0x1000
+		COREBOOT 0x1000
+	}
+	RW_VPD 0x2000
+}`
+
+// testImage returns a 16K image where the n-th kilobyte is filled with the
+// byte n.
+func testImage() []byte {
+	var image []byte
+	for i := 0; i < 0x10; i++ {
+		image = append(image, bytes.Repeat([]byte{byte(i)}, 0x400)...)
+	}
+	return image
+}
+
+func TestExtract(t *testing.T) {
+	f, err := Parse(strings.NewReader(imageLayout))
+	require.NoError(t, err)
+	image := bytes.NewReader(testImage())
+
+	data, err := f.Extract(image, "COREBOOT")
+	require.NoError(t, err)
+	assert.Equal(t, testImage()[0x1000:0x2000], data)
+
+	data, err = f.Extract(image, "RW_VPD")
+	require.NoError(t, err)
+	assert.Equal(t, testImage()[0x2000:], data)
+
+	_, err = f.Extract(image, "NONEXISTING")
+	assert.True(t, errors.Is(err, ErrSectionNotFound))
+}
+
+func TestExtractSection(t *testing.T) {
+	f, err := Parse(strings.NewReader(imageLayout))
+	require.NoError(t, err)
+	image := bytes.NewReader(testImage())
+
+	data, err := f.ExtractSection(image, f)
+	require.NoError(t, err)
+	assert.Equal(t, testImage(), data)
+
+	_, err = f.ExtractSection(image, &Section{Name: "OTHER", Size: 1})
+	assert.Error(t, err)
+}
+
+func TestExtractShortImage(t *testing.T) {
+	f, err := Parse(strings.NewReader(imageLayout))
+	require.NoError(t, err)
+	_, err = f.Extract(bytes.NewReader(testImage()[:0x3000]), "RW_VPD")
+	require.Error(t, err)
+	assert.Equal(t, "section RW_VPD (6): range 0x2000-0x4000 extends past the end of the image", err.Error())
+}
+
+// memImage is an in-memory flash image implementing io.WriterAt.
+type memImage []byte
+
+func (m memImage) WriteAt(p []byte, off int64) (int, error) {
+	if off+int64(len(p)) > int64(len(m)) {
+		return 0, errors.New("write past the end of the image")
+	}
+	return copy(m[off:], p), nil
+}
+
+func TestInject(t *testing.T) {
+	f, err := Parse(strings.NewReader(imageLayout))
+	require.NoError(t, err)
+
+	image := memImage(testImage())
+	require.NoError(t, f.Inject(image, "COREBOOT", []byte{0xaa, 0xbb}, false))
+	want := testImage()
+	want[0x1000], want[0x1001] = 0xaa, 0xbb
+	assert.Equal(t, want, []byte(image))
+
+	require.NoError(t, f.Inject(image, "COREBOOT", []byte{0xcc}, true))
+	want[0x1000] = 0xcc
+	copy(want[0x1001:0x2000], bytes.Repeat([]byte{0xff}, 0xfff))
+	assert.Equal(t, want, []byte(image))
+}
+
+func TestInjectTooLarge(t *testing.T) {
+	f, err := Parse(strings.NewReader(imageLayout))
+	require.NoError(t, err)
+	image := memImage(testImage())
+	err = f.Inject(image, "FMAP", make([]byte, 0x1001), true)
+	require.Error(t, err)
+	assert.Equal(t, "section FMAP (3): payload of 0x1001 bytes does not fit in 0x1000 bytes", err.Error())
+	assert.Equal(t, testImage(), []byte(image))
+
+	err = f.Inject(image, "NONEXISTING", nil, true)
+	assert.True(t, errors.Is(err, ErrSectionNotFound))
+}
+
+func TestBlankCheck(t *testing.T) {
+	f, err := Parse(strings.NewReader(imageLayout))
+	require.NoError(t, err)
+	image := testImage()
+	copy(image[0x2000:], bytes.Repeat([]byte{0xff}, 0x2000))
+	image[0x3ffe] = 0
+
+	blank, _, err := f.BlankCheck(bytes.NewReader(image), "COREBOOT")
+	require.NoError(t, err)
+	assert.False(t, blank)
+	blank, first, err := f.BlankCheck(bytes.NewReader(image), "RW_VPD")
+	require.NoError(t, err)
+	assert.False(t, blank)
+	assert.Equal(t, int64(0x3ffe), first)
+
+	image[0x3ffe] = 0xff
+	blank, _, err = f.BlankCheck(bytes.NewReader(image), "RW_VPD")
+	require.NoError(t, err)
+	assert.True(t, blank)
+
+	_, _, err = f.BlankCheck(bytes.NewReader(image[:0x3000]), "RW_VPD")
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "range 0x2000-0x4000 extends past the end of the image")
+	_, _, err = f.BlankCheck(bytes.NewReader(image), "NONEXISTING")
+	assert.True(t, errors.Is(err, ErrSectionNotFound))
+}
+
+func TestWipe(t *testing.T) {
+	f, err := Parse(strings.NewReader(imageLayout))
+	require.NoError(t, err)
+	image := memImage(testImage())
+
+	require.NoError(t, f.Wipe(image, "COREBOOT", 0xff))
+	want := testImage()
+	copy(want[0x1000:0x2000], bytes.Repeat([]byte{0xff}, 0x1000))
+	assert.Equal(t, want, []byte(image))
+	blank, _, err := f.BlankCheck(bytes.NewReader(image), "COREBOOT")
+	require.NoError(t, err)
+	assert.True(t, blank)
+
+	require.NoError(t, f.Wipe(image, "RW_VPD", 0))
+	copy(want[0x2000:], make([]byte, 0x2000))
+	assert.Equal(t, want, []byte(image))
+
+	f.Find("FMAP", true).SetAttribute(AttrReadOnly, "true")
+	f.ProtectReadOnly(true)
+	err = f.Wipe(image, "FMAP", 0xff)
+	assert.True(t, errors.Is(err, ErrReadOnly))
+	assert.Equal(t, want, []byte(image))
+
+	// nothing is written if a section is protected
+	err = f.WipeSections(image, []*Section{f.Find("COREBOOT", true), f.Find("FMAP", true)}, 0)
+	assert.True(t, errors.Is(err, ErrReadOnly))
+	assert.Equal(t, want, []byte(image))
+}
+
+func TestCopyRegion(t *testing.T) {
+	src, err := Parse(strings.NewReader(imageLayout))
+	require.NoError(t, err)
+	// RW_VPD is at the start of the destination image
+	dst, err := Parse(strings.NewReader(`FLASH 0x4000 {
+	RW_VPD 0x2000
+	RO 0x1000
+	COREBOOT 0x1000
+}`))
+	require.NoError(t, err)
+
+	image := memImage(bytes.Repeat([]byte{0xff}, 0x4000))
+	require.NoError(t, CopyRegion(image, dst, bytes.NewReader(testImage()), src, "RW_VPD"))
+	want := bytes.Repeat([]byte{0xff}, 0x4000)
+	copy(want, testImage()[0x2000:])
+	assert.Equal(t, want, []byte(image))
+
+	err = CopyRegion(image, dst, bytes.NewReader(testImage()), src, "RO")
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "size 0x1000 does not match the size 0x2000 of the source section")
+	err = CopyRegion(image, dst, bytes.NewReader(testImage()), src, "FMAP")
+	assert.True(t, errors.Is(err, ErrSectionNotFound))
+	assert.Equal(t, want, []byte(image))
+
+	// nothing is written if a section cannot be copied
+	image = memImage(bytes.Repeat([]byte{0xff}, 0x4000))
+	err = CopyRegions(image, dst, bytes.NewReader(testImage()), src, []string{"COREBOOT", "FMAP"})
+	assert.True(t, errors.Is(err, ErrSectionNotFound))
+	assert.Equal(t, bytes.Repeat([]byte{0xff}, 0x4000), []byte(image))
+}
+
+func TestAssemble(t *testing.T) {
+	f, err := Parse(strings.NewReader(imageLayout))
+	require.NoError(t, err)
+	image := testImage()
+	payloads := make(map[string][]byte)
+	for _, name := range []string{"FMAP", "COREBOOT", "RW_VPD"} {
+		data, err := f.Extract(bytes.NewReader(image), name)
+		require.NoError(t, err)
+		payloads[name] = data
+	}
+	assembled, err := f.Assemble(payloads)
+	require.NoError(t, err)
+	assert.Equal(t, image, assembled)
+
+	// short payloads are padded, and missing ones left erased
+	assembled, err = f.Assemble(map[string][]byte{"COREBOOT": {1, 2}})
+	require.NoError(t, err)
+	want := bytes.Repeat([]byte{0xff}, 0x4000)
+	want[0x1000], want[0x1001] = 1, 2
+	assert.Equal(t, want, assembled)
+	// the payload of RO is overwritten by the one of COREBOOT
+	assembled, err = f.Assemble(map[string][]byte{"RO": make([]byte, 0x2000), "COREBOOT": {1, 2}})
+	require.NoError(t, err)
+	assert.Equal(t, append(make([]byte, 0x1000), 1, 2), assembled[:0x1002])
+	assert.Equal(t, byte(0), assembled[0x1002])
+
+	_, err = f.Assemble(map[string][]byte{"FMAP": make([]byte, 0x1001)})
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "payload of 0x1001 bytes does not fit in 0x1000 bytes")
+	_, err = f.Assemble(map[string][]byte{"NONEXISTING": nil})
+	assert.True(t, errors.Is(err, ErrSectionNotFound))
+}
+
+func TestImageNegativeSize(t *testing.T) {
+	f, err := ParseString("FLASH 0x1000 - 0x2000 {\n\tA 0x1000 - 0x2000\n}")
+	require.NoError(t, err)
+	image := memImage(testImage())
+
+	_, err = f.Extract(bytes.NewReader(image), "A")
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "negative size -4096")
+	err = f.Inject(image, "A", nil, true)
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "negative size -4096")
+	_, err = f.Assemble(nil)
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "negative size -4096")
+}
@@ -0,0 +1,124 @@
+package fmap
+
+import (
+	"bytes"
+	"fmt"
+	"io/ioutil"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/alecthomas/participle/lexer"
+	"github.com/insomniacslk/fmap/pkg/fmap/syntax"
+)
+
+// Include is an `include "file.fmd"` directive in the body of a section. The
+// included file contains sub-sections, and possibly other includes, that are
+// inserted in place of the directive. Relative paths are resolved from the
+// directory of the including file. The parser resolves the includes, so
+// sections returned by Parse have no includes left, and ToFlashmap writes the
+// included sections inline.
+type Include struct {
+	Path string
+
+	Pos lexer.Position
+}
+
+// parseFragment parses an included file, and resolves the spans of its
+// sections. It returns a section without name holding the includes and the
+// sections of the file.
+func parseFragment(filename string) (*Section, error) {
+	data, err := ioutil.ReadFile(filename)
+	if err != nil {
+		return nil, err
+	}
+	data = normalize(data)
+	frag, err := syntax.ParseFragment(namedReader{Reader: bytes.NewReader(data), name: filename})
+	if err != nil {
+		return nil, err
+	}
+	tokens, err := syntax.Lex(bytes.NewReader(data))
+	if err != nil {
+		return nil, err
+	}
+	included := &Section{}
+	for _, inc := range frag.Includes {
+		included.Includes = append(included.Includes, fromSyntaxInclude(inc))
+	}
+	for _, sec := range frag.Sections {
+		child := fromSyntaxSection(sec)
+		resolveSpans(child, filename, tokens)
+		included.Sections = append(included.Sections, child)
+	}
+	return included, nil
+}
+
+// expandIncludes replaces the includes in the body of `s`, and of its
+// sub-sections, with the included sections. `filename` is the file `s` was
+// parsed from, and `stack` the absolute paths of the files being included, to
+// detect cycles.
+func expandIncludes(s *Section, filename string, stack []string) error {
+	for _, sec := range s.Sections {
+		if err := expandIncludes(sec, filename, stack); err != nil {
+			return err
+		}
+	}
+	if len(s.Includes) == 0 {
+		return nil
+	}
+	// includes and sections are interleaved in the source, and their order
+	// matters for the implicit starts
+	type item struct {
+		offset   int
+		sections []*Section
+	}
+	var items []item
+	for _, sec := range s.Sections {
+		items = append(items, item{offset: sec.Pos.Offset, sections: []*Section{sec}})
+	}
+	for _, inc := range s.Includes {
+		at := Span{Filename: filename, StartLine: inc.Pos.Line, EndLine: inc.Pos.Line}
+		path := inc.Path
+		if !filepath.IsAbs(path) {
+			path = filepath.Join(filepath.Dir(filename), path)
+		}
+		abs, err := filepath.Abs(path)
+		if err != nil {
+			return err
+		}
+		for idx, p := range stack {
+			if p == abs {
+				return fmt.Errorf("%s: include cycle: %s", at, strings.Join(append(stack[idx:], abs), " -> "))
+			}
+		}
+		included, err := parseFragment(path)
+		if err != nil {
+			return fmt.Errorf("%s: %w", at, err)
+		}
+		if err := expandIncludes(included, path, append(stack[:len(stack):len(stack)], abs)); err != nil {
+			return err
+		}
+		items = append(items, item{offset: inc.Pos.Offset, sections: included.Sections})
+	}
+	sort.SliceStable(items, func(i, j int) bool {
+		return items[i].offset < items[j].offset
+	})
+	s.Sections, s.Includes = nil, nil
+	for _, it := range items {
+		s.Sections = append(s.Sections, it.sections...)
+	}
+	return nil
+}
+
+// resolveIncludes expands the includes of a tree parsed from `filename`.
+func resolveIncludes(s *Section, filename string) error {
+	var stack []string
+	if filename != "" {
+		abs, err := filepath.Abs(filename)
+		if err != nil {
+			return err
+		}
+		stack = append(stack, abs)
+	}
+	return expandIncludes(s, filename, stack)
+}
@@ -0,0 +1,62 @@
+package fmap
+
+import (
+	"os"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestInclude(t *testing.T) {
+	fd, err := os.Open("test_data/include/board.fmd")
+	require.NoError(t, err)
+	defer fd.Close()
+	f, err := Parse(fd)
+	require.NoError(t, err)
+
+	assert.Equal(t, `FLASH 0x10000 {
+	RO 0x4000 {
+		FMAP 0x1000
+		COREBOOT(CBFS)
+	}
+	RW_A 0x4000 {
+		VBLOCK_A 0x1000
+		FW_MAIN(CBFS)
+		RW_FWID_A 0x100
+	}
+	RW_VPD(PRESERVE) 0x4000
+	RW_NVRAM(PRESERVE) 0x4000
+}
+`, f.ToFlashmap())
+	assert.Equal(t, int64(0x3000), f.Find("COREBOOT", true).Size)
+	assert.Equal(t, int64(0x2f00), f.Find("FW_MAIN", true).Size)
+	assert.NoError(t, f.CheckCoverage())
+
+	assert.Equal(t, Span{Filename: "test_data/include/common/ro.fmd", StartLine: 3, EndLine: 3}, f.Find("COREBOOT", true).Span())
+	assert.Equal(t, Span{Filename: "test_data/include/common/vpd.fmd", StartLine: 1, EndLine: 1}, f.Find("RW_VPD", true).Span())
+	assert.Equal(t, "FLASH/RW_A/FW_MAIN", f.Find("FW_MAIN", true).Path())
+	assert.Empty(t, f.Find("RO", false).Includes)
+}
+
+func TestIncludeCycle(t *testing.T) {
+	fd, err := os.Open("test_data/include/cycle.fmd")
+	require.NoError(t, err)
+	defer fd.Close()
+	_, err = Parse(fd)
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "test_data/include/cycle_b.fmd:1: include cycle: ")
+	cycle := err.Error()[strings.Index(err.Error(), "include cycle: ")+len("include cycle: "):]
+	files := strings.Split(cycle, " -> ")
+	require.Equal(t, 3, len(files))
+	assert.True(t, strings.HasSuffix(files[0], "test_data/include/cycle_a.fmd"))
+	assert.True(t, strings.HasSuffix(files[1], "test_data/include/cycle_b.fmd"))
+	assert.Equal(t, files[0], files[2])
+}
+
+func TestIncludeMissing(t *testing.T) {
+	_, err := Parse(strings.NewReader("FLASH 0x1000 {\n\tinclude \"test_data/include/nonexisting.fmd\"\n}"))
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "2: open test_data/include/nonexisting.fmd")
+}
@@ -0,0 +1,192 @@
+package fmap
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// Position is where Insert places a new sub-section, see AtOffset and AtIndex.
+type Position struct {
+	// Offset is the start of the new section, relative to its parent. It is
+	// ignored if the position is an index.
+	Offset int64
+	// Index is the position of the new section among its siblings ordered
+	// by start: it starts at the end of the sibling before it, or at 0.
+	Index   int
+	byIndex bool
+	// ShrinkUnused allows the new section to take its space from the free
+	// regions it lands on, see IsUnused, which are shrunk, or removed if
+	// nothing is left of them. Without it, any overlap with a sibling is an
+	// error.
+	ShrinkUnused bool
+}
+
+// AtOffset returns the position at `offset` relative to the parent.
+func AtOffset(offset int64) Position {
+	return Position{Offset: offset}
+}
+
+// AtIndex returns the position after the first `idx` sub-sections of the
+// parent, ordered by start.
+func AtIndex(idx int) Position {
+	return Position{Index: idx, byIndex: true}
+}
+
+// String returns a description of the position.
+func (p Position) String() string {
+	if p.byIndex {
+		return fmt.Sprintf("index %d", p.Index)
+	}
+	return fmt.Sprintf("0x%x", p.Offset)
+}
+
+// IsUnused returns true if the section is a free region of the flash: a leaf
+// called UNUSED, or whose name ends with _UNUSED, e.g. RO_UNUSED, or starts
+// with UNUSED_, e.g. UNUSED_0 as named by MaterializeGaps.
+func (s *Section) IsUnused() bool {
+	return len(s.Sections) == 0 && (s.Name == "UNUSED" || strings.HasSuffix(s.Name, "_UNUSED") || strings.HasPrefix(s.Name, "UNUSED_"))
+}
+
+// sortedChildren returns the sub-sections of `s` and their starts, ordered by
+// start.
+func sortedChildren(s *Section) ([]*Section, []int64) {
+	starts := childStarts(s)
+	order := make([]int, len(starts))
+	for idx := range order {
+		order[idx] = idx
+	}
+	sort.SliceStable(order, func(i, j int) bool {
+		return starts[order[i]] < starts[order[j]]
+	})
+	secs := make([]*Section, len(order))
+	sorted := make([]int64, len(order))
+	for i, idx := range order {
+		secs[i], sorted[i] = s.Sections[idx], starts[idx]
+	}
+	return secs, sorted
+}
+
+// Insert adds `child` as a sub-section of `s` at the given position, before
+// the first sub-section that starts after it, so that sub-sections ordered by
+// start stay in order. The start of `child` is set to the position, and the
+// following sub-sections get an explicit start, so that they don't move. The
+// new section must fit in `s`, must not have the name of a sibling, and must
+// not overlap with its siblings, unless they are free regions and
+// ShrinkUnused is set. Nothing is changed if the insertion fails, or if it
+// would modify a protected section, see ProtectReadOnly.
+func (s *Section) Insert(child *Section, pos Position) error {
+	if child.parent != nil {
+		return sectionErrorf(child, "already a sub-section of %s", child.parent.Name)
+	}
+	_, err := s.insert(child, pos, fmt.Sprintf("Insert(%s, %s)", child.Name, pos))
+	return err
+}
+
+// insert implements Insert, recording the operation `op`, and returns its
+// transform.
+func (s *Section) insert(child *Section, pos Position, op string) (Transform, error) {
+	for _, sec := range s.Sections {
+		if sec.Name == child.Name {
+			return Transform{}, sectionErrorf(sec, "%s already has a sub-section called %s", s.Name, child.Name)
+		}
+	}
+	secs, starts := sortedChildren(s)
+	start := pos.Offset
+	if pos.byIndex {
+		if pos.Index < 0 || pos.Index > len(secs) {
+			return Transform{}, sectionErrorf(s, "index %d out of range, there are %d sub-sections", pos.Index, len(secs))
+		}
+		start = 0
+		if pos.Index > 0 {
+			start = starts[pos.Index-1] + size(secs[pos.Index-1])
+		}
+	}
+	end, err := addInt64(start, size(child))
+	if start < 0 || err != nil || end > size(s) {
+		return Transform{}, sectionErrorf(child, "range 0x%x-0x%x does not fit in %s (0x%x bytes)", start, start+size(child), s.Name, size(s))
+	}
+	if err := checkWritable(s, op); err != nil {
+		return Transform{}, err
+	}
+
+	// free regions to shrink, with their new start and size
+	type shrunk struct {
+		sec         *Section
+		start, size int64
+	}
+	var shrinks []shrunk
+	for idx, sec := range secs {
+		secEnd := starts[idx] + size(sec)
+		if secEnd <= start || starts[idx] >= end || size(sec) == 0 {
+			continue
+		}
+		if !pos.ShrinkUnused || !sec.IsUnused() {
+			return Transform{}, sectionErrorf(child, "range 0x%x-0x%x overlaps with %s at 0x%x-0x%x", start, end, sec.Name, starts[idx], secEnd)
+		}
+		if err := checkWritable(sec, op); err != nil {
+			return Transform{}, err
+		}
+		switch {
+		case starts[idx] >= start && secEnd <= end:
+			shrinks = append(shrinks, shrunk{sec, starts[idx], 0})
+		case starts[idx] >= start:
+			shrinks = append(shrinks, shrunk{sec, end, secEnd - end})
+		case secEnd <= end:
+			shrinks = append(shrinks, shrunk{sec, starts[idx], start - starts[idx]})
+		default:
+			return Transform{}, sectionErrorf(sec, "inserting %s at 0x%x-0x%x would split it", child.Name, start, end)
+		}
+	}
+
+	t := s.record(op)
+	// make the starts of the following sub-sections explicit, so that those
+	// placed after their previous sibling don't move
+	for idx, st := range childStarts(s) {
+		if st >= start && s.Sections[idx].Start == nil {
+			st := st
+			s.Sections[idx].Start = &st
+		}
+	}
+	for _, sh := range shrinks {
+		if sh.size == 0 {
+			for idx, sec := range s.Sections {
+				if sec == sh.sec {
+					s.Sections = append(s.Sections[:idx], s.Sections[idx+1:]...)
+					break
+				}
+			}
+			sh.sec.parent = nil
+			continue
+		}
+		shStart := sh.start
+		sh.sec.Start = &shStart
+		setSize(sh.sec, sh.size)
+		sh.sec.touch(t)
+	}
+	place(s, child, start, t)
+	return t, nil
+}
+
+// place adds `child` to the sub-sections of `s` at `start`, before the first
+// sub-section that starts after it, as part of the transform `t`. The
+// following sub-sections get an explicit start.
+func place(s, child *Section, start int64, t Transform) {
+	at := len(s.Sections)
+	for idx, st := range childStarts(s) {
+		if st >= start && s.Sections[idx].Start == nil {
+			st := st
+			s.Sections[idx].Start = &st
+		}
+		if st >= start && at == len(s.Sections) {
+			at = idx
+		}
+	}
+	child.Start = &start
+	s.Sections = append(s.Sections[:at], append([]*Section{child}, s.Sections[at:]...)...)
+	setJournal(child, s.journal)
+	child.parent = s
+	link(child)
+	child.touch(t)
+	s.touch(t)
+}
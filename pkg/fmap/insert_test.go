@@ -0,0 +1,74 @@
+package fmap
+
+import (
+	"errors"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+const insertLayout = `FLASH 0x10000 {
+	RO 0x4000
+	RO_UNUSED 0x4000
+	RW 0x8000
+}`
+
+func TestInsertShrinkUnused(t *testing.T) {
+	f, err := Parse(strings.NewReader(insertLayout))
+	require.NoError(t, err)
+
+	child := &Section{Name: "RO_VPD", Size: 0x1000}
+	pos := AtIndex(1)
+	pos.ShrinkUnused = true
+	require.NoError(t, f.Insert(child, pos))
+	assert.Equal(t, f, child.Parent())
+	assert.Equal(t, "Insert(RO_VPD, index 1)", child.Provenance()[0].Op)
+	assert.Equal(t, `FLASH 0x10000 {
+	RO 0x4000
+	RO_VPD@0x4000 0x1000
+	RO_UNUSED@0x5000 0x3000
+	RW@0x8000 0x8000
+}
+`, f.ToFlashmap())
+	assert.Empty(t, f.Validate())
+	assert.NoError(t, f.CheckCoverage())
+
+	// taking the whole free region removes it
+	pos = AtOffset(0x5000)
+	pos.ShrinkUnused = true
+	require.NoError(t, f.Insert(&Section{Name: "RO_GSCVD", Size: 0x3000}, pos))
+	assert.Nil(t, f.Find("RO_UNUSED", false))
+	assert.Equal(t, []string{"RO", "RO_VPD", "RO_GSCVD", "RW"}, sectionNames(f.Sections))
+	assert.NoError(t, f.CheckCoverage())
+}
+
+func TestInsertErrors(t *testing.T) {
+	f, err := Parse(strings.NewReader(insertLayout))
+	require.NoError(t, err)
+	want := f.ToFlashmap()
+
+	for _, tc := range []struct {
+		child *Section
+		pos   Position
+		err   string
+	}{
+		{&Section{Name: "RW", Size: 0x1000}, AtOffset(0x8000), "FLASH already has a sub-section called RW"},
+		{&Section{Name: "X", Size: 0x1000}, AtOffset(0x4000), "range 0x4000-0x5000 overlaps with RO_UNUSED at 0x4000-0x8000"},
+		{&Section{Name: "X", Size: 0x1000}, AtOffset(0xf800), "range 0xf800-0x10800 does not fit in FLASH"},
+		{&Section{Name: "X", Size: 0x1000}, AtIndex(4), "index 4 out of range"},
+		{&Section{Name: "X", Size: 0x1000}, Position{Offset: 0x5000, ShrinkUnused: true}, "inserting X at 0x5000-0x6000 would split it"},
+		{&Section{Name: "X", Size: 0x1000}, Position{Offset: 0x3800, ShrinkUnused: true}, "overlaps with RO at 0x0-0x4000"},
+	} {
+		err := f.Insert(tc.child, tc.pos)
+		require.Error(t, err, tc.pos)
+		assert.Contains(t, err.Error(), tc.err)
+	}
+	assert.Equal(t, want, f.ToFlashmap())
+
+	f.Find("RO_UNUSED", false).SetAttribute(AttrReadOnly, "true")
+	f.ProtectReadOnly(true)
+	err = f.Insert(&Section{Name: "X", Size: 0x1000}, Position{Offset: 0x4000, ShrinkUnused: true})
+	assert.True(t, errors.Is(err, ErrReadOnly))
+}
@@ -0,0 +1,94 @@
+package fmap
+
+import (
+	"encoding/json"
+	"strings"
+)
+
+// jsonSection is the JSON representation of a Section. All the keys are
+// always present, so that consumers can rely on a stable schema. The
+// annotation is the flags as written between parentheses, kept for
+// compatibility with consumers predating the flags list.
+type jsonSection struct {
+	Name       string          `json:"name"`
+	Annotation *string         `json:"annotation"`
+	Start      *int64          `json:"start"`
+	Size       int64           `json:"size"`
+	Unit       string          `json:"unit"`
+	Flags      []Flag          `json:"flags"`
+	Attributes []jsonAttribute `json:"attributes"`
+	Children   []*Section      `json:"children"`
+}
+
+// jsonAttribute is the JSON representation of an Attribute.
+type jsonAttribute struct {
+	Key   string `json:"key"`
+	Value string `json:"value"`
+}
+
+// annotation returns the flags of a section as written between parentheses,
+// or nil if it has none.
+func annotation(s *Section) *string {
+	if len(s.Flags) == 0 {
+		return nil
+	}
+	ret := s.Flags.String()
+	return &ret
+}
+
+// MarshalJSON implements json.Marshaler. The size is always expressed in
+// bytes, and the unit it was originally written with is reported separately.
+// Starts are relative to the parent section, and null if omitted.
+func (s *Section) MarshalJSON() ([]byte, error) {
+	children := s.Sections
+	if children == nil {
+		children = []*Section{}
+	}
+	attrs := make([]jsonAttribute, 0, len(s.Attributes))
+	for _, a := range s.Attributes {
+		attrs = append(attrs, jsonAttribute{Key: a.Key, Value: a.Value})
+	}
+	return json.Marshal(jsonSection{
+		Name:       s.Name,
+		Annotation: annotation(s),
+		Start:      s.Start,
+		Size:       size(s),
+		Unit:       s.Unit,
+		Flags:      append([]Flag{}, s.Flags...),
+		Attributes: attrs,
+		Children:   children,
+	})
+}
+
+// UnmarshalJSON implements json.Unmarshaler. The flags are read from the
+// "flags" key, or from the annotation if the list is empty. If the size in
+// bytes is not a multiple of the unit, the unit is dropped.
+func (s *Section) UnmarshalJSON(data []byte) error {
+	var js jsonSection
+	if err := json.Unmarshal(data, &js); err != nil {
+		return err
+	}
+	*s = Section{
+		Name:     js.Name,
+		Start:    js.Start,
+		Size:     js.Size,
+		Sections: js.Children,
+	}
+	for _, fl := range js.Flags {
+		s.AddFlag(fl)
+	}
+	if len(js.Flags) == 0 && js.Annotation != nil {
+		for _, fl := range strings.Fields(*js.Annotation) {
+			s.AddFlag(Flag(fl))
+		}
+	}
+	for _, a := range js.Attributes {
+		s.SetAttribute(a.Key, a.Value)
+	}
+	if mult := unitSize(js.Unit); mult > 1 && js.Size%mult == 0 {
+		s.Size = js.Size / mult
+		s.Unit = js.Unit
+	}
+	link(s)
+	return nil
+}
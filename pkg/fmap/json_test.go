@@ -0,0 +1,51 @@
+package fmap
+
+import (
+	"encoding/json"
+	"os"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestMarshalJSON(t *testing.T) {
+	f, err := Parse(strings.NewReader(`FLASH@0xff000000 16M {
+	SI_DESC 4k
+	COREBOOT(CBFS)[alias=BOOT_STUB]@0x1000 0xfff000
+}`))
+	require.NoError(t, err)
+	data, err := json.Marshal(f)
+	require.NoError(t, err)
+	want := `{"name":"FLASH","annotation":null,"start":4278190080,"size":16777216,"unit":"M","flags":[],"attributes":[],"children":[` +
+		`{"name":"SI_DESC","annotation":null,"start":null,"size":4096,"unit":"k","flags":[],"attributes":[],"children":[]},` +
+		`{"name":"COREBOOT","annotation":"CBFS","start":4096,"size":16773120,"unit":"","flags":["CBFS"],"attributes":[{"key":"alias","value":"BOOT_STUB"}],"children":[]}]}`
+	assert.Equal(t, want, string(data))
+}
+
+func TestUnmarshalJSON(t *testing.T) {
+	fd, err := os.Open("test_data/chromeos.fmd")
+	require.NoError(t, err)
+	defer fd.Close()
+	f, err := Parse(fd)
+	require.NoError(t, err)
+
+	data, err := json.Marshal(f)
+	require.NoError(t, err)
+	var f2 Section
+	require.NoError(t, json.Unmarshal(data, &f2))
+	assert.Equal(t, f.ToFlashmap(), f2.ToFlashmap())
+}
+
+func TestUnmarshalJSONUnit(t *testing.T) {
+	var s Section
+	require.NoError(t, json.Unmarshal([]byte(`{"name":"A","size":8192,"unit":"k"}`), &s))
+	assert.Equal(t, int64(8), s.Size)
+	assert.Equal(t, "k", s.Unit)
+
+	// not a multiple of the unit
+	require.NoError(t, json.Unmarshal([]byte(`{"name":"A","size":8193,"unit":"k"}`), &s))
+	assert.Equal(t, int64(8193), s.Size)
+	assert.Equal(t, "", s.Unit)
+}
@@ -0,0 +1,66 @@
+package fmap
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// Region is a contiguous range of flash, with an offset relative to the start
+// of the root section, and the leaf sections that make it up.
+type Region struct {
+	Offset   int64
+	Size     int64
+	Sections []*Section
+}
+
+// Name returns the name of the region. Regions made of several merged leaves
+// are named after all of them, joined by "+".
+func (r Region) Name() string {
+	return strings.Join(sectionNames(r.Sections), "+")
+}
+
+// sectionNames returns the names of a list of sections.
+func sectionNames(sections []*Section) []string {
+	names := make([]string, 0, len(sections))
+	for _, sec := range sections {
+		names = append(names, sec.Name)
+	}
+	return names
+}
+
+// String returns a human-readable description of the region.
+func (r Region) String() string {
+	return fmt.Sprintf("%s@0x%x 0x%x", r.Name(), r.Offset, r.Size)
+}
+
+// Leaves returns the leaf sections of the tree, i.e. the sections without
+// sub-sections, with their ranges relative to the start of `s`, sorted by
+// offset. These are the regions that flash programmers actually write.
+// If `merge` is true, contiguous leaves are merged into a single region.
+func (s *Section) Leaves(merge bool) []Region {
+	var leaves []Region
+	_ = walkOffsets(s, 0, func(sec *Section, offset int64) error {
+		if len(sec.Sections) == 0 {
+			leaves = append(leaves, Region{Offset: offset, Size: size(sec), Sections: []*Section{sec}})
+		}
+		return nil
+	})
+	sort.SliceStable(leaves, func(i, j int) bool {
+		return leaves[i].Offset < leaves[j].Offset
+	})
+	if !merge || len(leaves) == 0 {
+		return leaves
+	}
+	merged := []Region{leaves[0]}
+	for _, leaf := range leaves[1:] {
+		last := &merged[len(merged)-1]
+		if last.Offset+last.Size == leaf.Offset {
+			last.Size += leaf.Size
+			last.Sections = append(last.Sections, leaf.Sections...)
+		} else {
+			merged = append(merged, leaf)
+		}
+	}
+	return merged
+}
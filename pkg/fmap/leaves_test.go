@@ -0,0 +1,47 @@
+package fmap
+
+import (
+	"os"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestLeaves(t *testing.T) {
+	fd, err := os.Open("test_data/chromeos.fmd")
+	require.NoError(t, err)
+	defer fd.Close()
+	f, err := Parse(fd)
+	require.NoError(t, err)
+
+	leaves := f.Leaves(false)
+	require.Equal(t, 24, len(leaves))
+	assert.Equal(t, "SI_DESC@0x0 0x1000", leaves[0].String())
+	assert.Equal(t, "SI_ME@0x1000 0x1ff000", leaves[1].String())
+	assert.Equal(t, "VBLOCK_A@0x200000 0x10000", leaves[2].String())
+	// FW_MAIN_A is at SI_BIOS + RW_SECTION_A + 0x10000
+	assert.Equal(t, "FW_MAIN_A@0x210000 0x3d7fc0", leaves[3].String())
+	assert.Equal(t, "COREBOOT@0xd00000 0x300000", leaves[len(leaves)-1].String())
+}
+
+func TestLeavesMerge(t *testing.T) {
+	f, err := Parse(strings.NewReader(`FLASH 0x10000 {
+	RO@0x0 0x2000 {
+		A 0x1000
+		B 0x1000
+	}
+	C@0x2000 0x1000
+	D@0x8000 0x8000
+}`))
+	require.NoError(t, err)
+
+	leaves := f.Leaves(true)
+	require.Equal(t, 2, len(leaves))
+	assert.Equal(t, "A+B+C@0x0 0x3000", leaves[0].String())
+	assert.Equal(t, "D@0x8000 0x8000", leaves[1].String())
+
+	leaves = f.Leaves(false)
+	require.Equal(t, 4, len(leaves))
+}
@@ -0,0 +1,45 @@
+package fmap
+
+import "strings"
+
+// Link sets the parent back-references of all the sub-sections of `s`,
+// recursively, so that Parent, Root and Path can navigate upwards. Parse links
+// the trees it returns, and the operations of this package keep the links up
+// to date; Link only needs to be called again after modifying the Sections
+// fields directly. `s` itself becomes a root.
+func (s *Section) Link() {
+	s.parent = nil
+	link(s)
+}
+
+// link sets the parent back-references of the sub-sections of `s`.
+func link(s *Section) {
+	for _, sec := range s.Sections {
+		sec.parent = s
+		link(sec)
+	}
+}
+
+// Parent returns the parent section, or nil if the section is a root or the
+// tree was not linked.
+func (s *Section) Parent() *Section {
+	return s.parent
+}
+
+// Root returns the root of the tree the section belongs to.
+func (s *Section) Root() *Section {
+	for s.parent != nil {
+		s = s.parent
+	}
+	return s
+}
+
+// Path returns the names of the section's ancestors and its own, from the
+// root, separated by "/", e.g. "FLASH/SI_BIOS/RW_SECTION_A".
+func (s *Section) Path() string {
+	var names []string
+	for sec := s; sec != nil; sec = sec.parent {
+		names = append([]string{sec.Name}, names...)
+	}
+	return strings.Join(names, "/")
+}
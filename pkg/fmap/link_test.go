@@ -0,0 +1,72 @@
+package fmap
+
+import (
+	"encoding/json"
+	"os"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestLink(t *testing.T) {
+	fd, err := os.Open("test_data/chromeos.fmd")
+	require.NoError(t, err)
+	defer fd.Close()
+	f, err := Parse(fd)
+	require.NoError(t, err)
+
+	vblock := f.Find("VBLOCK_A", true)
+	require.NotNil(t, vblock)
+	require.NotNil(t, vblock.Parent())
+	assert.Equal(t, "RW_SECTION_A", vblock.Parent().Name)
+	assert.Equal(t, f, vblock.Root())
+	assert.Nil(t, f.Parent())
+	assert.Equal(t, "FLASH/SI_BIOS/RW_SECTION_A/VBLOCK_A", vblock.Path())
+	assert.Equal(t, "FLASH", f.Path())
+
+	// FindAnywhere searches from the root
+	assert.Equal(t, "SI_DESC", vblock.FindAnywhere("SI_DESC").Name)
+	assert.Equal(t, f, vblock.FindAnywhere("FLASH"))
+
+	// removed sections are detached
+	sec, err := f.Delete("RW_SECTION_A", true)
+	require.NoError(t, err)
+	assert.Nil(t, sec.Parent())
+	assert.Equal(t, "RW_SECTION_A/VBLOCK_A", vblock.Path())
+}
+
+func TestLinkManual(t *testing.T) {
+	child := &Section{Name: "CHILD", Size: 0x1000}
+	f := Section{Name: "FLASH", Size: 0x1000, Sections: []*Section{
+		{Name: "PARENT", Size: 0x1000, Sections: []*Section{child}},
+	}}
+	assert.Equal(t, "CHILD", child.Path())
+	f.Link()
+	assert.Equal(t, "FLASH/PARENT/CHILD", child.Path())
+	assert.Equal(t, &f, child.Root())
+
+	f.Sections[0].Link()
+	assert.Nil(t, f.Sections[0].Parent())
+	assert.Equal(t, "PARENT/CHILD", child.Path())
+}
+
+func TestLinkFromBinaryAndJSON(t *testing.T) {
+	fd, err := os.Open("test_data/chromeos.fmd")
+	require.NoError(t, err)
+	defer fd.Close()
+	f, err := Parse(fd)
+	require.NoError(t, err)
+
+	data, err := f.ToBinary()
+	require.NoError(t, err)
+	fb, err := FromBinary(data)
+	require.NoError(t, err)
+	assert.Equal(t, "FLASH/SI_BIOS/WP_RO/RO_SECTION/GBB", fb.Find("GBB", true).Path())
+
+	data, err = json.Marshal(f)
+	require.NoError(t, err)
+	var fj Section
+	require.NoError(t, json.Unmarshal(data, &fj))
+	assert.Equal(t, "FLASH/SI_BIOS/WP_RO/RO_SECTION/GBB", fj.Find("GBB", true).Path())
+}
@@ -0,0 +1,105 @@
+package fmap
+
+import (
+	"fmt"
+	"path"
+	"regexp"
+)
+
+// LintRule is a local convention of a firmware team, checked by Lint on top of
+// the structural checks of Validate, e.g. that the sections are 4K-aligned, or
+// that no RW section lives under WP_RO. A rule applies to the sections whose
+// name matches Sections, and checks all the conditions that are set.
+type LintRule struct {
+	// Name identifies the rule in the findings.
+	Name     string
+	Severity Severity
+	// Sections is a shell pattern, see path.Match, of the names, or aliases,
+	// of the sections the rule applies to, e.g. "RW_*". If empty, the rule
+	// applies to all the sections, the root included.
+	Sections string
+	// Align, if not zero, requires the starts of the sections, relative to
+	// the root, and their sizes in bytes to be multiples of it.
+	Align int64
+	// NamePattern, if not nil, requires the names of the sections to match
+	// it, e.g. `^[A-Z0-9_]+$`.
+	NamePattern *regexp.Regexp
+	// NotUnder is a shell pattern of the names, or aliases, of the sections
+	// that must not be ancestors of the sections, e.g. "WP_RO".
+	NotUnder string
+}
+
+// LintFinding is a section that breaks a LintRule.
+type LintFinding struct {
+	// Rule is the name of the rule.
+	Rule string
+	Violation
+}
+
+// Error implements the error interface.
+func (f LintFinding) Error() string {
+	return f.Rule + ": " + f.Violation.Error()
+}
+
+// Lint checks the sections of the tree `s` against the rules, and returns the
+// findings section by section, in pre-order, and rule by rule for each
+// section. It returns an error if a pattern of the rules is malformed.
+func (s *Section) Lint(rules []LintRule) ([]LintFinding, error) {
+	for _, r := range rules {
+		for _, pattern := range []string{r.Sections, r.NotUnder} {
+			if _, err := path.Match(pattern, ""); err != nil {
+				return nil, fmt.Errorf("rule %s: %v", r.Name, err)
+			}
+		}
+	}
+	var findings []LintFinding
+	var visit func(sec *Section, secPath string, offset int64, ancestors []*Section)
+	visit = func(sec *Section, secPath string, offset int64, ancestors []*Section) {
+		for _, r := range rules {
+			if r.Sections != "" && !matchPattern(sec, r.Sections) {
+				continue
+			}
+			report := func(format string, args ...interface{}) {
+				findings = append(findings, LintFinding{Rule: r.Name, Violation: Violation{
+					Severity: r.Severity,
+					Path:     secPath,
+					Section:  sec,
+					Message:  fmt.Sprintf(format, args...),
+				}})
+			}
+			if r.Align > 0 && offset%r.Align != 0 {
+				report("start 0x%x is not aligned to 0x%x", offset, r.Align)
+			}
+			if r.Align > 0 && size(sec)%r.Align != 0 {
+				report("size 0x%x is not a multiple of 0x%x", size(sec), r.Align)
+			}
+			if r.NamePattern != nil && !r.NamePattern.MatchString(sec.Name) {
+				report("name does not match %s", r.NamePattern)
+			}
+			if r.NotUnder != "" {
+				for _, a := range ancestors {
+					if matchPattern(a, r.NotUnder) {
+						report("must not be under %s", a.Name)
+						break
+					}
+				}
+			}
+		}
+		ancestors = append(ancestors, sec)
+		for idx, st := range childStarts(sec) {
+			child := sec.Sections[idx]
+			visit(child, secPath+"/"+child.Name, offset+st, ancestors)
+		}
+	}
+	visit(s, s.Name, 0, nil)
+	return findings, nil
+}
+
+// matchPattern returns true if the name or an alias of the section matches
+// the shell pattern `pattern`, which must be well-formed.
+func matchPattern(sec *Section, pattern string) bool {
+	return matchNames(sec, func(name string) bool {
+		ok, _ := path.Match(pattern, name)
+		return ok
+	})
+}
@@ -0,0 +1,55 @@
+package fmap
+
+import (
+	"regexp"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+const lintLayout = `FLASH 0x10000 {
+	WP_RO 0x8000 {
+		RO_SECTION 0x4000
+		RW_VPD 0x800
+		ro_legacy 0x3800
+	}
+	RW_SECTION_A[alias=FW_A] 0x4000
+	RW_misc@0xc800 0x3800
+}`
+
+func TestLint(t *testing.T) {
+	f, err := ParseString(lintLayout)
+	require.NoError(t, err)
+
+	findings, err := f.Lint([]LintRule{
+		{Name: "aligned", Severity: SeverityWarning, Align: 0x1000},
+		{Name: "names", NamePattern: regexp.MustCompile(`^[A-Z0-9_]+$`)},
+		{Name: "rw-not-ro", Sections: "RW_*", NotUnder: "WP_RO"},
+	})
+	require.NoError(t, err)
+	var msgs []string
+	for _, fd := range findings {
+		msgs = append(msgs, fd.Error())
+	}
+	assert.Equal(t, []string{
+		"aligned: FLASH/WP_RO/RW_VPD (4): size 0x800 is not a multiple of 0x1000",
+		"rw-not-ro: FLASH/WP_RO/RW_VPD (4): must not be under WP_RO",
+		"aligned: FLASH/WP_RO/ro_legacy (5): start 0x4800 is not aligned to 0x1000",
+		"aligned: FLASH/WP_RO/ro_legacy (5): size 0x3800 is not a multiple of 0x1000",
+		`names: FLASH/WP_RO/ro_legacy (5): name does not match ^[A-Z0-9_]+$`,
+		"aligned: FLASH/RW_misc (8): start 0xc800 is not aligned to 0x1000",
+		"aligned: FLASH/RW_misc (8): size 0x3800 is not a multiple of 0x1000",
+		`names: FLASH/RW_misc (8): name does not match ^[A-Z0-9_]+$`,
+	}, msgs)
+	assert.Equal(t, SeverityWarning, findings[0].Severity)
+	assert.Equal(t, SeverityError, findings[1].Severity)
+
+	findings, err = f.Lint([]LintRule{{Name: "aliases", Sections: "FW_*", NotUnder: "FLASH"}})
+	require.NoError(t, err)
+	require.Equal(t, 1, len(findings))
+	assert.Equal(t, "FLASH/RW_SECTION_A", findings[0].Path)
+
+	_, err = f.Lint([]LintRule{{Name: "bad", Sections: "["}})
+	assert.Error(t, err)
+}
@@ -0,0 +1,85 @@
+package fmap
+
+// ResolveOffsets computes the absolute offset of every section of the tree `s`
+// belongs to, and caches it for AbsoluteStart. Absolute offsets are relative
+// to the start of the root section, i.e. they are offsets in the flash image.
+// Implicit starts, of sections that omit "@", are filled in with the end of
+// the previous sibling.
+//
+// The cache is invalidated by the operations of this package that modify the
+// tree, but not by direct changes to the section fields, after which
+// ResolveOffsets should be called again.
+func (s *Section) ResolveOffsets() {
+	root := s.Root()
+	if root.journal == nil {
+		setJournal(root, &journal{})
+	}
+	resolveOffsets(root, 0, root.journal.steps)
+}
+
+// resolveOffsets caches the absolute offset `abs` of `s`, computed at the
+// journal step `step`, and resolves the offsets of its sub-sections.
+func resolveOffsets(s *Section, abs int64, step int) {
+	s.absStart, s.absStep, s.absValid = abs, step, true
+	starts := childStarts(s)
+	for idx, sec := range s.Sections {
+		if sec.Start == nil {
+			start := starts[idx]
+			sec.Start = &start
+		}
+		resolveOffsets(sec, abs+starts[idx], step)
+	}
+}
+
+// AbsoluteStart returns the offset of the section relative to the start of the
+// root of its tree. It uses the value cached by ResolveOffsets if still valid,
+// and otherwise computes it by walking up the parents.
+func (s *Section) AbsoluteStart() int64 {
+	if s.absValid && s.journal != nil && s.absStep == s.journal.steps {
+		return s.absStart
+	}
+	offset := int64(0)
+	for sec := s; sec.parent != nil; sec = sec.parent {
+		starts := childStarts(sec.parent)
+		for idx, sibling := range sec.parent.Sections {
+			if sibling == sec {
+				offset += starts[idx]
+				break
+			}
+		}
+	}
+	return offset
+}
+
+// FindByOffset returns the deepest section, among `s` and its sub-sections,
+// that contains the absolute offset `off`, as returned by AbsoluteStart. If
+// overlapping sibling sections contain it, the first one is returned. nil is
+// returned if `off` is outside of `s`.
+func (s *Section) FindByOffset(off int64) *Section {
+	return s.FindByRange(off, 1)
+}
+
+// FindByRange returns the deepest section, among `s` and its sub-sections,
+// that entirely contains the `length` bytes at the absolute offset `off`. nil
+// is returned if no section contains the whole range.
+func (s *Section) FindByRange(off, length int64) *Section {
+	if length < 1 {
+		length = 1
+	}
+	return findByRange(s, s.AbsoluteStart(), off, length)
+}
+
+// findByRange returns the deepest section containing the range, given the
+// absolute offset `start` of `s`.
+func findByRange(s *Section, start, off, length int64) *Section {
+	if off < start || off+length > start+size(s) {
+		return nil
+	}
+	starts := childStarts(s)
+	for idx, sec := range s.Sections {
+		if found := findByRange(sec, start+starts[idx], off, length); found != nil {
+			return found
+		}
+	}
+	return s
+}
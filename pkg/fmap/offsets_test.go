@@ -0,0 +1,85 @@
+package fmap
+
+import (
+	"os"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestResolveOffsets(t *testing.T) {
+	f, err := Parse(strings.NewReader(`FLASH@0xff000000 0x10000 {
+	RO 0x8000 {
+		FMAP 0x1000
+		COREBOOT 0x7000
+	}
+	RW@0xc000 0x4000 {
+		VPD 0x1000
+		NVRAM 0x3000
+	}
+}`))
+	require.NoError(t, err)
+
+	nvram := f.Find("NVRAM", true)
+	require.NotNil(t, nvram)
+	assert.Nil(t, nvram.Start)
+	assert.Equal(t, int64(0xd000), nvram.AbsoluteStart())
+
+	f.ResolveOffsets()
+	require.NotNil(t, nvram.Start)
+	assert.Equal(t, int64(0x1000), *nvram.Start)
+	assert.Equal(t, int64(0xd000), nvram.AbsoluteStart())
+	assert.Equal(t, int64(0x1000), f.Find("COREBOOT", true).AbsoluteStart())
+	assert.Equal(t, int64(0), f.AbsoluteStart())
+	assert.Equal(t, "FLASH@0xff000000 0x10000 {\n\tRO@0x0 0x8000 {\n\t\tFMAP@0x0 0x1000\n\t\tCOREBOOT@0x1000 0x7000\n\t}\n\tRW@0xc000 0x4000 {\n\t\tVPD@0x0 0x1000\n\t\tNVRAM@0x1000 0x3000\n\t}\n}\n", f.ToFlashmap())
+}
+
+func TestResolveOffsetsInvalidation(t *testing.T) {
+	fd, err := os.Open("test_data/chromeos.fmd")
+	require.NoError(t, err)
+	defer fd.Close()
+	f, err := Parse(fd)
+	require.NoError(t, err)
+
+	misc := f.Find("RW_MISC", true)
+	f.ResolveOffsets()
+	assert.Equal(t, int64(0x9d0000), misc.AbsoluteStart())
+	require.True(t, f.Remove("RW_SECTION_B", true))
+	require.NotEmpty(t, f.Defrag(false))
+	assert.Equal(t, int64(0x5e8000), misc.AbsoluteStart())
+}
+
+func TestFindByOffset(t *testing.T) {
+	fd, err := os.Open("test_data/chromeos.fmd")
+	require.NoError(t, err)
+	defer fd.Close()
+	f, err := Parse(fd)
+	require.NoError(t, err)
+
+	assert.Equal(t, "RW_FWID_A", f.FindByOffset(0x5e7fc0).Name)
+	assert.Equal(t, "FW_MAIN_A", f.FindByOffset(0x5e7fbf).Name)
+	assert.Equal(t, "SI_DESC", f.FindByOffset(0).Name)
+	assert.Equal(t, f, f.FindByOffset(0).Root())
+	assert.Nil(t, f.FindByOffset(0x1000000))
+	assert.Nil(t, f.FindByOffset(-1))
+
+	bios := f.Find("SI_BIOS", false)
+	assert.Nil(t, bios.FindByOffset(0))
+	assert.Equal(t, "VBLOCK_A", bios.FindByOffset(0x200000).Name)
+}
+
+func TestFindByRange(t *testing.T) {
+	fd, err := os.Open("test_data/chromeos.fmd")
+	require.NoError(t, err)
+	defer fd.Close()
+	f, err := Parse(fd)
+	require.NoError(t, err)
+
+	assert.Equal(t, "VBLOCK_A", f.FindByRange(0x200000, 0x10000).Name)
+	assert.Equal(t, "RW_SECTION_A", f.FindByRange(0x200000, 0x10001).Name)
+	assert.Equal(t, "SI_BIOS", f.FindByRange(0x200000, 0x3e8001).Name)
+	assert.Equal(t, f, f.FindByRange(0, 0x1000000))
+	assert.Nil(t, f.FindByRange(0, 0x1000001))
+}
@@ -0,0 +1,197 @@
+package fmap
+
+import "fmt"
+
+// AttrOverlay is the attribute key that controls how a section of an overlay
+// is applied to the base layout. See Overlay.
+const AttrOverlay = "overlay"
+
+// Overlay modes, used as values of the "overlay" attribute.
+const (
+	// OverlayMerge updates the matching base section with the size, start,
+	// flags and attributes of the overlay section, and applies the
+	// overlay sub-sections to its sub-sections. This is the default.
+	OverlayMerge = "merge"
+	// OverlayReplace replaces the matching base section, and its whole
+	// sub-tree, with the overlay section.
+	OverlayReplace = "replace"
+	// OverlayRemove removes the matching base section.
+	OverlayRemove = "remove"
+)
+
+// overlayCopy returns a copy of an overlay section tree to be inserted in the
+// base layout, without the overlay attributes.
+func overlayCopy(s *Section) *Section {
+	c := clone(s, nil)
+	stripOverlay(c)
+	return c
+}
+
+// stripOverlay removes the overlay attributes from a section tree.
+func stripOverlay(s *Section) {
+	var attrs []*Attribute
+	for _, a := range s.Attributes {
+		if a.Key != AttrOverlay {
+			attrs = append(attrs, a)
+		}
+	}
+	s.Attributes = attrs
+	for _, sec := range s.Sections {
+		stripOverlay(sec)
+	}
+}
+
+// Overlay applies an overlay layout onto `s`, so that board variants can be
+// expressed as small differences from a base layout. The overlay root must
+// have the same name as `s`. Overlay sections are matched by name against the
+// sub-sections of the corresponding base section, and applied according to
+// their "overlay" attribute (OverlayMerge if omitted, OverlayReplace or
+// OverlayRemove). Overlay sections without a match are appended to the
+// sub-sections of the corresponding base section. The overlay tree is not
+// modified. Nothing is changed if the overlay cannot be applied, e.g. if it
+// removes a section that does not exist, or if it would modify protected
+// read-only sections, see ProtectReadOnly.
+func (s *Section) Overlay(override *Section) error {
+	if override.Name != s.Name {
+		return fmt.Errorf("cannot overlay %s onto %s: root names differ", override.Name, s.Name)
+	}
+	op := "Overlay(" + override.Name + ")"
+	if err := checkOverlay(s, override, op, false); err != nil {
+		return err
+	}
+	t := s.record(op)
+	if err := overlay(s, override, t); err != nil {
+		return err
+	}
+	setJournal(s, s.journal)
+	link(s)
+	return nil
+}
+
+// checkOverlay returns an error if merging the overlay section `over` into the
+// base section `base` would fail, or would modify a protected section. It
+// follows the changes overlay makes to the sub-sections, so that nothing is
+// changed if the overlay cannot be applied. If `copied` is set, `base` is the
+// overlay section that a section of the base layout is a copy of.
+func checkOverlay(base, over *Section, op string, copied bool) error {
+	if !copied {
+		if err := checkWritable(base, op); err != nil {
+			return err
+		}
+	}
+	// the sub-sections of base as changed by the overlay so far
+	type entry struct {
+		sec    *Section
+		copied bool
+	}
+	secs := make([]entry, len(base.Sections))
+	for idx, sec := range base.Sections {
+		secs[idx] = entry{sec, copied}
+	}
+	for _, oc := range over.Sections {
+		idx := -1
+		for i, e := range secs {
+			if e.sec.Name == oc.Name {
+				idx = i
+				break
+			}
+		}
+		mode, ok := oc.Attribute(AttrOverlay)
+		if !ok {
+			mode = OverlayMerge
+		}
+		switch mode {
+		case OverlayMerge, OverlayReplace:
+			if idx < 0 {
+				secs = append(secs, entry{oc, true})
+				continue
+			}
+			if mode == OverlayMerge {
+				if err := checkOverlay(secs[idx].sec, oc, op, secs[idx].copied); err != nil {
+					return err
+				}
+				continue
+			}
+			if !secs[idx].copied {
+				if err := checkWritable(secs[idx].sec, op); err != nil {
+					return err
+				}
+			}
+			secs[idx] = entry{oc, true}
+		case OverlayRemove:
+			if idx < 0 {
+				return sectionErrorf(oc, "cannot remove section %s from %s: %v", oc.Name, base.Name, ErrSectionNotFound)
+			}
+			if !secs[idx].copied {
+				if err := checkWritable(secs[idx].sec, op); err != nil {
+					return err
+				}
+			}
+			secs = append(secs[:idx], secs[idx+1:]...)
+		default:
+			return sectionErrorf(oc, "unknown overlay mode %q", mode)
+		}
+	}
+	return nil
+}
+
+// overlay merges the overlay section `over` into the base section `base`.
+func overlay(base, over *Section, t Transform) error {
+	base.Size, base.Unit, base.SizeExpr, base.Fill = over.Size, over.Unit, over.SizeExpr, false
+	if over.Start != nil {
+		start := *over.Start
+		base.Start = &start
+	}
+	if len(over.Flags) > 0 {
+		base.Flags = append(Flags(nil), over.Flags...)
+	}
+	for _, a := range over.Attributes {
+		if a.Key == AttrOverlay {
+			continue
+		}
+		var attrs []*Attribute
+		for _, b := range base.Attributes {
+			if b.Key != a.Key {
+				attrs = append(attrs, b)
+			}
+		}
+		base.Attributes = append(attrs, &Attribute{Key: a.Key, Value: a.Value})
+	}
+	base.touch(t)
+
+	for _, oc := range over.Sections {
+		idx := -1
+		for i, bc := range base.Sections {
+			if bc.Name == oc.Name {
+				idx = i
+				break
+			}
+		}
+		mode, ok := oc.Attribute(AttrOverlay)
+		if !ok {
+			mode = OverlayMerge
+		}
+		switch mode {
+		case OverlayMerge:
+			if idx < 0 {
+				base.Sections = append(base.Sections, overlayCopy(oc))
+			} else if err := overlay(base.Sections[idx], oc, t); err != nil {
+				return err
+			}
+		case OverlayReplace:
+			if idx < 0 {
+				base.Sections = append(base.Sections, overlayCopy(oc))
+			} else {
+				base.Sections[idx] = overlayCopy(oc)
+			}
+		case OverlayRemove:
+			if idx < 0 {
+				return sectionErrorf(oc, "cannot remove section %s from %s: %v", oc.Name, base.Name, ErrSectionNotFound)
+			}
+			base.Sections = append(base.Sections[:idx], base.Sections[idx+1:]...)
+		default:
+			return sectionErrorf(oc, "unknown overlay mode %q", mode)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,94 @@
+package fmap
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+const overlayBase = `FLASH 0x10000 {
+	RO 0x8000 {
+		FMAP 0x1000
+		COREBOOT(CBFS)[owner=fw] 0x7000
+	}
+	RW_A 0x4000 {
+		VBLOCK_A 0x1000
+		FW_MAIN_A 0x3000
+	}
+	RW_B 0x4000
+}`
+
+func TestOverlay(t *testing.T) {
+	base, err := Parse(strings.NewReader(overlayBase))
+	require.NoError(t, err)
+	override, err := Parse(strings.NewReader(`FLASH 0x20000 {
+	RO 0x10000 {
+		COREBOOT[owner=platform] 0xf000
+	}
+	RW_A[overlay=replace] 0x8000 {
+		FW_MAIN_A 0x8000
+	}
+	RW_B[overlay=remove] 0
+	RW_LEGACY(CBFS) 0x8000
+}`))
+	require.NoError(t, err)
+	want := override.ToFlashmap()
+
+	require.NoError(t, base.Overlay(override))
+	assert.Equal(t, `FLASH 0x20000 {
+	RO 0x10000 {
+		FMAP 0x1000
+		COREBOOT(CBFS)[owner=platform] 0xf000
+	}
+	RW_A 0x8000 {
+		FW_MAIN_A 0x8000
+	}
+	RW_LEGACY(CBFS) 0x8000
+}
+`, base.ToFlashmap())
+	// the overlay is left untouched
+	assert.Equal(t, want, override.ToFlashmap())
+	assert.Equal(t, []Transform{{Op: "Overlay(FLASH)", Step: 1}}, base.Find("COREBOOT", true).Provenance())
+}
+
+func TestOverlayErrors(t *testing.T) {
+	base, err := Parse(strings.NewReader(overlayBase))
+	require.NoError(t, err)
+
+	override, err := Parse(strings.NewReader(`OTHER 0x10000`))
+	require.NoError(t, err)
+	assert.Error(t, base.Overlay(override))
+
+	override, err = Parse(strings.NewReader(`FLASH 0x10000 { RW_C[overlay=remove] 0 }`))
+	require.NoError(t, err)
+	assert.Error(t, base.Overlay(override))
+
+	override, err = Parse(strings.NewReader(`FLASH 0x10000 { RW_B[overlay=squash] 0 }`))
+	require.NoError(t, err)
+	err = base.Overlay(override)
+	require.Error(t, err)
+	assert.Equal(t, `section RW_B (1): unknown overlay mode "squash"`, err.Error())
+}
+
+func TestOverlayErrorsUnchanged(t *testing.T) {
+	base, err := Parse(strings.NewReader(overlayBase))
+	require.NoError(t, err)
+	want := base.ToFlashmap()
+
+	// the errors are found before anything is changed, after valid changes
+	// of the base sections or their sub-sections, and in the sub-sections
+	// of the added ones
+	for _, layout := range []string{
+		"FLASH 0x10000 {\n\tRO 0x9000\n\tRW_B 0x2000\n\tRW_C[overlay=remove] 0\n}",
+		"FLASH 0x10000 {\n\tRW_A 0x4000 {\n\t\tFW_MAIN_A[overlay=remove] 0\n\t\tVBLOCK_A[overlay=squash] 0\n\t}\n}",
+		"FLASH 0x10000 {\n\tRW_B[overlay=remove] 0\n\tRW_B[overlay=remove] 0\n}",
+		"FLASH 0x10000 {\n\tRW_C 0x1000\n\tRW_C 0x1000 {\n\t\tX[overlay=remove] 0\n\t}\n}",
+	} {
+		override, err := Parse(strings.NewReader(layout))
+		require.NoError(t, err)
+		assert.Error(t, base.Overlay(override), layout)
+		assert.Equal(t, want, base.ToFlashmap(), layout)
+	}
+}
@@ -0,0 +1,92 @@
+package fmap
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// Owners returns the owners of the section, declared with the "owner"
+// attribute, or the ones of its closest ancestor that declares any, like
+// CODEOWNERS files, where the most specific match wins. It returns nil if
+// neither the section nor its ancestors have owners.
+func (s *Section) Owners() []string {
+	for sec := s; sec != nil; sec = sec.parent {
+		if owners := sec.AttributeValues(AttrOwner); len(owners) > 0 {
+			return owners
+		}
+	}
+	return nil
+}
+
+// Approval lists the changed sections that an owner must approve, see
+// Approvals.
+type Approval struct {
+	Owner string   `json:"owner"`
+	Paths []string `json:"paths"`
+}
+
+// String returns the owner followed by the paths, e.g.
+// "firmware-team: FLASH/RW_SECTION_A, FLASH/RW_SECTION_B".
+func (a Approval) String() string {
+	return fmt.Sprintf("%s: %s", a.Owner, strings.Join(a.Paths, ", "))
+}
+
+// Approvals returns the owners, see Owners, that must approve changes to the
+// sections `paths`, given in the format of Change.Path, e.g. the paths of the
+// changes returned by Diff. A section that is not in the tree rooted at `s`,
+// e.g. one added by the change, is owned by the owners of its closest
+// ancestor in the tree. Any of the owners of a section can approve the
+// changes to it, like in CODEOWNERS files. The approvals are sorted by owner,
+// and the paths without owners are returned separately, in their order.
+func (s *Section) Approvals(paths []string) (approvals []Approval, unowned []string) {
+	byPath := make(map[string]*Section)
+	for _, fs := range flatten(s) {
+		if _, ok := byPath[fs.Path]; !ok {
+			byPath[fs.Path] = fs.Section
+		}
+	}
+	byOwner := make(map[string][]string)
+	seen := make(map[string]bool)
+	for _, path := range paths {
+		if seen[path] {
+			continue
+		}
+		seen[path] = true
+		var owners []string
+		for p := path; p != ""; {
+			if sec, ok := byPath[p]; ok {
+				owners = sec.Owners()
+				break
+			}
+			i := strings.LastIndex(p, "/")
+			if i < 0 {
+				break
+			}
+			p = p[:i]
+		}
+		if len(owners) == 0 {
+			unowned = append(unowned, path)
+			continue
+		}
+		for _, owner := range owners {
+			byOwner[owner] = append(byOwner[owner], path)
+		}
+	}
+	for owner, paths := range byOwner {
+		approvals = append(approvals, Approval{Owner: owner, Paths: paths})
+	}
+	sort.Slice(approvals, func(i, j int) bool {
+		return approvals[i].Owner < approvals[j].Owner
+	})
+	return approvals, unowned
+}
+
+// ChangedPaths returns the paths of the changes, in their order.
+func ChangedPaths(changes []Change) []string {
+	paths := make([]string, 0, len(changes))
+	for _, c := range changes {
+		paths = append(paths, c.Path)
+	}
+	return paths
+}
@@ -0,0 +1,64 @@
+package fmap
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+const ownedLayout = `FLASH[owner=platform] 0x10000 {
+	WP_RO[owner=security owner="fw-leads"] 0x8000 {
+		FMAP 0x1000
+		GBB[owner=gbb_team] 0x7000
+	}
+	RW_A 0x4000
+	RW_B 0x4000
+}`
+
+func TestOwners(t *testing.T) {
+	f, err := Parse(strings.NewReader(ownedLayout))
+	require.NoError(t, err)
+	assert.Equal(t, []string{"platform"}, f.Owners())
+	assert.Equal(t, []string{"security", "fw-leads"}, f.Find("FMAP", true).Owners())
+	assert.Equal(t, []string{"gbb_team"}, f.Find("GBB", true).Owners())
+	assert.Equal(t, []string{"platform"}, f.Find("RW_B", true).Owners())
+	assert.Nil(t, (&Section{Name: "X"}).Owners())
+}
+
+func TestApprovals(t *testing.T) {
+	old, err := Parse(strings.NewReader(ownedLayout))
+	require.NoError(t, err)
+	updated, err := Parse(strings.NewReader(`FLASH[owner=platform] 0x10000 {
+	WP_RO[owner=security owner="fw-leads"] 0x8000 {
+		FMAP 0x1000
+		GBB 0x6000
+		RO_VPD 0x1000
+	}
+	RW_A 0x8000
+}`))
+	require.NoError(t, err)
+
+	paths := ChangedPaths(Diff(old, updated))
+	approvals, unowned := old.Approvals(paths)
+	assert.Empty(t, unowned)
+	var got []string
+	for _, a := range approvals {
+		got = append(got, a.String())
+	}
+	assert.Equal(t, []string{
+		"fw-leads: FLASH/WP_RO/RO_VPD",
+		"gbb_team: FLASH/WP_RO/GBB",
+		"platform: FLASH/RW_A, FLASH/RW_B",
+		"security: FLASH/WP_RO/RO_VPD",
+	}, got)
+
+	plain, err := Parse(strings.NewReader(`FLASH 0x1000 {
+	A 0x1000
+}`))
+	require.NoError(t, err)
+	approvals, unowned = plain.Approvals([]string{"FLASH/A", "FLASH/A/NEW", "FLASH/A"})
+	assert.Empty(t, approvals)
+	assert.Equal(t, []string{"FLASH/A", "FLASH/A/NEW"}, unowned)
+}
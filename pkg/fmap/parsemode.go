@@ -0,0 +1,90 @@
+package fmap
+
+import "fmt"
+
+// ParseMode is the tolerance of ParseWithOptions for layouts that are
+// well-formed but dubious: duplicate section names, overlapping sub-sections
+// and an omitted root size.
+type ParseMode int
+
+// Parse modes.
+const (
+	// ParseDefault accepts duplicate names and overlapping sub-sections, see
+	// Validate, and rejects an omitted root size.
+	ParseDefault ParseMode = iota
+	// ParseStrict rejects duplicate names anywhere in the tree, and
+	// overlapping sub-sections, in addition to an omitted root size.
+	ParseStrict
+	// ParseLenient accepts all of them, and records them as warnings, see
+	// ParseWarnings. An omitted root size is taken to be the end of the last
+	// sub-section.
+	ParseLenient
+)
+
+// String returns the name of the mode.
+func (m ParseMode) String() string {
+	switch m {
+	case ParseDefault:
+		return "default"
+	case ParseStrict:
+		return "strict"
+	case ParseLenient:
+		return "lenient"
+	default:
+		return fmt.Sprintf("ParseMode(%d)", int(m))
+	}
+}
+
+// ParseWarnings returns the problems tolerated when parsing the flashmap in
+// lenient mode, see ParseLenient, as warnings. It is nil for flashmaps parsed
+// in the other modes, or built programmatically.
+func (s *Section) ParseWarnings() []Violation {
+	return s.parseWarnings
+}
+
+// inferRootSize sets the omitted size of the root section `s` to the end of
+// its last sub-section, and returns the corresponding warning. It does nothing
+// if the size is not omitted.
+func inferRootSize(s *Section) []Violation {
+	if !s.Fill {
+		return nil
+	}
+	var end int64
+	for idx, st := range childStarts(s) {
+		if e := st + size(s.Sections[idx]); e > end {
+			end = e
+		}
+	}
+	s.Size, s.Unit, s.Fill = end, "", false
+	return []Violation{{
+		Severity: SeverityWarning,
+		Path:     s.Name,
+		Section:  s,
+		Message:  fmt.Sprintf("size omitted on the root section, set to the end of its last sub-section, 0x%x", end),
+	}}
+}
+
+// checkParseMode checks the tree `s` for the duplicate names and the
+// overlapping sub-sections rejected in strict mode, and returns them as
+// warnings, or as an error in strict mode.
+func checkParseMode(s *Section, mode ParseMode) ([]Violation, error) {
+	var problems []Violation
+	seen := make(map[string]string)
+	for _, fs := range flatten(s) {
+		if first, ok := seen[fs.Section.Name]; ok {
+			problems = append(problems, Violation{Path: fs.Path, Section: fs.Section, Message: "duplicate section name, also used by " + first})
+		} else {
+			seen[fs.Section.Name] = fs.Path
+		}
+		for _, o := range overlaps(fs.Section) {
+			problems = append(problems, Violation{Path: fs.Path + "/" + o.sec.Name, Section: o.sec, Message: o.String()})
+		}
+	}
+	if len(problems) > 0 && mode == ParseStrict {
+		return nil, sectionErrorf(problems[0].Section, "%s", problems[0].Message)
+	}
+	for idx := range problems {
+		problems[idx].Severity = SeverityWarning
+	}
+	return problems, nil
+}
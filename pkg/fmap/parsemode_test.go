@@ -0,0 +1,67 @@
+package fmap
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+const dubiousLayout = `FLASH 0x4000 {
+	A 0x2000 {
+		B 0x1000
+	}
+	B@0x1000 0x2000
+	C 0x1000
+}`
+
+func parseMode(input string, mode ParseMode) (*Section, error) {
+	return ParseWithOptions(strings.NewReader(input), ParseOptions{Mode: mode})
+}
+
+func TestParseModeDefault(t *testing.T) {
+	f, err := parseMode(dubiousLayout, ParseDefault)
+	require.NoError(t, err)
+	assert.Nil(t, f.ParseWarnings())
+
+	_, err = parseMode("FLASH {\n\tA 0x100\n}", ParseDefault)
+	assert.EqualError(t, err, "section FLASH (1-3): size omitted on the root section")
+}
+
+func TestParseModeStrict(t *testing.T) {
+	_, err := parseMode(dubiousLayout, ParseStrict)
+	assert.EqualError(t, err, "section B (5): overlaps with A at 0x1000-0x2000")
+	_, err = parseMode(`FLASH 0x4000 {
+	A 0x2000
+	B@0x1000 0x2000
+}`, ParseStrict)
+	assert.EqualError(t, err, "section B (3): overlaps with A at 0x1000-0x2000")
+	_, err = parseMode("FLASH {\n\tA 0x100\n}", ParseStrict)
+	assert.Error(t, err)
+
+	// markers don't overlap
+	_, err = parseMode("FLASH 0x2000 {\n\tA 0x2000\n\tMARK@0x1000 0\n}", ParseStrict)
+	assert.NoError(t, err)
+}
+
+func TestParseModeLenient(t *testing.T) {
+	f, err := parseMode(dubiousLayout, ParseLenient)
+	require.NoError(t, err)
+	var msgs []string
+	for _, w := range f.ParseWarnings() {
+		assert.Equal(t, SeverityWarning, w.Severity)
+		msgs = append(msgs, w.Path+": "+w.Message)
+	}
+	assert.Equal(t, []string{
+		"FLASH/B: overlaps with A at 0x1000-0x2000",
+		"FLASH/B: duplicate section name, also used by FLASH/A/B",
+	}, msgs)
+
+	f, err = parseMode("FLASH {\n\tA 0x100\n\tB@0x800 0x100\n}", ParseLenient)
+	require.NoError(t, err)
+	assert.Equal(t, int64(0x900), f.ByteSize())
+	require.Len(t, f.ParseWarnings(), 1)
+	assert.Equal(t, "size omitted on the root section, set to the end of its last sub-section, 0x900", f.ParseWarnings()[0].Message)
+	assert.Equal(t, "FLASH 0x900 {\n\tA 0x100\n\tB@0x800 0x100\n}\n", f.ToFlashmap())
+}
@@ -0,0 +1,94 @@
+package fmap
+
+import (
+	"errors"
+	"strconv"
+)
+
+// ErrReadOnly is matched, via errors.Is, by the errors returned when an
+// operation would modify a read-only section of a protected tree, see
+// ProtectReadOnly.
+var ErrReadOnly = errors.New("section is read-only")
+
+// WriteProtectedSection is the name of the section covering the range of the
+// flash that is write-protected in the field.
+const WriteProtectedSection = "WP_RO"
+
+// IsReadOnly returns true if the section is immutable in the field: if it is
+// the WP_RO section or one of its sub-sections, or if it or one of its
+// ancestors has a true "readonly" attribute, e.g. `RO_VPD[readonly=true]`.
+func (s *Section) IsReadOnly() bool {
+	for sec := s; sec != nil; sec = sec.parent {
+		if sec.Name == WriteProtectedSection {
+			return true
+		}
+		if v, ok := sec.Attribute(AttrReadOnly); ok {
+			if ro, err := strconv.ParseBool(v); err == nil && ro {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// ProtectReadOnly enables or disables the protection of the read-only
+// sections, see IsReadOnly, of the tree `s` belongs to. When enabled, the
+// operations of this package that would modify a read-only section fail with
+// an error matching ErrReadOnly, and Defrag leaves read-only sections in
+// place. The protection is disabled by default.
+func (s *Section) ProtectReadOnly(protect bool) {
+	s.Root().protectRO = protect
+}
+
+// isProtected returns true if the section is read-only and protected.
+func (s *Section) isProtected() bool {
+	return s.Root().protectRO && s.IsReadOnly()
+}
+
+// checkWritable returns an error matching ErrReadOnly if the section is
+// protected, mentioning the operation `op` that would modify it.
+func checkWritable(sec *Section, op string) error {
+	if sec.isProtected() {
+		return sectionErrorf(sec, "%s would modify it: %w", op, ErrReadOnly)
+	}
+	return nil
+}
+
+// pinProtected makes the implicit starts of the protected sections of the tree
+// `s` explicit, at their current starts, so that they stay in place when the
+// sections before them are moved or resized, and returns them. See
+// unpinProtected.
+func pinProtected(s *Section) []*Section {
+	var pinned []*Section
+	for _, parent := range append([]*Section{s}, descendants(s)...) {
+		for idx, start := range childStarts(parent) {
+			if sec := parent.Sections[idx]; sec.Start == nil && sec.isProtected() {
+				start := start
+				sec.Start = &start
+				pinned = append(pinned, sec)
+			}
+		}
+	}
+	return pinned
+}
+
+// unpinProtected makes the starts of the sections pinned by pinProtected
+// implicit again if they still follow their previous sibling.
+func unpinProtected(pinned []*Section) {
+	for _, sec := range pinned {
+		if sec.parent == nil {
+			continue
+		}
+		implicit := int64(0)
+		starts := childStarts(sec.parent)
+		for idx, sibling := range sec.parent.Sections {
+			if sibling == sec {
+				if *sec.Start == implicit {
+					sec.Start = nil
+				}
+				break
+			}
+			implicit = starts[idx] + size(sibling)
+		}
+	}
+}
@@ -0,0 +1,124 @@
+package fmap
+
+import (
+	"errors"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+const protectLayout = `FLASH 0x10000 {
+	RW@0x0 0x4000 {
+		FW_MAIN@0x0 0x2000
+		RW_VPD[readonly=true]@0x2000 0x1000
+	}
+	WP_RO@0x8000 0x8000 {
+		FMAP@0x0 0x1000
+		COREBOOT@0x1000 0x2000
+	}
+}`
+
+func TestIsReadOnly(t *testing.T) {
+	f, err := Parse(strings.NewReader(protectLayout))
+	require.NoError(t, err)
+	assert.False(t, f.IsReadOnly())
+	assert.False(t, f.Find("FW_MAIN", true).IsReadOnly())
+	assert.True(t, f.Find("RW_VPD", true).IsReadOnly())
+	assert.True(t, f.Find("WP_RO", true).IsReadOnly())
+	assert.True(t, f.Find("COREBOOT", true).IsReadOnly())
+}
+
+func TestProtectReadOnly(t *testing.T) {
+	f, err := Parse(strings.NewReader(protectLayout))
+	require.NoError(t, err)
+	f.ProtectReadOnly(true)
+
+	_, err = f.Fit(map[string]int64{"COREBOOT": 0x1000}, FitOptions{})
+	require.True(t, errors.Is(err, ErrReadOnly))
+	assert.Equal(t, "section COREBOOT (8): Fit(COREBOOT) would modify it: section is read-only", err.Error())
+	assert.Equal(t, int64(0x2000), f.Find("COREBOOT", true).Size)
+
+	assert.False(t, f.Remove("RW_VPD", true))
+	_, err = f.Delete("FMAP", true)
+	require.True(t, errors.Is(err, ErrReadOnly))
+
+	err = f.Inject(make(memImage, 0x10000), "FMAP", []byte{0}, false)
+	require.True(t, errors.Is(err, ErrReadOnly))
+
+	over, err := Parse(strings.NewReader("FLASH 0x10000 {\n\tWP_RO 0x8000 {\n\t\tFMAP 0x800\n\t}\n}"))
+	require.NoError(t, err)
+	require.True(t, errors.Is(f.Overlay(over), ErrReadOnly))
+	assert.Equal(t, int64(0x1000), f.Find("FMAP", true).Size)
+
+	// writable sections can still be modified, and read-only ones stay in
+	// place
+	assert.True(t, f.Remove("FW_MAIN", true))
+	f.Defrag(false)
+	assert.Equal(t, `FLASH 0x10000 {
+	RW@0x0 0x4000 {
+		RW_VPD[readonly=true]@0x2000 0x1000
+	}
+	WP_RO@0x8000 0x8000 {
+		FMAP@0x0 0x1000
+		COREBOOT@0x1000 0x2000
+	}
+}
+`, f.ToFlashmap())
+
+	// unless the protection is disabled
+	f.ProtectReadOnly(false)
+	f.Defrag(false)
+	assert.Equal(t, int64(0x0), *f.Find("RW_VPD", true).Start)
+	assert.Equal(t, int64(0x4000), *f.Find("WP_RO", true).Start)
+}
+
+func TestProtectReadOnlyFit(t *testing.T) {
+	f, err := Parse(strings.NewReader(protectLayout))
+	require.NoError(t, err)
+	f.ProtectReadOnly(true)
+
+	// growing RW doesn't push WP_RO, and the overlap is reported
+	violations, err := f.Fit(map[string]int64{"RW": 0x9000}, FitOptions{})
+	require.NoError(t, err)
+	require.Equal(t, 1, len(violations))
+	assert.Equal(t, "FLASH/WP_RO", violations[0].Path)
+	assert.Equal(t, int64(0x8000), *f.Find("WP_RO", true).Start)
+}
+
+func TestProtectReadOnlyImplicitStart(t *testing.T) {
+	const layout = "FLASH 0x10000 {\n\tA@0x1000 0x1000\n\tWP_RO 0x2000\n\tB 0x1000\n}"
+	f, err := ParseString(layout)
+	require.NoError(t, err)
+	f.ProtectReadOnly(true)
+
+	// an implicit start is pinned where it resolves, and the following
+	// sections are compacted after it
+	f.Defrag(false)
+	assert.Equal(t, `FLASH 0x10000 {
+	A@0x0 0x1000
+	WP_RO@0x2000 0x2000
+	B 0x1000
+}
+`, f.ToFlashmap())
+
+	// growing a previous sibling doesn't push it, and the overlap is
+	// reported
+	f, err = ParseString(layout)
+	require.NoError(t, err)
+	f.ProtectReadOnly(true)
+	violations, err := f.Fit(map[string]int64{"A": 0x3000}, FitOptions{})
+	require.NoError(t, err)
+	require.Equal(t, 1, len(violations))
+	assert.Equal(t, "FLASH/WP_RO", violations[0].Path)
+	assert.Equal(t, int64(0x2000), *f.Find("WP_RO", true).Start)
+
+	// the start stays implicit if the section doesn't need to be pinned
+	f, err = ParseString(strings.Replace(layout, "A@0x1000", "A", 1))
+	require.NoError(t, err)
+	f.ProtectReadOnly(true)
+	_, err = f.Fit(map[string]int64{"B": 0x2000}, FitOptions{})
+	require.NoError(t, err)
+	assert.Nil(t, f.Find("WP_RO", true).Start)
+}
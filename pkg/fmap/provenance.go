@@ -0,0 +1,111 @@
+package fmap
+
+import (
+	"fmt"
+	"strings"
+)
+
+// Transform describes a programmatic change applied to a section tree, like a
+// removal or a defragmentation.
+type Transform struct {
+	// Op is the operation that was applied, e.g. "Remove(RW_SECTION_B)".
+	Op string
+	// Step is the position of the operation in the sequence of transforms
+	// applied to the tree, starting at 1.
+	Step int
+}
+
+// String returns a human-readable description of the transform.
+func (t Transform) String() string {
+	return fmt.Sprintf("%s at step %d", t.Op, t.Step)
+}
+
+// journal counts the transforms applied to a section tree, so that each one
+// gets a unique, increasing step number. Parsed trees share a single journal
+// across all of their sections.
+type journal struct {
+	steps int
+}
+
+// setJournal makes `s` and all of its sub-sections share the journal `j`.
+func setJournal(s *Section, j *journal) {
+	s.journal = j
+	for _, sec := range s.Sections {
+		setJournal(sec, j)
+	}
+}
+
+// record allocates a new transform step for the operation `op` applied to `s`.
+func (s *Section) record(op string) Transform {
+	if s.journal == nil {
+		setJournal(s, &journal{})
+	}
+	s.journal.steps++
+	return Transform{Op: op, Step: s.journal.steps}
+}
+
+// touch marks the section as modified by the transform `t`.
+func (s *Section) touch(t Transform) {
+	s.provenance = append(s.provenance, t)
+}
+
+// Provenance returns the transforms that modified the section, in the order
+// they were applied. Changes made by directly assigning to the section fields
+// are not tracked.
+func (s *Section) Provenance() []Transform {
+	return s.provenance
+}
+
+// Origin describes where the current state of a section comes from, in a form
+// suitable for error messages: its source span, if any, and the last transform
+// that modified it, if any. It returns an empty string if neither is known.
+func (s *Section) Origin() string {
+	return describeOrigin(s.span, s.provenance)
+}
+
+// describeOrigin joins a source span and the last transform of a provenance
+// list into a single description.
+func describeOrigin(sp Span, provenance []Transform) string {
+	var parts []string
+	if sp.IsValid() {
+		parts = append(parts, sp.String())
+	}
+	if len(provenance) > 0 {
+		parts = append(parts, "introduced by "+provenance[len(provenance)-1].String())
+	}
+	return strings.Join(parts, ", ")
+}
+
+// SectionError is an error related to a specific section. It carries the
+// section's source span and transform history, so that users can trace where
+// the offending state came from.
+type SectionError struct {
+	Name       string
+	Span       Span
+	Provenance []Transform
+	Err        error
+}
+
+// sectionErrorf returns a SectionError for the section `s` with a formatted
+// message.
+func sectionErrorf(s *Section, format string, args ...interface{}) *SectionError {
+	return &SectionError{
+		Name:       s.Name,
+		Span:       s.span,
+		Provenance: s.provenance,
+		Err:        fmt.Errorf(format, args...),
+	}
+}
+
+// Error implements the error interface.
+func (e *SectionError) Error() string {
+	if origin := describeOrigin(e.Span, e.Provenance); origin != "" {
+		return fmt.Sprintf("section %s (%s): %v", e.Name, origin, e.Err)
+	}
+	return fmt.Sprintf("section %s: %v", e.Name, e.Err)
+}
+
+// Unwrap returns the underlying error.
+func (e *SectionError) Unwrap() error {
+	return e.Err
+}
@@ -0,0 +1,66 @@
+package fmap
+
+import (
+	"errors"
+	"os"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestProvenance(t *testing.T) {
+	fd, err := os.Open("test_data/chromeos.fmd")
+	require.NoError(t, err)
+	defer fd.Close()
+	f, err := Parse(fd)
+	require.NoError(t, err)
+
+	bios := f.Find("SI_BIOS", false)
+	require.NotNil(t, bios)
+	assert.Empty(t, bios.Provenance())
+	assert.Equal(t, "test_data/chromeos.fmd:6-43", bios.Origin())
+
+	require.True(t, f.Remove("RW_SECTION_B", true))
+	assert.Equal(t, []Transform{{Op: "Remove(RW_SECTION_B)", Step: 1}}, bios.Provenance())
+	require.NotEmpty(t, f.Defrag(false))
+	assert.Equal(t, []Transform{{Op: "Remove(RW_SECTION_B)", Step: 1}}, bios.Provenance())
+	misc := f.Find("RW_MISC", true)
+	require.NotNil(t, misc)
+	assert.Equal(t, []Transform{{Op: "Defrag()", Step: 2}}, misc.Provenance())
+	assert.Equal(t, "test_data/chromeos.fmd:17-29, introduced by Defrag() at step 2", misc.Origin())
+
+	// operations on a sub-section share the step counter with the whole tree
+	require.True(t, bios.Remove("SMMSTORE", false))
+	assert.Equal(t, Transform{Op: "Remove(SMMSTORE)", Step: 3}, bios.Provenance()[1])
+}
+
+func TestProvenanceRemoveNotFound(t *testing.T) {
+	f, err := Parse(strings.NewReader("FLASH 4k {\n\tA 2k\n}\n"))
+	require.NoError(t, err)
+	require.False(t, f.Remove("B", false))
+	assert.Empty(t, f.Provenance())
+}
+
+func TestSectionError(t *testing.T) {
+	f, err := Parse(strings.NewReader("FLASH 0x100000 {\n\tRW@0x0 0x1000\n\tAREA_WITH_A_NAME_THAT_IS_WAY_TOO_LONG@0x2000 0x1000\n}\n"))
+	require.NoError(t, err)
+	require.NotEmpty(t, f.Defrag(false))
+	_, err = f.ToBinary()
+	require.Error(t, err)
+	var serr *SectionError
+	require.True(t, errors.As(err, &serr))
+	assert.Equal(t, "AREA_WITH_A_NAME_THAT_IS_WAY_TOO_LONG", serr.Name)
+	assert.Equal(t, 3, serr.Span.StartLine)
+	assert.Equal(t, "section AREA_WITH_A_NAME_THAT_IS_WAY_TOO_LONG (3, introduced by Defrag() at step 1): name is too long: must be at most 31 characters", err.Error())
+}
+
+func TestSectionErrorNoOrigin(t *testing.T) {
+	f := Section{Name: "FLASH", Size: 0x1000, Sections: []*Section{
+		{Name: strings.Repeat("A", 40), Size: 0x1000},
+	}}
+	_, err := f.ToBinary()
+	require.Error(t, err)
+	assert.Equal(t, "section "+strings.Repeat("A", 40)+": name is too long: must be at most 31 characters", err.Error())
+}
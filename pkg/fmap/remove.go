@@ -0,0 +1,73 @@
+package fmap
+
+import "path"
+
+// RemoveAll removes all the sub-sections of `s`, or, if `recursive` is true,
+// of its descendants too, whose name or alias matches the shell pattern
+// `pattern`, e.g. "*_B" to remove the B copies of an A/B layout. The pattern
+// syntax is the one of path.Match, so a plain name only matches itself. The
+// sub-sections of a removed section are removed with it, and are not matched.
+// It returns the number of sections removed. An error is returned if the
+// pattern is malformed, and nothing is removed if any of the matching
+// sections is protected, see ProtectReadOnly.
+func (s *Section) RemoveAll(pattern string, recursive bool) (int, error) {
+	if _, err := path.Match(pattern, ""); err != nil {
+		return 0, err
+	}
+	return s.removeFunc("RemoveAll("+pattern+")", func(sec *Section) bool {
+		return matchPattern(sec, pattern)
+	}, recursive)
+}
+
+// RemoveFunc is like RemoveAll, but removes the sections for which `f`
+// returns true.
+func (s *Section) RemoveFunc(f func(sec *Section) bool, recursive bool) (int, error) {
+	return s.removeFunc("RemoveFunc", f, recursive)
+}
+
+func (s *Section) removeFunc(op string, f func(sec *Section) bool, recursive bool) (int, error) {
+	// the parents of the matching sections, in pre-order, and their
+	// sub-sections left once the matching ones are removed
+	var parents []*Section
+	kept := make(map[*Section][]*Section)
+	var matches []*Section
+	var collect func(parent *Section)
+	collect = func(parent *Section) {
+		var left []*Section
+		found := false
+		for _, sec := range parent.Sections {
+			if f(sec) {
+				matches = append(matches, sec)
+				found = true
+				continue
+			}
+			left = append(left, sec)
+			if recursive {
+				collect(sec)
+			}
+		}
+		if found {
+			parents = append(parents, parent)
+			kept[parent] = left
+		}
+	}
+	collect(s)
+	for _, sec := range matches {
+		if err := checkWritable(sec, op); err != nil {
+			return 0, err
+		}
+	}
+	if len(matches) == 0 {
+		return 0, nil
+	}
+
+	t := s.record(op)
+	for _, parent := range parents {
+		parent.Sections = kept[parent]
+		parent.touch(t)
+	}
+	for _, sec := range matches {
+		sec.parent = nil
+	}
+	return len(matches), nil
+}
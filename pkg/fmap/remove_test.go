@@ -0,0 +1,95 @@
+package fmap
+
+import (
+	"errors"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+const abLayout = `FLASH 0x10000 {
+	RW_SECTION_A 0x4000 {
+		VBLOCK_A 0x1000
+		FW_MAIN_A 0x3000
+	}
+	RW_SECTION_B 0x4000 {
+		VBLOCK_B 0x1000
+		FW_MAIN_B 0x3000
+	}
+	RW_MISC 0x4000 {
+		RW_VPD_B 0x1000
+	}
+	WP_RO 0x4000 {
+		RO_B 0x1000
+	}
+}`
+
+func TestRemoveAll(t *testing.T) {
+	f, err := ParseString(abLayout)
+	require.NoError(t, err)
+
+	n, err := f.RemoveAll("*_B", true)
+	require.NoError(t, err)
+	assert.Equal(t, 3, n)
+	assert.Equal(t, `FLASH 0x10000 {
+	RW_SECTION_A 0x4000 {
+		VBLOCK_A 0x1000
+		FW_MAIN_A 0x3000
+	}
+	RW_MISC 0x4000
+	WP_RO 0x4000
+}
+`, f.ToFlashmap())
+	assert.Nil(t, f.FindPath("RW_SECTION_B"))
+	assert.Equal(t, []Transform{{Op: "RemoveAll(*_B)", Step: 1}}, f.Find("RW_MISC", false).Provenance())
+	assert.Equal(t, []Transform{{Op: "RemoveAll(*_B)", Step: 1}}, f.Provenance())
+
+	n, err = f.RemoveAll("VBLOCK_A", false)
+	require.NoError(t, err)
+	assert.Equal(t, 0, n)
+	n, err = f.RemoveAll("VBLOCK_A", true)
+	require.NoError(t, err)
+	assert.Equal(t, 1, n)
+
+	_, err = f.RemoveAll("[", true)
+	require.Error(t, err)
+}
+
+func TestRemoveAllProtected(t *testing.T) {
+	f, err := ParseString(abLayout)
+	require.NoError(t, err)
+	f.ProtectReadOnly(true)
+
+	_, err = f.RemoveAll("*_B", true)
+	require.True(t, errors.Is(err, ErrReadOnly))
+	assert.Equal(t, 4, len(f.Sections))
+	assert.Equal(t, 1, len(f.Find("RW_MISC", false).Sections))
+}
+
+func TestRemoveFunc(t *testing.T) {
+	f, err := ParseString(abLayout)
+	require.NoError(t, err)
+
+	var parents []string
+	n, err := f.RemoveFunc(func(sec *Section) bool {
+		parents = append(parents, sec.Parent().Name)
+		return strings.HasPrefix(sec.Name, "FW_MAIN_") || sec.Name == "WP_RO"
+	}, true)
+	require.NoError(t, err)
+	assert.Equal(t, 3, n)
+	assert.Equal(t, []string{"FLASH", "RW_SECTION_A", "RW_SECTION_A", "FLASH", "RW_SECTION_B", "RW_SECTION_B", "FLASH", "RW_MISC", "FLASH"}, parents)
+	assert.Equal(t, `FLASH 0x10000 {
+	RW_SECTION_A 0x4000 {
+		VBLOCK_A 0x1000
+	}
+	RW_SECTION_B 0x4000 {
+		VBLOCK_B 0x1000
+	}
+	RW_MISC 0x4000 {
+		RW_VPD_B 0x1000
+	}
+}
+`, f.ToFlashmap())
+}
@@ -0,0 +1,209 @@
+package fmap
+
+import (
+	"fmt"
+	"strings"
+)
+
+// ResizePolicy controls how Resize adjusts the sections around the resized
+// one. Policies can be combined with |, except ResizeGrowAncestors and
+// ResizeShrinkSibling.
+type ResizePolicy int
+
+// Resize policies. With none of them, only the section is resized, and its
+// following siblings are pushed forward if it grows.
+const (
+	// ResizeGrowAncestors resizes the ancestors of the section by the same
+	// amount, except the root, whose size is the size of the flash.
+	ResizeGrowAncestors ResizePolicy = 1 << iota
+	// ResizeShrinkSibling makes the following sibling of the section give or
+	// take the space: it keeps its end, and starts at the new end of the
+	// section. The sibling must not have sub-sections.
+	ResizeShrinkSibling
+	// ResizeScaleDescendants scales the starts and the sizes of the
+	// descendants of the section in proportion to its new size.
+	ResizeScaleDescendants
+)
+
+// String returns the names of the policies, separated by "|".
+func (p ResizePolicy) String() string {
+	var names []string
+	for _, v := range []struct {
+		policy ResizePolicy
+		name   string
+	}{
+		{ResizeGrowAncestors, "GrowAncestors"},
+		{ResizeShrinkSibling, "ShrinkSibling"},
+		{ResizeScaleDescendants, "ScaleDescendants"},
+	} {
+		if p&v.policy != 0 {
+			names = append(names, v.name)
+		}
+	}
+	if len(names) == 0 {
+		return "None"
+	}
+	return strings.Join(names, "|")
+}
+
+// setSize sets the size of the section to `n` bytes, keeping its unit if `n`
+// is a multiple of it.
+func setSize(sec *Section, n int64) {
+	if mult := unitSize(sec.Unit); n%mult == 0 {
+		sec.Size = n / mult
+	} else {
+		sec.Size, sec.Unit = n, ""
+	}
+	sec.Fill = false
+}
+
+// nextSibling returns the start of `s` relative to its parent, the sibling
+// of `s` that follows it in order of start, and its start, or nil if `s` is
+// the last one.
+func nextSibling(s *Section) (int64, *Section, int64) {
+	if s.parent == nil {
+		return 0, nil, 0
+	}
+	secs, starts := sortedChildren(s.parent)
+	for idx, sec := range secs {
+		if sec != s {
+			continue
+		}
+		if idx+1 < len(secs) {
+			return starts[idx], secs[idx+1], starts[idx+1]
+		}
+		return starts[idx], nil, 0
+	}
+	return 0, nil, 0
+}
+
+// descendants returns the sub-sections of `s`, at any depth, in pre-order.
+func descendants(s *Section) []*Section {
+	var ret []*Section
+	for _, sec := range s.Sections {
+		ret = append(ret, sec)
+		ret = append(ret, descendants(sec)...)
+	}
+	return ret
+}
+
+// scaled is the new start, if any, and size of a section scaled by Resize.
+type scaled struct {
+	sec   *Section
+	start *int64
+	size  int64
+}
+
+// scaleSection returns the start and the size of `s` multiplied by num/den.
+func scaleSection(s *Section, num, den int64) (scaled, error) {
+	ret := scaled{sec: s}
+	if s.Start != nil {
+		v, err := mulInt64(*s.Start, num)
+		if err != nil {
+			return ret, sectionErrorf(s, "cannot scale the start 0x%x: %v", *s.Start, err)
+		}
+		start := v / den
+		ret.start = &start
+	}
+	v, err := mulInt64(size(s), num)
+	if err != nil {
+		return ret, sectionErrorf(s, "cannot scale the size 0x%x: %v", size(s), err)
+	}
+	ret.size = v / den
+	return ret, nil
+}
+
+// Resize sets the size of the section to `newSize` bytes, and adjusts the
+// sections around it according to `policy`. The siblings following a grown
+// section are pushed forward, at every level. Protected read-only sections
+// cannot be adjusted, see ProtectReadOnly. It returns the violations of the
+// resulting layout, see Validate, and an error, without changing anything, if
+// the policy cannot be applied.
+func (s *Section) Resize(newSize int64, policy ResizePolicy) ([]Violation, error) {
+	if newSize < 0 {
+		return nil, sectionErrorf(s, "invalid size %d", newSize)
+	}
+	if policy&ResizeGrowAncestors != 0 && policy&ResizeShrinkSibling != 0 {
+		return nil, sectionErrorf(s, "conflicting resize policy %s", policy)
+	}
+	oldSize := size(s)
+	delta := newSize - oldSize
+	op := fmt.Sprintf("Resize(%s, 0x%x, %s)", s.Name, newSize, policy)
+
+	// collect the sections to change, to check them before changing any
+	affected := []*Section{s}
+	var ancestors []*Section
+	if policy&ResizeGrowAncestors != 0 {
+		for sec := s.parent; sec != nil && sec.parent != nil; sec = sec.parent {
+			ancestors = append(ancestors, sec)
+		}
+		affected = append(affected, ancestors...)
+	}
+	// the sibling keeps its end, and starts at siblingStart
+	var sibling *Section
+	start, siblingStart, siblingEnd := int64(0), int64(0), int64(0)
+	if policy&ResizeShrinkSibling != 0 {
+		if start, sibling, siblingStart = nextSibling(s); sibling == nil {
+			return nil, sectionErrorf(s, "no following sibling to take the space")
+		}
+		if len(sibling.Sections) > 0 {
+			return nil, sectionErrorf(sibling, "cannot shrink a section with sub-sections")
+		}
+		// the sibling gives or takes the space only if it is adjacent to
+		// the section, or would overlap with it
+		siblingEnd = siblingStart + size(sibling)
+		if siblingStart == start+oldSize || siblingStart < start+newSize {
+			if siblingEnd < start+newSize {
+				return nil, sectionErrorf(sibling, "only 0x%x bytes left to give to %s", size(sibling), s.Name)
+			}
+			siblingStart = start + newSize
+			affected = append(affected, sibling)
+		} else {
+			sibling = nil
+		}
+	}
+	var scaledSections []scaled
+	if policy&ResizeScaleDescendants != 0 {
+		if oldSize == 0 {
+			return nil, sectionErrorf(s, "cannot scale the sub-sections of an empty section")
+		}
+		for _, sec := range descendants(s) {
+			sc, err := scaleSection(sec, newSize, oldSize)
+			if err != nil {
+				return nil, err
+			}
+			scaledSections = append(scaledSections, sc)
+			affected = append(affected, sec)
+		}
+	}
+	for _, sec := range affected {
+		if err := checkWritable(sec, op); err != nil {
+			return nil, err
+		}
+	}
+
+	root := s.Root()
+	pinned := pinProtected(root)
+	t := s.record(op)
+	for _, sc := range scaledSections {
+		if sc.start != nil {
+			sc.sec.Start = sc.start
+		}
+		setSize(sc.sec, sc.size)
+		sc.sec.touch(t)
+	}
+	setSize(s, newSize)
+	s.touch(t)
+	for _, sec := range ancestors {
+		setSize(sec, size(sec)+delta)
+		sec.touch(t)
+	}
+	if sibling != nil {
+		setSize(sibling, siblingEnd-siblingStart)
+		sibling.Start = &siblingStart
+		sibling.touch(t)
+	}
+	pushForward(root, t)
+	unpinProtected(pinned)
+	return root.Validate(), nil
+}
@@ -0,0 +1,103 @@
+package fmap
+
+import (
+	"errors"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+const resizeLayout = `FLASH 0x10000 {
+	RW@0x0 0x8000 {
+		FW_MAIN@0x0 0x4000 {
+			CBFS@0x0 0x3000
+			FWID@0x3000 0x1000
+		}
+		NVRAM@0x4000 0x2000
+	}
+	RO@0x8000 0x8000
+}`
+
+func TestResize(t *testing.T) {
+	f, err := Parse(strings.NewReader(resizeLayout))
+	require.NoError(t, err)
+
+	// the following sibling is pushed forward
+	violations, err := f.Find("FW_MAIN", true).Resize(0x5000, 0)
+	require.NoError(t, err)
+	assert.Empty(t, violations)
+	assert.Equal(t, int64(0x5000), *f.Find("NVRAM", true).Start)
+	assert.Equal(t, "Resize(FW_MAIN, 0x5000, None)", f.Find("NVRAM", true).Provenance()[0].Op)
+}
+
+func TestResizeGrowAncestors(t *testing.T) {
+	f, err := Parse(strings.NewReader(resizeLayout))
+	require.NoError(t, err)
+
+	violations, err := f.Find("CBFS", true).Resize(0x4000, ResizeGrowAncestors)
+	require.NoError(t, err)
+	require.Equal(t, 1, len(violations))
+	assert.Equal(t, "FLASH/RO", violations[0].Path)
+	assert.Equal(t, `FLASH 0x10000 {
+	RW@0x0 0x9000 {
+		FW_MAIN@0x0 0x5000 {
+			CBFS@0x0 0x4000
+			FWID@0x4000 0x1000
+		}
+		NVRAM@0x5000 0x2000
+	}
+	RO@0x9000 0x8000
+}
+`, f.ToFlashmap())
+}
+
+func TestResizeShrinkSibling(t *testing.T) {
+	f, err := Parse(strings.NewReader(resizeLayout))
+	require.NoError(t, err)
+
+	violations, err := f.Find("NVRAM", true).Resize(0x3000, ResizeShrinkSibling)
+	require.Error(t, err)
+	assert.Nil(t, violations)
+
+	violations, err = f.Find("CBFS", true).Resize(0x3800, ResizeShrinkSibling)
+	require.NoError(t, err)
+	assert.Empty(t, violations)
+	assert.Equal(t, int64(0x3800), *f.Find("FWID", true).Start)
+	assert.Equal(t, int64(0x800), f.Find("FWID", true).Size)
+
+	_, err = f.Find("CBFS", true).Resize(0x4800, ResizeShrinkSibling)
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "only 0x800 bytes left to give to CBFS")
+	assert.Equal(t, int64(0x3800), f.Find("CBFS", true).Size)
+}
+
+func TestResizeScaleDescendants(t *testing.T) {
+	f, err := Parse(strings.NewReader(resizeLayout))
+	require.NoError(t, err)
+
+	violations, err := f.Find("FW_MAIN", true).Resize(0x2000, ResizeScaleDescendants)
+	require.NoError(t, err)
+	assert.Empty(t, violations)
+	assert.Equal(t, int64(0x1800), f.Find("CBFS", true).Size)
+	assert.Equal(t, int64(0x1800), *f.Find("FWID", true).Start)
+	assert.Equal(t, int64(0x800), f.Find("FWID", true).Size)
+}
+
+func TestResizeErrors(t *testing.T) {
+	f, err := Parse(strings.NewReader(resizeLayout))
+	require.NoError(t, err)
+	cbfs := f.Find("CBFS", true)
+
+	_, err = cbfs.Resize(-1, 0)
+	require.Error(t, err)
+	_, err = cbfs.Resize(0x1000, ResizeGrowAncestors|ResizeShrinkSibling)
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "conflicting resize policy GrowAncestors|ShrinkSibling")
+
+	f.Find("RW", true).SetAttribute(AttrReadOnly, "true")
+	f.ProtectReadOnly(true)
+	_, err = cbfs.Resize(0x1000, 0)
+	require.True(t, errors.Is(err, ErrReadOnly))
+}
@@ -0,0 +1,165 @@
+package fmap
+
+import (
+	"errors"
+	"fmt"
+	"path"
+)
+
+// ScalePolicy controls how Scale distributes the difference of size between
+// the old and the new flash.
+type ScalePolicy struct {
+	// Flexible are shell patterns, see path.Match, of the names, or aliases,
+	// of the sections that grow or shrink. If empty, the flexible sections
+	// are the free regions, see IsUnused, the sections called FREE and the
+	// ones with the CBFS flag.
+	Flexible []string
+	// Align rounds the share of every flexible section down to a multiple of
+	// it, if greater than 1. The remainder goes to the last flexible section
+	// of each parent.
+	Align int64
+}
+
+// flexible returns true if the section grows or shrinks with the flash.
+func (p ScalePolicy) flexible(sec *Section) bool {
+	if len(p.Flexible) == 0 {
+		return sec.IsUnused() || sec.Name == "FREE" || sec.IsCBFS()
+	}
+	for _, pattern := range p.Flexible {
+		if matchPattern(sec, pattern) {
+			return true
+		}
+	}
+	return false
+}
+
+// share returns the part of `delta` given to a flexible section of `length`
+// bytes, out of `total` bytes of flexible sections in the same parent, or out
+// of `count` flexible sections if they are all empty.
+func (p ScalePolicy) share(delta, length, total int64, count int) (int64, error) {
+	var ret int64
+	if total > 0 {
+		n, err := mulInt64(delta, length)
+		if err != nil {
+			return 0, err
+		}
+		ret = n / total
+	} else {
+		ret = delta / int64(count)
+	}
+	if p.Align > 1 {
+		ret -= ret % p.Align
+	}
+	return ret, nil
+}
+
+// Scale rewrites the layout for a flash of `newSize` bytes, e.g. to port a
+// 16MB layout to a 32MB part. The flexible sections of the policy absorb the
+// difference of size, and the other sections keep their sizes. The
+// difference is shared among the flexible sub-sections of the root, and of
+// the sections containing flexible sections, which grow or shrink with them,
+// in proportion to their sizes, and the starts of the sections that follow
+// them are moved accordingly, so that the gaps between siblings are kept.
+// The sub-sections of a flexible section are not resized, nor moved relative
+// to it. The start of the root is not changed. It returns the violations of
+// the resulting layout, see Validate, and an error, without changing
+// anything, if a pattern of the policy is malformed, if there is no flexible
+// section, if a flexible section would be too small for its share or for its
+// sub-sections, or if a protected read-only section would change, see
+// ProtectReadOnly.
+func (s *Section) Scale(newSize int64, policy ScalePolicy) ([]Violation, error) {
+	for _, pattern := range policy.Flexible {
+		if _, err := path.Match(pattern, ""); err != nil {
+			return nil, err
+		}
+	}
+	if newSize < 0 {
+		return nil, fmt.Errorf("invalid flash size %d", newSize)
+	}
+	delta := newSize - size(s)
+	if delta == 0 {
+		return s.Validate(), nil
+	}
+
+	// elastic sections are the flexible ones and the ones containing them
+	elastic := make(map[*Section]bool)
+	var mark func(sec *Section) bool
+	mark = func(sec *Section) bool {
+		if sec != s && policy.flexible(sec) {
+			elastic[sec] = true
+			return true
+		}
+		for _, child := range sec.Sections {
+			if mark(child) {
+				elastic[sec] = true
+			}
+		}
+		return elastic[sec]
+	}
+	if !mark(s) {
+		return nil, errors.New("no flexible section to absorb the difference of size")
+	}
+
+	extents := sectionExtents(s)
+	// move shifts the section `sec` and its sub-sections by `shift` bytes
+	move := func(sec *Section, shift int64) {
+		for _, d := range append([]*Section{sec}, descendants(sec)...) {
+			e := extents[d]
+			extents[d] = extent{e.start + shift, e.end + shift}
+		}
+	}
+	// scale grows the elastic section `sec`, already moved, by `delta` bytes
+	var scale func(sec *Section, delta int64) error
+	scale = func(sec *Section, delta int64) error {
+		length := size(sec) + delta
+		if length < 0 {
+			return sectionErrorf(sec, "too small to shrink by 0x%x bytes", -delta)
+		}
+		e := extents[sec]
+		extents[sec] = extent{e.start, e.start + length}
+		if sec != s && policy.flexible(sec) {
+			for idx, st := range childStarts(sec) {
+				if end := st + size(sec.Sections[idx]); end > length {
+					return sectionErrorf(sec, "sub-section %s would end at 0x%x, past the new size 0x%x", sec.Sections[idx].Name, end, length)
+				}
+			}
+			return nil
+		}
+		children, _ := sortedChildren(sec)
+		var total int64
+		var flex []*Section
+		for _, child := range children {
+			if elastic[child] {
+				total += size(child)
+				flex = append(flex, child)
+			}
+		}
+		var shift, given int64
+		for _, child := range children {
+			move(child, shift)
+			if !elastic[child] {
+				continue
+			}
+			share := delta - given
+			if child != flex[len(flex)-1] {
+				var err error
+				if share, err = policy.share(delta, size(child), total, len(flex)); err != nil {
+					return sectionErrorf(child, "cannot share 0x%x bytes: %v", delta, err)
+				}
+			}
+			if err := scale(child, share); err != nil {
+				return err
+			}
+			given += share
+			shift += share
+		}
+		return nil
+	}
+	if err := scale(s, delta); err != nil {
+		return nil, err
+	}
+	if err := applyExtents(s, extents, fmt.Sprintf("Scale(0x%x)", newSize)); err != nil {
+		return nil, err
+	}
+	return s.Validate(), nil
+}
@@ -0,0 +1,101 @@
+package fmap
+
+import (
+	"errors"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+const scaleLayout = `FLASH 16M {
+	SI_DESC 0x1000
+	SI_ME 0x4ff000
+	SI_BIOS@0x800000 8M {
+		RW_SECTION_A 0x200000 {
+			VBLOCK_A 0x10000
+			FW_MAIN_A(CBFS) 0x1f0000
+		}
+		RW_MRC_CACHE 0x10000
+		COREBOOT(CBFS) 0x5f0000
+	}
+}`
+
+func TestScale(t *testing.T) {
+	// grow, only the CBFS sections absorb the difference
+	f, err := ParseString(scaleLayout)
+	require.NoError(t, err)
+	violations, err := f.Scale(32<<20, ScalePolicy{Align: 0x1000})
+	require.NoError(t, err)
+	assert.Empty(t, violations)
+	assert.Equal(t, `FLASH 32M {
+	SI_DESC 0x1000
+	SI_ME 0x4ff000
+	SI_BIOS@0x800000 24M {
+		RW_SECTION_A 0x608000 {
+			VBLOCK_A 0x10000
+			FW_MAIN_A(CBFS) 0x5f8000
+		}
+		RW_MRC_CACHE 0x10000
+		COREBOOT(CBFS) 0x11e8000
+	}
+}
+`, f.ToFlashmap())
+	assert.Equal(t, "Scale(0x2000000)", f.Find("COREBOOT", true).Provenance()[0].Op)
+	assert.Empty(t, f.Find("SI_ME", true).Provenance())
+
+	// shrink back
+	_, err = f.Scale(16<<20, ScalePolicy{Align: 0x1000})
+	require.NoError(t, err)
+	orig, err := ParseString(scaleLayout)
+	require.NoError(t, err)
+	assert.True(t, f.Equal(orig, EqualOptions{IgnoreUnits: true}), f.ToFlashmap())
+
+	// the flexible sections of the policy, the following ones are moved
+	f, err = ParseString(scaleLayout)
+	require.NoError(t, err)
+	_, err = f.Scale(32<<20, ScalePolicy{Flexible: []string{"SI_ME"}})
+	require.NoError(t, err)
+	assert.Equal(t, `FLASH 32M {
+	SI_DESC 0x1000
+	SI_ME 0x14ff000
+	SI_BIOS@0x1800000 8M {
+		RW_SECTION_A 0x200000 {
+			VBLOCK_A 0x10000
+			FW_MAIN_A(CBFS) 0x1f0000
+		}
+		RW_MRC_CACHE 0x10000
+		COREBOOT(CBFS) 0x5f0000
+	}
+}
+`, f.ToFlashmap())
+}
+
+func TestScaleErrors(t *testing.T) {
+	for _, tc := range []struct {
+		size   int64
+		policy ScalePolicy
+		err    string
+	}{
+		{32 << 20, ScalePolicy{Flexible: []string{"NONEXISTING"}}, "no flexible section to absorb the difference of size"},
+		{32 << 20, ScalePolicy{Flexible: []string{"["}}, "syntax error in pattern"},
+		{-1, ScalePolicy{}, "invalid flash size -1"},
+		{4 << 20, ScalePolicy{Flexible: []string{"SI_DESC"}}, "too small to shrink by 0xc00000 bytes"},
+		{8 << 20, ScalePolicy{Flexible: []string{"SI_BIOS"}}, "sub-section RW_SECTION_A would end at 0x200000, past the new size 0x0"},
+	} {
+		f, err := ParseString(scaleLayout)
+		require.NoError(t, err)
+		_, err = f.Scale(tc.size, tc.policy)
+		require.Error(t, err)
+		assert.Contains(t, err.Error(), tc.err)
+		assert.Equal(t, int64(16), f.Size)
+	}
+
+	f, err := ParseString(strings.Replace(scaleLayout, "COREBOOT(CBFS)", "COREBOOT(CBFS)[readonly=true]", 1))
+	require.NoError(t, err)
+	f.ProtectReadOnly(true)
+	_, err = f.Scale(32<<20, ScalePolicy{})
+	require.True(t, errors.Is(err, ErrReadOnly))
+	assert.Equal(t, int64(0x1f0000), f.Find("FW_MAIN_A", true).Size)
+}
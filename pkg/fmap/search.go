@@ -0,0 +1,177 @@
+package fmap
+
+import (
+	"path"
+	"regexp"
+	"strings"
+)
+
+// SearchOptions controls how Search matches sections.
+type SearchOptions struct {
+	// Recursive also searches sub-sections at any depth, not only the direct
+	// sub-sections.
+	Recursive bool
+	// All returns every matching section instead of only the first one.
+	All bool
+	// IgnoreCase matches names case-insensitively.
+	IgnoreCase bool
+	// IgnoreSeparators ignores separator characters (underscores, dashes,
+	// dots and spaces) when matching names, so that "RW_SECTION_A" matches
+	// "RW-SECTION-A" and "RWSECTIONA".
+	IgnoreSeparators bool
+}
+
+// separators are the characters ignored by SearchOptions.IgnoreSeparators.
+const separators = "_-. "
+
+// normalizeName returns the form of a name that is compared when matching
+// according to the options.
+func (o SearchOptions) normalizeName(name string) string {
+	if o.IgnoreSeparators {
+		name = strings.Map(func(r rune) rune {
+			if strings.ContainsRune(separators, r) {
+				return -1
+			}
+			return r
+		}, name)
+	}
+	if o.IgnoreCase {
+		name = strings.ToUpper(name)
+	}
+	return name
+}
+
+// match returns true if the section name, or one of its aliases, matches the
+// searched name according to the options.
+func (o SearchOptions) match(sec *Section, want string) bool {
+	want = o.normalizeName(want)
+	return matchNames(sec, func(name string) bool {
+		return o.normalizeName(name) == want
+	})
+}
+
+// matchNames returns true if `f` returns true for the section name or for one
+// of its aliases.
+func matchNames(sec *Section, f func(name string) bool) bool {
+	if f(sec.Name) {
+		return true
+	}
+	for _, alias := range sec.Aliases() {
+		if f(alias) {
+			return true
+		}
+	}
+	return false
+}
+
+// searchFunc calls `f` for every sub-section of `s` for which `match` returns
+// true, with its index in the parent's sections and the parent, until `f`
+// returns false. Like findFunc, direct sub-sections are visited before
+// searching into them, if `recursive` is true.
+func searchFunc(s *Section, match func(*Section) bool, recursive bool, f func(sec *Section, idx int, parent *Section) bool) bool {
+	for idx, sec := range s.Sections {
+		if match(sec) && !f(sec, idx, s) {
+			return false
+		}
+	}
+	if recursive {
+		for _, sec := range s.Sections {
+			if !searchFunc(sec, match, true, f) {
+				return false
+			}
+		}
+	}
+	return true
+}
+
+// Search returns the sub-sections whose name or alias matches `name`,
+// according to the given options. Unless opts.All is set, at most one section
+// is returned, which is the same that Find would return. The returned list is
+// empty if no section matches.
+func (s *Section) Search(name string, opts SearchOptions) []*Section {
+	var found []*Section
+	match := func(sec *Section) bool {
+		return opts.match(sec, name)
+	}
+	searchFunc(s, match, opts.Recursive, func(sec *Section, _ int, _ *Section) bool {
+		found = append(found, sec)
+		return opts.All
+	})
+	return found
+}
+
+// FindAll returns all the sub-sections, at any depth, whose name or alias is
+// `name`. The path of each one is available through Path.
+func (s *Section) FindAll(name string) []*Section {
+	return s.Search(name, SearchOptions{Recursive: true, All: true})
+}
+
+// FindGlob returns all the sub-sections, at any depth, whose name or alias
+// matches the shell pattern `pattern`, e.g. "RW_SECTION_*". The pattern syntax
+// is the one of path.Match. An error is returned if the pattern is malformed.
+func (s *Section) FindGlob(pattern string) ([]*Section, error) {
+	if _, err := path.Match(pattern, ""); err != nil {
+		return nil, err
+	}
+	return s.findAllFunc(func(name string) bool {
+		ok, _ := path.Match(pattern, name)
+		return ok
+	}), nil
+}
+
+// FindRegexp returns all the sub-sections, at any depth, whose name or alias
+// matches the regular expression `re`. As with regexp.MatchString, the match
+// is not anchored: use "^" and "$" to match whole names.
+func (s *Section) FindRegexp(re *regexp.Regexp) []*Section {
+	return s.findAllFunc(re.MatchString)
+}
+
+// findAllFunc returns all the sub-sections, at any depth, for which `f`
+// returns true for the name or one of the aliases.
+func (s *Section) findAllFunc(f func(name string) bool) []*Section {
+	var found []*Section
+	match := func(sec *Section) bool {
+		return matchNames(sec, f)
+	}
+	searchFunc(s, match, true, func(sec *Section, _ int, _ *Section) bool {
+		found = append(found, sec)
+		return true
+	})
+	return found
+}
+
+// FindPath returns the section named by `path`, made of the names, or
+// aliases, of a sub-section of `s` and of its descendants separated by "/",
+// e.g. "SI_BIOS/RW_SECTION_A/VBLOCK_A", so that sections with the same name at
+// different levels can be told apart. A path starting with "/" is absolute:
+// it starts with the name of the root of the tree `s` belongs to, as returned
+// by Path, e.g. "/FLASH/SI_BIOS". It returns nil if a section does not exist.
+func (s *Section) FindPath(path string) *Section {
+	if strings.HasPrefix(path, "/") {
+		root := s.Root()
+		names := strings.SplitN(path[1:], "/", 2)
+		if !root.hasName(names[0]) {
+			return nil
+		}
+		if len(names) == 1 {
+			return root
+		}
+		s, path = root, names[1]
+	}
+	chain, err := childPath(s, path)
+	if err != nil {
+		return nil
+	}
+	return chain[len(chain)-1]
+}
+
+// FindAnywhere searches the whole tree `s` belongs to, starting from its root,
+// for a section with the given name, at any depth. The root itself matches
+// too.
+func (s *Section) FindAnywhere(name string) *Section {
+	root := s.Root()
+	if root.hasName(name) {
+		return root
+	}
+	return root.Find(name, true)
+}
@@ -0,0 +1,167 @@
+package fmap
+
+import (
+	"os"
+	"regexp"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestFindAnywhere(t *testing.T) {
+	fd, err := os.Open("test_data/chromeos.fmd")
+	require.NoError(t, err)
+	defer fd.Close()
+	f, err := Parse(fd)
+	require.NoError(t, err)
+
+	sec := f.FindAnywhere("RW_MRC_CACHE")
+	require.NotNil(t, sec)
+	assert.Equal(t, "RW_MRC_CACHE", sec.Name)
+	assert.Nil(t, f.FindAnywhere("SI_NONEXISTING"))
+}
+
+func TestSearch(t *testing.T) {
+	f, err := Parse(strings.NewReader(`FLASH 0x4000 {
+	RW_A 0x1000 {
+		VBLOCK 0x800
+	}
+	RW_B 0x1000 {
+		VBLOCK 0x800
+	}
+	VBLOCK 0x1000
+}`))
+	require.NoError(t, err)
+
+	found := f.Search("VBLOCK", SearchOptions{})
+	require.Equal(t, 1, len(found))
+	assert.Equal(t, f.Sections[2], found[0])
+
+	found = f.Search("VBLOCK", SearchOptions{Recursive: true, All: true})
+	require.Equal(t, 3, len(found))
+	assert.Equal(t, f.Sections[2], found[0])
+	assert.Equal(t, f.Sections[0].Sections[0], found[1])
+	assert.Equal(t, f.Sections[1].Sections[0], found[2])
+
+	found = f.Sections[0].Search("VBLOCK", SearchOptions{Recursive: true})
+	require.Equal(t, 1, len(found))
+	assert.Equal(t, f.Find("VBLOCK", true), f.Search("VBLOCK", SearchOptions{Recursive: true})[0])
+
+	assert.Empty(t, f.Search("NONEXISTING", SearchOptions{Recursive: true, All: true}))
+}
+
+func TestSearchNormalized(t *testing.T) {
+	fd, err := os.Open("test_data/chromeos.fmd")
+	require.NoError(t, err)
+	defer fd.Close()
+	f, err := Parse(fd)
+	require.NoError(t, err)
+
+	assert.Empty(t, f.Search("rw_section_a", SearchOptions{Recursive: true}))
+	assert.Empty(t, f.Search("RW-SECTION-A", SearchOptions{Recursive: true, IgnoreCase: true}))
+
+	found := f.Search("rw_section_a", SearchOptions{Recursive: true, IgnoreCase: true})
+	require.Equal(t, 1, len(found))
+	assert.Equal(t, "RW_SECTION_A", found[0].Name)
+
+	found = f.Search("RW-SECTION-A", SearchOptions{Recursive: true, IgnoreSeparators: true})
+	require.Equal(t, 1, len(found))
+	assert.Equal(t, "RW_SECTION_A", found[0].Name)
+
+	found = f.Search("rw-section.a", SearchOptions{Recursive: true, IgnoreCase: true, IgnoreSeparators: true})
+	require.Equal(t, 1, len(found))
+	assert.Equal(t, "RW_SECTION_A", found[0].Name)
+}
+
+func TestFindAll(t *testing.T) {
+	f, err := Parse(strings.NewReader(`FLASH 0x4000 {
+	RW_A 0x1000 {
+		VBLOCK 0x800
+	}
+	RW_B 0x1000 {
+		VBLOCK 0x800
+	}
+	VBLOCK 0x1000
+}`))
+	require.NoError(t, err)
+
+	found := f.FindAll("VBLOCK")
+	require.Equal(t, 3, len(found))
+	assert.Equal(t, "FLASH/VBLOCK", found[0].Path())
+	assert.Equal(t, "FLASH/RW_A/VBLOCK", found[1].Path())
+	assert.Equal(t, "FLASH/RW_B/VBLOCK", found[2].Path())
+	assert.Empty(t, f.FindAll("NONEXISTING"))
+}
+
+func TestFindGlob(t *testing.T) {
+	fd, err := os.Open("test_data/chromeos.fmd")
+	require.NoError(t, err)
+	defer fd.Close()
+	f, err := Parse(fd)
+	require.NoError(t, err)
+
+	found, err := f.FindGlob("RW_SECTION_*")
+	require.NoError(t, err)
+	require.Equal(t, 2, len(found))
+	assert.Equal(t, "FLASH/SI_BIOS/RW_SECTION_A", found[0].Path())
+	assert.Equal(t, "FLASH/SI_BIOS/RW_SECTION_B", found[1].Path())
+
+	found, err = f.FindGlob("VBLOCK_?")
+	require.NoError(t, err)
+	assert.Equal(t, 2, len(found))
+
+	found, err = f.FindGlob("NONE*")
+	require.NoError(t, err)
+	assert.Empty(t, found)
+
+	_, err = f.FindGlob("RW_[")
+	require.Error(t, err)
+}
+
+func TestFindRegexp(t *testing.T) {
+	fd, err := os.Open("test_data/chromeos.fmd")
+	require.NoError(t, err)
+	defer fd.Close()
+	f, err := Parse(fd)
+	require.NoError(t, err)
+
+	found := f.FindRegexp(regexp.MustCompile(`^VBLOCK_`))
+	require.Equal(t, 3, len(found))
+	assert.Equal(t, "VBLOCK_A", found[0].Name)
+	assert.Equal(t, "VBLOCK_B", found[1].Name)
+	assert.Equal(t, "VBLOCK_DEV", found[2].Name)
+
+	found = f.FindRegexp(regexp.MustCompile(`^RW_FWID_[AB]$`))
+	assert.Equal(t, 2, len(found))
+}
+
+func TestFindPath(t *testing.T) {
+	f, err := ParseString(`FLASH 0x4000 {
+	RW_A[alias=SLOT_A] 0x1000 {
+		VBLOCK 0x800
+	}
+	RW_B 0x1000 {
+		VBLOCK 0x800
+	}
+	VBLOCK 0x1000
+}`)
+	require.NoError(t, err)
+
+	assert.Equal(t, f.Sections[0].Sections[0], f.FindPath("RW_A/VBLOCK"))
+	assert.Equal(t, f.Sections[1].Sections[0], f.FindPath("RW_B/VBLOCK"))
+	assert.Equal(t, f.Sections[2], f.FindPath("VBLOCK"))
+	assert.Equal(t, f.Sections[0].Sections[0], f.FindPath("SLOT_A/VBLOCK"))
+	assert.Nil(t, f.FindPath("RW_C/VBLOCK"))
+	assert.Nil(t, f.FindPath("VBLOCK/RW_A"))
+	assert.Nil(t, f.FindPath("FLASH/RW_A"))
+
+	rwb := f.Sections[1]
+	assert.Equal(t, rwb.Sections[0], rwb.FindPath("VBLOCK"))
+	assert.Equal(t, f.Sections[0].Sections[0], rwb.FindPath("/FLASH/RW_A/VBLOCK"))
+	assert.Equal(t, f, rwb.FindPath("/FLASH"))
+	assert.Equal(t, rwb.Sections[0], f.FindPath(rwb.Sections[0].Path()[len("FLASH/"):]))
+	assert.Equal(t, rwb.Sections[0], f.FindPath("/"+rwb.Sections[0].Path()))
+	assert.Nil(t, rwb.FindPath("/ROM/RW_A"))
+}
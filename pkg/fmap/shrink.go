@@ -0,0 +1,91 @@
+package fmap
+
+import (
+	"fmt"
+	"io"
+	"strings"
+)
+
+// Shrink is a proposed reduction of the size of a section to the size of its
+// content in an image, as returned by ProposeShrinks.
+type Shrink struct {
+	Section *Section
+	// Size is the current size of the section, and NewSize the size it is
+	// shrunk to, both in bytes.
+	Size    int64
+	NewSize int64
+}
+
+// Reclaimed returns the number of bytes the shrink frees.
+func (sh Shrink) Reclaimed() int64 {
+	return sh.Size - sh.NewSize
+}
+
+// String returns a description of the shrink.
+func (sh Shrink) String() string {
+	return fmt.Sprintf("%s: 0x%x -> 0x%x (0x%x bytes reclaimed)", sh.Section.Path(), sh.Size, sh.NewSize, sh.Reclaimed())
+}
+
+// contentSize returns the size of `data` without its trailing erased (0xff)
+// bytes.
+func contentSize(data []byte) int64 {
+	end := len(data)
+	for end > 0 && data[end-1] == 0xff {
+		end--
+	}
+	return int64(end)
+}
+
+// ProposeShrinks measures the trailing erased (0xff) space of the sections
+// named `names`, at any depth, in a flash image, and proposes to shrink them to
+// the size of their content, plus the headroom and alignment in the options.
+// Offsets in the image are relative to the start of `s`. Sections that would
+// not shrink are omitted. A *NotFoundError is returned if a section does not
+// exist.
+func (s *Section) ProposeShrinks(image io.ReaderAt, names []string, opts FitOptions) ([]Shrink, error) {
+	var shrinks []Shrink
+	for _, name := range names {
+		sec, err := s.Lookup(name, true)
+		if err != nil {
+			return nil, err
+		}
+		data, err := s.ExtractSection(image, sec)
+		if err != nil {
+			return nil, err
+		}
+		if newSize := opts.size(contentSize(data)); newSize < size(sec) {
+			shrinks = append(shrinks, Shrink{Section: sec, Size: size(sec), NewSize: newSize})
+		}
+	}
+	return shrinks, nil
+}
+
+// ApplyShrinks resizes the sections of the shrinks, which must be part of the
+// tree rooted at `s`, and defragments the layout so that the following
+// sections take the reclaimed space. It returns the violations of the
+// resulting layout, see Validate. Protected read-only sections cannot be
+// shrunk, see ProtectReadOnly.
+func (s *Section) ApplyShrinks(shrinks []Shrink) ([]Violation, error) {
+	if len(shrinks) == 0 {
+		return s.Validate(), nil
+	}
+	var names []string
+	for _, sh := range shrinks {
+		names = append(names, sh.Section.Name)
+	}
+	op := "Shrink(" + strings.Join(names, ", ") + ")"
+	for _, sh := range shrinks {
+		if err := checkWritable(sh.Section, op); err != nil {
+			return nil, err
+		}
+	}
+	t := s.record(op)
+	pinned := pinProtected(s)
+	for _, sh := range shrinks {
+		sh.Section.Size, sh.Section.Unit, sh.Section.Fill = sh.NewSize, "", false
+		sh.Section.touch(t)
+	}
+	s.Defrag(false)
+	unpinProtected(pinned)
+	return s.Validate(), nil
+}
@@ -0,0 +1,72 @@
+package fmap
+
+import (
+	"bytes"
+	"errors"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// shrinkImage returns a blank image for fitLayout with some content in
+// COREBOOT and FW_MAIN.
+func shrinkImage() *bytes.Reader {
+	image := bytes.Repeat([]byte{0xff}, 0x10000)
+	copy(image[0x1000:], bytes.Repeat([]byte{0x55}, 0x800))
+	copy(image[0x8000:], bytes.Repeat([]byte{0xaa}, 0x1234))
+	return bytes.NewReader(image)
+}
+
+func TestProposeShrinks(t *testing.T) {
+	f, err := Parse(strings.NewReader(fitLayout))
+	require.NoError(t, err)
+
+	shrinks, err := f.ProposeShrinks(shrinkImage(), []string{"FMAP", "COREBOOT", "FW_MAIN"}, FitOptions{Align: 0x1000})
+	require.NoError(t, err)
+	require.Equal(t, 3, len(shrinks))
+	assert.Equal(t, "FLASH/RO/FMAP: 0x1000 -> 0x0 (0x1000 bytes reclaimed)", shrinks[0].String())
+	assert.Equal(t, "FLASH/RO/COREBOOT: 0x2000 -> 0x1000 (0x1000 bytes reclaimed)", shrinks[1].String())
+	assert.Equal(t, "FLASH/RW/FW_MAIN: 0x4000 -> 0x2000 (0x2000 bytes reclaimed)", shrinks[2].String())
+
+	// the headroom leaves no room to shrink
+	shrinks, err = f.ProposeShrinks(shrinkImage(), []string{"COREBOOT"}, FitOptions{Headroom: 0x1800})
+	require.NoError(t, err)
+	assert.Empty(t, shrinks)
+}
+
+func TestApplyShrinks(t *testing.T) {
+	f, err := Parse(strings.NewReader(fitLayout))
+	require.NoError(t, err)
+
+	shrinks, err := f.ProposeShrinks(shrinkImage(), []string{"COREBOOT", "FW_MAIN"}, FitOptions{Align: 0x1000})
+	require.NoError(t, err)
+	violations, err := f.ApplyShrinks(shrinks)
+	require.NoError(t, err)
+	assert.Empty(t, violations)
+	assert.Equal(t, `FLASH 0x10000 {
+	RO@0x0 0x8000 {
+		FMAP@0x0 0x1000
+		COREBOOT@0x1000 0x1000
+		GBB@0x2000 0x1000
+	}
+	RW@0x8000 0x8000 {
+		FW_MAIN@0x0 0x2000
+	}
+}
+`, f.ToFlashmap())
+	assert.Contains(t, f.Find("COREBOOT", true).Origin(), "introduced by Shrink(COREBOOT, FW_MAIN) at step 1")
+}
+
+func TestProposeShrinksErrors(t *testing.T) {
+	f, err := Parse(strings.NewReader(fitLayout))
+	require.NoError(t, err)
+
+	_, err = f.ProposeShrinks(shrinkImage(), []string{"NONEXISTING"}, FitOptions{})
+	require.True(t, errors.Is(err, ErrSectionNotFound))
+
+	_, err = f.ProposeShrinks(bytes.NewReader(make([]byte, 0x8000)), []string{"FW_MAIN"}, FitOptions{})
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "extends past the end of the image")
+}
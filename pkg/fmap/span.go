@@ -0,0 +1,65 @@
+package fmap
+
+import (
+	"fmt"
+	"sort"
+
+	"github.com/alecthomas/participle/lexer"
+)
+
+// Span identifies the range of lines of a source file a section was parsed
+// from. Sections that were created programmatically have an invalid, zero
+// Span.
+type Span struct {
+	Filename  string
+	StartLine int
+	EndLine   int
+}
+
+// IsValid returns true if the span refers to an actual location in a source
+// file.
+func (sp Span) IsValid() bool {
+	return sp.StartLine > 0
+}
+
+// String returns the span in the form "file:start-end". The file name is
+// omitted if unknown, and the end line is omitted if the span covers a single
+// line.
+func (sp Span) String() string {
+	if !sp.IsValid() {
+		return "-"
+	}
+	ret := ""
+	if sp.Filename != "" {
+		ret = sp.Filename + ":"
+	}
+	ret += fmt.Sprintf("%d", sp.StartLine)
+	if sp.EndLine > sp.StartLine {
+		ret += fmt.Sprintf("-%d", sp.EndLine)
+	}
+	return ret
+}
+
+// Span returns the position in the source file the section was parsed from.
+func (s *Section) Span() Span {
+	return s.span
+}
+
+// resolveSpans computes the source span of a section and all of its
+// sub-sections, using the positions recorded by the parser and the list of
+// tokens of the source file.
+func resolveSpans(s *Section, filename string, tokens []lexer.Token) {
+	// EndPos points to the first token after the section, so the section ends
+	// on the line of the token that precedes it.
+	end := sort.Search(len(tokens), func(i int) bool {
+		return tokens[i].Pos.Offset >= s.EndPos.Offset
+	})
+	endLine := s.Pos.Line
+	if end > 0 && tokens[end-1].Pos.Line > endLine {
+		endLine = tokens[end-1].Pos.Line
+	}
+	s.span = Span{Filename: filename, StartLine: s.Pos.Line, EndLine: endLine}
+	for _, sec := range s.Sections {
+		resolveSpans(sec, filename, tokens)
+	}
+}
@@ -0,0 +1,37 @@
+package fmap
+
+import (
+	"os"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestSpan(t *testing.T) {
+	fd, err := os.Open("test_data/chromeos.fmd")
+	require.NoError(t, err)
+	defer fd.Close()
+	f, err := Parse(fd)
+	require.NoError(t, err)
+
+	assert.Equal(t, Span{Filename: "test_data/chromeos.fmd", StartLine: 1, EndLine: 44}, f.Span())
+	assert.Equal(t, Span{Filename: "test_data/chromeos.fmd", StartLine: 2, EndLine: 5}, f.Find("SI_ALL", false).Span())
+	assert.Equal(t, Span{Filename: "test_data/chromeos.fmd", StartLine: 3, EndLine: 3}, f.Find("SI_DESC", true).Span())
+	assert.Equal(t, "test_data/chromeos.fmd:7-11", f.Find("RW_SECTION_A", true).Span().String())
+	assert.Equal(t, "test_data/chromeos.fmd:9", f.Find("FW_MAIN_A", true).Span().String())
+}
+
+func TestSpanNoFilename(t *testing.T) {
+	f, err := Parse(strings.NewReader("FLASH 4k {\n\tA 2k\n\tB 2k\n}\n"))
+	require.NoError(t, err)
+	assert.Equal(t, "1-4", f.Span().String())
+	assert.Equal(t, "3", f.Find("B", false).Span().String())
+}
+
+func TestSpanInvalid(t *testing.T) {
+	s := Section{Name: "NEW", Size: 0x1000}
+	assert.False(t, s.Span().IsValid())
+	assert.Equal(t, "-", s.Span().String())
+}
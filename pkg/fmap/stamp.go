@@ -0,0 +1,74 @@
+package fmap
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// Stamp describes the tool and the inputs that produced a fmd file. It is
+// written as a comment block at the start of the file by ToFlashmap with the
+// WithStamp option, so that downstream consumers can tell where a layout
+// comes from. The parser ignores it like any other comment.
+type Stamp struct {
+	// Tool is the name and the version of the tool, e.g. "fmap v1.2.0".
+	Tool string
+	// Sources are the input files the layout was generated from.
+	Sources []StampSource
+	// Time is when the layout was generated. It is omitted if zero, so that
+	// reproducible builds produce the same output.
+	Time time.Time
+}
+
+// StampSource is an input file of a generated layout, and the SHA-256 hash
+// of its content.
+type StampSource struct {
+	Path string
+	Hash string
+}
+
+// NewStampSource returns the StampSource of the file at `path` with the
+// content `data`.
+func NewStampSource(path string, data []byte) StampSource {
+	sum := sha256.Sum256(data)
+	return StampSource{Path: path, Hash: hex.EncodeToString(sum[:])}
+}
+
+// Reproducible returns a copy of the stamp without the time, and with only
+// the base names of the source paths, so that the output does not depend on
+// when, and in which directory, it was generated.
+func (st Stamp) Reproducible() Stamp {
+	ret := Stamp{Tool: st.Tool}
+	for _, src := range st.Sources {
+		ret.Sources = append(ret.Sources, StampSource{Path: filepath.Base(src.Path), Hash: src.Hash})
+	}
+	return ret
+}
+
+// String returns the stamp as a comment block, followed by an empty line.
+func (st Stamp) String() string {
+	var b strings.Builder
+	tool := st.Tool
+	if tool == "" {
+		tool = "an unknown tool"
+	}
+	fmt.Fprintf(&b, "// Generated by %s. Do not edit.\n", tool)
+	for _, src := range st.Sources {
+		fmt.Fprintf(&b, "// Source: %s (%s %s)\n", src.Path, HashAlgorithmSHA256, src.Hash)
+	}
+	if !st.Time.IsZero() {
+		fmt.Fprintf(&b, "// Time: %s\n", st.Time.UTC().Format(time.RFC3339))
+	}
+	b.WriteString("\n")
+	return b.String()
+}
+
+// WithStamp writes the stamp at the start of the output.
+func WithStamp(st Stamp) FormatOption {
+	return func(f *formatter) {
+		f.stamp = &st
+	}
+}
@@ -0,0 +1,44 @@
+package fmap
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestStamp(t *testing.T) {
+	f, err := Parse(strings.NewReader("define SIZE 0x1000\n\nFLASH $SIZE"))
+	require.NoError(t, err)
+
+	st := Stamp{Tool: "fmap v1.0.0", Sources: []StampSource{NewStampSource("board.fmd", []byte("FLASH 0x1000"))}}
+	out := f.ToFlashmap(WithStamp(st))
+	assert.Equal(t, `// Generated by fmap v1.0.0. Do not edit.
+// Source: board.fmd (sha256 170f4fd5da928169338819e05c2c0097cb0265840c704f249a489b3a8bbf74af)
+
+define SIZE 0x1000
+
+FLASH $SIZE
+`, out)
+
+	// the stamp is a comment
+	g, err := Parse(strings.NewReader(out))
+	require.NoError(t, err)
+	assert.Equal(t, f.ToFlashmap(), g.ToFlashmap())
+
+	st.Time = time.Date(2020, 1, 2, 3, 4, 5, 0, time.UTC)
+	assert.Contains(t, f.ToFlashmap(WithStamp(st)), "// Time: 2020-01-02T03:04:05Z\n")
+}
+
+func TestStampReproducible(t *testing.T) {
+	st := Stamp{
+		Tool:    "fmap v1.0.0",
+		Sources: []StampSource{{Path: "/home/user/src/board.fmd", Hash: "abcd"}},
+		Time:    time.Date(2020, 1, 2, 3, 4, 5, 0, time.UTC),
+	}
+	assert.Equal(t, "// Generated by fmap v1.0.0. Do not edit.\n// Source: board.fmd (sha256 abcd)\n\n", st.Reproducible().String())
+	// the original stamp is not modified
+	assert.Equal(t, "/home/user/src/board.fmd", st.Sources[0].Path)
+}
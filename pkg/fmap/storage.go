@@ -0,0 +1,167 @@
+package fmap
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"strings"
+)
+
+// Image is a flash image, wherever it is stored, see OpenImage. Images opened
+// read-only return ErrReadOnlyImage on writes. Writes are held until Commit,
+// and reads see them, while Close discards the writes that were not
+// committed, so that a command failing halfway through leaves the image as
+// it was. Backends must do the same.
+type Image interface {
+	io.ReaderAt
+	io.WriterAt
+	io.Closer
+	// Commit stores the pending writes, if any.
+	Commit() error
+	// Name returns the location the image was opened from.
+	Name() string
+	// Size returns the size of the image in bytes.
+	Size() (int64, error)
+}
+
+// ErrReadOnlyImage is returned when writing to an image opened read-only, or
+// stored in a backend that cannot be written to.
+var ErrReadOnlyImage = errors.New("image is read-only")
+
+// Backend opens the image at `location`, for writing too if `writable` is
+// set, see RegisterBackend.
+type Backend func(location string, writable bool) (Image, error)
+
+// backends are the registered storage backends, by scheme.
+var backends = map[string]Backend{
+	"file": openFileImage,
+}
+
+// RegisterBackend makes the images stored at locations starting with
+// "SCHEME://" available to OpenImage, e.g. to access private buckets with the
+// SDK of a cloud provider. It is meant to be called from the init function of
+// the package implementing the backend, and panics if the scheme is empty or
+// already registered.
+func RegisterBackend(scheme string, b Backend) {
+	if scheme == "" {
+		panic("fmap: RegisterBackend with an empty scheme")
+	}
+	if _, ok := backends[scheme]; ok {
+		panic("fmap: RegisterBackend called twice for scheme " + scheme)
+	}
+	backends[scheme] = b
+}
+
+// Backends returns the schemes of the registered storage backends, sorted.
+func Backends() []string {
+	var schemes []string
+	for scheme := range backends {
+		schemes = append(schemes, scheme)
+	}
+	sort.Strings(schemes)
+	return schemes
+}
+
+// OpenImage opens the flash image at `location`, for writing too if
+// `writable` is set. The location is a path, or a URL whose scheme selects the
+// storage backend, see RegisterBackend. The built-in backend reads and writes
+// local files, given as path/image.bin or file:///path/image.bin.
+// Importing package github.com/insomniacslk/fmap/pkg/fmap/storage registers
+// the backends of the images served over HTTP, stored in buckets, or in a
+// flash chip read by flashrom.
+func OpenImage(location string, writable bool) (Image, error) {
+	scheme := "file"
+	if i := strings.Index(location, "://"); i > 0 {
+		scheme = location[:i]
+	}
+	b, ok := backends[scheme]
+	if !ok {
+		return nil, fmt.Errorf("%s: unknown storage backend %q", location, scheme)
+	}
+	return b(location, writable)
+}
+
+// fileImage is a flash image in a local file. Its writes are held in memory,
+// in order, until they are committed.
+type fileImage struct {
+	*os.File
+	writable bool
+	pending  []pendingWrite
+}
+
+// pendingWrite is a write to a fileImage that was not committed.
+type pendingWrite struct {
+	off  int64
+	data []byte
+}
+
+func openFileImage(location string, writable bool) (Image, error) {
+	path := strings.TrimPrefix(location, "file://")
+	flags := os.O_RDONLY
+	if writable {
+		flags = os.O_RDWR
+	}
+	fd, err := os.OpenFile(path, flags, 0)
+	if err != nil {
+		return nil, err
+	}
+	return &fileImage{File: fd, writable: writable}, nil
+}
+
+func (f *fileImage) ReadAt(p []byte, off int64) (int, error) {
+	n, err := f.File.ReadAt(p, off)
+	for _, w := range f.pending {
+		// the part of the write within the bytes read
+		lo, hi := maxInt64(w.off, off), minInt64(w.off+int64(len(w.data)), off+int64(n))
+		if lo < hi {
+			copy(p[lo-off:hi-off], w.data[lo-w.off:hi-w.off])
+		}
+	}
+	return n, err
+}
+
+func (f *fileImage) WriteAt(p []byte, off int64) (int, error) {
+	if !f.writable {
+		return 0, ErrReadOnlyImage
+	}
+	size, err := f.Size()
+	if err != nil {
+		return 0, err
+	}
+	if off < 0 || off+int64(len(p)) > size {
+		return 0, fmt.Errorf("%s: write at 0x%x-0x%x is outside of the image (0x%x bytes)", f.Name(), off, off+int64(len(p)), size)
+	}
+	f.pending = append(f.pending, pendingWrite{off: off, data: append([]byte(nil), p...)})
+	return len(p), nil
+}
+
+// Commit writes the pending writes to the file, in order, and syncs it.
+func (f *fileImage) Commit() error {
+	if !f.writable {
+		return nil
+	}
+	for len(f.pending) > 0 {
+		w := f.pending[0]
+		if _, err := f.File.WriteAt(w.data, w.off); err != nil {
+			return err
+		}
+		f.pending = f.pending[1:]
+	}
+	return f.Sync()
+}
+
+// Close discards the pending writes and closes the file.
+func (f *fileImage) Close() error {
+	f.pending = nil
+	return f.File.Close()
+}
+
+func (f *fileImage) Size() (int64, error) {
+	fi, err := f.Stat()
+	if err != nil {
+		return 0, err
+	}
+	return fi.Size(), nil
+}
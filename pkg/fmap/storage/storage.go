@@ -0,0 +1,248 @@
+// Package storage provides the storage backends of fmap.OpenImage for images
+// that are not local files, registered when the package is imported:
+//
+//	http://host/image.bin and https://host/image.bin, read with range requests
+//	s3://bucket/image.bin and gs://bucket/image.bin, public objects of an
+//	Amazon S3 or Google Cloud Storage bucket, read like HTTPS URLs
+//	flashrom://PROGRAMMER, e.g. flashrom://internal or
+//	flashrom://linux_spi:dev=/dev/spidev0.0, the flash chip read by
+//	flashrom, and written back by Commit if the image was modified
+package storage
+
+import (
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/insomniacslk/fmap/pkg/fmap"
+)
+
+func init() {
+	fmap.RegisterBackend("http", openHTTPImage)
+	fmap.RegisterBackend("https", openHTTPImage)
+	fmap.RegisterBackend("s3", openBucketImage)
+	fmap.RegisterBackend("gs", openBucketImage)
+	fmap.RegisterBackend("flashrom", openFlashromImage)
+}
+
+// HTTPClient is the client used by the http, https, s3 and gs backends.
+var HTTPClient = &http.Client{Timeout: time.Minute}
+
+// httpImage is a read-only flash image served over HTTP, read with range
+// requests so that only the needed parts are downloaded.
+type httpImage struct {
+	name, url string
+	size      int64
+}
+
+func openHTTPImage(location string, writable bool) (fmap.Image, error) {
+	return openURLImage(location, location, writable)
+}
+
+// openURLImage opens the image at `url`, called `name`.
+func openURLImage(name, url string, writable bool) (fmap.Image, error) {
+	if writable {
+		return nil, fmt.Errorf("%s: %v", name, fmap.ErrReadOnlyImage)
+	}
+	resp, err := HTTPClient.Head(url)
+	if err != nil {
+		return nil, err
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("%s: %s", name, resp.Status)
+	}
+	if resp.ContentLength < 0 {
+		return nil, fmt.Errorf("%s: unknown image size", name)
+	}
+	return &httpImage{name: name, url: url, size: resp.ContentLength}, nil
+}
+
+func (h *httpImage) ReadAt(p []byte, off int64) (int, error) {
+	if off < 0 {
+		return 0, fmt.Errorf("%s: negative offset 0x%x", h.name, off)
+	}
+	if off >= h.size {
+		return 0, io.EOF
+	}
+	end := off + int64(len(p))
+	if end > h.size {
+		end = h.size
+	}
+	if end == off {
+		return 0, nil
+	}
+	req, err := http.NewRequest(http.MethodGet, h.url, nil)
+	if err != nil {
+		return 0, err
+	}
+	req.Header.Set("Range", fmt.Sprintf("bytes=%d-%d", off, end-1))
+	resp, err := HTTPClient.Do(req)
+	if err != nil {
+		return 0, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusPartialContent {
+		return 0, fmt.Errorf("%s: range request for 0x%x-0x%x: %s", h.name, off, end, resp.Status)
+	}
+	n, err := io.ReadFull(resp.Body, p[:end-off])
+	if err != nil {
+		return n, err
+	}
+	if end-off < int64(len(p)) {
+		return n, io.EOF
+	}
+	return n, nil
+}
+
+func (h *httpImage) WriteAt(p []byte, off int64) (int, error) {
+	return 0, fmap.ErrReadOnlyImage
+}
+
+func (h *httpImage) Commit() error        { return nil }
+func (h *httpImage) Close() error         { return nil }
+func (h *httpImage) Name() string         { return h.name }
+func (h *httpImage) Size() (int64, error) { return h.size, nil }
+
+// bucketURL returns the public HTTPS URL of an object of an Amazon S3 or
+// Google Cloud Storage bucket, given as s3://bucket/key or gs://bucket/key.
+func bucketURL(location string) (string, error) {
+	i := strings.Index(location, "://")
+	parts := strings.SplitN(location[i+3:], "/", 2)
+	if len(parts) != 2 || parts[0] == "" || parts[1] == "" {
+		return "", fmt.Errorf("%s: expected %s://BUCKET/OBJECT", location, location[:i])
+	}
+	if location[:i] == "s3" {
+		return fmt.Sprintf("https://%s.s3.amazonaws.com/%s", parts[0], parts[1]), nil
+	}
+	return fmt.Sprintf("https://storage.googleapis.com/%s/%s", parts[0], parts[1]), nil
+}
+
+func openBucketImage(location string, writable bool) (fmap.Image, error) {
+	url, err := bucketURL(location)
+	if err != nil {
+		return nil, err
+	}
+	return openURLImage(location, url, writable)
+}
+
+// FlashromPath is the flashrom executable used by the flashrom backend.
+var FlashromPath = "flashrom"
+
+// bufferImage is a flash image held in memory, written back by `flush` when
+// it is committed, if it was modified. Closing it discards the writes that
+// were not committed.
+type bufferImage struct {
+	name     string
+	data     []byte
+	writable bool
+	dirty    bool
+	flush    func(data []byte) error
+}
+
+func (m *bufferImage) ReadAt(p []byte, off int64) (int, error) {
+	if off < 0 {
+		return 0, fmt.Errorf("%s: negative offset 0x%x", m.name, off)
+	}
+	if off >= int64(len(m.data)) {
+		return 0, io.EOF
+	}
+	n := copy(p, m.data[off:])
+	if n < len(p) {
+		return n, io.EOF
+	}
+	return n, nil
+}
+
+func (m *bufferImage) WriteAt(p []byte, off int64) (int, error) {
+	if !m.writable {
+		return 0, fmap.ErrReadOnlyImage
+	}
+	if off < 0 || off+int64(len(p)) > int64(len(m.data)) {
+		return 0, fmt.Errorf("%s: write at 0x%x-0x%x is outside of the image (0x%x bytes)", m.name, off, off+int64(len(p)), len(m.data))
+	}
+	m.dirty = true
+	return copy(m.data[off:], p), nil
+}
+
+func (m *bufferImage) Commit() error {
+	if !m.dirty || m.flush == nil {
+		return nil
+	}
+	if err := m.flush(m.data); err != nil {
+		return err
+	}
+	m.dirty = false
+	return nil
+}
+
+func (m *bufferImage) Close() error {
+	m.dirty = false
+	return nil
+}
+
+func (m *bufferImage) Name() string         { return m.name }
+func (m *bufferImage) Size() (int64, error) { return int64(len(m.data)), nil }
+
+// runFlashrom runs flashrom with the programmer `programmer`, to read the
+// flash chip into the file at `path` if `op` is "-r", or to write it if `op`
+// is "-w".
+func runFlashrom(programmer, op, path string) error {
+	out, err := exec.Command(FlashromPath, "-p", programmer, op, path).CombinedOutput()
+	if err == nil {
+		return nil
+	}
+	if msg := strings.TrimSpace(string(out)); msg != "" {
+		return fmt.Errorf("flashrom -p %s %s: %v: %s", programmer, op, err, msg)
+	}
+	return fmt.Errorf("flashrom -p %s %s: %v", programmer, op, err)
+}
+
+// withTempFile calls `f` with the path of a file in a temporary directory,
+// removed afterwards.
+func withTempFile(f func(path string) error) error {
+	dir, err := ioutil.TempDir("", "fmap-flashrom")
+	if err != nil {
+		return err
+	}
+	defer os.RemoveAll(dir)
+	return f(filepath.Join(dir, "image.bin"))
+}
+
+func openFlashromImage(location string, writable bool) (fmap.Image, error) {
+	programmer := strings.TrimPrefix(location, "flashrom://")
+	if programmer == "" {
+		return nil, fmt.Errorf("%s: expected flashrom://PROGRAMMER", location)
+	}
+	var data []byte
+	err := withTempFile(func(path string) error {
+		if err := runFlashrom(programmer, "-r", path); err != nil {
+			return err
+		}
+		var err error
+		data, err = ioutil.ReadFile(path)
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+	return &bufferImage{
+		name:     location,
+		data:     data,
+		writable: writable,
+		flush: func(data []byte) error {
+			return withTempFile(func(path string) error {
+				if err := ioutil.WriteFile(path, data, 0600); err != nil {
+					return err
+				}
+				return runFlashrom(programmer, "-w", path)
+			})
+		},
+	}, nil
+}
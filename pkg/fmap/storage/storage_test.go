@@ -0,0 +1,105 @@
+package storage
+
+import (
+	"bytes"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/insomniacslk/fmap/pkg/fmap"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestOpenImageHTTP(t *testing.T) {
+	content := make([]byte, 0x3000)
+	for i := range content {
+		content[i] = byte(i)
+	}
+	var ranges []string
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method == http.MethodGet {
+			ranges = append(ranges, r.Header.Get("Range"))
+		}
+		http.ServeContent(w, r, "image.bin", time.Time{}, bytes.NewReader(content))
+	}))
+	defer srv.Close()
+
+	img, err := fmap.OpenImage(srv.URL+"/image.bin", false)
+	require.NoError(t, err)
+	defer img.Close()
+	size, err := img.Size()
+	require.NoError(t, err)
+	assert.Equal(t, int64(0x3000), size)
+
+	f, err := fmap.Parse(strings.NewReader(`FLASH 0x3000 {
+	A 0x1000
+	B 0x2000
+}`))
+	require.NoError(t, err)
+	data, err := f.Extract(img, "B")
+	require.NoError(t, err)
+	assert.Equal(t, content[0x1000:], data)
+	assert.Equal(t, []string{"bytes=4096-12287"}, ranges)
+
+	// reads past the end are short
+	buf := make([]byte, 0x10)
+	n, err := img.ReadAt(buf, 0x2ff8)
+	assert.Equal(t, 8, n)
+	assert.Error(t, err)
+
+	_, err = img.WriteAt([]byte{0}, 0)
+	assert.Equal(t, fmap.ErrReadOnlyImage, err)
+	_, err = fmap.OpenImage(srv.URL+"/image.bin", true)
+	assert.Error(t, err)
+}
+
+func TestBucketURL(t *testing.T) {
+	url, err := bucketURL("s3://firmware/board/image.bin")
+	require.NoError(t, err)
+	assert.Equal(t, "https://firmware.s3.amazonaws.com/board/image.bin", url)
+	url, err = bucketURL("gs://firmware/image.bin")
+	require.NoError(t, err)
+	assert.Equal(t, "https://storage.googleapis.com/firmware/image.bin", url)
+	_, err = bucketURL("gs://firmware")
+	assert.Error(t, err)
+}
+
+func TestOpenImageFlashrom(t *testing.T) {
+	dir, err := ioutil.TempDir("", "fmap-test")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+	chip := filepath.Join(dir, "chip.bin")
+	require.NoError(t, ioutil.WriteFile(chip, bytes.Repeat([]byte{0xff}, 0x100), 0644))
+	// a fake flashrom reading and writing chip.bin
+	script := "#!/bin/sh\ncase $3 in\n-r) cp " + chip + " $4 ;;\n-w) cp $4 " + chip + " ;;\nesac\n"
+	FlashromPath = filepath.Join(dir, "flashrom")
+	defer func() { FlashromPath = "flashrom" }()
+	require.NoError(t, ioutil.WriteFile(FlashromPath, []byte(script), 0755))
+
+	// closing discards the writes
+	img, err := fmap.OpenImage("flashrom://dummy", true)
+	require.NoError(t, err)
+	_, err = img.WriteAt([]byte{0}, 0x10)
+	require.NoError(t, err)
+	require.NoError(t, img.Close())
+	data, err := ioutil.ReadFile(chip)
+	require.NoError(t, err)
+	assert.Equal(t, byte(0xff), data[0x10])
+
+	// committing writes them to the chip
+	img, err = fmap.OpenImage("flashrom://dummy", true)
+	require.NoError(t, err)
+	_, err = img.WriteAt([]byte{0}, 0x10)
+	require.NoError(t, err)
+	require.NoError(t, img.Commit())
+	require.NoError(t, img.Close())
+	data, err = ioutil.ReadFile(chip)
+	require.NoError(t, err)
+	assert.Equal(t, byte(0), data[0x10])
+}
@@ -0,0 +1,84 @@
+package fmap
+
+import (
+	"bytes"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestOpenImageFile(t *testing.T) {
+	dir, err := ioutil.TempDir("", "fmap-test")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "image.bin")
+	require.NoError(t, ioutil.WriteFile(path, bytes.Repeat([]byte{0xff}, 0x1000), 0644))
+
+	img, err := OpenImage(path, false)
+	require.NoError(t, err)
+	size, err := img.Size()
+	require.NoError(t, err)
+	assert.Equal(t, int64(0x1000), size)
+	_, err = img.WriteAt([]byte{0}, 0)
+	assert.Equal(t, ErrReadOnlyImage, err)
+	require.NoError(t, img.Close())
+
+	// the writes are read back, and discarded if not committed
+	img, err = OpenImage("file://"+path, true)
+	require.NoError(t, err)
+	_, err = img.WriteAt([]byte("FMAP"), 0x10)
+	require.NoError(t, err)
+	buf := make([]byte, 6)
+	_, err = img.ReadAt(buf, 0xf)
+	require.NoError(t, err)
+	assert.Equal(t, []byte("\xffFMAP\xff"), buf)
+	_, err = img.WriteAt([]byte{0}, 0x1000)
+	assert.Error(t, err)
+	require.NoError(t, img.Close())
+	data, err := ioutil.ReadFile(path)
+	require.NoError(t, err)
+	assert.Equal(t, bytes.Repeat([]byte{0xff}, 0x1000), data)
+
+	img, err = OpenImage("file://"+path, true)
+	require.NoError(t, err)
+	_, err = img.WriteAt([]byte("FMAP"), 0x10)
+	require.NoError(t, err)
+	require.NoError(t, img.Commit())
+	require.NoError(t, img.Close())
+	data, err = ioutil.ReadFile(path)
+	require.NoError(t, err)
+	assert.Equal(t, []byte("FMAP"), data[0x10:0x14])
+
+	_, err = OpenImage("ftp://host/image.bin", false)
+	assert.Error(t, err)
+}
+
+func TestRegisterBackend(t *testing.T) {
+	dir, err := ioutil.TempDir("", "fmap-test")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+	RegisterBackend("test-dir", func(location string, writable bool) (Image, error) {
+		return openFileImage(filepath.Join(dir, strings.TrimPrefix(location, "test-dir://")), writable)
+	})
+	defer func() {
+		delete(backends, "test-dir")
+		backends["file"] = openFileImage
+	}()
+	assert.Contains(t, Backends(), "test-dir")
+	assert.Panics(t, func() { RegisterBackend("file", nil) })
+
+	require.NoError(t, ioutil.WriteFile(filepath.Join(dir, "x"), make([]byte, 0x100), 0644))
+	img, err := OpenImage("test-dir://x", true)
+	require.NoError(t, err)
+	defer img.Close()
+	n, err := img.WriteAt([]byte{1, 2}, 0xfe)
+	require.NoError(t, err)
+	assert.Equal(t, 2, n)
+	require.NoError(t, img.Commit())
+	assert.Equal(t, filepath.Join(dir, "x"), img.Name())
+}
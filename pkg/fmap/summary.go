@@ -0,0 +1,76 @@
+package fmap
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+)
+
+// Summary is a short description of a layout, see Section.Summary.
+type Summary struct {
+	Name string
+	// Base is the start of the root section, and Size its size in bytes.
+	Base int64
+	Size int64
+	// Sections is the number of sub-sections, at any depth.
+	Sections int
+	// ReadOnly is the number of bytes in read-only sections, see
+	// IsReadOnly.
+	ReadOnly int64
+	// Fingerprint is the SHA-256 hash, in hexadecimal, of the paths,
+	// offsets, sizes and flags of the sections. Layouts that only differ in
+	// formatting, comments or constants have the same fingerprint.
+	Fingerprint string
+}
+
+// ReadOnlyPercent returns the percentage of the flash that is read-only.
+func (sm Summary) ReadOnlyPercent() float64 {
+	if sm.Size <= 0 {
+		return 0
+	}
+	return float64(sm.ReadOnly) * 100 / float64(sm.Size)
+}
+
+// String returns the summary on a single line, with the first 12 digits of
+// the fingerprint, e.g.
+// "FLASH base=0xff000000 size=0x1000000 sections=33 ro=25.0% rw=75.0% fp=0123456789ab".
+func (sm Summary) String() string {
+	fp := sm.Fingerprint
+	if len(fp) > 12 {
+		fp = fp[:12]
+	}
+	ro := sm.ReadOnlyPercent()
+	return fmt.Sprintf("%s base=0x%x size=0x%x sections=%d ro=%.1f%% rw=%.1f%% fp=%s", sm.Name, sm.Base, sm.Size, sm.Sections, ro, 100-ro, fp)
+}
+
+// readOnlyBytes returns the number of bytes of the read-only sections of the
+// tree rooted at `s`.
+func readOnlyBytes(s *Section) int64 {
+	if s.IsReadOnly() {
+		return size(s)
+	}
+	var total int64
+	for _, sec := range s.Sections {
+		total += readOnlyBytes(sec)
+	}
+	return total
+}
+
+// Summary returns a short description of the layout rooted at `s`.
+func (s *Section) Summary() Summary {
+	sm := Summary{Name: s.Name, Size: size(s)}
+	if s.Start != nil {
+		sm.Base = *s.Start
+	}
+	sections := flatten(s)
+	sm.Sections = len(sections) - 1
+	h := sha256.New()
+	for _, fs := range sections {
+		fmt.Fprintf(h, "%s 0x%x 0x%x %s\n", fs.Path, fs.Offset, size(fs.Section), fs.Section.Flags)
+	}
+	sm.Fingerprint = hex.EncodeToString(h.Sum(nil))
+	if sm.ReadOnly = readOnlyBytes(s); sm.ReadOnly > sm.Size {
+		sm.ReadOnly = sm.Size
+	}
+	return sm
+}
@@ -0,0 +1,46 @@
+package fmap
+
+import (
+	"os"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestSummary(t *testing.T) {
+	f, err := Parse(strings.NewReader(`FLASH@0xff000000 0x10000 {
+	WP_RO 0x4000 {
+		FMAP 0x1000
+	}
+	RW 0xc000
+}`))
+	require.NoError(t, err)
+	sm := f.Summary()
+	assert.Equal(t, 3, sm.Sections)
+	assert.Equal(t, int64(0x4000), sm.ReadOnly)
+	assert.Equal(t, 25.0, sm.ReadOnlyPercent())
+	assert.Equal(t, 64, len(sm.Fingerprint))
+	assert.True(t, strings.HasPrefix(sm.String(), "FLASH base=0xff000000 size=0x10000 sections=3 ro=25.0% rw=75.0% fp="))
+	assert.Equal(t, len("fp=")+12, len(sm.String()[strings.Index(sm.String(), "fp="):]))
+
+	// the fingerprint does not depend on the formatting
+	g, err := Parse(strings.NewReader("define RO 16k\nFLASH@0xff000000 64k { WP_RO $RO { FMAP 4k } RW }"))
+	require.NoError(t, err)
+	assert.Equal(t, sm, g.Summary())
+
+	g.Find("FMAP", true).Size = 0x800
+	assert.NotEqual(t, sm.Fingerprint, g.Summary().Fingerprint)
+}
+
+func TestSummaryChromeOS(t *testing.T) {
+	fd, err := os.Open("test_data/chromeos.fmd")
+	require.NoError(t, err)
+	defer fd.Close()
+	f, err := Parse(fd)
+	require.NoError(t, err)
+	sm := f.Summary()
+	assert.Equal(t, 33, sm.Sections)
+	assert.Equal(t, f.Find("WP_RO", true).ByteSize(), sm.ReadOnly)
+}
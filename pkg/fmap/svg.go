@@ -0,0 +1,91 @@
+package fmap
+
+import (
+	"fmt"
+	"html"
+	"strings"
+)
+
+// Dimensions of the flash bar drawn by ToSVG, in pixels.
+const (
+	svgWidth    = 1200
+	svgRow      = 24
+	svgMinLabel = 7 // approximate width of a character of a label
+)
+
+// svgFills are the colors of the sections by depth.
+var svgFills = []string{"#e8f0fe", "#c6dafc", "#a1c2fa", "#7baaf7", "#5e97f6", "#4285f4"}
+
+// maxDepth returns the depth of the deepest descendant of `s`, 0 for a leaf.
+func maxDepth(s *Section) int {
+	depth := 0
+	_ = s.WalkWithDepth(PreOrder, func(_ *Section, d int) error {
+		if d > depth {
+			depth = d
+		}
+		return nil
+	})
+	return depth
+}
+
+// ToSVG returns a proportional picture of the flash as an SVG image: every
+// section is a rectangle whose width is its share of the flash, and
+// sub-sections are drawn inside their parents, one row lower. Sections are
+// labeled with their names if they are wide enough, and all of them have a
+// tooltip with their name, range relative to the root and size. Read-only
+// sections are grey, and free regions, see IsUnused, are white and dashed.
+func (s *Section) ToSVG() string {
+	total := size(s)
+	if total <= 0 {
+		total = 1
+	}
+	height := (maxDepth(s) + 2) * svgRow
+	var b strings.Builder
+	fmt.Fprintf(&b, "<svg xmlns=\"http://www.w3.org/2000/svg\" width=\"%d\" height=\"%d\" font-family=\"monospace\" font-size=\"12\">\n", svgWidth+1, height+1)
+	var visit func(sec *Section, offset int64, depth int)
+	visit = func(sec *Section, offset int64, depth int) {
+		x := float64(offset) * svgWidth / float64(total)
+		w := float64(size(sec)) * svgWidth / float64(total)
+		y := depth * svgRow
+		fill, dash := svgFills[depth%len(svgFills)], ""
+		switch {
+		case sec.IsReadOnly():
+			fill = "#dadce0"
+		case sec.IsUnused():
+			fill, dash = "#ffffff", " stroke-dasharray=\"4 2\""
+		}
+		title := fmt.Sprintf("%s: 0x%x-0x%x, 0x%x bytes", sec.Name, offset, offset+size(sec), size(sec))
+		if len(sec.Flags) > 0 {
+			title += " (" + sec.Flags.String() + ")"
+		}
+		fmt.Fprintf(&b, "<g><title>%s</title><rect x=\"%.2f\" y=\"%d\" width=\"%.2f\" height=\"%d\" fill=\"%s\" stroke=\"#202124\"%s/>", html.EscapeString(title), x, y, w, height-y, fill, dash)
+		if w >= float64((len(sec.Name)+1)*svgMinLabel) {
+			fmt.Fprintf(&b, "<text x=\"%.2f\" y=\"%d\">%s</text>", x+svgMinLabel/2, y+svgRow*2/3, html.EscapeString(sec.Name))
+		}
+		b.WriteString("</g>\n")
+		for idx, st := range childStarts(sec) {
+			visit(sec.Sections[idx], offset+st, depth+1)
+		}
+	}
+	visit(s, 0, 0)
+	b.WriteString("</svg>\n")
+	return b.String()
+}
+
+// ToHTML returns a standalone HTML page with the picture of the flash drawn
+// by ToSVG, followed by a table of the sections with their ranges relative to
+// the root, sizes and flags.
+func (s *Section) ToHTML() string {
+	var b strings.Builder
+	name := html.EscapeString(s.Name)
+	fmt.Fprintf(&b, "<!DOCTYPE html>\n<html>\n<head>\n<meta charset=\"utf-8\">\n<title>%s</title>\n", name)
+	b.WriteString("<style>body { font-family: sans-serif; } table { border-collapse: collapse; font-family: monospace; } td, th { padding: 2px 8px; text-align: left; }</style>\n")
+	fmt.Fprintf(&b, "</head>\n<body>\n<h1>%s</h1>\n", name)
+	b.WriteString(s.ToSVG())
+	b.WriteString("<table>\n<tr><th>Section</th><th>Start</th><th>End</th><th>Size</th><th>Flags</th></tr>\n")
+	for _, fs := range flatten(s) {
+		fmt.Fprintf(&b, "<tr><td>%s</td><td>0x%x</td><td>0x%x</td><td>0x%x</td><td>%s</td></tr>\n", html.EscapeString(fs.Path), fs.Offset, fs.Offset+size(fs.Section), size(fs.Section), html.EscapeString(fs.Section.Flags.String()))
+	}
+	b.WriteString("</table>\n</body>\n</html>\n")
+	return b.String()
+}
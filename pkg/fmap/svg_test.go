@@ -0,0 +1,48 @@
+package fmap
+
+import (
+	"encoding/xml"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestToSVG(t *testing.T) {
+	f, err := Parse(strings.NewReader(`FLASH 0x10000 {
+	WP_RO 0x4000 {
+		FMAP 0x1000
+		RO_UNUSED 0x3000
+	}
+	RW_MAIN(CBFS) 0xc000
+}`))
+	require.NoError(t, err)
+	svg := f.ToSVG()
+
+	// the output is well-formed XML
+	dec := xml.NewDecoder(strings.NewReader(svg))
+	for {
+		if _, err := dec.Token(); err != nil {
+			assert.Equal(t, "EOF", err.Error())
+			break
+		}
+	}
+	assert.Equal(t, 5, strings.Count(svg, "<rect "))
+	assert.Contains(t, svg, `<title>FLASH: 0x0-0x10000, 0x10000 bytes</title><rect x="0.00" y="0" width="1200.00" height="96"`)
+	assert.Contains(t, svg, `<title>RW_MAIN: 0x4000-0x10000, 0xc000 bytes (CBFS)</title><rect x="300.00" y="24" width="900.00" height="72"`)
+	assert.Contains(t, svg, `<title>RO_UNUSED: 0x1000-0x4000, 0x3000 bytes</title><rect x="75.00" y="48" width="225.00" height="48" fill="#dadce0"`)
+	assert.Contains(t, svg, `<text x="303.00" y="40">RW_MAIN</text>`)
+}
+
+func TestToHTML(t *testing.T) {
+	f, err := Parse(strings.NewReader(`FLASH 0x2000 {
+	A 0x1000
+	B(CBFS) 0x1000
+}`))
+	require.NoError(t, err)
+	page := f.ToHTML()
+	assert.True(t, strings.HasPrefix(page, "<!DOCTYPE html>\n"))
+	assert.Contains(t, page, f.ToSVG())
+	assert.Contains(t, page, "<tr><td>FLASH/B</td><td>0x1000</td><td>0x2000</td><td>0x1000</td><td>CBFS</td></tr>\n")
+}
@@ -0,0 +1,244 @@
+// Package syntax provides the grammar of the flashmap descriptor (fmd) files
+// and their abstract syntax tree, for tools that work at the syntax level, like
+// formatters and linters, without the manipulation logic of package fmap.
+// The tree is what is written in the file: expressions are not evaluated,
+// constants are not substituted, and includes are not expanded.
+package syntax
+
+import (
+	"io"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/alecthomas/participle"
+	"github.com/alecthomas/participle/lexer"
+)
+
+// File is a fmd file: constant definitions followed by the root section.
+type File struct {
+	Defines []*Define `{ @@ }`
+	Flash   *Section  `@@`
+}
+
+// Fragment is an included file: sections and includes, in any order.
+type Fragment struct {
+	Includes []*Include `{ @@`
+	Sections []*Section `  | @@ }`
+}
+
+// Define is a constant definition, e.g. "define ROM_SIZE 16M".
+type Define struct {
+	Name string `"define" @Ident`
+	Expr *Expr  `@@`
+
+	Pos lexer.Position
+}
+
+// Include is an `include "file.fmd"` directive in the body of a section.
+type Include struct {
+	Path string `"include" @String`
+
+	Pos lexer.Position
+}
+
+// Section is a section, e.g. `COREBOOT(CBFS)[alias=BOOT_STUB]@0x1000 1M`,
+// with its body. Includes and sub-sections are interleaved in the body, and
+// their positions tell their order.
+type Section struct {
+	Name       string       `@Ident`
+	Flags      []string     `("(" { @Ident } ")")?`
+	Attributes []*Attribute `("[" { @@ } "]")?`
+	Start      *Expr        `("@" @@)?`
+	Size       *Expr        `@@?`
+	Includes   []*Include   `("{" { @@`
+	Sections   []*Section   `    | @@ } "}")*`
+
+	// Pos and EndPos are the position of the first token of the section
+	// and of the first token following it.
+	Pos    lexer.Position
+	EndPos lexer.Position
+}
+
+// Attribute is a key=value pair in the square brackets of a section.
+type Attribute struct {
+	Key   string `@Ident "="`
+	Value string `@(Ident | String | Int)`
+}
+
+// Expr is an arithmetic expression, a sum of terms, e.g. "4k + 0x100".
+type Expr struct {
+	Left  *Term     `@@`
+	Right []*ExprOp `{ @@ }`
+}
+
+// ExprOp is an addition or subtraction in an Expr.
+type ExprOp struct {
+	Op   string `@("+" | "-")`
+	Term *Term  `@@`
+}
+
+// Term is a product of factors in an Expr.
+type Term struct {
+	Left  *Factor   `@@`
+	Right []*TermOp `{ @@ }`
+}
+
+// TermOp is a multiplication or division in a Term.
+type TermOp struct {
+	Op     string  `@("*" | "/")`
+	Factor *Factor `@@`
+}
+
+// Factor is a number, optionally followed by a unit, a reference to a
+// constant, e.g. "$ROM_SIZE", or a parenthesized expression.
+type Factor struct {
+	Number *Number `(   @Int`
+	Unit   string  `    @("k"|"K"|"m"|"M")?`
+	Const  string  `  | "$" @Ident`
+	Sub    *Expr   `  | "(" @@ ")" )`
+}
+
+// Number is an integer literal, with the base it is written in: 2, 8, 10 or
+// 16.
+type Number struct {
+	Value int64
+	Base  int
+}
+
+// Capture implements the participle.Capture interface.
+func (n *Number) Capture(values []string) error {
+	text := strings.Join(values, "")
+	v, err := strconv.ParseInt(text, 0, 64)
+	if err != nil {
+		return err
+	}
+	n.Value, n.Base = v, 10
+	lower := strings.ToLower(text)
+	switch {
+	case strings.HasPrefix(lower, "0x"):
+		n.Base = 16
+	case strings.HasPrefix(lower, "0b"):
+		n.Base = 2
+	case strings.HasPrefix(lower, "0o"), len(text) > 1 && text[0] == '0':
+		n.Base = 8
+	}
+	return nil
+}
+
+// ParseError is a syntax error, at the position of the offending token.
+type ParseError struct {
+	// Filename is the name of the file, empty if unknown.
+	Filename string
+	// Line and Column start at 1, and are 0 if unknown.
+	Line   int
+	Column int
+	// Token is the text of the offending token, empty at the end of the
+	// file.
+	Token   string
+	Message string
+}
+
+// Error implements the error interface, in the form "file:line:column:
+// message".
+func (e *ParseError) Error() string {
+	return lexer.FormatError(lexer.Position{Filename: e.Filename, Line: e.Line, Column: e.Column}, e.Message)
+}
+
+// parseError converts the errors of participle, which carry the offending
+// token, to a ParseError. Other errors are returned unchanged.
+func parseError(err error) error {
+	perr, ok := err.(interface {
+		Message() string
+		Token() lexer.Token
+	})
+	if !ok {
+		return err
+	}
+	tok := perr.Token()
+	ret := &ParseError{
+		Filename: tok.Pos.Filename,
+		Line:     tok.Pos.Line,
+		Column:   tok.Pos.Column,
+		Message:  perr.Message(),
+	}
+	if !tok.EOF() {
+		ret.Token = tok.Value
+	}
+	return ret
+}
+
+// grammars are the participle parsers of the grammars. Building them is
+// expensive, so they are built once, on first use, see build, and shared by
+// all the parses, which don't modify them.
+var grammars struct {
+	once                 sync.Once
+	err                  error
+	file, fragment, expr *participle.Parser
+}
+
+// build builds the parsers in grammars, if not built yet.
+func build() error {
+	grammars.once.Do(func() {
+		if grammars.file, grammars.err = participle.Build(&File{}); grammars.err != nil {
+			return
+		}
+		if grammars.fragment, grammars.err = participle.Build(&Fragment{}); grammars.err != nil {
+			return
+		}
+		grammars.expr, grammars.err = participle.Build(&Expr{})
+	})
+	return grammars.err
+}
+
+// Parse parses a fmd file. The positions in the tree refer to the file name
+// of `r`, if it has one, see lexer.NameOfReader. Syntax errors are returned as
+// a *ParseError.
+func Parse(r io.Reader) (*File, error) {
+	if err := build(); err != nil {
+		return nil, err
+	}
+	var f File
+	if err := grammars.file.Parse(r, &f); err != nil {
+		return nil, parseError(err)
+	}
+	return &f, nil
+}
+
+// ParseFragment parses an included file, like Parse.
+func ParseFragment(r io.Reader) (*Fragment, error) {
+	if err := build(); err != nil {
+		return nil, err
+	}
+	var frag Fragment
+	if err := grammars.fragment.Parse(r, &frag); err != nil {
+		return nil, parseError(err)
+	}
+	return &frag, nil
+}
+
+// ParseExpr parses an expression, e.g. the value of a constant given on the
+// command line.
+func ParseExpr(s string) (*Expr, error) {
+	if err := build(); err != nil {
+		return nil, err
+	}
+	var e Expr
+	if err := grammars.expr.ParseString(s, &e); err != nil {
+		return nil, parseError(err)
+	}
+	return &e, nil
+}
+
+// Lex returns the tokens of a fmd file, or of an included file, without the
+// comments and the whitespace.
+func Lex(r io.Reader) ([]lexer.Token, error) {
+	if err := build(); err != nil {
+		return nil, err
+	}
+	tokens, err := grammars.file.Lex(r)
+	if err != nil {
+		return nil, parseError(err)
+	}
+	return tokens, nil
+}
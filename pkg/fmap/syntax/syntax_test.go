@@ -0,0 +1,94 @@
+package syntax
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestParse(t *testing.T) {
+	f, err := Parse(strings.NewReader(`define ROM 16M
+FLASH@0xff000000 $ROM {
+	// a comment
+	COREBOOT(CBFS PRESERVE)[alias=BOOT_STUB]@0x1000 4k + 0x100
+	include "ro.fmd"
+	RW 010
+}`))
+	require.NoError(t, err)
+	require.Len(t, f.Defines, 1)
+	assert.Equal(t, "ROM", f.Defines[0].Name)
+	assert.Equal(t, &Number{Value: 16, Base: 10}, f.Defines[0].Expr.Left.Left.Number)
+	assert.Equal(t, "M", f.Defines[0].Expr.Left.Left.Unit)
+
+	flash := f.Flash
+	assert.Equal(t, "FLASH", flash.Name)
+	assert.Equal(t, "ROM", flash.Size.Left.Left.Const)
+	assert.Equal(t, &Number{Value: 0xff000000, Base: 16}, flash.Start.Left.Left.Number)
+	require.Len(t, flash.Sections, 2)
+	require.Len(t, flash.Includes, 1)
+	assert.Equal(t, "ro.fmd", flash.Includes[0].Path)
+
+	cb := flash.Sections[0]
+	assert.Equal(t, []string{"CBFS", "PRESERVE"}, cb.Flags)
+	assert.Equal(t, []*Attribute{{Key: "alias", Value: "BOOT_STUB"}}, cb.Attributes)
+	require.Len(t, cb.Size.Right, 1)
+	assert.Equal(t, "+", cb.Size.Right[0].Op)
+	assert.Equal(t, 4, cb.Pos.Line)
+	// the include is between the sections
+	assert.True(t, cb.Pos.Offset < flash.Includes[0].Pos.Offset)
+	assert.True(t, flash.Includes[0].Pos.Offset < flash.Sections[1].Pos.Offset)
+	assert.Equal(t, &Number{Value: 8, Base: 8}, flash.Sections[1].Size.Left.Left.Number)
+	assert.Nil(t, flash.Sections[1].Start)
+
+	_, err = Parse(strings.NewReader("FLASH 0x1000 {"))
+	assert.Error(t, err)
+}
+
+func TestParseFragment(t *testing.T) {
+	frag, err := ParseFragment(strings.NewReader(`A 0x1000
+include "b.fmd"
+C 0x1000 { D 0x800 }`))
+	require.NoError(t, err)
+	require.Len(t, frag.Sections, 2)
+	assert.Equal(t, "D", frag.Sections[1].Sections[0].Name)
+	require.Len(t, frag.Includes, 1)
+}
+
+func TestParseExpr(t *testing.T) {
+	e, err := ParseExpr("(1M - 0x10) * 2")
+	require.NoError(t, err)
+	require.NotNil(t, e.Left.Left.Sub)
+	assert.Equal(t, "*", e.Left.Right[0].Op)
+	assert.Equal(t, &Number{Value: 2, Base: 10}, e.Left.Right[0].Factor.Number)
+
+	_, err = ParseExpr("0x10 +")
+	assert.Error(t, err)
+}
+
+func TestLex(t *testing.T) {
+	tokens, err := Lex(strings.NewReader("FLASH 0x1000 /* comment */ {\n}"))
+	require.NoError(t, err)
+	var values []string
+	for _, tok := range tokens {
+		if !tok.EOF() {
+			values = append(values, tok.Value)
+		}
+	}
+	assert.Equal(t, []string{"FLASH", "0x1000", "{", "}"}, values)
+}
+
+func TestParseError(t *testing.T) {
+	_, err := Parse(strings.NewReader("FLASH 0x1000 {\n\tA(CBFS 0x100\n}"))
+	require.Error(t, err)
+	pe, ok := err.(*ParseError)
+	require.True(t, ok)
+	assert.Equal(t, 2, pe.Line)
+	assert.Equal(t, 9, pe.Column)
+	assert.Equal(t, "0x100", pe.Token)
+	assert.Equal(t, "2:9: "+pe.Message, pe.Error())
+
+	_, err = ParseExpr("0x10 +")
+	assert.IsType(t, &ParseError{}, err)
+}
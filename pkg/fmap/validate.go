@@ -0,0 +1,303 @@
+package fmap
+
+import (
+	"fmt"
+	"strings"
+)
+
+// CoverageError is returned by CheckCoverage when the leaf sections of a tree
+// do not exactly tile the root section.
+type CoverageError struct {
+	// Holes are the ranges of the root that are not covered by any leaf.
+	Holes []Region
+	// Overlaps are the ranges covered by more than one leaf. Sections lists
+	// the overlapping leaves.
+	Overlaps []Region
+	// Overflows are the ranges of leaves that extend past the end of the
+	// root, or start before its start.
+	Overflows []Region
+}
+
+// Error implements the error interface.
+func (e *CoverageError) Error() string {
+	var problems []string
+	for _, r := range e.Holes {
+		problems = append(problems, fmt.Sprintf("hole at 0x%x-0x%x", r.Offset, r.Offset+r.Size))
+	}
+	for _, r := range e.Overlaps {
+		problems = append(problems, fmt.Sprintf("overlap at 0x%x-0x%x between %s", r.Offset, r.Offset+r.Size, strings.Join(sectionNames(r.Sections), " and ")))
+	}
+	for _, r := range e.Overflows {
+		if r.Offset < 0 {
+			problems = append(problems, fmt.Sprintf("%s starts 0x%x bytes before the flash", r.Name(), -r.Offset))
+			continue
+		}
+		problems = append(problems, fmt.Sprintf("%s overflows the flash at 0x%x-0x%x", r.Name(), r.Offset, r.Offset+r.Size))
+	}
+	return "leaf sections do not tile the flash: " + strings.Join(problems, "; ")
+}
+
+// CheckCoverage verifies that the leaf sections of the tree, including any
+// UNUSED fillers, cover the whole range of `s` exactly once, with no holes
+// and no overlaps. This is the property flash programmers depend on. Markers,
+// see IsMarker, cover nothing and are ignored. It returns nil if the layout is
+// fully covered, or a *CoverageError describing every problem otherwise.
+func (s *Section) CheckCoverage() error {
+	if len(s.Sections) == 0 {
+		return nil
+	}
+	var (
+		cerr CoverageError
+		// cursor is the end of the covered area so far, and `last` the leaf
+		// that reaches it.
+		cursor int64
+		last   *Section
+	)
+	for _, leaf := range s.Leaves(false) {
+		if leaf.Size == 0 {
+			continue
+		}
+		sec := leaf.Sections[0]
+		start, end := leaf.Offset, leaf.Offset+leaf.Size
+		if start < 0 {
+			// the part before the root is out of bounds, and the rest is
+			// checked like a leaf starting at 0
+			cerr.Overflows = append(cerr.Overflows, Region{Offset: start, Size: minInt64(end, 0) - start, Sections: []*Section{sec}})
+			if end <= 0 {
+				continue
+			}
+			start = 0
+		}
+		if start > cursor {
+			cerr.Holes = append(cerr.Holes, Region{Offset: cursor, Size: start - cursor})
+		} else if start < cursor && last != nil {
+			if overlapEnd := minInt64(cursor, end); overlapEnd > start {
+				cerr.Overlaps = append(cerr.Overlaps, Region{
+					Offset:   start,
+					Size:     overlapEnd - start,
+					Sections: []*Section{last, sec},
+				})
+			}
+		}
+		if end > size(s) {
+			if start < size(s) {
+				start = size(s)
+			}
+			cerr.Overflows = append(cerr.Overflows, Region{Offset: start, Size: end - start, Sections: []*Section{sec}})
+		}
+		if end > cursor {
+			cursor = end
+			last = sec
+		}
+	}
+	if cursor < size(s) {
+		cerr.Holes = append(cerr.Holes, Region{Offset: cursor, Size: size(s) - cursor})
+	}
+	if len(cerr.Holes) == 0 && len(cerr.Overlaps) == 0 && len(cerr.Overflows) == 0 {
+		return nil
+	}
+	return &cerr
+}
+
+// Severity is the severity of a Violation.
+type Severity int
+
+// Violation severities. Errors make a layout unusable, while warnings point at
+// things that should be fixed eventually, like deprecated sections.
+const (
+	SeverityError Severity = iota
+	SeverityWarning
+)
+
+// String returns the name of the severity.
+func (s Severity) String() string {
+	switch s {
+	case SeverityError:
+		return "error"
+	case SeverityWarning:
+		return "warning"
+	default:
+		return fmt.Sprintf("Severity(%d)", int(s))
+	}
+}
+
+// Violation is a structural problem found by Validate.
+type Violation struct {
+	Severity Severity
+	// Path is the path of the offending section, made of the names of its
+	// ancestors and its own, separated by "/", e.g. "FLASH/SI_BIOS/SMMSTORE".
+	Path    string
+	Section *Section
+	Message string
+}
+
+// Error implements the error interface. The message includes the source span
+// and the last transform of the offending section, if known.
+func (v Violation) Error() string {
+	if origin := v.Section.Origin(); origin != "" {
+		return fmt.Sprintf("%s (%s): %s", v.Path, origin, v.Message)
+	}
+	return fmt.Sprintf("%s: %s", v.Path, v.Message)
+}
+
+// Validate checks the structure of the section tree: that starts and sizes
+// are non-negative, that every sub-section fits within its parent, and that
+// sibling sections do not overlap. Deprecated sections are reported as
+// warnings. Markers, see IsMarker, never overlap with their siblings, but
+// must be leaves. It returns the list of violations found, which is empty if
+// the layout is valid.
+func (s *Section) Validate() []Violation {
+	return s.ValidateWith(ValidateOptions{})
+}
+
+// ValidateOptions are the options of ValidateWith.
+type ValidateOptions struct {
+	// ZeroSize is how zero-size sections are reported.
+	ZeroSize ZeroSizePolicy
+	// DuplicateNames reports as errors the sections whose name is already
+	// used by another section, anywhere in the tree.
+	DuplicateNames bool
+	// Align, if not zero, reports as errors the sections whose start,
+	// relative to the root, or size in bytes is not a multiple of it, e.g.
+	// the erase block size of the flash.
+	Align int64
+}
+
+// ValidateWith is like Validate, with the given options. The violations of
+// the checks enabled by the options are listed after the other ones.
+func (s *Section) ValidateWith(opts ValidateOptions) []Violation {
+	var violations []Violation
+	validate(s, s.Name, opts, &violations)
+	if opts.DuplicateNames {
+		for _, v := range duplicateNames(s) {
+			v.Severity = SeverityError
+			violations = append(violations, v)
+		}
+	}
+	if opts.Align > 0 {
+		for _, fs := range flatten(s) {
+			if fs.Offset%opts.Align != 0 {
+				violations = append(violations, Violation{Path: fs.Path, Section: fs.Section, Message: fmt.Sprintf("start 0x%x is not aligned to 0x%x", fs.Offset, opts.Align)})
+			}
+			if size(fs.Section)%opts.Align != 0 {
+				violations = append(violations, Violation{Path: fs.Path, Section: fs.Section, Message: fmt.Sprintf("size 0x%x is not a multiple of 0x%x", size(fs.Section), opts.Align)})
+			}
+		}
+	}
+	return violations
+}
+
+// duplicateNames returns the sections of the tree `s` whose name is already
+// used by a section that precedes them in pre-order, with no severity.
+func duplicateNames(s *Section) []Violation {
+	var ret []Violation
+	seen := make(map[string]string)
+	for _, fs := range flatten(s) {
+		if first, ok := seen[fs.Section.Name]; ok {
+			ret = append(ret, Violation{Path: fs.Path, Section: fs.Section, Message: "duplicate section name, also used by " + first})
+		} else {
+			seen[fs.Section.Name] = fs.Path
+		}
+	}
+	return ret
+}
+
+// validate checks the sub-sections of `s`, whose path is `path`, recursively.
+func validate(s *Section, path string, opts ValidateOptions, violations *[]Violation) {
+	report := func(sec *Section, path, format string, args ...interface{}) {
+		*violations = append(*violations, Violation{Path: path, Section: sec, Message: fmt.Sprintf(format, args...)})
+	}
+	if replacement, ok := s.Deprecated(); ok {
+		msg := "section is deprecated"
+		if replacement != "" {
+			msg += ", replaced by " + replacement
+		}
+		*violations = append(*violations, Violation{Severity: SeverityWarning, Path: path, Section: s, Message: msg})
+	}
+	if s.Start != nil && *s.Start < 0 {
+		report(s, path, "negative start %d", *s.Start)
+	}
+	if s.Size < 0 {
+		report(s, path, "negative size %d", s.Size)
+	} else if _, err := mulInt64(s.Size, unitSize(s.Unit)); err != nil {
+		report(s, path, "size %d%s overflows 64 bits", s.Size, s.Unit)
+	}
+	if s.IsMarker() {
+		switch {
+		case len(s.Sections) > 0:
+			report(s, path, "zero-size section has sub-sections")
+		case opts.ZeroSize == ZeroSizeError:
+			report(s, path, "zero-size section")
+		case opts.ZeroSize == ZeroSizeWarn:
+			*violations = append(*violations, Violation{Severity: SeverityWarning, Path: path, Section: s, Message: "zero-size section"})
+		}
+	}
+	overlapping := make(map[*Section]overlap)
+	for _, o := range overlaps(s) {
+		overlapping[o.sec] = o
+	}
+	secs, starts := sortedChildren(s)
+	for idx, sec := range secs {
+		secPath := path + "/" + sec.Name
+		if end := starts[idx] + size(sec); end > size(s) {
+			report(sec, secPath, "ends at 0x%x, past the end of %s (size 0x%x)", end, s.Name, size(s))
+		}
+		if o, ok := overlapping[sec]; ok {
+			report(sec, secPath, "%s", o)
+		}
+	}
+	for _, sec := range s.Sections {
+		validate(sec, path+"/"+sec.Name, opts, violations)
+	}
+}
+
+// overlap is a sub-section overlapping at start-end with a sibling that starts
+// before it.
+type overlap struct {
+	sec, with  *Section
+	start, end int64
+}
+
+// String returns a description of the overlap.
+func (o overlap) String() string {
+	return fmt.Sprintf("overlaps with %s at 0x%x-0x%x", o.with.Name, o.start, o.end)
+}
+
+// overlaps returns the overlaps between the sub-sections of `s`, ordered by
+// start. Markers, see IsMarker, never overlap.
+func overlaps(s *Section) []overlap {
+	var ret []overlap
+	secs, starts := sortedChildren(s)
+	// track the sub-section that reaches the highest end so far
+	var last *Section
+	lastEnd := int64(0)
+	for idx, sec := range secs {
+		if sec.IsMarker() {
+			continue
+		}
+		start, end := starts[idx], starts[idx]+size(sec)
+		if last != nil && start < lastEnd {
+			ret = append(ret, overlap{sec: sec, with: last, start: start, end: minInt64(end, lastEnd)})
+		}
+		if last == nil || end > lastEnd {
+			last, lastEnd = sec, end
+		}
+	}
+	return ret
+}
+
+// minInt64 returns the smaller of two integers.
+func minInt64(a, b int64) int64 {
+	if a < b {
+		return a
+	}
+	return b
+}
+
+// maxInt64 returns the larger of two integers.
+func maxInt64(a, b int64) int64 {
+	if a > b {
+		return a
+	}
+	return b
+}
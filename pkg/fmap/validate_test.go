@@ -0,0 +1,199 @@
+package fmap
+
+import (
+	"os"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestCheckCoverage(t *testing.T) {
+	fd, err := os.Open("test_data/chromeos.fmd")
+	require.NoError(t, err)
+	defer fd.Close()
+	f, err := Parse(fd)
+	require.NoError(t, err)
+	require.NoError(t, f.CheckCoverage())
+}
+
+func TestCheckCoverageHoles(t *testing.T) {
+	fd, err := os.Open("test_data/chromeos.fmd")
+	require.NoError(t, err)
+	defer fd.Close()
+	f, err := Parse(fd)
+	require.NoError(t, err)
+
+	// removing a section without defragmenting leaves a hole
+	require.True(t, f.Remove("RW_MISC", true))
+	err = f.CheckCoverage()
+	require.Error(t, err)
+	cerr, ok := err.(*CoverageError)
+	require.True(t, ok)
+	require.Equal(t, 1, len(cerr.Holes))
+	assert.Equal(t, int64(0x9d0000), cerr.Holes[0].Offset)
+	assert.Equal(t, int64(0x30000), cerr.Holes[0].Size)
+	assert.Empty(t, cerr.Overlaps)
+	assert.Empty(t, cerr.Overflows)
+	assert.Equal(t, "leaf sections do not tile the flash: hole at 0x9d0000-0xa00000", err.Error())
+}
+
+func TestCheckCoverageOverlapAndOverflow(t *testing.T) {
+	f, err := Parse(strings.NewReader(`FLASH 0x4000 {
+	A@0x0 0x2000
+	B@0x1000 0x2000
+	C@0x3000 0x2000
+}`))
+	require.NoError(t, err)
+	err = f.CheckCoverage()
+	require.Error(t, err)
+	cerr, ok := err.(*CoverageError)
+	require.True(t, ok)
+	assert.Empty(t, cerr.Holes)
+	require.Equal(t, 1, len(cerr.Overlaps))
+	assert.Equal(t, "A+B", cerr.Overlaps[0].Name())
+	require.Equal(t, 1, len(cerr.Overflows))
+	assert.Equal(t, "leaf sections do not tile the flash: overlap at 0x1000-0x2000 between A and B; C overflows the flash at 0x4000-0x5000", err.Error())
+}
+
+func TestCheckCoverageNegativeStart(t *testing.T) {
+	f, err := ParseString("FLASH 0x1000 {\n\tA@0-0x10 0x100\n\tB 0x100\n}")
+	require.NoError(t, err)
+	err = f.CheckCoverage()
+	require.Error(t, err)
+	cerr, ok := err.(*CoverageError)
+	require.True(t, ok)
+	assert.Empty(t, cerr.Overlaps)
+	require.Equal(t, 1, len(cerr.Overflows))
+	assert.Equal(t, int64(-0x10), cerr.Overflows[0].Offset)
+	assert.Equal(t, int64(0x10), cerr.Overflows[0].Size)
+	assert.Equal(t, "leaf sections do not tile the flash: hole at 0x1f0-0x1000; A starts 0x10 bytes before the flash", err.Error())
+}
+
+func TestCheckCoverageNoSections(t *testing.T) {
+	f := Section{Name: "FLASH", Size: 0x1000}
+	require.NoError(t, f.CheckCoverage())
+}
+
+func TestValidate(t *testing.T) {
+	fd, err := os.Open("test_data/chromeos.fmd")
+	require.NoError(t, err)
+	defer fd.Close()
+	f, err := Parse(fd)
+	require.NoError(t, err)
+	assert.Empty(t, f.Validate())
+}
+
+func TestValidateViolations(t *testing.T) {
+	f, err := Parse(strings.NewReader(`FLASH 0x4000 {
+	A@0x0 0x2000 {
+		A1@0x1000 0x2000
+	}
+	B@0x1000 0x1000
+	C@0x3000 0x2000
+}`))
+	require.NoError(t, err)
+	violations := f.Validate()
+	require.Equal(t, 3, len(violations))
+	assert.Equal(t, "FLASH/B", violations[0].Path)
+	assert.Equal(t, "FLASH/B (5): overlaps with A at 0x1000-0x2000", violations[0].Error())
+	assert.Equal(t, "FLASH/C", violations[1].Path)
+	assert.Equal(t, "FLASH/C (6): ends at 0x5000, past the end of FLASH (size 0x4000)", violations[1].Error())
+	assert.Equal(t, "FLASH/A/A1", violations[2].Path)
+	assert.Equal(t, f.Find("A1", true), violations[2].Section)
+}
+
+func TestValidateNegative(t *testing.T) {
+	start := int64(-0x1000)
+	f := Section{Name: "FLASH", Size: 0x1000, Sections: []*Section{
+		{Name: "A", Start: &start, Size: 0x1000},
+	}}
+	violations := f.Validate()
+	require.Equal(t, 1, len(violations))
+	assert.Equal(t, "FLASH/A: negative start -4096", violations[0].Error())
+}
+
+func TestValidateSizeOverflow(t *testing.T) {
+	f := Section{Name: "FLASH", Size: 1 << 60, Unit: "M"}
+	violations := f.Validate()
+	require.Equal(t, 1, len(violations))
+	assert.Equal(t, "FLASH: size 1152921504606846976M overflows 64 bits", violations[0].Error())
+}
+
+func TestValidateDeprecated(t *testing.T) {
+	f, err := Parse(strings.NewReader(`FLASH 0x4000 {
+	RW_LEGACY(CBFS)[deprecated=RW_PAYLOAD] 0x2000
+	RW_PAYLOAD(CBFS) 0x2000
+}`))
+	require.NoError(t, err)
+	legacy := f.Find("RW_LEGACY", false)
+	replacement, ok := legacy.Deprecated()
+	require.True(t, ok)
+	assert.Equal(t, "RW_PAYLOAD", replacement)
+	_, ok = f.Find("RW_PAYLOAD", false).Deprecated()
+	assert.False(t, ok)
+
+	violations := f.Validate()
+	require.Equal(t, 1, len(violations))
+	assert.Equal(t, SeverityWarning, violations[0].Severity)
+	assert.Equal(t, "FLASH/RW_LEGACY (2): section is deprecated, replaced by RW_PAYLOAD", violations[0].Error())
+
+	f.Find("RW_PAYLOAD", false).Deprecate("")
+	violations = f.Validate()
+	require.Equal(t, 2, len(violations))
+	assert.Equal(t, "FLASH/RW_PAYLOAD (3): section is deprecated", violations[1].Error())
+	legacy.Deprecate("RW_NEW")
+	replacement, _ = legacy.Deprecated()
+	assert.Equal(t, "RW_NEW", replacement)
+	assert.Equal(t, 1, len(legacy.Attributes))
+}
+
+func TestValidateDuplicateNames(t *testing.T) {
+	f, err := ParseString(`FLASH 0x4000 {
+	RW_A 0x2000 {
+		VBLOCK 0x1000
+	}
+	RW_B 0x2000 {
+		VBLOCK 0x1000
+	}
+}`)
+	require.NoError(t, err)
+	assert.Empty(t, f.Validate())
+
+	violations := f.ValidateWith(ValidateOptions{DuplicateNames: true})
+	require.Equal(t, 1, len(violations))
+	assert.Equal(t, SeverityError, violations[0].Severity)
+	assert.Equal(t, "FLASH/RW_B/VBLOCK (6): duplicate section name, also used by FLASH/RW_A/VBLOCK", violations[0].Error())
+}
+
+func TestValidateAlign(t *testing.T) {
+	f, err := ParseString(`FLASH 0x4000 {
+	A 0x1000 {
+		A1@0x800 0x800
+	}
+	B 0x1800
+	MARK@0x2800 0
+	C 0x1000
+}`)
+	require.NoError(t, err)
+	assert.Empty(t, f.ValidateWith(ValidateOptions{Align: 0x800}))
+
+	var msgs []string
+	for _, v := range f.ValidateWith(ValidateOptions{Align: 0x1000}) {
+		assert.Equal(t, SeverityError, v.Severity)
+		msgs = append(msgs, v.Path+": "+v.Message)
+	}
+	assert.Equal(t, []string{
+		"FLASH/A/A1: start 0x800 is not aligned to 0x1000",
+		"FLASH/A/A1: size 0x800 is not a multiple of 0x1000",
+		"FLASH/B: size 0x1800 is not a multiple of 0x1000",
+		"FLASH/MARK: start 0x2800 is not aligned to 0x1000",
+		"FLASH/C: start 0x2800 is not aligned to 0x1000",
+	}, msgs)
+}
+
+func TestSeverityString(t *testing.T) {
+	assert.Equal(t, "error", SeverityError.String())
+	assert.Equal(t, "warning", SeverityWarning.String())
+}
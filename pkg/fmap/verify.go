@@ -0,0 +1,68 @@
+package fmap
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+)
+
+// Verification is the result of checking that a section of an image holds the
+// data that was written to it, see VerifySection.
+type Verification struct {
+	Section *Section
+	// Offset and Size are the range that was checked, relative to the start
+	// of the image.
+	Offset int64
+	Size   int64
+	// Want and Got are the SHA-256 hashes of the intended content of the
+	// range and of its actual content.
+	Want string
+	Got  string
+}
+
+// OK returns true if the section holds the intended content.
+func (v Verification) OK() bool {
+	return v.Want == v.Got
+}
+
+// String returns a description of the verification.
+func (v Verification) String() string {
+	if v.OK() {
+		return fmt.Sprintf("%s: ok, 0x%x bytes at 0x%x, %s %s", v.Section.Path(), v.Size, v.Offset, HashAlgorithmSHA256, v.Got)
+	}
+	return fmt.Sprintf("%s: mismatch, 0x%x bytes at 0x%x, want %s %s, got %s", v.Section.Path(), v.Size, v.Offset, HashAlgorithmSHA256, v.Want, v.Got)
+}
+
+// VerifySection reads back the range of `sec`, which must be part of the tree
+// rooted at `s`, from a flash image, and compares it with the data written to
+// it by InjectSection with the same `data` and `pad` arguments: the whole
+// section if `pad` is true, and only the length of `data` otherwise. Offsets in
+// the image are relative to the start of `s`. A mismatch is not an error, see
+// Verification.OK.
+func (s *Section) VerifySection(image io.ReaderAt, sec *Section, data []byte, pad bool) (Verification, error) {
+	offset, ok := offsetOf(s, sec)
+	if !ok {
+		return Verification{}, fmt.Errorf("section %s is not part of %s", sec.Name, s.Name)
+	}
+	want := data
+	if pad && int64(len(data)) < size(sec) {
+		want = append(append([]byte(nil), data...), bytes.Repeat([]byte{0xff}, int(size(sec))-len(data))...)
+	}
+	got := make([]byte, len(want))
+	if _, err := image.ReadAt(got, offset); err != nil {
+		if err == io.EOF {
+			return Verification{}, sectionErrorf(sec, "range 0x%x-0x%x extends past the end of the image", offset, offset+int64(len(want)))
+		}
+		return Verification{}, err
+	}
+	wantSum, gotSum := sha256.Sum256(want), sha256.Sum256(got)
+	return Verification{
+		Section: sec,
+		Offset:  offset,
+		Size:    int64(len(want)),
+		Want:    hex.EncodeToString(wantSum[:]),
+		Got:     hex.EncodeToString(gotSum[:]),
+	}, nil
+}
@@ -0,0 +1,49 @@
+package fmap
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestVerifySection(t *testing.T) {
+	f, err := Parse(strings.NewReader(imageLayout))
+	require.NoError(t, err)
+	coreboot := f.Find("COREBOOT", true)
+
+	image := memImage(testImage())
+	require.NoError(t, f.InjectSection(image, coreboot, []byte{0xaa, 0xbb}, true))
+	v, err := f.VerifySection(bytes.NewReader(image), coreboot, []byte{0xaa, 0xbb}, true)
+	require.NoError(t, err)
+	assert.True(t, v.OK())
+	assert.Equal(t, int64(0x1000), v.Offset)
+	assert.Equal(t, int64(0x1000), v.Size)
+	assert.True(t, strings.HasPrefix(v.String(), "FLASH/RO/COREBOOT: ok, 0x1000 bytes at 0x1000, sha256 "))
+
+	// without padding, only the payload is checked
+	v, err = f.VerifySection(bytes.NewReader(image), coreboot, []byte{0xaa}, false)
+	require.NoError(t, err)
+	assert.True(t, v.OK())
+	assert.Equal(t, int64(1), v.Size)
+
+	image[0x1fff] = 0
+	v, err = f.VerifySection(bytes.NewReader(image), coreboot, []byte{0xaa, 0xbb}, true)
+	require.NoError(t, err)
+	assert.False(t, v.OK())
+	assert.Contains(t, v.String(), "FLASH/RO/COREBOOT: mismatch")
+}
+
+func TestVerifySectionErrors(t *testing.T) {
+	f, err := Parse(strings.NewReader(imageLayout))
+	require.NoError(t, err)
+
+	_, err = f.VerifySection(bytes.NewReader(testImage()[:0x3000]), f.Find("RW_VPD", true), nil, true)
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "extends past the end of the image")
+
+	_, err = f.VerifySection(bytes.NewReader(testImage()), &Section{Name: "OTHER"}, nil, true)
+	require.Error(t, err)
+}
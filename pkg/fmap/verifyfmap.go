@@ -0,0 +1,122 @@
+package fmap
+
+import "fmt"
+
+// MismatchKind is the kind of difference between a layout and a binary FMAP,
+// see FMAPMismatch.
+type MismatchKind string
+
+// Kinds of mismatches reported by VerifyFMAP.
+const (
+	// MismatchHeader is a FMAP name, base or size that differs.
+	MismatchHeader MismatchKind = "header"
+	// MismatchMissing is a section of the layout without an area in the
+	// FMAP.
+	MismatchMissing MismatchKind = "missing"
+	// MismatchExtra is an area of the FMAP without a section in the layout.
+	MismatchExtra MismatchKind = "extra"
+	// MismatchOffset and MismatchSize are an area at a different offset,
+	// or with a different size, than its section.
+	MismatchOffset MismatchKind = "offset"
+	MismatchSize   MismatchKind = "size"
+	// MismatchFlags is an area whose PRESERVE flag differs from the one of
+	// its section.
+	MismatchFlags MismatchKind = "flags"
+)
+
+// FMAPMismatch is a difference between a layout and a binary FMAP.
+type FMAPMismatch struct {
+	Kind MismatchKind `json:"kind"`
+	// Name is the name of the area, empty for the header.
+	Name    string `json:"name,omitempty"`
+	Message string `json:"message"`
+}
+
+// String returns a description of the mismatch.
+func (m FMAPMismatch) String() string {
+	if m.Name == "" {
+		return "header: " + m.Message
+	}
+	return m.Name + ": " + m.Message
+}
+
+// VerifyFMAP compares the layout `s` with `embedded`, the binary FMAP of an
+// image, e.g. found by ScanImage, to catch a layout that drifted from what the
+// build embedded. Both are converted to their canonical form, the header and
+// the flat list of areas of ToBinary, with offsets relative to the start of
+// the flash, and areas are matched by name, the n-th area with a name in the
+// layout with the n-th one in the FMAP, ordered by offset. The base of the
+// FMAP is compared only if the root of the layout has a start, and only the
+// PRESERVE flag is compared, as the other area flags have no fmd
+// representation. The mismatches of the header come first, then the ones of
+// the sections of the layout, ordered by offset, then the extra areas of the
+// FMAP. An error is returned if either tree cannot be written as a binary
+// FMAP.
+func (s *Section) VerifyFMAP(embedded *Section) ([]FMAPMismatch, error) {
+	wantHdr, want, err := toAreas(s)
+	if err != nil {
+		return nil, err
+	}
+	gotHdr, got, err := toAreas(embedded)
+	if err != nil {
+		return nil, err
+	}
+
+	var ret []FMAPMismatch
+	mismatch := func(kind MismatchKind, name, format string, args ...interface{}) {
+		ret = append(ret, FMAPMismatch{Kind: kind, Name: name, Message: fmt.Sprintf(format, args...)})
+	}
+	if s.Name != embedded.Name {
+		mismatch(MismatchHeader, "", "the layout is called %s, but the FMAP %s", s.Name, embedded.Name)
+	}
+	if s.Start != nil && wantHdr.Base != gotHdr.Base {
+		mismatch(MismatchHeader, "", "the layout has base 0x%x, but the FMAP 0x%x", wantHdr.Base, gotHdr.Base)
+	}
+	if wantHdr.Size != gotHdr.Size {
+		mismatch(MismatchHeader, "", "the layout has size 0x%x, but the FMAP 0x%x", wantHdr.Size, gotHdr.Size)
+	}
+
+	sortAreas(want)
+	sortAreas(got)
+	// the areas of the FMAP with each name, in order, and whether they were
+	// matched
+	byName := make(map[[NameLen]byte][]int)
+	for idx, area := range got {
+		byName[area.Name] = append(byName[area.Name], idx)
+	}
+	matched := make([]bool, len(got))
+	for _, w := range want {
+		name, _ := parseName(w.Name)
+		candidates := byName[w.Name]
+		if len(candidates) == 0 {
+			mismatch(MismatchMissing, name, "0x%x-0x%x in the layout, not in the FMAP", w.Offset, uint64(w.Offset)+uint64(w.Size))
+			continue
+		}
+		g := got[candidates[0]]
+		matched[candidates[0]], byName[w.Name] = true, candidates[1:]
+		if w.Offset != g.Offset {
+			mismatch(MismatchOffset, name, "the layout has offset 0x%x, but the FMAP 0x%x", w.Offset, g.Offset)
+		}
+		if w.Size != g.Size {
+			mismatch(MismatchSize, name, "the layout has size 0x%x, but the FMAP 0x%x", w.Size, g.Size)
+		}
+		if w.Flags != g.Flags {
+			mismatch(MismatchFlags, name, "the layout has flags %q, but the FMAP %q", areaFlagNames(w.Flags), areaFlagNames(g.Flags))
+		}
+	}
+	for idx, g := range got {
+		if !matched[idx] {
+			name, _ := parseName(g.Name)
+			mismatch(MismatchExtra, name, "0x%x-0x%x in the FMAP, not in the layout", g.Offset, uint64(g.Offset)+uint64(g.Size))
+		}
+	}
+	return ret, nil
+}
+
+// areaFlagNames returns the fmd flags corresponding to binary FMAP flags.
+func areaFlagNames(flags uint16) string {
+	if AreaFlags(flags)&AreaPreserve != 0 {
+		return string(FlagPreserve)
+	}
+	return ""
+}
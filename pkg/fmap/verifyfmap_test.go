@@ -0,0 +1,61 @@
+package fmap
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestVerifyFMAP(t *testing.T) {
+	layout, err := ParseString(`FLASH@0xff000000 0x10000 {
+	RO 0x8000 {
+		FMAP 0x1000
+		GBB 0x7000
+	}
+	RW_A(PRESERVE) 0x4000
+	RW_B 0x4000
+}`)
+	require.NoError(t, err)
+	bin, err := layout.ToBinary()
+	require.NoError(t, err)
+	embedded, err := FromBinary(bin)
+	require.NoError(t, err)
+	mismatches, err := layout.VerifyFMAP(embedded)
+	require.NoError(t, err)
+	assert.Empty(t, mismatches)
+
+	// the build embedded an older layout
+	embedded, err = ParseString(`FLASH@0xfe000000 0x10000 {
+	RO 0x8000 {
+		FMAP 0x1000
+		GBB 0x6000
+		VPD 0x1000
+	}
+	RW_A 0x4000
+	RW_B@0xa000 0x4000
+}`)
+	require.NoError(t, err)
+	mismatches, err = layout.VerifyFMAP(embedded)
+	require.NoError(t, err)
+	assert.Equal(t, []FMAPMismatch{
+		{Kind: MismatchHeader, Message: "the layout has base 0xff000000, but the FMAP 0xfe000000"},
+		{Kind: MismatchSize, Name: "GBB", Message: "the layout has size 0x7000, but the FMAP 0x6000"},
+		{Kind: MismatchFlags, Name: "RW_A", Message: `the layout has flags "PRESERVE", but the FMAP ""`},
+		{Kind: MismatchOffset, Name: "RW_B", Message: "the layout has offset 0xc000, but the FMAP 0xa000"},
+		{Kind: MismatchExtra, Name: "VPD", Message: "0x7000-0x8000 in the FMAP, not in the layout"},
+	}, mismatches)
+	assert.Equal(t, "header: the layout has base 0xff000000, but the FMAP 0xfe000000", mismatches[0].String())
+
+	// the areas missing from the FMAP are the extra ones the other way round
+	mismatches, err = embedded.VerifyFMAP(layout)
+	require.NoError(t, err)
+	assert.Contains(t, mismatches, FMAPMismatch{Kind: MismatchMissing, Name: "VPD", Message: "0x7000-0x8000 in the layout, not in the FMAP"})
+
+	// the base is not compared without a start
+	layout.Start = nil
+	mismatches, err = layout.VerifyFMAP(embedded)
+	require.NoError(t, err)
+	assert.Len(t, mismatches, 4)
+	assert.NotEqual(t, MismatchHeader, mismatches[0].Kind)
+}
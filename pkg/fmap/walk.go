@@ -0,0 +1,76 @@
+package fmap
+
+import "errors"
+
+// WalkOrder is the order in which Walk visits the sections.
+type WalkOrder int
+
+// Walk orders.
+const (
+	// PreOrder visits a section before its sub-sections.
+	PreOrder WalkOrder = iota
+	// PostOrder visits a section after its sub-sections.
+	PostOrder
+)
+
+// SkipSubSections can be returned by the function called by Walk in pre-order
+// to skip the sub-sections of the visited section. Walk does not return it.
+var SkipSubSections = errors.New("skip the sub-sections")
+
+// StopWalk can be returned by the function called by Walk to stop the walk
+// early. Walk does not return it.
+var StopWalk = errors.New("stop the walk")
+
+// Walk calls `fn` for `s` and all of its sub-sections, recursively, in the
+// given order. Sub-sections are visited in the order they are listed. If `fn`
+// returns an error, the walk stops and Walk returns it, unless it is StopWalk,
+// and Walk then returns nil. In pre-order, `fn` can return SkipSubSections to
+// skip the sub-sections of the visited section, and can change them: the
+// sub-sections visited are the ones of the section after `fn` returns.
+func (s *Section) Walk(order WalkOrder, fn func(sec *Section) error) error {
+	return s.walk(order, func(sec, _ *Section, _ int) error { return fn(sec) })
+}
+
+// WalkWithParent is like Walk, also passing the parent of the visited section
+// to `fn`. The parent of `s` is its actual parent, nil for a root section.
+func (s *Section) WalkWithParent(order WalkOrder, fn func(sec, parent *Section) error) error {
+	return s.walk(order, func(sec, parent *Section, _ int) error { return fn(sec, parent) })
+}
+
+// WalkWithDepth is like Walk, also passing the depth of the visited section
+// relative to `s` to `fn`: 0 for `s`, 1 for its sub-sections, and so on.
+func (s *Section) WalkWithDepth(order WalkOrder, fn func(sec *Section, depth int) error) error {
+	return s.walk(order, func(sec, _ *Section, depth int) error { return fn(sec, depth) })
+}
+
+// walk implements Walk and its variants.
+func (s *Section) walk(order WalkOrder, fn func(sec, parent *Section, depth int) error) error {
+	err := walk(s, s.parent, 0, order, fn)
+	if err == StopWalk {
+		return nil
+	}
+	return err
+}
+
+func walk(s, parent *Section, depth int, order WalkOrder, fn func(sec, parent *Section, depth int) error) error {
+	if order == PreOrder {
+		if err := fn(s, parent, depth); err == SkipSubSections {
+			return nil
+		} else if err != nil {
+			return err
+		}
+	}
+	// visit a copy, so that `fn` can change the sub-sections of the sections
+	// it visits
+	for _, sec := range append([]*Section(nil), s.Sections...) {
+		if err := walk(sec, s, depth+1, order, fn); err != nil {
+			return err
+		}
+	}
+	if order == PostOrder {
+		if err := fn(s, parent, depth); err != SkipSubSections {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,102 @@
+package fmap
+
+import (
+	"errors"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+const walkLayout = `FLASH 0x4000 {
+	A 0x2000 {
+		A1 0x1000
+		A2 0x1000
+	}
+	B 0x2000 {
+		B1 0x1000
+	}
+}`
+
+func TestWalk(t *testing.T) {
+	f, err := ParseString(walkLayout)
+	require.NoError(t, err)
+	var names []string
+	visit := func(sec *Section) error {
+		names = append(names, sec.Name)
+		return nil
+	}
+	require.NoError(t, f.Walk(PreOrder, visit))
+	assert.Equal(t, []string{"FLASH", "A", "A1", "A2", "B", "B1"}, names)
+	names = nil
+	require.NoError(t, f.Walk(PostOrder, visit))
+	assert.Equal(t, []string{"A1", "A2", "A", "B1", "B", "FLASH"}, names)
+}
+
+func TestWalkSkipAndStop(t *testing.T) {
+	f, err := ParseString(walkLayout)
+	require.NoError(t, err)
+	var names []string
+	require.NoError(t, f.Walk(PreOrder, func(sec *Section) error {
+		names = append(names, sec.Name)
+		if sec.Name == "A" {
+			return SkipSubSections
+		}
+		return nil
+	}))
+	assert.Equal(t, []string{"FLASH", "A", "B", "B1"}, names)
+
+	names = nil
+	require.NoError(t, f.Walk(PostOrder, func(sec *Section) error {
+		names = append(names, sec.Name)
+		if sec.Name == "A" {
+			return StopWalk
+		}
+		return nil
+	}))
+	assert.Equal(t, []string{"A1", "A2", "A"}, names)
+
+	boom := errors.New("boom")
+	assert.Equal(t, boom, f.Walk(PreOrder, func(sec *Section) error {
+		if sec.Name == "A2" {
+			return boom
+		}
+		return nil
+	}))
+}
+
+func TestWalkWithParentAndDepth(t *testing.T) {
+	f, err := ParseString(walkLayout)
+	require.NoError(t, err)
+	var visits []string
+	a := f.Find("A", false)
+	require.NoError(t, a.WalkWithParent(PreOrder, func(sec, parent *Section) error {
+		visits = append(visits, parent.Name+">"+sec.Name)
+		return nil
+	}))
+	assert.Equal(t, []string{"FLASH>A", "A>A1", "A>A2"}, visits)
+
+	visits = nil
+	require.NoError(t, f.WalkWithDepth(PreOrder, func(sec *Section, depth int) error {
+		visits = append(visits, strings.Repeat(" ", depth)+sec.Name)
+		return nil
+	}))
+	assert.Equal(t, []string{"FLASH", " A", "  A1", "  A2", " B", "  B1"}, visits)
+}
+
+func TestWalkModify(t *testing.T) {
+	f, err := ParseString(walkLayout)
+	require.NoError(t, err)
+	// remove the sub-sections of A while visiting them
+	var names []string
+	require.NoError(t, f.WalkWithParent(PreOrder, func(sec, parent *Section) error {
+		names = append(names, sec.Name)
+		if parent != nil && parent.Name == "A" {
+			assert.True(t, parent.Remove(sec.Name, false))
+		}
+		return nil
+	}))
+	assert.Equal(t, []string{"FLASH", "A", "A1", "A2", "B", "B1"}, names)
+	assert.Empty(t, f.Find("A", false).Sections)
+}
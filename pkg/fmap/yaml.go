@@ -0,0 +1,97 @@
+package fmap
+
+import (
+	"errors"
+	"io"
+	"io/ioutil"
+
+	"gopkg.in/yaml.v2"
+)
+
+// yamlSection is the YAML representation of a Section. It has the keys of the
+// JSON representation, see MarshalJSON, without the annotation, and the empty
+// ones are omitted so that layouts stay short enough to be reviewed.
+type yamlSection struct {
+	Name       string          `yaml:"name"`
+	Start      *int64          `yaml:"start,omitempty"`
+	Size       int64           `yaml:"size"`
+	Unit       string          `yaml:"unit,omitempty"`
+	Flags      []Flag          `yaml:"flags,omitempty"`
+	Attributes []yamlAttribute `yaml:"attributes,omitempty"`
+	Children   []*yamlSection  `yaml:"children,omitempty"`
+}
+
+// yamlAttribute is the YAML representation of an Attribute.
+type yamlAttribute struct {
+	Key   string `yaml:"key"`
+	Value string `yaml:"value"`
+}
+
+func toYAMLSection(s *Section) *yamlSection {
+	ys := &yamlSection{
+		Name:  s.Name,
+		Start: s.Start,
+		Size:  size(s),
+		Unit:  s.Unit,
+		Flags: s.Flags,
+	}
+	for _, a := range s.Attributes {
+		ys.Attributes = append(ys.Attributes, yamlAttribute{Key: a.Key, Value: a.Value})
+	}
+	for _, sec := range s.Sections {
+		ys.Children = append(ys.Children, toYAMLSection(sec))
+	}
+	return ys
+}
+
+func fromYAMLSection(ys *yamlSection) *Section {
+	s := &Section{
+		Name:  ys.Name,
+		Start: ys.Start,
+		Size:  ys.Size,
+	}
+	for _, fl := range ys.Flags {
+		s.AddFlag(fl)
+	}
+	for _, a := range ys.Attributes {
+		s.SetAttribute(a.Key, a.Value)
+	}
+	if mult := unitSize(ys.Unit); mult > 1 && ys.Size%mult == 0 {
+		s.Size = ys.Size / mult
+		s.Unit = ys.Unit
+	}
+	for _, child := range ys.Children {
+		s.Sections = append(s.Sections, fromYAMLSection(child))
+	}
+	return s
+}
+
+// ToYAML returns the flashmap as a YAML document, to be kept alongside board
+// configurations written in YAML. Like in JSON, sizes are in bytes with the
+// unit they were written with reported separately, and starts are relative to
+// the parent section and omitted if implicit. Flags, attributes, units and
+// sub-sections are omitted when empty.
+func (s *Section) ToYAML() ([]byte, error) {
+	return yaml.Marshal(toYAMLSection(s))
+}
+
+// FromYAML reads a flashmap written by ToYAML. Unknown keys are an error, so
+// that typos in hand-written layouts are not silently ignored. Numbers can be
+// written in hexadecimal, e.g. 0x1000. If the size in bytes is not a multiple
+// of the unit, the unit is dropped.
+func FromYAML(r io.Reader) (*Section, error) {
+	data, err := ioutil.ReadAll(r)
+	if err != nil {
+		return nil, err
+	}
+	var ys yamlSection
+	if err := yaml.UnmarshalStrict(data, &ys); err != nil {
+		return nil, err
+	}
+	if ys.Name == "" {
+		return nil, errors.New("the root section has no name")
+	}
+	s := fromYAMLSection(&ys)
+	link(s)
+	return s, nil
+}
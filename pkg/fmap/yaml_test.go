@@ -0,0 +1,70 @@
+package fmap
+
+import (
+	"os"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestToYAML(t *testing.T) {
+	f, err := Parse(strings.NewReader(`FLASH@0xff000000 16M {
+	SI_DESC 4k
+	COREBOOT(CBFS)[alias=BOOT_STUB]@0x1000 0xfff000
+}`))
+	require.NoError(t, err)
+	data, err := f.ToYAML()
+	require.NoError(t, err)
+	assert.Equal(t, `name: FLASH
+start: 4278190080
+size: 16777216
+unit: M
+children:
+- name: SI_DESC
+  size: 4096
+  unit: k
+- name: COREBOOT
+  start: 4096
+  size: 16773120
+  flags:
+  - CBFS
+  attributes:
+  - key: alias
+    value: BOOT_STUB
+`, string(data))
+}
+
+func TestFromYAML(t *testing.T) {
+	fd, err := os.Open("test_data/chromeos.fmd")
+	require.NoError(t, err)
+	defer fd.Close()
+	f, err := Parse(fd)
+	require.NoError(t, err)
+
+	data, err := f.ToYAML()
+	require.NoError(t, err)
+	f2, err := FromYAML(strings.NewReader(string(data)))
+	require.NoError(t, err)
+	assert.Equal(t, f.ToFlashmap(), f2.ToFlashmap())
+	assert.Equal(t, f2, f2.Sections[0].Parent())
+}
+
+func TestFromYAMLHandWritten(t *testing.T) {
+	f, err := FromYAML(strings.NewReader(`name: FLASH
+size: 0x2000
+children:
+  - name: A
+    size: 0x1000
+    unit: k
+  - {name: B, start: 0x1000, size: 0x1000, flags: [PRESERVE]}
+`))
+	require.NoError(t, err)
+	assert.Equal(t, "FLASH 0x2000 {\n\tA 4k\n\tB(PRESERVE)@0x1000 0x1000\n}\n", f.ToFlashmap())
+
+	_, err = FromYAML(strings.NewReader("name: FLASH\nsize: 0x2000\nsise: 1\n"))
+	assert.Error(t, err)
+	_, err = FromYAML(strings.NewReader("size: 0x2000\n"))
+	assert.EqualError(t, err, "the root section has no name")
+}
@@ -0,0 +1,26 @@
+package fmap
+
+// IsMarker returns true if the section has a size of zero. Zero-size sections
+// are markers of an offset in the flash, e.g. the position of a descriptor
+// that other tools look up by name: they are valid leaves, which overlap with
+// no other section and cover nothing, so they are excluded from CheckCoverage,
+// and they are not moved by Defrag. In binary FMAPs, a marker is placed in the
+// innermost section whose range contains its offset, see FromBinary.
+func (s *Section) IsMarker() bool {
+	return size(s) == 0
+}
+
+// ZeroSizePolicy is how ValidateWith reports zero-size sections, see
+// IsMarker.
+type ZeroSizePolicy int
+
+// Zero-size section policies. Markers with sub-sections are always errors.
+const (
+	// ZeroSizeAllow accepts zero-size sections as markers.
+	ZeroSizeAllow ZeroSizePolicy = iota
+	// ZeroSizeWarn reports zero-size sections as warnings.
+	ZeroSizeWarn
+	// ZeroSizeError reports zero-size sections as errors, for layouts
+	// consumed by tools that don't support them.
+	ZeroSizeError
+)
@@ -0,0 +1,106 @@
+package fmap
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+const markerLayout = `FLASH 0x4000 {
+	A 0x1000
+	MARK 0
+	B 0x1000
+	END_MARK@0x4000 0
+}`
+
+func TestZeroSizeValidate(t *testing.T) {
+	f, err := Parse(strings.NewReader(markerLayout))
+	require.NoError(t, err)
+	assert.True(t, f.Find("MARK", false).IsMarker())
+	assert.False(t, f.Find("A", false).IsMarker())
+	assert.Equal(t, int64(0x1000), f.Find("B", false).AbsoluteStart()-f.AbsoluteStart())
+	assert.Empty(t, f.Validate())
+
+	warnings := f.ValidateWith(ValidateOptions{ZeroSize: ZeroSizeWarn})
+	require.Equal(t, 2, len(warnings))
+	assert.Equal(t, SeverityWarning, warnings[0].Severity)
+	assert.Equal(t, "FLASH/MARK", warnings[0].Path)
+	assert.Equal(t, "zero-size section", warnings[0].Message)
+	errs := f.ValidateWith(ValidateOptions{ZeroSize: ZeroSizeError})
+	require.Equal(t, 2, len(errs))
+	assert.Equal(t, SeverityError, errs[1].Severity)
+	assert.Equal(t, "FLASH/END_MARK", errs[1].Path)
+
+	// markers inside another section don't overlap with it, but can't have
+	// sub-sections or be past the end of their parent
+	f, err = Parse(strings.NewReader(`FLASH 0x2000 {
+	A 0x2000
+	IN_A@0x1000 0 {
+		X 0
+	}
+	PAST@0x2001 0
+}`))
+	require.NoError(t, err)
+	var msgs []string
+	for _, v := range f.Validate() {
+		msgs = append(msgs, v.Path+": "+v.Message)
+	}
+	assert.Equal(t, []string{
+		"FLASH/PAST: ends at 0x2001, past the end of FLASH (size 0x2000)",
+		"FLASH/IN_A: zero-size section has sub-sections",
+	}, msgs)
+}
+
+func TestZeroSizeCoverage(t *testing.T) {
+	f, err := Parse(strings.NewReader(`FLASH 0x2000 {
+	A 0x1000
+	B 0x1000
+	MARK@0x800 0
+}`))
+	require.NoError(t, err)
+	assert.NoError(t, f.CheckCoverage())
+	assert.Equal(t, int64(0), f.FreeSpace())
+}
+
+func TestZeroSizeSerialize(t *testing.T) {
+	f, err := Parse(strings.NewReader(markerLayout))
+	require.NoError(t, err)
+	text := f.ToFlashmap()
+	assert.Contains(t, text, "\tMARK 0x0\n")
+	again, err := Parse(strings.NewReader(text))
+	require.NoError(t, err)
+	assert.Equal(t, text, again.ToFlashmap())
+
+	bin, err := f.ToBinary()
+	require.NoError(t, err)
+	decoded, err := FromBinary(bin)
+	require.NoError(t, err)
+	// markers are leaves of the innermost section containing their offset
+	assert.Equal(t, `FLASH@0x0 0x4000 {
+	A@0x0 0x1000
+	B@0x1000 0x1000 {
+		MARK@0x0 0x0
+	}
+	END_MARK@0x4000 0x0
+}
+`, decoded.ToFlashmap())
+}
+
+func TestZeroSizeDefrag(t *testing.T) {
+	for _, strategy := range []DefragStrategy{DefragCompact, DefragMinimizeMoves} {
+		f, err := Parse(strings.NewReader(`FLASH 0x4000 {
+	A 0x1000
+	MARK@0x1800 0
+	B@0x2000 0x1000
+}`))
+		require.NoError(t, err)
+		moves := f.DefragWith(strategy, false)
+		for _, m := range moves {
+			assert.NotEqual(t, "MARK", m.Section.Name, strategy.String())
+		}
+		assert.Equal(t, int64(0x1800), *f.Find("MARK", false).Start, strategy.String())
+		assert.Empty(t, f.Validate(), strategy.String())
+	}
+}